@@ -2,12 +2,13 @@
 package analyser
 
 import (
-	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/alecthomas/participle"
 	"github.com/alecthomas/participle/lexer"
 
+	"github.com/alecthomas/langx/constant"
 	"github.com/alecthomas/langx/parser"
 	"github.com/alecthomas/langx/types"
 )
@@ -16,31 +17,53 @@ var (
 	builtins = &Scope{
 		symbols: map[string]types.Reference{
 			"string": types.String,
+			"char":   types.Char,
 			"bool":   types.Bool,
 			"int":    types.Int,
 			"float":  types.Float,
+			"void":   types.None,
+			// Prelude.
+			"Comparable": types.Comparable,
+			"Equatable":  types.Equatable,
 		},
 	}
 )
 
 type funcAndScope struct {
-	fn    *parser.Block
-	scope *Scope
+	fn         *parser.Block
+	scope      *Scope
+	deprecated bool
 }
 
 type analyser struct {
 	p     *Program
 	funcs []funcAndScope
+	// Deprecated symbols and their deprecation messages.
+	deprecated map[types.Reference]string
+	// True while checking deprecated code, where deprecation warnings are suppressed.
+	inDeprecated bool
+	warned       map[lexer.Position]bool
+	// Values of constants whose defaults are constant expressions.
+	constants map[*types.Value]*parser.Literal
+	// Nesting depth of generic constraints being resolved, and checks of type
+	// arguments against constraints deferred until they are.
+	constraintDepth     int
+	deferredConstraints []func() error
 }
 
 func (a *analyser) deferFunc(fn *parser.Block, scope *Scope) {
-	a.funcs = append(a.funcs, funcAndScope{fn, scope})
+	a.funcs = append(a.funcs, funcAndScope{fn, scope, a.inDeprecated})
 }
 
 func (a *analyser) checkRoot(scope *Scope, ast *parser.AST) error {
 	// TODO: Accumulate function bodies across all classes/enums and globals,
 	//  and do them all in one pass.
 	for _, decl := range ast.Declarations {
+		deprecated, message, err := a.checkAnnotations(decl.Annotations)
+		if err != nil {
+			return err
+		}
+		a.inDeprecated = deprecated
 		switch {
 		case decl.Var != nil:
 			if err := a.checkVarDecl(scope, decl.Var); err != nil {
@@ -64,19 +87,31 @@ func (a *analyser) checkRoot(scope *Scope, ast *parser.AST) error {
 				return err
 			}
 
+		case decl.Import != nil:
+			// Imports are resolved by the loader.
+
+		case decl.Cond != nil:
+			return participle.Errorf(decl.Cond.Pos, "compile-time conditionals must be applied before analysis")
+
 		default:
 			panic("not implemented")
 		}
+		if deprecated {
+			a.deprecate(scope, decl, message)
+		}
 	}
+	a.inDeprecated = false
 	return a.checkFuncScopes()
 }
 
 func (a *analyser) checkFuncScopes() error {
 	for _, fn := range a.funcs {
+		a.inDeprecated = fn.deprecated
 		if err := a.checkBlock(fn.scope, fn.fn); err != nil {
 			return err
 		}
 	}
+	a.inDeprecated = false
 	return nil
 }
 
@@ -98,9 +133,7 @@ func (a *analyser) checkEnumDecl(scope *Scope, enum *parser.EnumDecl) error {
 	}
 
 	// Add generics to the enum scope.
-	t := enum.Type
-	enumt.TParams, err = a.declGenericParameters(enumScope, t)
-	if err != nil {
+	if err := a.declGenericParameters(enumScope, enum.Type, &enumt.TParams); err != nil {
 		return err
 	}
 
@@ -124,28 +157,57 @@ func (a *analyser) checkEnumDecl(scope *Scope, enum *parser.EnumDecl) error {
 			panic("??")
 		}
 	}
+	if err := a.checkRawValues(enumScope, enumt, enum); err != nil {
+		return err
+	}
 	enumt.Flds = a.scopeToTypeFields(enumScope)
 	return nil
 }
 
-func (a *analyser) declGenericParameters(scope *Scope, t *parser.NamedTypeDecl) ([]types.NamedType, error) {
-	var flds []types.NamedType
+// Declare the generic parameters of a type in scope, appending them to params.
+//
+// Constraints are resolved once all parameters are declared and params is
+// populated, so that they may refer to any of the parameters and to the type
+// being declared, eg. "class Node<T: Comparable<T>, N: Node<T, N>>".
+func (a *analyser) declGenericParameters(scope *Scope, t *parser.NamedTypeDecl, params *[]types.NamedType) error {
+	tparams := []*types.TypeParam{}
 	for _, gp := range t.TypeParameter {
-		if len(gp.Constraints) > 0 {
-			return nil, participle.Errorf(t.Pos, "generic constraints are not supported yet")
+		tparam := &types.TypeParam{Name: gp.Name}
+		if err := scope.AddType(gp.Name, tparam); err != nil {
+			return participle.AnnotateError(gp.Pos, err)
 		}
-		flds = append(flds, types.NamedType{
-			Nme: gp.Name,
-		})
-		a.p.associate(t, types.Any)
-		err := scope.AddType(gp.Name, types.Any)
-		if err != nil {
-			return nil, participle.AnnotateError(t.Pos, err)
+		a.p.associate(gp, tparam)
+		*params = append(*params, types.NamedType{Nme: gp.Name, Typ: tparam})
+		tparams = append(tparams, tparam)
+	}
+	// Constraints may specialise types whose parameters are still being
+	// resolved, so checks against constraints are deferred until they are.
+	a.constraintDepth++
+	for i, gp := range t.TypeParameter {
+		for _, constraint := range gp.Constraints {
+			typ, err := a.resolveTypeReference(scope, constraint)
+			if err != nil {
+				a.constraintDepth--
+				return err
+			}
+			tparams[i].Constraints = append(tparams[i].Constraints, typ)
 		}
 	}
-	return flds, nil
+	a.constraintDepth--
+	if a.constraintDepth > 0 {
+		return nil
+	}
+	deferred := a.deferredConstraints
+	a.deferredConstraints = nil
+	for _, check := range deferred {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// Convert the symbols in a scope to fields, sorted by name so that output is stable.
 func (a *analyser) scopeToTypeFields(scope *Scope) []types.NamedType {
 	symbols := scope.Symbols()
 	var out []types.NamedType
@@ -155,6 +217,7 @@ func (a *analyser) scopeToTypeFields(scope *Scope) []types.NamedType {
 			Typ: sym.Type(),
 		})
 	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Nme < out[j].Nme })
 	return out
 }
 
@@ -170,10 +233,82 @@ func (a *analyser) resolveCaseDecl(scope *Scope, enum *types.Enum, decl *parser.
 		}
 		ctype.Case = typ
 	}
+	seen := map[string]bool{}
+	for _, field := range decl.Fields {
+		if seen[field.Name] {
+			return participle.Errorf(field.Pos, "duplicate associated value %q", field.Name)
+		}
+		seen[field.Name] = true
+		typ, err := a.resolveType(scope, field.Type)
+		if err != nil {
+			return err
+		}
+		ctype.Values = append(ctype.Values, types.NamedType{Nme: field.Name, Typ: typ})
+	}
 	err := scope.AddType(decl.Name, ctype)
 	if err != nil {
 		return participle.Errorf(decl.Pos, "%s", err)
 	}
+	a.p.associate(decl, ctype)
+	return nil
+}
+
+// Check the raw values of the cases of an enum, which must be distinct constants
+// of the same type, and declare "rawValue" if there are any.
+func (a *analyser) checkRawValues(scope *Scope, enumt *types.Enum, enum *parser.EnumDecl) error {
+	var first *parser.CaseDecl
+	seen := map[string]string{}
+	for _, member := range enum.Members {
+		decl := member.CaseDecl
+		if decl == nil {
+			continue
+		}
+		if first == nil {
+			first = decl
+		}
+		if (decl.Value == nil) != (first.Value == nil) {
+			return participle.Errorf(decl.Pos, "either all or none of the cases of %s must have raw values", enum.Type.Type)
+		}
+		if decl.Value == nil {
+			continue
+		}
+		if decl.Type != nil || decl.Fields != nil {
+			return participle.Errorf(decl.Pos, "case %q can't have both associated values and a raw value", decl.Name)
+		}
+		value, err := a.resolveExprValue(scope, decl.Value)
+		if err != nil {
+			return participle.Wrapf(decl.Value.Pos, err, "invalid raw value for %q", decl.Name)
+		}
+		ref, err := types.Concrete(value.Type())
+		if err != nil {
+			return participle.Wrapf(decl.Value.Pos, err, "invalid raw value for %q", decl.Name)
+		}
+		typ := ref.(types.Type)
+		if enumt.Raw == nil {
+			enumt.Raw = typ
+		} else if types.Coerce(typ, enumt.Raw) == nil {
+			return participle.Errorf(decl.Value.Pos, "raw value of %q must be %s, not %s", decl.Name, enumt.Raw, typ)
+		}
+		raw, err := a.evalConstant(decl.Value)
+		if err != nil {
+			return err
+		}
+		if raw == nil {
+			return participle.Errorf(decl.Value.Pos, "raw value of %q must be a constant expression", decl.Name)
+		}
+		a.p.constants[decl.Value] = raw
+		key := constant.String(raw)
+		if other, ok := seen[key]; ok {
+			return participle.Errorf(decl.Value.Pos, "duplicate raw value %s of %q, already used by %q", key, decl.Name, other)
+		}
+		seen[key] = decl.Name
+	}
+	if enumt.Raw == nil {
+		return nil
+	}
+	if err := scope.AddValue("rawValue", types.Let(enumt.Raw)); err != nil {
+		return participle.Errorf(enum.Pos, "%s", err)
+	}
 	return nil
 }
 
@@ -184,6 +319,7 @@ func (a *analyser) resolveType(scope *Scope, cse *parser.TypeDecl) (types.Type,
 		if typ == nil {
 			return nil, participle.Errorf(cse.Pos, "unknown type %q", cse)
 		}
+		a.checkDeprecated(cse.Pos, cse.Named.Type, typ)
 		return typ, nil
 
 	case cse.Array != nil:
@@ -227,8 +363,7 @@ func (a *analyser) checkClassDecl(scope *Scope, class *parser.ClassDecl) error {
 	if err != nil {
 		return participle.AnnotateError(class.Pos, err)
 	}
-	clst.TParams, err = a.declGenericParameters(classScope, class.Type)
-	if err != nil {
+	if err := a.declGenericParameters(classScope, class.Type, &clst.TParams); err != nil {
 		return err
 	}
 
@@ -315,6 +450,7 @@ func (a *analyser) checkFuncDecl(scope *Scope, fn *parser.FuncDecl) (*Scope, err
 	if err != nil {
 		return nil, err
 	}
+	a.p.associate(fn, fnt)
 
 	// Create scope and add parameters to it.
 	funcScope := scope.Sub(fnt)
@@ -334,7 +470,9 @@ func (a *analyser) addParametersToScope(scope *Scope, parameters []*parser.Param
 		if err != nil {
 			return err
 		}
-		err = a.declVars(param.Pos, scope, types.Let(typ), param.Names...)
+		value := types.Let(typ)
+		a.p.associate(param, value)
+		err = a.declVars(param.Pos, scope, value, param.Names...)
 		if err != nil {
 			return err
 		}
@@ -376,9 +514,14 @@ func (a *analyser) checkStatement(scope *Scope, stmt *parser.Stmt) error {
 		if f == nil {
 			return participle.Errorf(stmt.Return.Pos, "can't return from outside a function")
 		}
-		val, err := a.resolveExprValue(scope, stmt.Return.Value)
-		if err != nil {
-			return err
+		// A bare return yields none.
+		val := types.Let(types.None)
+		if stmt.Return.Value != nil {
+			var err error
+			val, err = a.resolveExprValue(scope, stmt.Return.Value)
+			if err != nil {
+				return err
+			}
 		}
 		if types.Coerce(val.Type(), f.ReturnType) == nil {
 			return participle.Errorf(stmt.Return.Pos, "cannot return %s as %s", val.Kind(), f.ReturnType.Kind())
@@ -397,13 +540,18 @@ func (a *analyser) checkStatement(scope *Scope, stmt *parser.Stmt) error {
 
 	case stmt.If != nil:
 		stmt := stmt.If
-		if err := a.checkBoolExpr(scope, stmt.Condition); err != nil {
+		mainScope := scope.Sub(nil)
+		if stmt.Binding != "" {
+			if err := a.checkOptionalBinding(scope, mainScope, stmt); err != nil {
+				return err
+			}
+		} else if err := a.checkBoolExpr(scope, stmt.Condition); err != nil {
 			return err
 		}
-		if err := a.checkBlock(scope.Sub(nil), stmt.Main); err != nil {
+		if err := a.checkBlock(mainScope, stmt.Main); err != nil {
 			return err
 		}
-		return a.checkBlock(scope.Sub(nil), stmt.Else)
+		return a.checkStatements(scope.Sub(nil), stmt.ElseStatements())
 
 	case stmt.Switch != nil:
 		return a.checkSwitch(scope, stmt.Switch)
@@ -416,6 +564,10 @@ func (a *analyser) checkStatement(scope *Scope, stmt *parser.Stmt) error {
 
 	case stmt.For != nil:
 		return a.checkForStmt(scope, stmt.For)
+
+	case stmt.Break != nil, stmt.Continue != nil:
+		// Targets are checked by checkLabels.
+		return nil
 	}
 	panic("unsupported statement at " + stmt.Pos.String())
 }
@@ -472,6 +624,7 @@ func (a *analyser) checkSwitchOnEnum(scope *Scope, enum *types.Enum, stmt *parse
 		for cse := range seen {
 			caseStrings = append(caseStrings, cse)
 		}
+		sort.Strings(caseStrings)
 		return participle.Errorf(stmt.Pos, "cases not matched: %s", strings.Join(caseStrings, ", "))
 	}
 	return nil
@@ -489,6 +642,23 @@ func (a *analyser) checkPatternMatch(scope *Scope, enum *types.Enum, pattern *pa
 	if selected == nil {
 		return "", participle.Errorf(pattern.Pos, "invalid enum case %q", pattern.Case)
 	}
+	if selected.Values != nil {
+		// Case has named associated values, bound in order.
+		vars := append([]string{pattern.Var}, pattern.Rest...)
+		if pattern.Var == "" || len(vars) != len(selected.Values) {
+			return "", participle.Errorf(pattern.Pos, "enum case %q requires %d variables", selected.Name, len(selected.Values))
+		}
+		for i, field := range selected.Values {
+			if vars[i] == "_" {
+				continue
+			}
+			if err := scope.AddValue(vars[i], &types.Value{Typ: field.Typ}); err != nil {
+				return "", participle.AnnotateError(pattern.Pos, err)
+			}
+		}
+		return selected.Name, nil
+	}
+
 	if selected.Case == nil {
 		if pattern.Var != "" {
 			return "", participle.Errorf(pattern.Pos, "case %q does not have a type to apply", selected.Name)
@@ -499,6 +669,13 @@ func (a *analyser) checkPatternMatch(scope *Scope, enum *types.Enum, pattern *pa
 	if pattern.Var == "" {
 		return "", participle.Errorf(pattern.Pos, "typed enum case %q requires a variable", selected.Name)
 	}
+	if len(pattern.Rest) > 0 {
+		return "", participle.Errorf(pattern.Pos, "enum case %q has a single associated value", selected.Name)
+	}
+
+	if pattern.Var == "_" {
+		return selected.Name, nil
+	}
 
 	// Case has an associated type.
 	err := scope.AddValue(pattern.Var, &types.Value{Typ: selected.Case})
@@ -555,6 +732,23 @@ func (a *analyser) checkBoolExpr(scope *Scope, cond *parser.Expr) error {
 	return nil
 }
 
+// Check the condition of an "if let", binding its unwrapped value in the scope
+// of the main block.
+func (a *analyser) checkOptionalBinding(scope, mainScope *Scope, stmt *parser.IfStmt) error {
+	value, err := a.resolveExprValue(scope, stmt.Condition)
+	if err != nil {
+		return err
+	}
+	optional, ok := value.Type().(*types.OptionalType)
+	if !ok {
+		return participle.Errorf(stmt.Condition.Pos, "if let requires an optional value but got %s", value.Type())
+	}
+	if err := mainScope.AddValue(stmt.Binding, types.Let(optional.TParams[1].Typ)); err != nil {
+		return participle.AnnotateError(stmt.Pos, err)
+	}
+	return nil
+}
+
 func (a *analyser) checkBlock(scope *Scope, block *parser.Block) error {
 	if block == nil {
 		return nil
@@ -576,8 +770,17 @@ func (a *analyser) checkVarDecl(scope *Scope, varDecl *parser.VarDecl) error {
 	var untyped []*parser.VarDeclAsgn // Collect any vars that don't end up with types associated.
 	var last *parser.VarDeclAsgn
 	for _, decl := range varDecl.Vars {
+		if decl.Pattern != nil {
+			if err := a.checkPatternDecl(scope, varDecl, decl); err != nil {
+				return err
+			}
+			continue
+		}
 		last = decl
 		untyped = append(untyped, decl)
+		if varDecl.Const && decl.Default == nil {
+			return participle.Errorf(decl.Pos, "constant %q must have a value", decl.Name)
+		}
 		if decl.Type == nil && decl.Default == nil {
 			continue
 		}
@@ -585,6 +788,7 @@ func (a *analyser) checkVarDecl(scope *Scope, varDecl *parser.VarDecl) error {
 		var (
 			typ     types.Type
 			dfltTyp types.Type
+			literal *parser.Literal
 			err     error
 		)
 
@@ -593,11 +797,23 @@ func (a *analyser) checkVarDecl(scope *Scope, varDecl *parser.VarDecl) error {
 			if err != nil {
 				return participle.Wrapf(decl.Default.Pos, err, "invalid initial value for %q", decl.Name)
 			}
-			ref, err := types.Concrete(dfltValue.Type())
+			if dfltValue.Kind() == types.KindNone && decl.Type != nil {
+				// nil has no concrete type of its own, it can only be coerced to the declared type.
+				dfltTyp = dfltValue.Type()
+			} else {
+				ref, err := types.Concrete(dfltValue.Type())
+				if err != nil {
+					return participle.Wrapf(decl.Default.Pos, err, "invalid initial value for %q", decl.Name)
+				}
+				dfltTyp = ref.(types.Type)
+			}
+			literal, err = a.evalConstant(decl.Default)
 			if err != nil {
-				return participle.Wrapf(decl.Default.Pos, err, "invalid initial value for %q", decl.Name)
+				return err
+			}
+			if literal != nil {
+				a.p.constants[decl.Default] = literal
 			}
-			dfltTyp = ref.(types.Type)
 		}
 		if decl.Type == nil {
 			if dfltTyp == nil {
@@ -619,6 +835,12 @@ func (a *analyser) checkVarDecl(scope *Scope, varDecl *parser.VarDecl) error {
 			}
 		}
 		value := types.Var(typ)
+		if varDecl.Const {
+			value = types.Let(typ)
+			if literal != nil {
+				a.constants[value] = literal
+			}
+		}
 		for _, sym := range untyped {
 			a.p.associate(sym, value)
 		}
@@ -638,6 +860,77 @@ func (a *analyser) checkVarDecl(scope *Scope, varDecl *parser.VarDecl) error {
 	return nil
 }
 
+// Check a destructuring declaration, binding each name in its pattern.
+func (a *analyser) checkPatternDecl(scope *Scope, varDecl *parser.VarDecl, decl *parser.VarDeclAsgn) error {
+	pattern := decl.Pattern
+	if decl.Type != nil {
+		return participle.Errorf(decl.Type.Pos, "destructuring declarations can't have a type")
+	}
+	if decl.Default == nil {
+		return participle.Errorf(decl.Pos, "destructuring declaration must have a value")
+	}
+	value, err := a.resolveExprValue(scope, decl.Default)
+	if err != nil {
+		return participle.Wrapf(decl.Default.Pos, err, "invalid value for destructuring declaration")
+	}
+	ref, err := types.Concrete(value.Type())
+	if err != nil {
+		return participle.Wrapf(decl.Default.Pos, err, "invalid value for destructuring declaration")
+	}
+	typ := ref.(types.Type)
+	bind := types.Var
+	if varDecl.Const {
+		bind = types.Let
+	}
+	switch {
+	case pattern.Array != nil:
+		array, ok := typ.(types.ArrayType)
+		if !ok {
+			return participle.Errorf(pattern.Pos, "can't destructure %s as an array", typ)
+		}
+		element := array.Constraints[0].Typ
+		for i, el := range pattern.Array.Elements {
+			elType := element
+			if el.Rest {
+				if i != len(pattern.Array.Elements)-1 {
+					return participle.Errorf(el.Pos, "...%s must be the last element", el.Name)
+				}
+				elType = types.Array(element)
+			}
+			if err := a.declVars(el.Pos, scope, bind(elType), el.Name); err != nil {
+				return err
+			}
+		}
+
+	case pattern.Dict != nil:
+		for _, key := range pattern.Dict.Keys {
+			var fieldType types.Type
+			switch typ := typ.(type) {
+			case *types.MapType:
+				if typ.TParams[0].Typ.Kind() != types.KindString {
+					return participle.Errorf(pattern.Pos, "can't destructure %s, keys must be strings", typ)
+				}
+				// The key may not be present.
+				fieldType = types.Optional(typ.TParams[1].Typ)
+
+			case *types.ClassType:
+				field, ok := typ.FieldByName(key).(types.Type)
+				if !ok {
+					return participle.Errorf(pattern.Pos, "unknown field %s on %s", key, typ)
+				}
+				fieldType = field
+
+			default:
+				return participle.Errorf(pattern.Pos, "can't destructure %s as a dict or class", typ)
+			}
+			if err := a.declVars(pattern.Pos, scope, bind(fieldType), key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (a *analyser) resolveExprValue(scope *Scope, expr *parser.Expr) (*types.Value, error) {
 	ref, err := a.resolveExpr(scope, expr)
 	if err != nil {
@@ -654,6 +947,10 @@ func (a *analyser) resolveExprValue(scope *Scope, expr *parser.Expr) (*types.Val
 	case *types.Case:
 		return &types.Value{Typ: ref}, nil
 
+	case *types.Function:
+		// Named functions can be passed as values, eg. a comparison to sort().
+		return types.Let(ref), nil
+
 	case types.Field:
 		return ref.Value, nil
 
@@ -694,6 +991,10 @@ func (a *analyser) resolveExpr(scope *Scope, expr *parser.Expr) (ref types.Refer
 	if err != nil {
 		return nil, err
 	}
+	if expr.Chained {
+		// The comparison on the left has resolved the shared operand.
+		lhs = a.p.Resolved(expr.Operand())
+	}
 	if expr.Op == parser.OpBitOr {
 		if typ := a.resolveAnonymousEnum(lhs, rhs); typ != nil {
 			return typ, nil
@@ -708,7 +1009,8 @@ func (a *analyser) resolveExpr(scope *Scope, expr *parser.Expr) (ref types.Refer
 		parser.OpDivAsgn, parser.OpModAsgn:
 		return lhs, nil
 
-	case parser.OpLe, parser.OpLt, parser.OpGe, parser.OpGt, parser.OpEq, parser.OpNe:
+	case parser.OpLe, parser.OpLt, parser.OpGe, parser.OpGt, parser.OpEq, parser.OpNe,
+		parser.OpAnd, parser.OpOr:
 		ref := &types.Value{Typ: types.Bool}
 		return ref, nil
 	}
@@ -798,16 +1100,36 @@ func (a *analyser) resolveTerminal(scope *Scope, terminal *parser.Terminal) (ref
 		if err != nil {
 			return nil, err
 		}
-		if len(terminal.New.Init) != 0 {
-			return nil, participle.Errorf(terminal.Pos, "constructor calls are not supported yet")
+		call := terminal.New.Call
+		if call == nil {
+			call = &parser.Call{Mixin: terminal.New.Mixin}
 		}
-		return &types.Value{Typ: typ}, nil
+		var parameters []types.NamedType
+		switch typ := typ.(type) {
+		case *types.ClassType:
+			if typ.Init != nil {
+				parameters = typ.Init.Parameters
+			}
+
+		case *types.Enum:
+			if typ.Init != nil {
+				parameters = typ.Init.Parameters
+			}
+		}
+		return a.resolveCallActual(scope, typ, parameters, call)
+
+	case terminal.Do != nil:
+		return a.resolveDoExpr(scope.Sub(nil), terminal.Do)
+
+	case terminal.Func != nil:
+		return a.resolveFuncType(scope, terminal.Func)
 
 	case terminal.Ident != "":
 		ref := a.p.resolveConcrete(terminal, scope, terminal.Ident)
 		if ref == nil {
 			return nil, participle.Errorf(terminal.Pos, "unknown symbol %q", terminal.Ident)
 		}
+		a.checkDeprecated(terminal.Pos, terminal.Ident, ref)
 		return ref, nil
 
 	case terminal.Tuple != nil:
@@ -822,6 +1144,37 @@ func (a *analyser) resolveTerminal(scope *Scope, terminal *parser.Terminal) (ref
 	}
 }
 
+func (a *analyser) resolveDoExpr(scope *Scope, do *parser.DoExpr) (types.Reference, error) {
+	result := do.Result()
+	if result == nil {
+		return nil, participle.Errorf(do.Pos, "do block must end with an expression")
+	}
+	stmts := do.Body.Statements
+	if err := a.checkStatements(scope, stmts[:len(stmts)-1]); err != nil {
+		return nil, err
+	}
+	return a.resolveExprValue(scope, result)
+}
+
+func (a *analyser) resolveFuncType(scope *Scope, fn *parser.FuncType) (types.Type, error) {
+	out := &types.Function{ReturnType: types.None}
+	for _, param := range fn.Parameters {
+		typ, err := a.resolveTypeReference(scope, param)
+		if err != nil {
+			return nil, err
+		}
+		out.Parameters = append(out.Parameters, types.NamedType{Typ: typ})
+	}
+	if fn.Return != nil {
+		typ, err := a.resolveTypeReference(scope, fn.Return)
+		if err != nil {
+			return nil, err
+		}
+		out.ReturnType = typ
+	}
+	return out, nil
+}
+
 func (a *analyser) resolveReference(scope *Scope, reference *parser.Reference) (ref types.Reference, err error) {
 	defer a.autoAssoc(reference, &ref)
 	ref, err = a.resolveTerminal(scope, reference.Terminal)
@@ -848,10 +1201,21 @@ func (a *analyser) resolveReferenceNext(scope *Scope, ref types.Reference, next
 	}
 	switch {
 	case next.Reference != nil:
-		return a.resolveField(scope, ref, next.Reference)
+		field, err := a.resolveField(scope, ref, next.Reference)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkArrayMethod(ref, next); err != nil {
+			return nil, err
+		}
+		return a.resolveReferenceNext(scope, field, next.Next)
 
 	case next.Call != nil:
-		return a.resolveCallLike(scope, ref, next)
+		value, err := a.resolveCallLike(scope, ref, next)
+		if err != nil {
+			return nil, err
+		}
+		return a.resolveReferenceNext(scope, value, next.Next)
 
 	case next.Subscript != nil:
 		panic("subscript not supported: " + next.Subscript.Pos.String())
@@ -861,38 +1225,79 @@ func (a *analyser) resolveReferenceNext(scope *Scope, ref types.Reference, next
 		if !ok {
 			return nil, participle.Errorf(next.Pos, "type specialisation <> must be applied to a type, not %s", ref)
 		}
-		typeParams := typ.Fields()
-		if len(next.Specialisation) != len(typeParams) {
-			return nil, participle.Errorf(next.Pos, "need %d type parameters for %s but have %d", len(next.Specialisation), typ, len(typeParams))
+		typeParams := typ.TypeParameters()
+		if len(next.Specialisation.Types) != len(typeParams) {
+			return nil, participle.Errorf(next.Pos, "need %d type parameters for %s but have %d", len(typeParams), types.Describe(typ), len(next.Specialisation.Types))
 		}
 		params := []types.Type{}
-		for i, param := range next.Specialisation {
+		for i, param := range next.Specialisation.Types {
 			ptyp, err := a.resolveTypeReference(scope, param)
 			if err != nil {
 				return nil, participle.Wrapf(next.Pos, err, "type parameter %s", typeParams[i].Nme)
 			}
-			if typeParams[i].Typ != nil {
-				return nil, participle.Errorf(param.Pos, "type constraints are not supported")
-			}
 			params = append(params, ptyp)
 		}
-		return types.Specialise(typ, params...), nil
+		check := func() error { return checkConstraints(next.Specialisation.Types, typeParams, params) }
+		if a.constraintDepth > 0 {
+			a.deferredConstraints = append(a.deferredConstraints, check)
+		} else if err := check(); err != nil {
+			return nil, err
+		}
+		return a.resolveReferenceNext(scope, types.Specialise(typ, params...), next.Next)
 
 	default:
 		panic("??")
 	}
 }
 
+// Check that type arguments satisfy the constraints of their parameters.
+func checkConstraints(refs []*parser.Reference, params []types.NamedType, args []types.Type) error {
+	for i, param := range params {
+		tparam, ok := param.Typ.(*types.TypeParam)
+		if !ok {
+			continue
+		}
+		for _, constraint := range tparam.Constraints {
+			constraint = types.Substitute(constraint, params, args)
+			if !types.Satisfies(args[i], constraint) {
+				return participle.Errorf(refs[i].Pos, "%s does not satisfy constraint %s of type parameter %s",
+					types.Describe(args[i]), types.Describe(constraint), param.Nme)
+			}
+		}
+	}
+	return nil
+}
+
+// Check that the elements of an array satisfy the constraints of a method call on it.
+//
+// Only sort() without a comparison function is constrained.
+func checkArrayMethod(parent types.Reference, next *parser.ReferenceNext) error {
+	array, ok := parent.Type().(types.ArrayType)
+	if !ok || next.Reference.Ident != "sort" || next.Next == nil || next.Next.Call == nil || next.Next.Call.Arity() != 0 {
+		return nil
+	}
+	elem := array.Constraints[0].Typ
+	constraint := types.Specialise(types.Comparable, elem)
+	if !types.Satisfies(elem, constraint) {
+		return participle.Errorf(next.Reference.Pos, "sort() requires %s to satisfy %s, or a comparison function",
+			types.Describe(elem), types.Describe(constraint))
+	}
+	return nil
+}
+
 // Resolve something that looks like a function call (function, case, class initialiser).
 func (a *analyser) resolveCallLike(scope *Scope, ref types.Reference, ast *parser.ReferenceNext) (*types.Value, error) {
 	switch ref := ref.(type) {
 	case *types.Case: // Case(Type)
-		if ref.Case == nil {
+		parameters := ref.Values
+		if ref.Case != nil {
+			// Synthesise case parameters.
+			parameters = []types.NamedType{{Typ: ref.Case, Nme: ref.Name}}
+		}
+		if parameters == nil {
 			return nil, participle.Errorf(ast.Call.Pos, "untyped case should not be called")
 		}
-		// Synthesise case parameters.
-		parameters := []types.NamedType{{Typ: ref.Case, Nme: ref.Name}}
-		_, err := a.resolveCallActual(scope, ref.Case, parameters, ast.Call)
+		_, err := a.resolveCallActual(scope, ref, parameters, ast.Call)
 		if err != nil {
 			return nil, err
 		}
@@ -913,18 +1318,157 @@ func (a *analyser) resolveCallLike(scope *Scope, ref types.Reference, ast *parse
 		return a.resolveCallActual(scope, ref, parameters, ast.Call)
 
 	case *types.Function:
-		return a.resolveCallActual(scope, ref.ReturnType, ref.Parameters, ast.Call)
+		return a.resolveFunctionCall(scope, ref, ast.Call)
+
+	case *types.Value:
+		// Call through a function value, eg. let f = g; f(1).
+		if fn, ok := ref.Typ.(*types.Function); ok {
+			return a.resolveFunctionCall(scope, fn, ast.Call)
+		}
+		return nil, participle.Errorf(ast.Call.Pos, "can't call value of type %s", ref.Typ)
+
+	case types.NamedType:
+		// Member of a type, eg. Enum.Case(v).
+		return a.resolveCallLike(scope, ref.Typ, ast)
+
+	case types.Field:
+		// Method call, eg. a.compare(b).
+		switch fn := ref.Type().(type) {
+		case *types.Function:
+			return a.resolveFunctionCall(scope, fn, ast.Call)
+
+		case *types.Overloaded:
+			overload := fn.Overload(ast.Call.Arity())
+			if overload == nil {
+				return nil, participle.Errorf(ast.Call.Pos, "no overload of %s takes %d parameters", ref.Nme, ast.Call.Arity())
+			}
+			return a.resolveCallActual(scope, overload.ReturnType, overload.Parameters, ast.Call)
+		}
+		return nil, participle.Errorf(ast.Call.Pos, "can't call %s", ref)
 
 	default:
 		return nil, participle.Errorf(ast.Call.Pos, "can't call %s", ref)
 	}
 }
 
+// Resolve a call to fn, first inferring its type parameters if it is generic.
+func (a *analyser) resolveFunctionCall(scope *Scope, fn *types.Function, call *parser.Call) (*types.Value, error) {
+	if len(fn.TypeParams) > 0 && len(fn.Parameters) == call.Arity() {
+		args := make([]types.Type, len(fn.TypeParams))
+		for i, param := range call.Parameters {
+			value, err := a.resolveExprValue(scope, param)
+			if err != nil {
+				return nil, err
+			}
+			inferTypeArguments(fn.TypeParams, args, fn.Parameters[i].Typ, value.Type())
+		}
+		if call.TrailingClosure != nil {
+			if err := a.inferClosureTypeArguments(scope, fn, args, call.TrailingClosure); err != nil {
+				return nil, err
+			}
+		}
+		for i, arg := range args {
+			if arg == nil {
+				return nil, participle.Errorf(call.Pos, "can't infer type parameter %s of %s", fn.TypeParams[i].Nme, fn)
+			}
+		}
+		fn = types.Substitute(fn, fn.TypeParams, args).(*types.Function)
+	}
+	return a.resolveCallActual(scope, fn.ReturnType, fn.Parameters, call)
+}
+
+// Bind the type parameters of fn to the result of a trailing closure, eg. U
+// in "xs.map { x -> x * 2 }".
+//
+// The parameters of the closure must be bound by the preceding arguments.
+func (a *analyser) inferClosureTypeArguments(scope *Scope, fn *types.Function, args []types.Type, closure *parser.Closure) error {
+	expected, ok := fn.Parameters[len(fn.Parameters)-1].Typ.(*types.Function)
+	if !ok {
+		return nil
+	}
+	params, bound := []types.NamedType{}, []types.Type{}
+	for i, arg := range args {
+		if arg != nil {
+			params = append(params, fn.TypeParams[i])
+			bound = append(bound, arg)
+		}
+	}
+	expected = types.Substitute(expected, params, bound).(*types.Function)
+	result, err := a.resolveClosure(scope, closure, expected)
+	if err != nil {
+		return err
+	}
+	inferTypeArguments(fn.TypeParams, args, expected.ReturnType, result)
+	return nil
+}
+
+// Check a closure passed as a function of type fn, returning the type of its
+// result.
+func (a *analyser) resolveClosure(scope *Scope, closure *parser.Closure, fn *types.Function) (types.Type, error) {
+	if len(closure.Parameters) != len(fn.Parameters) {
+		return nil, participle.Errorf(closure.Pos, "closure has %d parameters but %s requires %d",
+			len(closure.Parameters), fn, len(fn.Parameters))
+	}
+	closureScope := scope.Sub(fn)
+	for i, name := range closure.Parameters {
+		if err := a.declVars(closure.Pos, closureScope, types.Let(fn.Parameters[i].Typ), name); err != nil {
+			return nil, err
+		}
+	}
+	a.p.associate(closure, fn)
+	result := closure.Result()
+	if fn.ReturnType == types.None {
+		return types.None, a.checkStatements(closureScope, closure.Body)
+	}
+	if result == nil {
+		return nil, participle.Errorf(closure.Pos, "closure must end with an expression")
+	}
+	if err := a.checkStatements(closureScope, closure.Body[:len(closure.Body)-1]); err != nil {
+		return nil, err
+	}
+	value, err := a.resolveExprValue(closureScope, result)
+	if err != nil {
+		return nil, err
+	}
+	return value.Type(), nil
+}
+
+// Bind the type parameters in param to the corresponding types in arg, where
+// they are not already bound.
+func inferTypeArguments(params []types.NamedType, args []types.Type, param, arg types.Type) {
+	switch param := param.(type) {
+	case *types.TypeParam:
+		for i, tparam := range params {
+			if tparam.Typ == param && args[i] == nil {
+				if concrete, err := types.Concrete(arg); err == nil {
+					arg = concrete.Type()
+				}
+				args[i] = arg
+			}
+		}
+
+	case *types.Function:
+		arg, ok := arg.(*types.Function)
+		if !ok || len(arg.Parameters) != len(param.Parameters) {
+			return
+		}
+		for i, p := range param.Parameters {
+			inferTypeArguments(params, args, p.Typ, arg.Parameters[i].Typ)
+		}
+		inferTypeArguments(params, args, param.ReturnType, arg.ReturnType)
+
+	case types.ArrayType:
+		if arg, ok := arg.(types.ArrayType); ok {
+			inferTypeArguments(params, args, param.Constraints[0].Typ, arg.Constraints[0].Typ)
+		}
+	}
+}
+
 func (a *analyser) resolveCallActual(scope *Scope, returnType types.Type, parameters []types.NamedType, call *parser.Call) (*types.Value, error) {
-	if len(parameters) != len(call.Parameters) {
+	if len(parameters) != call.Arity() {
 		return nil, participle.Errorf(call.Pos,
 			"%d parameters provided for function that takes %d parameters",
-			len(call.Parameters), len(parameters))
+			call.Arity(), len(parameters))
 	}
 	for i, param := range call.Parameters {
 		value, err := a.resolveExprValue(scope, param)
@@ -937,6 +1481,20 @@ func (a *analyser) resolveCallActual(scope *Scope, returnType types.Type, parame
 				parameter.Name(), value.Kind(), parameter.Type())
 		}
 	}
+	if closure := call.TrailingClosure; closure != nil {
+		parameter := parameters[len(parameters)-1]
+		fn, ok := parameter.Typ.(*types.Function)
+		if !ok {
+			return nil, participle.Errorf(closure.Pos, "can't pass a closure as %q of type %s", parameter.Name(), parameter.Type())
+		}
+		result, err := a.resolveClosure(scope, closure, fn)
+		if err != nil {
+			return nil, err
+		}
+		if fn.ReturnType != types.None && types.Coerce(result, fn.ReturnType) == nil {
+			return nil, participle.Errorf(closure.Pos, "can't coerce result of closure from %s to %s", result, fn.ReturnType)
+		}
+	}
 	return &types.Value{Typ: returnType}, nil
 }
 
@@ -949,6 +1507,7 @@ func (a *analyser) resolveField(scope *Scope, parent types.Reference, terminal *
 		}
 		a.p.associateConcrete(terminal, field)
 		a.p.associate(terminal, field)
+		a.p.owners[terminal] = parent.Type()
 		return field, nil
 
 	default:
@@ -960,8 +1519,7 @@ func (a *analyser) resolveLiteral(scope *Scope, literal *parser.Literal) (ref ty
 	defer a.autoAssoc(literal, &ref)
 	switch {
 	case literal.Number != nil:
-		n := big.Float(*literal.Number)
-		if n.IsInt() {
+		if literal.Number.IsInt() {
 			return &types.Value{Typ: types.LiteralInt}, nil
 		}
 		return &types.Value{Typ: types.LiteralFloat}, nil
@@ -970,9 +1528,27 @@ func (a *analyser) resolveLiteral(scope *Scope, literal *parser.Literal) (ref ty
 		// TODO: Resolve interpolation vars eg. "{x}, {y}, {z}".
 		return &types.Value{Typ: types.LiteralString}, nil
 
+	case literal.Template != nil:
+		if !templateTags[literal.Template.Tag] {
+			return nil, participle.Errorf(literal.Pos, "unknown template tag %q", literal.Template.Tag)
+		}
+		return &types.Value{Typ: types.LiteralString}, nil
+
+	case literal.Embedded != nil:
+		if err := checkEmbedded(literal.Embedded); err != nil {
+			return nil, err
+		}
+		return &types.Value{Typ: types.LiteralString}, nil
+
+	case literal.Char != nil:
+		return &types.Value{Typ: types.Char}, nil
+
 	case literal.Bool != nil:
 		return &types.Value{Typ: types.Bool}, nil
 
+	case literal.Nil:
+		return &types.Value{Typ: types.None}, nil
+
 	case literal.Array != nil:
 		return a.resolveArrayLiteral(scope, literal.Array)
 
@@ -1094,6 +1670,9 @@ func (a *analyser) checkExprStmt(scope *Scope, stmt *parser.ExprStmt) error {
 	if err != nil {
 		return err
 	}
+	if stmt.RHS != nil && !isLValue(stmt.LHS) {
+		return participle.Errorf(stmt.LHS.Pos, "left hand side of assignment must be assignable")
+	}
 	if stmt.LHS.Unary == nil {
 		return participle.Errorf(stmt.Pos, "statement with no effect")
 	}
@@ -1114,6 +1693,26 @@ func (a *analyser) checkExprStmt(scope *Scope, stmt *parser.ExprStmt) error {
 	return nil
 }
 
+// Returns true if expr is syntactically a valid assignment target: a
+// variable, member or subscript, optionally parenthesised.
+func isLValue(expr *parser.Expr) bool {
+	if expr.Unary == nil || expr.Unary.Op != parser.OpNone || expr.Unary.Reference.Optional {
+		return false
+	}
+	ref := expr.Unary.Reference
+	if ref.Next == nil {
+		if len(ref.Terminal.Tuple) == 1 {
+			return isLValue(ref.Terminal.Tuple[0])
+		}
+		return ref.Terminal.Ident != ""
+	}
+	last := ref.Next
+	for last.Next != nil {
+		last = last.Next
+	}
+	return last.Subscript != nil || last.Reference != nil
+}
+
 func (a *analyser) checkExprStmtIsFunctionCall(scope *Scope, expr *parser.Unary) error {
 	if expr.Op != 0 {
 		return participle.Errorf(expr.Pos, "statement with no effect")
@@ -1,9 +1,15 @@
 package analyser
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"testing"
+	"unicode"
 
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
 	"github.com/alecthomas/repr"
 	"github.com/stretchr/testify/require"
 
@@ -66,6 +72,32 @@ func TestAnalyser(t *testing.T) {
 			`,
 			fail: `4:5: left hand side of assignment must be assignable`,
 		},
+		{name: "BinaryLHSAssignment",
+			input: `
+			fn f() {
+				let a: int
+				a + a = 10
+			}
+			`,
+			fail: `4:7: left hand side of assignment must be assignable`,
+		},
+		{name: "NegatedLHSAssignment",
+			input: `
+			fn f() {
+				let a: int
+				-a = 10
+			}
+			`,
+			fail: `4:5: left hand side of assignment must be assignable`,
+		},
+		{name: "ParenthesisedAssignment",
+			input: `
+			fn f() {
+				let a: int
+				(a) = 10
+			}
+			`,
+		},
 		{name: "Assignment",
 			input: `
 			fn f() {
@@ -243,6 +275,387 @@ func TestAnalyser(t *testing.T) {
 				}
 			`,
 		},
+		{name: "DestructureArray",
+			input: `
+				let xs = [1, 2, 3]
+				let [a, b, ...rest] = xs
+			`,
+			refs: refs{
+				"a":    {types.Var(types.Int), nil},
+				"b":    {types.Var(types.Int), nil},
+				"rest": {types.Var(types.Array(types.Int)), nil},
+			},
+		},
+		{name: "DestructureRestNotLast",
+			input: `
+				let [...rest, a] = [1, 2]
+			`,
+			fail: "2:10: ...rest must be the last element",
+		},
+		{name: "DestructureDict",
+			input: `
+				let d = {"x": 1}
+				const {x, y} = d
+			`,
+			refs: refs{
+				"x": {types.Let(types.Optional(types.Int)), nil},
+				"y": {types.Let(types.Optional(types.Int)), nil},
+			},
+		},
+		{name: "DestructureClass",
+			input: `
+				class Point {
+					let x: int
+					let y: float
+				}
+				fn f(p: Point) {
+					let {x, y} = p
+					let z: float = y
+				}
+			`,
+		},
+		{name: "DestructureUnknownField",
+			input: `
+				class Point {
+					let x: int
+				}
+				fn f(p: Point) {
+					let {x, z} = p
+				}
+			`,
+			fail: "6:10: unknown field z on class",
+		},
+		{name: "DestructureNonArray",
+			input: `
+				let [a] = 1
+			`,
+			fail: "2:9: can't destructure int as an array",
+		},
+		{name: "Const",
+			input: `
+				const a = 1, b = "b"
+			`,
+			refs: refs{
+				"a": {types.Let(types.Int), nil},
+				"b": {types.Let(types.String), nil},
+			},
+		},
+		{name: "ConstAssignment",
+			input: `
+				const a = 1
+				fn f() {
+					a = 2
+				}
+			`,
+			fail: "4:6: left hand side of assignment must be assignable",
+		},
+		{name: "ConstWithoutValue",
+			input: `
+				const a: int
+			`,
+			fail: `2:11: constant "a" must have a value`,
+		},
+		{name: "ConstSharingValue",
+			input: `
+				const a, b = 1
+			`,
+			fail: `2:11: constant "a" must have a value`,
+		},
+		{name: "ChainedComparison",
+			input: `
+				let a = 1
+				let b = 0 < a <= 2
+			`,
+			refs: refs{
+				"b": {types.Var(types.Bool), nil},
+			},
+		},
+		{name: "ChainedComparisonMismatch",
+			input: `
+				let a = 1
+				let b = 0 < a < "x"
+			`,
+			fail: `3:19: invalid initial value for "b": cannot apply int value < literal string value`,
+		},
+		{name: "DoExpr",
+			input: `
+				let a = do {
+					let t = 2
+					t * t
+				}
+			`,
+			refs: refs{
+				"a": {types.Var(types.Int), nil},
+			},
+		},
+		{name: "DoExprScope",
+			input: `
+				let a = do { let t = 2; t }
+				let b = t
+			`,
+			fail: `3:13: invalid initial value for "b": unknown symbol "t"`,
+		},
+		{name: "DoExprWithoutResult",
+			input: `
+				let a = do { let t = 2 }
+			`,
+			fail: `2:13: invalid initial value for "a": do block must end with an expression`,
+		},
+		{name: "LabelledSwitch",
+			input: `
+				fn f() {
+					let a = 1
+					outer: switch a {
+					case 1:
+						switch a {
+						case 1:
+							break outer
+						default:
+							break
+						}
+					}
+				}
+			`,
+		},
+		{name: "BreakOutsideLoop",
+			input: `
+				fn f() {
+					break
+				}
+			`,
+			fail: "3:6: break is not in a loop or switch",
+		},
+		{name: "BreakInClosure",
+			input: `
+				fn f(xs: [int]) {
+					for x in xs {
+						xs.filter { y -> break }
+					}
+				}
+			`,
+			fail: "4:24: break is not in a loop or switch",
+		},
+		{name: "BreakInInitialiser",
+			input: `
+				fn f(xs: [int]) {
+					outer: for x in xs {
+						class C {
+							init() {
+								break outer
+							}
+						}
+					}
+				}
+			`,
+			fail: `6:9: unknown label "outer"`,
+		},
+		{name: "BreakInDoExpr",
+			input: `
+				fn f(x: int) {
+					switch x {
+					case 1:
+						let a = do {
+							break
+							2
+						}
+					}
+				}
+			`,
+			fail: "6:8: break can not leave a do expression",
+		},
+		{name: "ContinueInDoExpr",
+			input: `
+				fn f(xs: [int]) {
+					for x in xs {
+						let a = do {
+							continue
+							2
+						}
+					}
+				}
+			`,
+			fail: "5:8: continue can not leave a do expression",
+		},
+		{name: "ReturnInDoExpr",
+			input: `
+				fn f(): int {
+					let a = do {
+						return 1
+						2
+					}
+					return a
+				}
+			`,
+			fail: "4:7: return can not be used within a do expression",
+		},
+		{name: "SwitchInDoExpr",
+			input: `
+				fn f(x: int): int {
+					return do {
+						switch x {
+						case 1:
+							break
+						}
+						1
+					}
+				}
+			`,
+		},
+		{name: "ContinueInSwitch",
+			input: `
+				fn f() {
+					switch 1 {
+					case 1:
+						continue
+					}
+				}
+			`,
+			fail: "5:7: continue is not in a loop",
+		},
+		{name: "ContinueToSwitchLabel",
+			input: `
+				fn f(xs: [int]) {
+					sw: switch 1 {
+					case 1:
+						for x in xs {
+							continue sw
+						}
+					}
+				}
+			`,
+			fail: `6:8: continue label "sw" does not refer to a loop`,
+		},
+		{name: "UnknownLabel",
+			input: `
+				fn f(xs: [int]) {
+					outer: for x in xs {
+						break inner
+					}
+				}
+			`,
+			fail: `4:7: unknown label "inner"`,
+		},
+		{name: "LabelDoesNotCrossFunctions",
+			input: `
+				fn f(xs: [int]) {
+					outer: for x in xs {
+						fn g() {
+							break outer
+						}
+					}
+				}
+			`,
+			fail: `5:8: unknown label "outer"`,
+		},
+		{name: "DuplicateLabel",
+			input: `
+				fn f(xs: [int]) {
+					outer: for x in xs {
+						outer: for y in xs {
+						}
+					}
+				}
+			`,
+			fail: `4:7: label "outer" is already defined`,
+		},
+		{name: "LabelOnInvalidStatement",
+			input: `
+				fn f() {
+					outer: if true {
+					}
+				}
+			`,
+			fail: `3:6: label "outer" can only be applied to for and switch statements`,
+		},
+		{name: "DefiniteReturn",
+			input: `
+				enum E {
+					case A
+					case B
+				}
+
+				fn f(a: int, e: E): int {
+					if a > 1 {
+						return 1
+					} else {
+						switch e {
+						case .A:
+							return 2
+						case .B:
+							return 3
+						}
+					}
+				}
+			`,
+		},
+		{name: "MissingReturn",
+			input: `
+				fn f(a: int): int {
+					if a > 1 {
+						return 1
+					}
+				}
+			`,
+			fail: `2:5: missing return at end of "f", reached from 3:11`,
+		},
+		{name: "ElseIf",
+			input: `
+				fn sign(n: int): int {
+					if n > 0 {
+						return 1
+					} else if n < 0 {
+						return -1
+					} else {
+						return 0
+					}
+				}
+			`,
+		},
+		{name: "ElseIfMissingReturn",
+			input: `
+				fn sign(n: int): int {
+					if n > 0 {
+						return 1
+					} else if n < 0 {
+						return -1
+					}
+				}
+			`,
+			fail: `2:5: missing return at end of "sign", reached from 5:18`,
+		},
+		{name: "ElseIfCondition",
+			input: `
+				fn f(n: int) {
+					if n > 0 {
+					} else if n {
+					}
+				}
+			`,
+			fail: `4:16: condition must be bool but is int value`,
+		},
+		{name: "MissingReturnPaths",
+			input: `
+				class C {
+					fn f(x: int): int {
+						let y = x
+						switch x {
+						case 1:
+							return 1
+						case 2:
+							y = 3
+						default:
+							break
+						}
+						if y > 1 {
+							y = 1
+						} else {
+							y = 2
+						}
+					}
+				}
+			`,
+			fail: `3:6: missing return at end of "C.f", reached from 14:8, 16:8`,
+		},
 		{name: "SwitchOnValueInvalidCaseType",
 			input: `
 				fn f() {
@@ -325,6 +738,25 @@ func TestAnalyser(t *testing.T) {
 			`,
 			fail: `10:6: cases not matched: Int`,
 		},
+		{name: "EnumSwitchNotExhaustiveStableOrder",
+			input: `
+				enum Enum {
+					case D
+					case B
+					case C
+					case A
+				}
+
+				fn f() {
+					let a = Enum.A
+
+					switch a {
+					case .C:
+					}
+				}
+			`,
+			fail: `12:6: cases not matched: A, B, D`,
+		},
 		{name: "SwitchOnEnumUnknownCase",
 			input: `
 				enum Enum {
@@ -388,54 +820,606 @@ func TestAnalyser(t *testing.T) {
 					}
 				}
 			`,
-			fail: `10:17: unexpected token "," (expected ")")`,
+			fail: `10:11: enum case "Int" has a single associated value`,
 		},
-		{name: "GenericClass",
+		{name: "EnumNamedAssociatedValues",
 			input: `
-				class Pair<A, B> {
-					let a: A
-					let b: B
+				enum Shape {
+					case point(x: int, y: int)
+					case circle(float)
+				}
+
+				fn f(): int {
+					let a = Shape.point(1, 2)
+					switch a {
+					case .point(x, y):
+						return x + y
+					case .circle(r):
+						return 0
+					}
 				}
 			`},
-		{name: "GenericConstructor",
+		{name: "IfLet",
 			input: `
-				class Pair<A, B> {
-					let a: A
-					let b: B
+				fn find(): int? {
+					return nil
 				}
-		
-				// let a = new Pair<string, string>()
-				`,
-		},
-		{name: "GenericEnum",
-			input: `
-				enum Maybe<T> {
-					case None
-					case Some(T)
+				fn f(): int {
+					if let value = find() {
+						return value + 1
+					} else {
+						return 0
+					}
 				}
 			`},
-		{name: "MultiGenericEnum",
+		{name: "IfLetBindingNotInElse",
 			input: `
-				enum OneOf<A, B> {
-					case First(A)
-					case Second(B)
+				fn find(): int? {
+					return nil
 				}
-			`},
-		{name: "Self",
-			input: `
-				class ClassType {
-					let a: int
-	
-					init() {
-						self.a = 2
-					}
-	
-					fn f() {
-						self.a = 2
+				fn f(): int {
+					if let value = find() {
+						return value
+					} else {
+						return value
 					}
 				}
-			`},
-		{name: "DeferredBodyAnalysis",
+			`,
+			fail: `9:14: unknown symbol "value"`},
+		{name: "IfLetNotOptional",
+			input: `
+				fn f(a: int) {
+					if let value = a {
+					}
+				}
+			`,
+			fail: `3:21: if let requires an optional value but got int`},
+		{name: "EnumLetBindings",
+			input: `
+				enum Shape {
+					case point(x: int, y: int)
+					case circle(int)
+				}
+
+				fn f(shape: Shape): int {
+					switch shape {
+					case .point(let x, _):
+						return x
+					case .circle(_):
+						return 0
+					}
+				}
+			`},
+		{name: "EnumIgnoredBindingIsUndefined",
+			input: `
+				enum Shape {
+					case point(x: int, y: int)
+				}
+
+				fn f(shape: Shape): int {
+					switch shape {
+					case .point(_, _):
+						return _
+					}
+				}
+			`,
+			fail: `9:14: unknown symbol "_"`},
+		{name: "EnumNamedAssociatedValuesMismatched",
+			input: `
+				enum Shape {
+					case point(x: int, y: int)
+				}
+
+				fn f() {
+					switch Shape.point(1, 2) {
+					case .point(x):
+					}
+				}
+			`,
+			fail: `8:11: enum case "point" requires 2 variables`},
+		{name: "EnumNamedAssociatedValuesWrongType",
+			input: `
+				enum Shape {
+					case point(x: int, y: int)
+				}
+				let a = Shape.point(1, "2")
+			`,
+			fail: `5:28: invalid initial value for "a": can't coerce "y" from literal string to int`},
+		{name: "EnumDuplicateAssociatedValue",
+			input: `
+				enum Shape {
+					case point(x: int, x: int)
+				}
+			`,
+			fail: `3:25: duplicate associated value "x"`},
+		{name: "EnumRawValues",
+			input: `
+				const base = 10
+				enum Colour {
+					case red = base
+					case green = base + 1
+					case blue = -1
+				}
+
+				fn f(c: Colour): int {
+					return c.rawValue
+				}
+			`},
+		{name: "EnumDuplicateRawValue",
+			input: `
+				enum Colour {
+					case red = 2
+					case green = 1 + 1
+				}
+			`,
+			fail: `4:21: duplicate raw value 2 of "green", already used by "red"`},
+		{name: "EnumMissingRawValue",
+			input: `
+				enum Colour {
+					case red = 1
+					case green
+				}
+			`,
+			fail: `4:6: either all or none of the cases of Colour must have raw values`},
+		{name: "EnumRawValueNotConstant",
+			input: `
+				let base = 1
+				enum Colour {
+					case red = base
+				}
+			`,
+			fail: `4:17: raw value of "red" must be a constant expression`},
+		{name: "EnumRawValueMismatchedType",
+			input: `
+				enum Colour {
+					case red = 1
+					case green = "green"
+				}
+			`,
+			fail: `4:19: raw value of "green" must be int, not string`},
+		{name: "EnumRawValueWithAssociatedValue",
+			input: `
+				enum Colour {
+					case red(int) = 1
+				}
+			`,
+			fail: `3:6: case "red" can't have both associated values and a raw value`},
+		{name: "GenericClass",
+			input: `
+				class Pair<A, B> {
+					let a: A
+					let b: B
+				}
+			`},
+		{name: "GenericConstructor",
+			input: `
+				class Pair<A, B> {
+					let a: A
+					let b: B
+				}
+		
+				// let a = new Pair<string, string>()
+				`,
+		},
+		{name: "GenericEnum",
+			input: `
+				enum Maybe<T> {
+					case None
+					case Some(T)
+				}
+			`},
+		{name: "MultiGenericEnum",
+			input: `
+				enum OneOf<A, B> {
+					case First(A)
+					case Second(B)
+				}
+			`},
+		{name: "FBoundedConstraint",
+			input: `
+				class Comparable<T> {
+					fn compare(other: T): int {
+						return 0
+					}
+				}
+
+				class Version {
+					let major: int
+
+					fn compare(other: Version): int {
+						return major - other.major
+					}
+				}
+
+				class Tree<U: Comparable<U>> {
+					let root: U
+				}
+
+				class SortedList<T: Comparable<T>> {
+					let items: [T]
+
+					fn less(a: T, b: T): bool {
+						return a.compare(b) < 0
+					}
+
+					fn index(tree: Tree<T>) {
+					}
+				}
+
+				fn sort(list: SortedList<Version>, a: Version, b: Version): bool {
+					return list.less(a, b)
+				}
+			`},
+		{name: "UnsatisfiedConstraint",
+			input: `
+				class Comparable<T> {
+					fn compare(other: T): int {
+						return 0
+					}
+				}
+
+				class Version {
+					let major: int
+
+					fn compare(other: Version): int {
+						return major - other.major
+					}
+				}
+
+				class Tree<U: Comparable<U>> {
+					let root: U
+				}
+
+				class SortedList<T: Comparable<T>> {
+					let items: [T]
+
+					fn less(a: T, b: T): bool {
+						return a.compare(b) < 0
+					}
+
+					fn index(tree: Tree<T>) {
+					}
+				}
+
+				fn sort(list: SortedList<int>) {
+				}
+			`,
+			fail: `31:30: int does not satisfy constraint Comparable<int> of type parameter T`},
+		{name: "MismatchedConstraintMethod",
+			input: `
+				class Comparable<T> {
+					fn compare(other: T): int {
+						return 0
+					}
+				}
+
+				class Version {
+					let major: int
+
+					fn compare(other: Version): int {
+						return major - other.major
+					}
+				}
+
+				class Tree<U: Comparable<U>> {
+					let root: U
+				}
+
+				class SortedList<T: Comparable<T>> {
+					let items: [T]
+
+					fn less(a: T, b: T): bool {
+						return a.compare(b) < 0
+					}
+
+					fn index(tree: Tree<T>) {
+					}
+				}
+
+				class Date {
+					fn compare(other: Version): int {
+						return 0
+					}
+				}
+
+				fn sort(list: SortedList<Date>) {
+				}
+			`,
+			fail: `37:30: Date does not satisfy constraint Comparable<Date> of type parameter T`},
+		{name: "SelfReferentialConstraint",
+			input: `
+				class Node<N: Node<N>> {
+					let next: N
+
+					fn last(): N {
+						return next.last()
+					}
+				}
+			`},
+		{name: "SpecialisedFields",
+			input: `
+				class Box<T> {
+					let value: T
+				}
+
+				fn unbox(box: Box<int>): string {
+					return box.value
+				}
+			`,
+			fail: `7:6: cannot return int as string`},
+		{name: "SpecialisationArity",
+			input: `
+				class Box<T> {
+					let value: T
+				}
+
+				fn unbox(box: Box<int, int>) {
+				}
+			`,
+			fail: `6:22: need 1 type parameters for Box but have 2`},
+		{name: "PreludeComparable",
+			input: `
+				class Version {
+					let major: int
+
+					fn compare(other: Version): int {
+						return major - other.major
+					}
+				}
+
+				class SortedList<T: Comparable<T>> {
+					let items: [T]
+				}
+
+				fn newest(versions: SortedList<Version>, names: SortedList<string>) {
+				}
+			`},
+		{name: "PreludeEquatable",
+			input: `
+				class Set<T: Equatable<T>> {
+					let items: [T]
+				}
+
+				fn f(a: Set<bool>) {
+				}
+			`},
+		{name: "SortComparable",
+			input: `
+				class Version {
+					let major: int
+
+					fn compare(other: Version): int {
+						return major - other.major
+					}
+				}
+
+				fn f(numbers: [int], versions: [Version]) {
+					numbers.sort()
+					versions.sort()
+				}
+			`},
+		{name: "SortWithComparison",
+			input: `
+				class Point {
+					let x: int
+				}
+
+				fn byX(a: Point, b: Point): int {
+					return a.x - b.x
+				}
+
+				fn f(points: [Point]) {
+					points.sort(byX)
+				}
+			`},
+		{name: "SortNotComparable",
+			input: `
+				class Point {
+					let x: int
+				}
+
+				fn f(points: [Point]) {
+					points.sort()
+				}
+			`,
+			fail: `7:13: sort() requires Point to satisfy Comparable<Point>, or a comparison function`},
+		{name: "SortMismatchedComparison",
+			input: `
+				fn byLength(a: string, b: string): int {
+					return 0
+				}
+
+				fn f(numbers: [int]) {
+					numbers.sort(byLength)
+				}
+			`,
+			fail: `7:19: can't coerce "compare" from function to fn(a: int, b: int): int`},
+		{name: "CollectionMethods",
+			input: `
+				fn length(s: string): int {
+					return 0
+				}
+
+				fn isLong(s: string): bool {
+					return length(s) > 3
+				}
+
+				fn add(total: int, n: int): int {
+					return total + n
+				}
+
+				fn f(csv: string, ages: {string: int}) {
+					let words: [string] = csv.split(",")
+					let lengths: [int] = words.map(length)
+					let long: [string] = words.filter(isLong)
+					let total: int = lengths.reduce(0, add)
+					let joined: string = long.join(" ")
+					let names: [string] = ages.keys()
+					let values: [int] = ages.values()
+				}
+			`},
+		{name: "MapResultType",
+			input: `
+				fn length(s: string): int {
+					return 0
+				}
+
+				fn f(words: [string]) {
+					let lengths: [string] = words.map(length)
+				}
+			`,
+			fail: `7:30: can't assign [int] to [string]`},
+		{name: "MapMismatchedTransform",
+			input: `
+				fn double(n: int): int {
+					return n * 2
+				}
+
+				fn f(words: [string]) {
+					words.map(double)
+				}
+			`,
+			fail: `7:16: can't coerce "transform" from function to fn(value: string): int`},
+		{name: "JoinNonStrings",
+			input: `
+				fn f(numbers: [int]) {
+					numbers.join(",")
+				}
+			`,
+			fail: `3:14: unknown field join on generic value`},
+		{name: "TrailingClosures",
+			input: `
+				fn length(s: string): int {
+					return 0
+				}
+
+				fn f(words: [string], numbers: [int]) {
+					let lengths: [int] = words.map { w -> length(w) }
+					let long: [string] = words.filter { w ->
+						let n = length(w)
+						n > 3
+					}
+					let total: int = numbers.reduce(0) { sum, n -> sum + n }
+					numbers.sort { a, b -> b - a }
+				}
+			`},
+		{name: "TrailingClosureResultType",
+			input: `
+				fn f(numbers: [int]) {
+					let doubled: [string] = numbers.map { n -> n * 2 }
+				}
+			`,
+			fail: `3:30: can't assign [int] to [string]`},
+		{name: "TrailingClosureParameterCount",
+			input: `
+				fn f(numbers: [int]) {
+					numbers.filter { a, b -> true }
+				}
+			`,
+			fail: `3:21: closure has 2 parameters but fn(value: int): bool requires 1`},
+		{name: "TrailingClosureWithoutResult",
+			input: `
+				fn f(numbers: [int]) {
+					numbers.filter { n -> }
+				}
+			`,
+			fail: `3:21: closure must end with an expression`},
+		{name: "TrailingClosureMismatchedResult",
+			input: `
+				fn f(numbers: [int]) {
+					numbers.filter { n -> n }
+				}
+			`,
+			fail: `3:21: can't coerce result of closure from int to bool`},
+		{name: "TrailingClosureNotFunction",
+			input: `
+				fn g(n: int) {}
+
+				fn f() {
+					g { -> 1 }
+				}
+			`,
+			fail: `5:8: can't pass a closure as "n" of type int`},
+		{name: "FunctionValues",
+			input: `
+				fn double(n: int): int {
+					return n * 2
+				}
+
+				fn apply(n: int, f: fn(int): int): int {
+					return f(n)
+				}
+
+				class Counter {
+					let n = 0
+					fn get(): int {
+						return n
+					}
+				}
+
+				fn f(c: Counter, numbers: [int]) {
+					let g = double
+					let a: int = g(1)
+					let h: fn(int): int = double
+					let b: int = apply(2, h)
+					let get: fn(): int = c.get
+					let d: int = get()
+					let m = numbers.map
+					let doubled: [int] = m(double)
+				}
+			`},
+		{name: "FunctionValueMismatch",
+			input: `
+				fn double(n: int): int {
+					return n * 2
+				}
+
+				let f: fn(string): int = double
+			`,
+			fail: `6:30: can't assign fn(n: int): int to fn(string): int`},
+		{name: "CallNonFunctionValue",
+			input: `
+				fn f(n: int): int {
+					return n(1)
+				}
+			`,
+			fail: `3:14: can't call value of type int`},
+		{name: "ConstantDivisionByZero",
+			input: `
+				const size = 10
+				const half = size / (size - 10)
+			`,
+			fail: `3:23: division by zero in constant expression`},
+		{name: "ConstantOverflow",
+			input: `
+				let big = 4611686018427387904 * 2
+			`,
+			fail: `2:35: constant expression overflows int`},
+		{name: "ConstantDecimalOverflow",
+			input: `
+				let big = 9223372036854775807 + 1
+			`,
+			fail: `2:35: constant expression overflows int`},
+		{name: "NonConstantDivisionByZero",
+			input: `
+				let size = 0
+				let half = 10 / size
+			`},
+		{name: "Self",
+			input: `
+				class ClassType {
+					let a: int
+	
+					init() {
+						self.a = 2
+					}
+	
+					fn f() {
+						self.a = 2
+					}
+				}
+			`},
+		{name: "DeferredBodyAnalysis",
 			input: `
 			class A {
 				init() {
@@ -573,6 +1557,73 @@ func TestAnalyser(t *testing.T) {
 				"a": ref{types.Var(types.Optional(types.Int)), nil},
 			},
 		},
+		{name: "NumericLiterals",
+			input: `
+				let a = 0xFF
+				let b = 1_000
+				let c = 1.5e3
+				let d = 25e-1
+			`,
+			refs: refs{
+				"a": ref{types.Var(types.Int), nil},
+				"b": ref{types.Var(types.Int), nil},
+				"c": ref{types.Var(types.Float), nil},
+				"d": ref{types.Var(types.Float), nil},
+			},
+		},
+		{name: "CharLiteral",
+			input: `
+				let a = 'a'
+				let b: char = '\t'
+			`,
+			refs: refs{
+				"a": ref{types.Var(types.Char), nil},
+				"b": ref{types.Var(types.Char), nil},
+			},
+		},
+		{name: "CharIsNotString",
+			input: `
+				let a: string = 'a'
+			`,
+			fail: `2:21: can't assign char to string`,
+		},
+		{name: "NilOptional",
+			input: `
+				let a: int? = nil
+			`,
+			refs: refs{
+				"a": ref{types.Var(types.Optional(types.Int)), nil},
+			},
+		},
+		{name: "NilWithoutType",
+			input: `
+				let a = nil
+			`,
+			fail: `2:13: invalid initial value for "a": can't reference "none"`,
+		},
+		{name: "NilToNonOptional",
+			input: `
+				let a: int = nil
+			`,
+			fail: `2:18: can't assign none to int`,
+		},
+		{name: "BareReturn",
+			input: `
+				fn f() {
+					return
+				}
+			`,
+		},
+		{name: "VoidReturn",
+			input: `
+				fn f(): void {
+					return
+				}
+			`,
+			refs: refs{
+				"f": {&types.Function{ReturnType: types.None}, nil},
+			},
+		},
 		{name: "NestedEnum",
 			input: `
 				enum Scalar {
@@ -610,6 +1661,45 @@ func TestAnalyser(t *testing.T) {
 				// }}, nil},
 			},
 		},
+		{name: "NewWithConstructor",
+			input: `
+				class ClassType {
+					init(a: int, b: string) {
+					}
+				}
+				let a = new ClassType(1, "b")
+			`},
+		{name: "NewWithMethodCall",
+			input: `
+				class Counter {
+					let n: int
+					init(n: int) {
+						self.n = n
+					}
+					fn get(): int {
+						return n
+					}
+				}
+				let a: int = new Counter(1).get()
+			`},
+		{name: "NewWithInvalidConstructorArgs",
+			input: `
+				class ClassType {
+					init(a: int) {
+					}
+				}
+				let a = new ClassType("a")
+			`,
+			fail: `6:27: invalid initial value for "a": can't coerce "a" from literal string to int`},
+		{name: "NewMissingConstructorArgs",
+			input: `
+				class ClassType {
+					init(a: int) {
+					}
+				}
+				let a = new ClassType
+			`,
+			fail: `6:13: invalid initial value for "a": 0 parameters provided for function that takes 1 parameters`},
 		{name: "EnumUnambiguousInference",
 			input: `
 			enum A {
@@ -689,6 +1779,175 @@ func TestAnalyser(t *testing.T) {
 	}
 }
 
+func TestFieldsAreSorted(t *testing.T) {
+	ast, err := parser.ParseString(`
+		class A {
+			let z: int
+			let a: int
+			fn m() {}
+		}
+	`)
+	require.NoError(t, err)
+	program, err := Analyse(ast)
+	require.NoError(t, err)
+	names := []string{}
+	for _, field := range program.Root.Resolve("A").(types.Type).Fields() {
+		names = append(names, field.Nme)
+	}
+	require.Equal(t, []string{"a", "m", "z"}, names)
+}
+
+func TestAnalyseWithImports(t *testing.T) {
+	util, err := parser.ParseString(`
+		module app.util
+
+		pub fn double(n: int): int { return n * 2 }
+		pub let scale = 3
+	`)
+	require.NoError(t, err)
+	utilProgram, err := Analyse(util)
+	require.NoError(t, err)
+	modules := map[string]*Program{"app.util": utilProgram}
+
+	tests := []struct {
+		name  string
+		input string
+		fail  string
+	}{
+		{name: "Namespace",
+			input: `
+				import app.util
+				let a: int = util.double(2) + util.scale
+			`},
+		{name: "Alias",
+			input: `
+				import u "app/util"
+				let a: int = u.double(2)
+			`},
+		{name: "Symbols",
+			input: `
+				import app.util.{double}
+				let a: int = double(2)
+			`},
+		{name: "Wildcard",
+			input: `
+				import app.util.*
+				let a: int = double(scale)
+			`},
+		{name: "TypeMismatch",
+			input: `
+				import app.util.{double}
+				let a: string = double(2)
+			`,
+			fail: `3:21: can't assign int to string`},
+		{name: "UnknownSymbol",
+			input: `
+				import app.util.{triple}
+			`,
+			fail: `2:5: unknown symbol "triple" in module "app.util"`},
+		{name: "UnknownModule",
+			input: `
+				import app.other
+			`,
+			fail: `2:5: module "app.other" has not been analysed`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			_, err = AnalyseWithImports(ast, modules)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestDeprecation(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		warnings []string
+		fail     string
+	}{
+		{name: "UseSites",
+			input: `
+				@deprecated("use g")
+				fn f(): int { return 1 }
+
+				@deprecated
+				class Old {}
+
+				fn g(o: Old): int {
+					return f()
+				}
+				let a = f()
+			`,
+			warnings: []string{
+				`8:13: "Old" is deprecated`,
+				`11:13: "f" is deprecated: use g`,
+				`9:13: "f" is deprecated: use g`,
+			}},
+		{name: "SuppressedInDeprecatedCode",
+			input: `
+				@deprecated
+				fn f(): int { return 1 }
+
+				@deprecated
+				fn g(): int { return f() }
+
+				@deprecated
+				let a = f()
+			`},
+		{name: "UnknownAnnotation",
+			input: `
+				@frobnicate
+				fn f() {}
+			`,
+			fail: "2:5: unknown annotation @frobnicate"},
+		{name: "InvalidMessage",
+			input: `
+				@deprecated(1)
+				fn f() {}
+			`,
+			fail: "2:17: @deprecated message must be a string literal"},
+		{name: "Experimental",
+			input: `
+				@experimental
+				fn f(): int { return 1 }
+				let a = f()
+			`},
+		{name: "ExperimentalWithArguments",
+			input: `
+				@experimental(1)
+				fn f() {}
+			`,
+			fail: "2:5: @experimental takes no arguments"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			program, err := Analyse(ast)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+			warnings := []string{}
+			for _, warning := range program.Warnings {
+				warnings = append(warnings, warning.Error())
+			}
+			if test.warnings == nil {
+				test.warnings = []string{}
+			}
+			require.Equal(t, test.warnings, warnings)
+		})
+	}
+}
+
 func normaliseCase(in types.Reference) {
 	in.(types.NamedType).Typ.(*types.Case).Enum = nil
 }
@@ -708,3 +1967,271 @@ func resolve(root *Scope, key string) types.Reference {
 	}
 	return ref
 }
+
+func TestEmbeddedValidators(t *testing.T) {
+	RegisterEmbeddedValidator("upper", func(embedded *parser.Embedded) error {
+		if i := strings.IndexFunc(embedded.Content, unicode.IsLower); i >= 0 {
+			return participle.Errorf(embedded.PositionOf(i), "unexpected lower case %q", embedded.Content[i])
+		}
+		return nil
+	})
+	RegisterEmbeddedValidator("nonempty", func(embedded *parser.Embedded) error {
+		if embedded.Content == "" {
+			return errors.New("must not be empty")
+		}
+		return nil
+	})
+	defer delete(embeddedValidators, "upper")
+	defer delete(embeddedValidators, "nonempty")
+	tests := []struct {
+		name  string
+		input string
+		fail  string
+	}{
+		{name: "Valid",
+			input: "let a: string = upper`ABC`\nlet b = other`anything`\n"},
+		{name: "PositionedError",
+			input: "let a = upper`AB\n CdE`\n",
+			fail:  "2:3: invalid initial value for \"a\": invalid upper: unexpected lower case 'd'"},
+		{name: "UnpositionedError",
+			input: "let a = nonempty``\n",
+			fail:  "1:18: invalid initial value for \"a\": invalid nonempty: must not be empty"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			_, err = Analyse(ast)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHTMLTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		warnings []string
+		fail     string
+	}{
+		{name: "Interpolation",
+			input: `
+				pub fn f(name: string): string {
+					return "<b>{name}</b>"
+				}
+			`,
+			warnings: []string{"3:13: string interpolation into markup is not escaped, use an html template"}},
+		{name: "URLAttribute",
+			input: `
+				pub fn f(url: string): string {
+					return html"<a href='{url}'>link</a>"
+				}
+			`,
+			fail: "3:13: interpolation into the start of href attribute can not be escaped"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			program, err := Analyse(ast)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+			warnings := []string{}
+			for _, warning := range program.Warnings {
+				warnings = append(warnings, warning.Error())
+			}
+			require.Equal(t, test.warnings, warnings)
+		})
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	source := `class Vector<T> {
+	let x: int
+	fn add(other: Vector<T>): int {
+		return x + other.x
+	}
+}
+enum Shape {
+	case circle(int)
+	case none
+}
+fn area(shape: Shape): int {
+	switch shape {
+	case .circle(r):
+		return r
+	case .none:
+		return 0
+	}
+}
+let total = area(Shape.none)
+`
+	ast, err := parser.ParseString(source)
+	require.NoError(t, err)
+	program, err := Analyse(ast)
+	require.NoError(t, err)
+	tokens, err := program.SemanticTokens(source)
+	require.NoError(t, err)
+	actual := []string{}
+	for _, token := range tokens {
+		decl := ""
+		if token.Declaration {
+			decl = " declaration"
+		}
+		actual = append(actual, fmt.Sprintf("%d:%d %s %s%s", token.Pos.Line, token.Pos.Column, token.Value, token.Type, decl))
+	}
+	require.Equal(t, []string{
+		"1:7 Vector class declaration",
+		"1:14 T typeParameter declaration",
+		"2:6 x property declaration",
+		"2:9 int type",
+		"3:5 add method declaration",
+		"3:9 other parameter declaration",
+		"3:16 Vector class",
+		"3:23 T typeParameter",
+		"3:28 int type",
+		"4:10 x property",
+		"4:14 other parameter",
+		"4:20 x property",
+		"7:6 Shape enum declaration",
+		"8:7 circle enumMember declaration",
+		"8:14 int type",
+		"9:7 none enumMember declaration",
+		"11:4 area function declaration",
+		"11:9 shape parameter declaration",
+		"11:16 Shape enum",
+		"11:24 int type",
+		"12:9 shape parameter",
+		"13:8 circle enumMember",
+		"13:15 r variable declaration",
+		"14:10 r variable",
+		"15:8 none enumMember",
+		"19:5 total variable declaration",
+		"19:13 area function",
+		"19:18 Shape enum",
+		"19:24 none enumMember",
+	}, actual)
+
+	require.Equal(t, []uint32{
+		0, 6, 6, uint32(SemanticClass), 1,
+		0, 7, 1, uint32(SemanticTypeParameter), 1,
+		1, 5, 1, uint32(SemanticProperty), 1,
+	}, tokens[:3].Encode(source))
+}
+
+func TestHoverInfo(t *testing.T) {
+	source := `// A Vector of values.
+class Vector<T> {
+	// X coordinate.
+	let x: int
+	fn add(other: Vector<T>): int {
+		return x + other.x
+	}
+}
+enum Shape {
+	// A circle of a radius.
+	case circle(int)
+	case none
+}
+// Area of a shape.
+@deprecated("use size")
+fn area(shape: Shape): int {
+	return 0
+}
+const total = area(Shape.circle(1))
+`
+	ast, err := parser.ParseString(source)
+	require.NoError(t, err)
+	program, err := Analyse(ast)
+	require.NoError(t, err)
+	tests := []struct {
+		name     string
+		line     int
+		column   int
+		expected *Hover
+	}{
+		{name: "Class", line: 2, column: 8,
+			expected: &Hover{Type: "Vector", Signature: "class Vector<T>", Doc: "A Vector of values."}},
+		{name: "TypeParameter", line: 5, column: 23,
+			expected: &Hover{Type: "T", Signature: "T"}},
+		{name: "Property", line: 4, column: 6,
+			expected: &Hover{Type: "int", Signature: "let x: int", Doc: "X coordinate."}},
+		{name: "Field", line: 6, column: 20,
+			expected: &Hover{Type: "int", Signature: "let x: int", Doc: "X coordinate."}},
+		{name: "Parameter", line: 6, column: 15,
+			expected: &Hover{Type: "Vector<T>", Signature: "other: Vector<T>"}},
+		{name: "Function", line: 19, column: 15,
+			expected: &Hover{Type: "fn(shape: enum): int", Signature: "fn area(shape: Shape): int", Doc: "Area of a shape."}},
+		{name: "EnumCase", line: 19, column: 26,
+			expected: &Hover{Type: "case", Signature: "case circle(int)", Doc: "A circle of a radius."}},
+		{name: "Constant", line: 19, column: 7,
+			expected: &Hover{Type: "int", Signature: "const total: int"}},
+		{name: "Builtin", line: 4, column: 9,
+			expected: &Hover{Type: "int"}},
+		{name: "Keyword", line: 4, column: 2},
+	}
+	for _, test := range tests {
+		// nolint: scopelint
+		t.Run(test.name, func(t *testing.T) {
+			hover, err := program.HoverInfo(source, test.line, test.column)
+			require.NoError(t, err)
+			if hover != nil {
+				hover.Pos, hover.EndPos = lexer.Position{}, lexer.Position{}
+			}
+			require.Equal(t, test.expected, hover)
+		})
+	}
+
+	hover, err := program.HoverInfo(source, 16, 4)
+	require.NoError(t, err)
+	require.Equal(t, "```langx\nfn area(shape: Shape): int\n```\n\nArea of a shape.", hover.Markdown())
+}
+
+func TestConstants(t *testing.T) {
+	ast, err := parser.ParseString(`
+const size = 4 * 1024
+let blocks = size / 512 + 1
+const ratio = 1.5 * 2
+let fraction = 7 / 2
+const hello = "hello"
+let big = size > 1000 && -size < 0
+let counter = blocks + 1
+const interpolated = "{size}"
+`)
+	require.NoError(t, err)
+	program, err := Analyse(ast)
+	require.NoError(t, err)
+	constants := map[string]string{}
+	for _, decl := range ast.Declarations {
+		for _, asgn := range decl.Var.Vars {
+			constant := program.Constant(asgn.Default)
+			switch {
+			case constant == nil:
+				constants[asgn.Name] = "<nil>"
+			case constant.Number != nil:
+				constants[asgn.Name] = constant.Number.String()
+			case constant.Str != nil:
+				constants[asgn.Name] = strconv.Quote(constant.Str.Fragments[0].String)
+			case constant.Bool != nil:
+				constants[asgn.Name] = strconv.FormatBool(bool(*constant.Bool))
+			}
+		}
+	}
+	require.Equal(t, map[string]string{
+		"size":         "4096",
+		"blocks":       "9",
+		"ratio":        "3.0",
+		"fraction":     "<nil>",
+		"hello":        `"hello"`,
+		"big":          "true",
+		"counter":      "<nil>", // blocks is not constant.
+		"interpolated": "<nil>",
+	}, constants)
+}
@@ -0,0 +1,98 @@
+package analyser
+
+import (
+	"github.com/alecthomas/participle"
+
+	"github.com/alecthomas/langx/constant"
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// Constant returns the value of the default of a variable declaration, as
+// evaluated during analysis, or nil if it is not a constant expression.
+//
+// Constant expressions are literals of numbers, strings without interpolation,
+// characters and booleans, references to constants, and operators applied to
+// them. Integer division that is not exact is not evaluated, as the result
+// depends on whether the operands are used as integers or floats.
+func (p *Program) Constant(expr *parser.Expr) *parser.Literal {
+	return p.constants[expr]
+}
+
+// Evaluate a variable's default value at check time.
+//
+// Constant expressions that overflow or divide by zero are errors.
+func (a *analyser) evalConstant(expr *parser.Expr) (*parser.Literal, error) {
+	if expr.Unary != nil {
+		return a.evalUnary(expr.Unary)
+	}
+	left, err := a.evalConstant(expr.Operand())
+	if err != nil {
+		return nil, err
+	}
+	right, err := a.evalConstant(expr.Right)
+	if err != nil || left == nil || right == nil {
+		return nil, err
+	}
+	literal, err := constant.Binary(expr.Op, left, right)
+	if err != nil {
+		return nil, participle.Errorf(expr.Pos, "%s", err)
+	}
+	if expr.Chained && literal != nil {
+		prev, err := a.evalConstant(expr.Left)
+		if err != nil || prev == nil {
+			return nil, err
+		}
+		return constant.Binary(parser.OpAnd, prev, literal)
+	}
+	return literal, nil
+}
+
+func (a *analyser) evalUnary(unary *parser.Unary) (*parser.Literal, error) {
+	ref := unary.Reference
+	if ref.Next != nil || ref.Optional {
+		return nil, nil
+	}
+	var (
+		literal *parser.Literal
+		err     error
+	)
+	switch terminal := ref.Terminal; {
+	case len(terminal.Tuple) == 1:
+		literal, err = a.evalConstant(terminal.Tuple[0])
+
+	case terminal.Ident != "":
+		if value, ok := a.p.Actual(terminal).(*types.Value); ok {
+			literal = a.constants[value]
+		}
+
+	case terminal.Literal != nil:
+		literal = constantLiteral(terminal.Literal)
+	}
+	if err != nil || literal == nil {
+		return nil, err
+	}
+	return constant.Unary(unary.Op, literal), nil
+}
+
+// The literal if it is a constant, with strings reduced to a single fragment.
+func constantLiteral(literal *parser.Literal) *parser.Literal {
+	switch {
+	case literal.Number != nil, literal.Char != nil, literal.Bool != nil:
+		return literal
+
+	case literal.Str != nil:
+		s := ""
+		for _, fragment := range literal.Str.Fragments {
+			if fragment.Expr != nil {
+				return nil
+			}
+			s += fragment.String
+		}
+		return &parser.Literal{Str: &parser.String{
+			Raw:       literal.Str.Raw,
+			Fragments: []parser.StringFragment{{String: s}},
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package analyser
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// Check the annotations on a root declaration, returning whether it is deprecated
+// and the optional deprecation message.
+func (a *analyser) checkAnnotations(annotations parser.Annotations) (deprecated bool, message string, err error) {
+	for _, annotation := range annotations {
+		switch annotation.Name {
+		case "deprecated":
+			deprecated = true
+			switch len(annotation.Arguments) {
+			case 0:
+			case 1:
+				var ok bool
+				message, ok = stringLiteral(annotation.Arguments[0])
+				if !ok {
+					return false, "", participle.Errorf(annotation.Arguments[0].Pos, "@deprecated message must be a string literal")
+				}
+			default:
+				return false, "", participle.Errorf(annotation.Pos, "@deprecated takes at most one argument")
+			}
+
+		case "experimental":
+			// Enforced by the loader, as it only applies across module boundaries.
+			if len(annotation.Arguments) != 0 {
+				return false, "", participle.Errorf(annotation.Pos, "@experimental takes no arguments")
+			}
+
+		default:
+			return false, "", participle.Errorf(annotation.Pos, "unknown annotation @%s", annotation.Name)
+		}
+	}
+	return deprecated, message, nil
+}
+
+// Record the symbols declared by decl as deprecated.
+func (a *analyser) deprecate(scope *Scope, decl *parser.RootDecl, message string) {
+	for _, name := range decl.Names() {
+		if ref := scope.Resolve(name); ref != nil {
+			a.deprecated[ref] = message
+		}
+	}
+}
+
+// Warn if ref is deprecated, unless we're within deprecated code.
+func (a *analyser) checkDeprecated(pos lexer.Position, name string, ref types.Reference) {
+	if a.inDeprecated {
+		return
+	}
+	// Only declared symbols can be deprecated, and not all references are hashable.
+	switch ref.(type) {
+	case *types.Function, *types.ClassType, *types.Enum, *types.Value:
+	default:
+		return
+	}
+	message, ok := a.deprecated[ref]
+	// Some nodes are resolved more than once, so only warn once per position.
+	if !ok || a.warned[pos] {
+		return
+	}
+	a.warned[pos] = true
+	warning := parser.Diagnostic{Severity: parser.SeverityWarning, Code: "deprecated", Pos: pos}
+	if message != "" {
+		warning.Message = fmt.Sprintf("%q is deprecated: %s", name, message)
+	} else {
+		warning.Message = fmt.Sprintf("%q is deprecated", name)
+	}
+	a.p.Warnings = append(a.p.Warnings, warning)
+}
+
+// Returns the value of expr if it is a string literal without interpolation.
+func stringLiteral(expr *parser.Expr) (string, bool) {
+	if expr.Unary == nil || expr.Unary.Op != 0 || expr.Unary.Reference.Next != nil {
+		return "", false
+	}
+	literal := expr.Unary.Reference.Terminal.Literal
+	if literal == nil || literal.Str == nil {
+		return "", false
+	}
+	out := ""
+	for _, fragment := range literal.Str.Fragments {
+		if fragment.Expr != nil {
+			return "", false
+		}
+		out += fragment.String
+	}
+	return out, true
+}
@@ -0,0 +1,39 @@
+package analyser
+
+import (
+	"github.com/alecthomas/participle"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+// An EmbeddedValidator checks the content of embedded blocks, eg. sql`SELECT 1`.
+//
+// Errors may be positioned within the content with Embedded.PositionOf,
+// otherwise they are reported at the start of the content.
+type EmbeddedValidator func(embedded *parser.Embedded) error
+
+var embeddedValidators = map[string]EmbeddedValidator{}
+
+// Tags supported by templates, eg. html"<p>{name}</p>".
+//
+// Code generators escape interpolated values according to the tag.
+var templateTags = map[string]bool{"html": true}
+
+// RegisterEmbeddedValidator registers a validator for embedded blocks with the given tag.
+//
+// Blocks with tags that have no validator are not checked. Validators should be
+// registered during initialisation.
+func RegisterEmbeddedValidator(tag string, validator EmbeddedValidator) {
+	embeddedValidators[tag] = validator
+}
+
+func checkEmbedded(embedded *parser.Embedded) error {
+	validator, ok := embeddedValidators[embedded.Tag]
+	if !ok {
+		return nil
+	}
+	if err := validator(embedded); err != nil {
+		return participle.Wrapf(embedded.ContentPos, err, "invalid %s", embedded.Tag)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package analyser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// Hover describes the symbol declared or referred to by an identifier, for
+// display by an editor.
+type Hover struct {
+	// Span of the identifier.
+	Pos    lexer.Position
+	EndPos lexer.Position
+	// Type of the symbol, eg. "int" or "fn(a: int): int".
+	Type string
+	// Signature of the symbol's declaration, eg. "fn area(shape: Shape): int",
+	// if it is declared in the program.
+	Signature string
+	// Doc is the comment on the lines preceding the declaration, without
+	// comment markers.
+	Doc string
+}
+
+// Markdown renders the hover as a code block of the signature, or type if
+// there is none, followed by the documentation.
+func (h *Hover) Markdown() string {
+	code := h.Signature
+	if code == "" {
+		code = h.Type
+	}
+	out := "```langx\n" + code + "\n```"
+	if h.Doc != "" {
+		out += "\n\n" + h.Doc
+	}
+	return out
+}
+
+// HoverInfo describes the identifier at the 1-based line and column of source,
+// from which the program was parsed.
+//
+// It returns nil if there is no identifier there, or it was not resolved.
+func (p *Program) HoverInfo(source string, line, column int) (*Hover, error) {
+	s, err := p.classify(source)
+	if err != nil {
+		return nil, err
+	}
+	var token parser.Token
+	for _, ident := range s.idents {
+		if ident.Pos.Line == line && ident.Pos.Column <= column && column < ident.EndPos.Column {
+			token = ident
+			break
+		}
+	}
+	ref := s.refs[token.Pos.Offset]
+	if ref == nil {
+		return nil, nil
+	}
+	hover := &Hover{
+		Pos:    token.Pos,
+		EndPos: token.EndPos,
+		Type:   types.Describe(ref.Type()),
+	}
+	decls := p.declarations(source)
+	decl, ok := decls[symbol{ref, token.Value}]
+	if owner := s.owners[token.Pos.Offset]; owner != nil {
+		if spec, isSpec := owner.(*types.Specialisation); isSpec {
+			owner = spec.Typ
+		}
+		if member, isMember := decls[symbol{owner, token.Value}]; isMember {
+			decl, ok = member, true
+		}
+	}
+	if ok {
+		hover.Signature = decl.signature
+		hover.Doc = decl.doc
+	}
+	return hover, nil
+}
+
+// A symbol declared by name in the scope of ref, or as a member of ref if it
+// is a type.
+type symbol struct {
+	ref  types.Reference
+	name string
+}
+
+type declaration struct {
+	signature string
+	doc       string
+}
+
+// Index the declarations of the program by symbol.
+func (p *Program) declarations(source string) map[symbol]declaration {
+	decls := map[symbol]declaration{}
+	add := func(ref types.Reference, name, signature string, node parser.Node, ancestors []parser.Node) {
+		if ref == nil {
+			return
+		}
+		decl := declaration{signature: signature}
+		if node != nil {
+			decl.doc = docComment(source, declarationStart(node, ancestors).Offset)
+		}
+		decls[symbol{ref, name}] = decl
+		// Members are also indexed by the type declaring them.
+		if owner := memberOwner(p, ancestors); owner != nil {
+			decls[symbol{owner, name}] = decl
+		}
+	}
+	_ = parser.Inspect(p.AST, func(node parser.Node, ancestors []parser.Node) bool {
+		switch node := node.(type) {
+		case *parser.String:
+			return false
+
+		case *parser.ClassDecl:
+			add(p.Resolved(node), node.Type.Type, span(source, node, node.Type), node, ancestors)
+
+		case *parser.EnumDecl:
+			add(p.Resolved(node), node.Type.Type, span(source, node, node.Type), node, ancestors)
+
+		case *parser.NamedTypeDecl:
+			for _, param := range node.TypeParameter {
+				add(p.Resolved(param), param.Name, span(source, param, param), nil, nil)
+			}
+
+		case *parser.CaseDecl:
+			add(p.Resolved(node), node.Name, span(source, node, node), node, ancestors)
+
+		case *parser.FuncDecl:
+			signature := strings.TrimSpace(source[node.Pos.Offset:node.Body.Pos.Offset])
+			add(p.Resolved(node), node.Name, signature, node, ancestors)
+			p.declareParameters(add, node.Parameters)
+
+		case *parser.InitialiserDecl:
+			p.declareParameters(add, node.Parameters)
+
+		case *parser.VarDecl:
+			keyword := "let"
+			if node.Const {
+				keyword = "const"
+			}
+			for _, asgn := range node.Vars {
+				ref := p.Resolved(asgn)
+				if asgn.Pattern != nil || ref == nil {
+					continue
+				}
+				signature := fmt.Sprintf("%s %s: %s", keyword, asgn.Name, types.Describe(ref.Type()))
+				add(ref, asgn.Name, signature, node, ancestors)
+			}
+		}
+		return true
+	})
+	return decls
+}
+
+func (p *Program) declareParameters(add func(types.Reference, string, string, parser.Node, []parser.Node), parameters []*parser.Parameters) {
+	for _, param := range parameters {
+		ref := p.Resolved(param)
+		if ref == nil {
+			continue
+		}
+		for _, name := range param.Names {
+			add(ref, name, fmt.Sprintf("%s: %s", name, types.Describe(ref.Type())), nil, nil)
+		}
+	}
+}
+
+// The type declaring a member, if the node with the given ancestors is one.
+func memberOwner(p *Program, ancestors []parser.Node) types.Type {
+	if len(ancestors) < 2 {
+		return nil
+	}
+	switch ancestors[len(ancestors)-1].(type) {
+	case *parser.ClassMember, *parser.EnumMember:
+		return p.ResolvedType(ancestors[len(ancestors)-2])
+	}
+	return nil
+}
+
+// The start of a declaration, including any annotations and modifiers.
+func declarationStart(node parser.Node, ancestors []parser.Node) lexer.Position {
+	if len(ancestors) > 0 {
+		switch parent := ancestors[len(ancestors)-1].(type) {
+		case *parser.RootDecl, *parser.ClassMember, *parser.EnumMember:
+			return parent.Position()
+		}
+	}
+	return node.Position()
+}
+
+// The source from the start of node to the end of last.
+func span(source string, node, last parser.Node) string {
+	return source[node.Position().Offset:last.EndPosition().Offset]
+}
+
+// The line comments immediately preceding the line containing offset, without
+// their markers.
+func docComment(source string, offset int) string {
+	lines := strings.Split(source[:strings.LastIndexByte(source[:offset], '\n')+1], "\n")
+	doc := []string{}
+	// The final line is the empty remainder following the last newline.
+	for i := len(lines) - 2; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		doc = append([]string{strings.TrimPrefix(strings.TrimPrefix(line, "//"), " ")}, doc...)
+	}
+	return strings.Join(doc, "\n")
+}
@@ -0,0 +1,77 @@
+package analyser
+
+import (
+	"sort"
+
+	"github.com/alecthomas/participle"
+
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// Declare the symbols imported by ast in scope.
+//
+// Selected and wildcard imports declare the symbols of the module, and other
+// imports declare a namespace named by the alias or the last component of the
+// module path.
+func declareImports(scope *Scope, ast *parser.AST, modules map[string]*Program) error {
+	for _, decl := range ast.Declarations {
+		imp := decl.Import
+		if imp == nil {
+			continue
+		}
+		module, ok := modules[imp.Module()]
+		if !ok {
+			return participle.Errorf(imp.Pos, "module %q has not been analysed", imp.Module())
+		}
+		symbols := module.Root.Symbols()
+		names := make([]string, 0, len(symbols))
+		for name := range symbols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		switch {
+		case imp.Qualified != nil && imp.Qualified.Wildcard:
+			for _, name := range names {
+				if err := declareImport(scope, imp, name, symbols[name]); err != nil {
+					return err
+				}
+			}
+
+		case imp.Qualified != nil && len(imp.Qualified.Symbols) > 0:
+			for _, name := range imp.Qualified.Symbols {
+				ref, ok := symbols[name]
+				if !ok {
+					return participle.Errorf(imp.Pos, "unknown symbol %q in module %q", name, imp.Module())
+				}
+				if err := declareImport(scope, imp, name, ref); err != nil {
+					return err
+				}
+			}
+
+		default:
+			namespace := &types.Module{Name: imp.Module()}
+			for _, name := range names {
+				namespace.Flds = append(namespace.Flds, types.NamedType{Nme: name, Typ: symbols[name].Type()})
+			}
+			if err := declareImport(scope, imp, imp.Namespace(), namespace); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func declareImport(scope *Scope, imp *parser.ImportDecl, name string, ref types.Reference) error {
+	var err error
+	switch ref := ref.(type) {
+	case *types.Value:
+		err = scope.AddValue(name, ref)
+	case types.Type:
+		err = scope.AddType(name, ref)
+	}
+	if err != nil {
+		return participle.Errorf(imp.Pos, "%s", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package analyser
+
+import (
+	"github.com/alecthomas/participle"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+// A statement that can be the target of a break or continue.
+type breakable struct {
+	label string
+	loop  bool
+	// Function boundary, which labels can not cross.
+	fn bool
+	// Do expression boundary, which no control statement can cross.
+	do bool
+}
+
+// Check that break and continue statements are within a loop or switch, and that
+// their labels resolve to an enclosing statement of the correct kind.
+//
+// A do expression must evaluate to its final expression, so break, continue and
+// return can not leave one.
+func checkLabels(ast *parser.AST) error {
+	stack := []breakable{}
+	push := func(b breakable) func() {
+		stack = append(stack, b)
+		return func() { stack = stack[:len(stack)-1] }
+	}
+	return parser.VisitFunc(ast, func(node parser.Node, next parser.Next) error {
+		switch node := node.(type) {
+		case *parser.FuncDecl, *parser.InitialiserDecl, *parser.Closure:
+			defer push(breakable{fn: true})()
+
+		case *parser.DoExpr:
+			defer push(breakable{fn: true, do: true})()
+
+		case parser.ReturnStmt:
+			if inDoExpr(stack) {
+				return participle.Errorf(node.Pos, "return can not be used within a do expression")
+			}
+
+		case parser.Stmt:
+			label := string(node.Label)
+			if label != "" {
+				if node.For == nil && node.Switch == nil {
+					return participle.Errorf(node.Pos, "label %q can only be applied to for and switch statements", label)
+				}
+				if target := findBreakable(stack, label, false); target != nil {
+					return participle.Errorf(node.Pos, "label %q is already defined", label)
+				}
+			}
+			if node.For != nil || node.Switch != nil {
+				defer push(breakable{label: label, loop: node.For != nil})()
+			}
+
+		case parser.BreakStmt:
+			target := findBreakable(stack, node.Label, false)
+			switch {
+			case target != nil:
+			case inDoExpr(stack):
+				return participle.Errorf(node.Pos, "break can not leave a do expression")
+			case node.Label != "":
+				return participle.Errorf(node.Pos, "unknown label %q", node.Label)
+			default:
+				return participle.Errorf(node.Pos, "break is not in a loop or switch")
+			}
+
+		case parser.ContinueStmt:
+			target := findBreakable(stack, node.Label, true)
+			switch {
+			case target != nil && target.loop:
+			case target != nil:
+				return participle.Errorf(node.Pos, "continue label %q does not refer to a loop", node.Label)
+			case inDoExpr(stack):
+				return participle.Errorf(node.Pos, "continue can not leave a do expression")
+			case node.Label != "":
+				return participle.Errorf(node.Pos, "unknown label %q", node.Label)
+			default:
+				return participle.Errorf(node.Pos, "continue is not in a loop")
+			}
+		}
+		return next(nil)
+	})
+}
+
+// Find the innermost enclosing breakable statement with the given label, or if label
+// is empty, the innermost breakable statement (loops only if loop is true).
+//
+// The search stops at function boundaries.
+func findBreakable(stack []breakable, label string, loop bool) *breakable {
+	for i := len(stack) - 1; i >= 0; i-- {
+		b := &stack[i]
+		switch {
+		case b.fn:
+			return nil
+		case label != "" && b.label == label:
+			return b
+		case label == "" && (b.loop || !loop):
+			return b
+		}
+	}
+	return nil
+}
+
+// Returns true if the innermost boundary is a do expression.
+func inDoExpr(stack []breakable) bool {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].fn {
+			return stack[i].do
+		}
+	}
+	return false
+}
@@ -1,28 +1,87 @@
 package analyser
 
 import (
+	"github.com/alecthomas/participle/lexer"
+
 	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/std/html"
 	"github.com/alecthomas/langx/types"
 )
 
 // Program represents the type analysis of an associated AST.
 type Program struct {
-	AST      *parser.AST
+	AST *parser.AST
+	// Imports is the scope of symbols imported from other modules, the parent
+	// of Root.
+	Imports  *Scope
 	Root     *Scope
 	resolved map[parser.Node]types.Reference
 	actual   map[parser.Node]types.Reference
+	// Types of which terminals reference fields.
+	owners map[*parser.Terminal]types.Type
+	// Values of variable defaults that are constant expressions.
+	constants map[*parser.Expr]*parser.Literal
+	// Warnings are non-fatal diagnostics, such as uses of deprecated symbols.
+	Warnings parser.Diagnostics
 }
 
 // Analyse performs semantic analysis on the AST.
+//
+// Imports are not resolved, so uses of imported symbols are errors. See
+// AnalyseWithImports.
 func Analyse(ast *parser.AST) (*Program, error) {
+	return analyse(ast, nil)
+}
+
+// AnalyseWithImports performs semantic analysis on the AST, resolving its
+// imports against the analysed programs of the modules they refer to, keyed
+// by module path.
+func AnalyseWithImports(ast *parser.AST, modules map[string]*Program) (*Program, error) {
+	return analyse(ast, modules)
+}
+
+func analyse(ast *parser.AST, modules map[string]*Program) (*Program, error) {
+	imports := makeScope(builtins, nil)
 	p := &Program{
-		AST:      ast,
-		Root:     makeScope(builtins, nil),
-		resolved: map[parser.Node]types.Reference{},
-		actual:   map[parser.Node]types.Reference{},
+		AST:       ast,
+		Imports:   imports,
+		Root:      makeScope(imports, nil),
+		resolved:  map[parser.Node]types.Reference{},
+		actual:    map[parser.Node]types.Reference{},
+		owners:    map[*parser.Terminal]types.Type{},
+		constants: map[*parser.Expr]*parser.Literal{},
+	}
+	if err := checkLabels(ast); err != nil {
+		return p, parser.ToDiagnostic(err)
+	}
+	if modules != nil {
+		if err := declareImports(imports, ast, modules); err != nil {
+			return p, parser.ToDiagnostic(err)
+		}
+	}
+	a := &analyser{
+		p:          p,
+		deprecated: map[types.Reference]string{},
+		warned:     map[lexer.Position]bool{},
+		constants:  map[*types.Value]*parser.Literal{},
+	}
+	if err := a.checkRoot(p.Root, p.AST); err != nil {
+		return p, parser.ToDiagnostic(err)
 	}
-	a := &analyser{p: p}
-	return p, a.checkRoot(p.Root, p.AST)
+	if err := checkReturns(ast); err != nil {
+		return p, parser.ToDiagnostic(err)
+	}
+	warnings, err := html.Check(ast)
+	if err != nil {
+		return p, parser.ToDiagnostic(err)
+	}
+	for _, err := range warnings {
+		warning := *parser.ToDiagnostic(err)
+		warning.Severity = parser.SeverityWarning
+		warning.Code = "html"
+		p.Warnings = append(p.Warnings, warning)
+	}
+	return p, nil
 }
 
 // Associate an AST node with a type reference.
@@ -75,6 +134,22 @@ func (p *Program) Actual(node parser.Node) types.Reference {
 	return p.actual[node]
 }
 
+// Derive associates node, created after analysis, such as by a desugaring
+// pass, with the references of the node it was derived from.
+func (p *Program) Derive(node, from parser.Node) {
+	if ref, ok := p.resolved[from]; ok {
+		p.resolved[node] = ref
+	}
+	if ref, ok := p.actual[from]; ok {
+		p.actual[node] = ref
+	}
+}
+
+// Owner returns the type whose field a terminal references (if any).
+func (p *Program) Owner(terminal *parser.Terminal) types.Type {
+	return p.owners[terminal]
+}
+
 // ActualType returns the concrete type reference for an AST Node.
 func (p *Program) ActualType(node parser.Node) types.Type {
 	t, _ := p.actual[node].(types.Type)
@@ -0,0 +1,64 @@
+package analyser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+
+	"github.com/alecthomas/langx/cfg"
+	"github.com/alecthomas/langx/parser"
+)
+
+// Check that every path through a function with a declared return type ends
+// in a return statement.
+func checkReturns(ast *parser.AST) error {
+	for _, graph := range cfg.Build(ast) {
+		fn, ok := graph.Decl.(*parser.FuncDecl)
+		if !ok || fn.Return == nil {
+			continue
+		}
+		paths := []string{}
+		related := []parser.RelatedInfo{}
+		seen := map[*cfg.Block]bool{}
+		for _, block := range graph.Exit.Preds {
+			if block.Return() == nil {
+				for _, pos := range fallthroughPositions(fn, block, seen) {
+					paths = append(paths, fmt.Sprintf("%d:%d", pos.Line, pos.Column))
+					related = append(related, parser.RelatedInfo{Pos: pos, Message: "path ends without returning"})
+				}
+			}
+		}
+		if len(paths) > 0 {
+			return &parser.Diagnostic{
+				Severity:    parser.SeverityError,
+				Code:        "missing-return",
+				Message:     fmt.Sprintf("missing return at end of %q, reached from %s", graph.Name, strings.Join(paths, ", ")),
+				Pos:         fn.Pos,
+				RelatedInfo: related,
+			}
+		}
+	}
+	return nil
+}
+
+// Positions of the last statement or expression executed on each path
+// through block, which is empty on paths merging from preceding blocks.
+func fallthroughPositions(fn *parser.FuncDecl, block *cfg.Block, seen map[*cfg.Block]bool) []lexer.Position {
+	if seen[block] || !block.Live {
+		return nil
+	}
+	seen[block] = true
+	if len(block.Nodes) > 0 {
+		return []lexer.Position{block.Nodes[len(block.Nodes)-1].Position()}
+	}
+	if len(block.Preds) == 0 {
+		// The function body is empty.
+		return []lexer.Position{fn.Pos}
+	}
+	out := []lexer.Position{}
+	for _, pred := range block.Preds {
+		out = append(out, fallthroughPositions(fn, pred, seen)...)
+	}
+	return out
+}
@@ -0,0 +1,382 @@
+package analyser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// SemanticTokenType classifies an identifier for semantic highlighting.
+type SemanticTokenType int
+
+const (
+	SemanticType SemanticTokenType = iota
+	SemanticClass
+	SemanticEnum
+	SemanticTypeParameter
+	SemanticParameter
+	SemanticVariable
+	SemanticProperty
+	SemanticEnumMember
+	SemanticFunction
+	SemanticMethod
+)
+
+// SemanticTokenTypes is the legend of token types, indexed by
+// SemanticTokenType, as registered with a Language Server Protocol client.
+var SemanticTokenTypes = []string{
+	"type", "class", "enum", "typeParameter", "parameter", "variable",
+	"property", "enumMember", "function", "method",
+}
+
+// SemanticTokenModifiers is the legend of token modifiers, as registered with
+// a Language Server Protocol client.
+var SemanticTokenModifiers = []string{"declaration"}
+
+func (s SemanticTokenType) String() string { return SemanticTokenTypes[s] }
+
+// A SemanticToken is a classified identifier.
+type SemanticToken struct {
+	parser.Token
+	Type SemanticTokenType
+	// Declaration is true if the token declares the symbol, rather than
+	// referring to it.
+	Declaration bool
+}
+
+// SemanticTokens in source order.
+type SemanticTokens []SemanticToken
+
+// Encode tokens in the relative form of the Language Server Protocol, with
+// positions in UTF-16 code units of source.
+//
+// Each token is encoded as five integers: the line relative to the previous
+// token, the character relative to the previous token if it is on the same
+// line, the length, and the indices of its type and modifiers in
+// SemanticTokenTypes and SemanticTokenModifiers.
+func (s SemanticTokens) Encode(source string) []uint32 {
+	out := make([]uint32, 0, len(s)*5)
+	line, character := 0, 0
+	for _, token := range s {
+		tokenLine := token.Pos.Line - 1
+		lineStart := strings.LastIndexByte(source[:token.Pos.Offset], '\n') + 1
+		tokenCharacter := utf16Len(source[lineStart:token.Pos.Offset])
+		if tokenLine != line {
+			character = 0
+		}
+		modifiers := uint32(0)
+		if token.Declaration {
+			modifiers = 1
+		}
+		out = append(out,
+			uint32(tokenLine-line), uint32(tokenCharacter-character),
+			uint32(utf16Len(token.Value)), uint32(token.Type), modifiers)
+		line, character = tokenLine, tokenCharacter
+	}
+	return out
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r > 0xffff {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// SemanticTokens classifies the identifiers of source, from which the
+// program was parsed.
+//
+// Identifiers that were not resolved, such as those following an analysis
+// error, are omitted unless they are declarations.
+func (p *Program) SemanticTokens(source string) (SemanticTokens, error) {
+	s, err := p.classify(source)
+	if err != nil {
+		return nil, err
+	}
+	out := make(SemanticTokens, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		out = append(out, token)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Pos.Offset < out[j].Pos.Offset })
+	return out, nil
+}
+
+// Classify the identifiers of source.
+func (p *Program) classify(source string) (*semanticTokens, error) {
+	tokens, err := parser.Lex(strings.NewReader(source))
+	if err != nil {
+		return nil, parser.ToDiagnostic(err)
+	}
+	s := &semanticTokens{
+		p:      p,
+		tokens: map[int]SemanticToken{},
+		refs:   map[int]types.Reference{},
+		owners: map[int]types.Type{},
+		values: map[types.Reference]SemanticTokenType{},
+	}
+	for _, token := range tokens {
+		if token.Kind == parser.TokenIdent {
+			s.idents = append(s.idents, token)
+		}
+	}
+	// Declarations are classified first, so that parameters and fields are
+	// known before any references to them.
+	_ = parser.Inspect(p.AST, s.declarations)
+	_ = parser.Inspect(p.AST, s.references)
+	return s, nil
+}
+
+type semanticTokens struct {
+	p      *Program
+	idents []parser.Token
+	// Classified tokens, and the symbols they declare or refer to, by offset.
+	tokens map[int]SemanticToken
+	refs   map[int]types.Reference
+	// Types of which member references are fields, by offset.
+	owners map[int]types.Type
+	// Values declared as parameters or fields.
+	values map[types.Reference]SemanticTokenType
+}
+
+func (s *semanticTokens) declarations(node parser.Node, ancestors []parser.Node) bool {
+	member := false
+	if len(ancestors) > 0 {
+		switch ancestors[len(ancestors)-1].(type) {
+		case *parser.ClassMember, *parser.EnumMember:
+			member = true
+		}
+	}
+	switch node := node.(type) {
+	case *parser.String:
+		// Interpolated expressions are positioned within the string.
+		return false
+
+	case *parser.ClassDecl:
+		s.declare(node.Type, SemanticClass, s.p.Resolved(node), node.Type.Type)
+
+	case *parser.EnumDecl:
+		s.declare(node.Type, SemanticEnum, s.p.Resolved(node), node.Type.Type)
+
+	case *parser.NamedTypeDecl:
+		for _, param := range node.TypeParameter {
+			s.declare(param, SemanticTypeParameter, s.p.Resolved(param), param.Name)
+		}
+
+	case *parser.FuncDecl:
+		if member {
+			s.declare(node, SemanticMethod, s.p.Resolved(node), node.Name)
+		} else {
+			s.declare(node, SemanticFunction, s.p.Resolved(node), node.Name)
+		}
+		s.declareParameters(node.Parameters)
+
+	case *parser.InitialiserDecl:
+		s.declareParameters(node.Parameters)
+
+	case *parser.VarDecl:
+		for _, asgn := range node.Vars {
+			ref := s.p.Resolved(asgn)
+			switch {
+			case asgn.Pattern != nil:
+				s.declare(asgn, SemanticVariable, nil, asgn.Pattern.Names()...)
+			case member:
+				s.declare(asgn, SemanticProperty, ref, asgn.Name)
+				if ref != nil {
+					s.values[ref] = SemanticProperty
+				}
+			default:
+				s.declare(asgn, SemanticVariable, ref, asgn.Name)
+			}
+		}
+
+	case *parser.CaseDecl:
+		s.declare(node, SemanticEnumMember, s.p.Resolved(node), node.Name)
+
+	case parser.IfStmt:
+		if node.Binding != "" {
+			s.declare(node, SemanticVariable, nil, node.Binding)
+		}
+
+	case *parser.Closure:
+		s.declare(node, SemanticParameter, nil, node.Parameters...)
+
+	case parser.EnumCase:
+		if token, ok := s.find(node.Pos.Offset, node.Case); ok {
+			s.add(token, SemanticEnumMember, nil, false)
+		}
+		if node.Var != "" {
+			s.declare(node, SemanticVariable, nil, append([]string{node.Var}, node.Rest...)...)
+		}
+
+	case *parser.CaseField:
+		s.declare(node, SemanticProperty, nil, node.Name)
+	}
+	return true
+}
+
+func (s *semanticTokens) declareParameters(parameters []*parser.Parameters) {
+	for _, param := range parameters {
+		ref := s.p.Resolved(param)
+		s.declare(param, SemanticParameter, ref, param.Names...)
+		if ref != nil {
+			s.values[ref] = SemanticParameter
+		}
+	}
+}
+
+// Classify the successive identifiers with the given names from the start of
+// node, as declarations of ref.
+func (s *semanticTokens) declare(node parser.Node, typ SemanticTokenType, ref types.Reference, names ...string) {
+	offset := node.Position().Offset
+	for _, name := range names {
+		token, ok := s.find(offset, name)
+		if !ok {
+			return
+		}
+		s.add(token, typ, ref, true)
+		offset = token.EndPos.Offset
+	}
+}
+
+func (s *semanticTokens) references(node parser.Node, ancestors []parser.Node) bool {
+	switch node := node.(type) {
+	case *parser.String:
+		return false
+
+	case *parser.Reference:
+		s.reference(node.Terminal, false)
+
+	case *parser.ReferenceNext:
+		s.reference(node.Reference, true)
+
+	// Type declarations outside of expressions.
+	case *parser.CaseDecl:
+		s.typeDecl(node.Type)
+
+	case *parser.CaseField:
+		s.typeDecl(node.Type)
+
+	case *parser.ArrayTypeDecl:
+		s.typeDecl(node.Element)
+
+	case *parser.DictOrSetTypeDecl:
+		s.typeDecl(node.Key)
+		s.typeDecl(node.Value)
+	}
+	return true
+}
+
+func (s *semanticTokens) typeDecl(decl *parser.TypeDecl) {
+	if decl == nil || decl.Named == nil {
+		return
+	}
+	ref := s.p.Actual(decl)
+	if ref == nil {
+		return
+	}
+	if token, ok := s.find(decl.Named.Pos.Offset, decl.Named.Type); ok {
+		s.add(token, typeType(ref), ref, false)
+	}
+}
+
+func (s *semanticTokens) reference(terminal *parser.Terminal, member bool) {
+	if terminal == nil || terminal.Ident == "" {
+		return
+	}
+	ref := s.p.Actual(terminal)
+	if ref == nil {
+		return
+	}
+	token, ok := s.find(terminal.Pos.Offset, terminal.Ident)
+	if !ok {
+		return
+	}
+	var typ SemanticTokenType
+	switch ref := ref.(type) {
+	case *types.Value:
+		typ, ok = s.values[ref]
+		switch {
+		case member:
+			typ = SemanticProperty
+		case !ok:
+			typ = SemanticVariable
+		}
+
+	case types.Field:
+		typ = memberType(ref.Typ)
+
+	case types.NamedType:
+		typ = memberType(ref.Typ)
+
+	case *types.Function, *types.Overloaded:
+		if member {
+			typ = SemanticMethod
+		} else {
+			typ = SemanticFunction
+		}
+
+	default:
+		typ = typeType(ref)
+	}
+	if member {
+		s.owners[token.Pos.Offset] = s.p.owners[terminal]
+	}
+	s.add(token, typ, ref, false)
+}
+
+func memberType(typ types.Type) SemanticTokenType {
+	switch typ.(type) {
+	case *types.Function:
+		return SemanticMethod
+
+	case *types.Case:
+		return SemanticEnumMember
+	}
+	return SemanticProperty
+}
+
+func typeType(ref types.Reference) SemanticTokenType {
+	switch ref.(type) {
+	case *types.ClassType:
+		return SemanticClass
+
+	case *types.Enum:
+		return SemanticEnum
+
+	case *types.Case:
+		return SemanticEnumMember
+
+	case *types.TypeParam:
+		return SemanticTypeParameter
+	}
+	return SemanticType
+}
+
+// The first identifier with the given name at or after offset.
+func (s *semanticTokens) find(offset int, name string) (parser.Token, bool) {
+	i := sort.Search(len(s.idents), func(i int) bool { return s.idents[i].Pos.Offset >= offset })
+	for ; i < len(s.idents); i++ {
+		if s.idents[i].Value == name {
+			return s.idents[i], true
+		}
+	}
+	return parser.Token{}, false
+}
+
+// Classify token as declaring or referring to ref, if it has not already been.
+func (s *semanticTokens) add(token parser.Token, typ SemanticTokenType, ref types.Reference, declaration bool) {
+	if _, ok := s.tokens[token.Pos.Offset]; ok {
+		return
+	}
+	s.tokens[token.Pos.Offset] = SemanticToken{Token: token, Type: typ, Declaration: declaration}
+	if ref != nil {
+		s.refs[token.Pos.Offset] = ref
+	}
+}
@@ -0,0 +1,325 @@
+// Package cfg constructs control flow graphs of function and initialiser bodies.
+//
+// Each graph consists of basic blocks: straight-line sequences of statements
+// and expressions that are always executed together. Control statements end a
+// block, with edges to each block control may transfer to. Every graph has a
+// synthetic exit block, reached by returning or by falling off the end of the
+// body.
+//
+// There is no throw statement, so exceptional control flow is not modelled.
+package cfg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+// Graph is the control flow graph of a single function or initialiser.
+type Graph struct {
+	// Qualified name of the function, eg. "Point.scale", or "Point.init" for initialisers.
+	Name string
+	// Either a *parser.FuncDecl or a *parser.InitialiserDecl.
+	Decl parser.Node
+	// Body the graph was constructed from.
+	Body  *parser.Block
+	Entry *Block
+	Exit  *Block
+	// All blocks, in construction order.
+	Blocks []*Block
+}
+
+// Block is a basic block.
+type Block struct {
+	Index int
+	// Kind describes the block's origin, eg. "if.then" or "for.body".
+	Kind string
+	// Statements in the block, and the expressions evaluated by control
+	// statements, such as if conditions.
+	//
+	// Compound statements are not included themselves, but a return, break or
+	// continue statement is always the last node of its block.
+	Nodes []parser.Node
+	Succs []*Block
+	Preds []*Block
+	// True if the block is reachable from the entry block.
+	Live bool
+}
+
+// Return returns the return statement ending the block, or nil.
+func (b *Block) Return() *parser.ReturnStmt {
+	if len(b.Nodes) == 0 {
+		return nil
+	}
+	if stmt, ok := b.Nodes[len(b.Nodes)-1].(*parser.Stmt); ok {
+		return stmt.Return
+	}
+	return nil
+}
+
+// Build the control flow graphs for all functions and initialisers in ast,
+// including nested functions and class members.
+func Build(ast *parser.AST) []*Graph {
+	graphs := []*Graph{}
+	scope := []string{}
+	push := func(name string) func() {
+		scope = append(scope, name)
+		return func() { scope = scope[:len(scope)-1] }
+	}
+	qualify := func(name string) string {
+		return strings.Join(append(scope[:len(scope):len(scope)], name), ".")
+	}
+	_ = parser.VisitFunc(ast, func(node parser.Node, next parser.Next) error {
+		switch node := node.(type) {
+		case *parser.ClassDecl:
+			defer push(node.Type.Type)()
+
+		case *parser.EnumDecl:
+			defer push(node.Type.Type)()
+
+		case *parser.FuncDecl:
+			graphs = append(graphs, New(qualify(node.Name), node, node.Body))
+			defer push(node.Name)()
+
+		case *parser.InitialiserDecl:
+			graphs = append(graphs, New(qualify("init"), node, node.Body))
+		}
+		return next(nil)
+	})
+	return graphs
+}
+
+// New constructs the control flow graph of body, the body of decl.
+//
+// The statements must have passed label checking, in that every break and
+// continue refers to an enclosing statement.
+func New(name string, decl parser.Node, body *parser.Block) *Graph {
+	g := &Graph{Name: name, Decl: decl, Body: body}
+	b := &builder{graph: g}
+	g.Entry = b.newBlock("entry")
+	g.Exit = &Block{Kind: "exit"}
+	b.current = g.Entry
+	b.stmts(body.Statements)
+	b.jump(g.Exit)
+	g.Exit.Index = len(g.Blocks)
+	g.Blocks = append(g.Blocks, g.Exit)
+	markLive(g.Entry)
+	return g
+}
+
+func markLive(block *Block) {
+	if block.Live {
+		return
+	}
+	block.Live = true
+	for _, succ := range block.Succs {
+		markLive(succ)
+	}
+}
+
+// WriteDot writes the graph in Graphviz dot format.
+func (g *Graph) WriteDot(w io.Writer) error {
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "digraph %q {\n", g.Name)
+	fmt.Fprintf(out, "  node [shape=box];\n")
+	for _, block := range g.Blocks {
+		label := fmt.Sprintf("%d: %s\\l", block.Index, block.Kind)
+		for _, node := range block.Nodes {
+			label += fmt.Sprintf("%s %s\\l", position(node), describe(node))
+		}
+		style := ""
+		if !block.Live {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(out, "  b%d [label=\"%s\"%s];\n", block.Index, label, style)
+	}
+	for _, block := range g.Blocks {
+		for _, succ := range block.Succs {
+			fmt.Fprintf(out, "  b%d -> b%d;\n", block.Index, succ.Index)
+		}
+	}
+	fmt.Fprintf(out, "}\n")
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func position(node parser.Node) string {
+	pos := node.Position()
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
+
+func describe(node parser.Node) string {
+	stmt, ok := node.(*parser.Stmt)
+	if !ok {
+		return "expr"
+	}
+	switch {
+	case stmt.Return != nil:
+		return "return"
+	case stmt.Break != nil:
+		return "break"
+	case stmt.Continue != nil:
+		return "continue"
+	case stmt.VarDecl != nil:
+		return "let"
+	case stmt.FuncDecl != nil:
+		return "fn " + stmt.FuncDecl.Name
+	case stmt.ClassDecl != nil:
+		return "class " + stmt.ClassDecl.Type.Type
+	case stmt.EnumDecl != nil:
+		return "enum " + stmt.EnumDecl.Type.Type
+	default:
+		return "expr"
+	}
+}
+
+// Target of break and continue statements.
+type target struct {
+	label      string
+	breakTo    *Block
+	continueTo *Block
+}
+
+type builder struct {
+	graph   *Graph
+	current *Block
+	targets []target
+}
+
+func (b *builder) newBlock(kind string) *Block {
+	block := &Block{Index: len(b.graph.Blocks), Kind: kind}
+	b.graph.Blocks = append(b.graph.Blocks, block)
+	return block
+}
+
+func (b *builder) add(node parser.Node) {
+	if b.current == nil {
+		// Statements following a jump.
+		b.current = b.newBlock("unreachable")
+	}
+	b.current.Nodes = append(b.current.Nodes, node)
+}
+
+func edge(from, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// End the current block with an edge to block. Any following statements are
+// unreachable until a new current block is set.
+func (b *builder) jump(block *Block) {
+	if b.current != nil {
+		edge(b.current, block)
+	}
+	b.current = nil
+}
+
+func (b *builder) stmts(stmts []*parser.Stmt) {
+	for _, stmt := range stmts {
+		b.stmt(stmt)
+	}
+}
+
+func (b *builder) stmt(stmt *parser.Stmt) {
+	switch {
+	case stmt.Return != nil:
+		b.add(stmt)
+		b.jump(b.graph.Exit)
+
+	case stmt.Break != nil:
+		b.add(stmt)
+		if t := b.findTarget(stmt.Break.Label, false); t != nil {
+			b.jump(t.breakTo)
+		}
+
+	case stmt.Continue != nil:
+		b.add(stmt)
+		if t := b.findTarget(stmt.Continue.Label, true); t != nil {
+			b.jump(t.continueTo)
+		}
+
+	case stmt.Block != nil:
+		b.stmts(stmt.Block.Statements)
+
+	case stmt.If != nil:
+		b.add(stmt.If.Condition)
+		cond := b.current
+		done := b.newBlock("if.done")
+		b.current = b.newBlock("if.then")
+		edge(cond, b.current)
+		b.stmts(stmt.If.Main.Statements)
+		b.jump(done)
+		if stmt.If.HasElse() {
+			b.current = b.newBlock("if.else")
+			edge(cond, b.current)
+			b.stmts(stmt.If.ElseStatements())
+			b.jump(done)
+		} else {
+			edge(cond, done)
+		}
+		b.current = done
+
+	case stmt.For != nil:
+		b.add(stmt.For.Source)
+		loop := b.newBlock("for.loop")
+		body := b.newBlock("for.body")
+		done := b.newBlock("for.done")
+		b.jump(loop)
+		edge(loop, body)
+		edge(loop, done)
+		b.targets = append(b.targets, target{label: string(stmt.Label), breakTo: done, continueTo: loop})
+		b.current = body
+		b.stmts(stmt.For.Body.Statements)
+		b.jump(loop)
+		b.targets = b.targets[:len(b.targets)-1]
+		b.current = done
+
+	case stmt.Switch != nil:
+		b.add(stmt.Switch.Target)
+		head := b.current
+		done := b.newBlock("switch.done")
+		b.targets = append(b.targets, target{label: string(stmt.Label), breakTo: done})
+		exhaustive := false
+		for _, cse := range stmt.Switch.Cases {
+			b.current = b.newBlock("switch.case")
+			edge(head, b.current)
+			switch {
+			case cse.Default:
+				exhaustive = true
+			case cse.Case.EnumCase != nil:
+				// The analyser requires switches on enums to be exhaustive.
+				exhaustive = true
+			default:
+				b.add(cse.Case.ExprCase)
+			}
+			// Cases do not fall through.
+			b.stmts(cse.Body)
+			b.jump(done)
+		}
+		b.targets = b.targets[:len(b.targets)-1]
+		if !exhaustive {
+			edge(head, done)
+		}
+		b.current = done
+
+	default:
+		b.add(stmt)
+	}
+}
+
+// Find the innermost target with the given label, or if label is empty, the
+// innermost target (loops only if loop is true).
+func (b *builder) findTarget(label string, loop bool) *target {
+	for i := len(b.targets) - 1; i >= 0; i-- {
+		t := &b.targets[i]
+		switch {
+		case label != "" && t.label == label:
+			return t
+		case label == "" && (t.continueTo != nil || !loop):
+			return t
+		}
+	}
+	return nil
+}
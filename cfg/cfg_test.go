@@ -0,0 +1,192 @@
+package cfg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{name: "Straight",
+			input: `
+				fn f(a: int): int {
+					let b = a
+					b += 1
+					return b
+				}
+			`,
+			output: `
+f
+  0 entry 3:6 let 4:6 expr 5:6 return -> 1
+  1 exit
+`},
+		{name: "If",
+			input: `
+				fn f(a: int): int {
+					if a > 1 {
+						return 1
+					} else {
+						a = 2
+					}
+					return a
+				}
+			`,
+			output: `
+f
+  0 entry 3:11 expr -> 2 3
+  1 if.done 8:6 return -> 4
+  2 if.then 4:7 return -> 4
+  3 if.else 6:7 expr -> 1
+  4 exit
+`},
+		{name: "Unreachable",
+			input: `
+				fn f(a: int) {
+					return
+					a = 1
+				}
+			`,
+			output: `
+f
+  0 entry 3:6 return -> 2
+  1 unreachable (dead) 4:6 expr -> 2
+  2 exit
+`},
+		{name: "ForBreakContinue",
+			input: `
+				fn f(a: [int]) {
+					outer: for x in a {
+						for y in a {
+							if y > x {
+								continue outer
+							}
+							break
+						}
+					}
+				}
+			`,
+			output: `
+f
+  0 entry 3:22 expr -> 1
+  1 for.loop -> 2 3
+  2 for.body 4:16 expr -> 4
+  3 for.done -> 9
+  4 for.loop -> 5 6
+  5 for.body 5:13 expr -> 8 7
+  6 for.done -> 1
+  7 if.done 8:8 break -> 6
+  8 if.then 6:9 continue -> 1
+  9 exit
+`},
+		{name: "Switch",
+			input: `
+				fn f(a: int): int {
+					switch a {
+					case 1:
+						return 1
+					case 2:
+						break
+					default:
+					}
+					return 0
+				}
+			`,
+			output: `
+f
+  0 entry 3:13 expr -> 2 3 4
+  1 switch.done 10:6 return -> 5
+  2 switch.case 4:11 expr 5:7 return -> 5
+  3 switch.case 6:11 expr 7:7 break -> 1
+  4 switch.case -> 1
+  5 exit
+`},
+		{name: "Nested",
+			input: `
+				class C {
+					init() {}
+					fn f() {
+						fn g() {}
+					}
+				}
+			`,
+			output: `
+C.init
+  0 entry -> 1
+  1 exit
+C.f
+  0 entry 5:7 fn g -> 1
+  1 exit
+C.f.g
+  0 entry -> 1
+  1 exit
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			out := &strings.Builder{}
+			for _, graph := range Build(ast) {
+				dump(out, graph)
+			}
+			require.Equal(t, test.output[1:], out.String())
+		})
+	}
+}
+
+func TestWriteDot(t *testing.T) {
+	ast, err := parser.ParseString(`
+		fn f(a: int) {
+			if a > 1 {
+				return
+			}
+		}
+	`)
+	require.NoError(t, err)
+	graphs := Build(ast)
+	require.Len(t, graphs, 1)
+	out := &strings.Builder{}
+	err = graphs[0].WriteDot(out)
+	require.NoError(t, err)
+	require.Equal(t, `digraph "f" {
+  node [shape=box];
+  b0 [label="0: entry\l3:9 expr\l"];
+  b1 [label="1: if.done\l"];
+  b2 [label="2: if.then\l4:5 return\l"];
+  b3 [label="3: exit\l"];
+  b0 -> b2;
+  b0 -> b1;
+  b1 -> b3;
+  b2 -> b3;
+}
+`, out.String())
+}
+
+func dump(out *strings.Builder, g *Graph) {
+	fmt.Fprintln(out, g.Name)
+	for _, block := range g.Blocks {
+		fmt.Fprintf(out, "  %d %s", block.Index, block.Kind)
+		if !block.Live {
+			fmt.Fprint(out, " (dead)")
+		}
+		for _, node := range block.Nodes {
+			fmt.Fprintf(out, " %s %s", position(node), describe(node))
+		}
+		if len(block.Succs) > 0 {
+			fmt.Fprint(out, " ->")
+		}
+		for _, succ := range block.Succs {
+			fmt.Fprintf(out, " %d", succ.Index)
+		}
+		fmt.Fprintln(out)
+	}
+}
@@ -0,0 +1,194 @@
+// Command langx provides tooling for langx programs.
+//
+// Usage:
+//
+//	langx lint [flags] <file>
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/lint"
+	"github.com/alecthomas/langx/loader"
+	"github.com/alecthomas/langx/parser"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: langx lint [flags] <file>")
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "lint":
+		os.Exit(lintCmd(os.Args[2:]))
+	default:
+		fmt.Fprintf(os.Stderr, "langx: unknown command %q\n", os.Args[1])
+		os.Exit(2)
+	}
+}
+
+// Lint the root file and its imports, returning the process exit code.
+//
+// The exit code is 1 if any diagnostics are reported, so lint can fail CI.
+func lintCmd(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	enable := flags.String("enable", "", "comma separated rules to enable")
+	disable := flags.String("disable", "", "comma separated rules to disable")
+	dictionary := flags.String("dictionary", "", "word list for the spelling rule, one word per line")
+	listRules := flags.Bool("rules", false, "list available rules and exit")
+	search := flags.String("I", "", "colon separated import search paths")
+	manifest := flags.String("manifest", "", "project manifest (default "+loader.ManifestFile+" alongside the root file, if present)")
+	jsonOutput := flags.Bool("json", false, "write diagnostics as JSON")
+	showSource := flags.Bool("source", false, "show the source of each diagnostic")
+	colour := flags.Bool("colour", false, "colour diagnostics shown with -source")
+	_ = flags.Parse(args)
+
+	if *listRules {
+		for _, rule := range lint.Rules() {
+			state := "disabled"
+			if lint.Enabled(rule.Name()) {
+				state = "enabled"
+			}
+			fmt.Printf("%-16s %-8s %s\n", rule.Name(), state, rule.Doc())
+		}
+		return 0
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: langx lint [flags] <file>")
+		return 2
+	}
+
+	config := lint.Config{Rules: map[string]bool{}}
+	for _, name := range splitList(*enable, ",") {
+		config.Rules[name] = true
+	}
+	for _, name := range splitList(*disable, ",") {
+		config.Rules[name] = false
+	}
+	if *dictionary != "" {
+		r, err := os.Open(*dictionary)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		config.Dictionary, err = lint.ReadDictionary(r)
+		r.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	diagnostics, err := lintProgram(flags.Arg(0), splitList(*search, ":"), *manifest, config)
+	if err != nil {
+		// Loading and analysis errors are reported alongside lint diagnostics.
+		diagnostics = append(diagnostics, *parser.ToDiagnostic(err))
+	}
+	write := diagnostics.WriteText
+	switch {
+	case *jsonOutput:
+		write = diagnostics.WriteJSON
+	case *showSource:
+		write = func(w io.Writer) error { return renderDiagnostics(w, diagnostics, *colour) }
+	}
+	if err := write(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(diagnostics) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Load root and its imports and lint each module, after the modules it
+// imports, so that imported symbols are resolved.
+//
+// Diagnostics for modules linted before any error are returned with it.
+func lintProgram(root string, searchPaths []string, manifestFile string, config lint.Config) (parser.Diagnostics, error) {
+	l := loader.New(append([]string{filepath.Dir(root)}, searchPaths...)...)
+	if manifestFile == "" {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(root), loader.ManifestFile)); err == nil {
+			manifestFile = filepath.Join(filepath.Dir(root), loader.ManifestFile)
+		}
+	}
+	if manifestFile != "" {
+		r, err := os.Open(manifestFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		manifest, err := loader.ReadManifest(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		l.SetManifest(manifest)
+	}
+	program, err := l.Load(root)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := program.DependencyGraph().Sort()
+	if err != nil {
+		return nil, err
+	}
+	analysed := map[string]*analyser.Program{}
+	out := parser.Diagnostics{}
+	for _, path := range paths {
+		module := program.Modules[path]
+		source, err := ioutil.ReadFile(module.File)
+		if err != nil {
+			return out, errors.WithStack(err)
+		}
+		analysis, err := analyser.AnalyseWithImports(module.AST, analysed)
+		if err != nil {
+			return out, err
+		}
+		analysed[path] = analysis
+		diagnostics, err := lint.Run(string(source), analysis, config)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, analysis.Warnings...)
+		out = append(out, diagnostics...)
+	}
+	out.Sort()
+	return out, nil
+}
+
+// Render diagnostics with the source they refer to.
+func renderDiagnostics(w io.Writer, diagnostics parser.Diagnostics, colour bool) error {
+	opts := []parser.RenderOption{}
+	if colour {
+		opts = append(opts, parser.WithColour())
+	}
+	sources := map[string]string{}
+	for _, diagnostic := range diagnostics {
+		file := diagnostic.Pos.Filename
+		if _, ok := sources[file]; !ok && file != "" {
+			// Render without source if the file is unreadable.
+			source, _ := ioutil.ReadFile(file)
+			sources[file] = string(source)
+		}
+		if _, err := fmt.Fprintln(w, parser.RenderDiagnostic(sources[file], diagnostic, opts...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitList(s, sep string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, sep)
+}
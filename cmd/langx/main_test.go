@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/lint"
+)
+
+func TestLintProgram(t *testing.T) {
+	tests := []struct {
+		name        string
+		main        string
+		diagnostics []string
+	}{
+		{name: "Namespace",
+			main: `import util
+
+pub let a = util.double(2)
+`},
+		{name: "Symbols",
+			main: `import util.{double}
+
+pub let a = double(2)
+`},
+		{name: "UnusedImport",
+			main: `import util
+
+pub let a = 2
+`,
+			diagnostics: []string{`main.langx:1:1: warning: import "util" is unused [unused-import]`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := ioutil.WriteFile(filepath.Join(dir, "util.langx"), []byte("pub fn double(n: int): int { return n * 2 }\n"), 0600)
+			require.NoError(t, err)
+			root := filepath.Join(dir, "main.langx")
+			err = ioutil.WriteFile(root, []byte(test.main), 0600)
+			require.NoError(t, err)
+			diagnostics, err := lintProgram(root, nil, "", lint.Config{Rules: map[string]bool{}})
+			require.NoError(t, err)
+			var actual []string
+			for _, diagnostic := range diagnostics {
+				diagnostic.Pos.Filename = filepath.Base(diagnostic.Pos.Filename)
+				actual = append(actual, diagnostic.String())
+			}
+			require.Equal(t, test.diagnostics, actual)
+		})
+	}
+}
@@ -0,0 +1,793 @@
+// Package c compiles typed langx functions to portable C99.
+//
+// The generated translation unit is self-contained: it begins with a small
+// runtime providing reference counted strings and arrays, followed by one C
+// function per langx function. A langx function "f" is emitted as "langx_f" so
+// that it can be called from hand written C.
+//
+// The supported subset is that of the other native backends, plus strings and
+// array literals: functions over int, float, bool, char, string and array
+// values, local variables, assignment, if/else, return and calls between
+// functions. Parameters are borrowed from the caller, and returned objects are
+// owned by the caller, who must release them with lx_release.
+package c
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+const (
+	cString = "lx_string *"
+	cArray  = "lx_array *"
+)
+
+// Generate a C translation unit for program.
+func Generate(w io.Writer, program *analyser.Program) error {
+	g := &generator{program: program, funcs: map[string]*function{}, strings: map[string]string{}}
+	for _, decl := range program.AST.Declarations {
+		if decl.Func == nil {
+			return participle.Errorf(decl.Pos, "only functions are supported by the C backend")
+		}
+		if err := g.declare(decl.Func); err != nil {
+			return err
+		}
+	}
+	for _, fn := range g.order {
+		if err := g.genFunc(fn); err != nil {
+			return err
+		}
+	}
+	out := &bytes.Buffer{}
+	out.WriteString(runtime)
+	if g.literals.Len() > 0 {
+		out.WriteString("\n")
+		out.Write(g.literals.Bytes())
+	}
+	out.WriteString("\n")
+	for _, fn := range g.order {
+		fmt.Fprintf(out, "%s;\n", fn.signature)
+	}
+	out.Write(g.out.Bytes())
+	_, err := w.Write(out.Bytes())
+	return errors.WithStack(err)
+}
+
+type function struct {
+	decl      *parser.FuncDecl
+	params    []string
+	result    string
+	signature string
+}
+
+type local struct {
+	// Name of the variable in the langx source, if any.
+	source string
+	name   string
+	typ    string
+}
+
+type generator struct {
+	program  *analyser.Program
+	funcs    map[string]*function
+	order    []*function
+	strings  map[string]string
+	literals bytes.Buffer
+	out      bytes.Buffer
+
+	// State for the function being generated.
+	fn     *function
+	scopes [][]local
+	names  map[string]int
+	// Temporaries holding owned objects that must be released.
+	live    []local
+	pending []local
+	temps   int
+	indent  int
+}
+
+func (g *generator) declare(decl *parser.FuncDecl) error {
+	fnt, ok := g.program.Root.ResolveType(decl.Name).(*types.Function)
+	if !ok {
+		return participle.Errorf(decl.Pos, "unknown function %q", decl.Name)
+	}
+	fn := &function{decl: decl, result: "void"}
+	for _, param := range fnt.Parameters {
+		typ, err := cType(decl.Pos, param.Typ)
+		if err != nil {
+			return err
+		}
+		fn.params = append(fn.params, typ)
+	}
+	if fnt.ReturnType != types.None {
+		typ, err := cType(decl.Return.Pos, fnt.ReturnType)
+		if err != nil {
+			return err
+		}
+		fn.result = typ
+	}
+	g.funcs[decl.Name] = fn
+	g.order = append(g.order, fn)
+	return nil
+}
+
+// Map a langx type to a C type.
+func cType(pos lexer.Position, ref types.Reference) (string, error) {
+	if value, ok := ref.(*types.Value); ok {
+		ref = value.Typ
+	}
+	if array, ok := ref.(types.ArrayType); ok {
+		if _, err := cType(pos, array.Constraints[0].Typ); err != nil {
+			return "", err
+		}
+		return cArray, nil
+	}
+	switch ref.Kind() {
+	case types.KindInt, types.KindLiteralInt:
+		return "int64_t", nil
+	case types.KindFloat, types.KindLiteralFloat:
+		return "double", nil
+	case types.KindBool:
+		return "bool", nil
+	case types.KindChar:
+		return "lx_char", nil
+	case types.KindString, types.KindLiteralString:
+		return cString, nil
+	default:
+		return "", participle.Errorf(pos, "%s values are not supported by the C backend", ref.Kind())
+	}
+}
+
+// Returns true if values of C type typ are reference counted objects.
+func isObject(typ string) bool {
+	return typ == cString || typ == cArray
+}
+
+// Declare a C variable of type typ.
+func declaration(typ, name string) string {
+	if strings.HasSuffix(typ, "*") {
+		return typ + name
+	}
+	return typ + " " + name
+}
+
+func (g *generator) emit(format string, args ...interface{}) {
+	g.out.WriteString(strings.Repeat("  ", g.indent))
+	fmt.Fprintf(&g.out, format+"\n", args...)
+}
+
+// Allocate a temporary variable of type typ.
+//
+// Variables are prefixed with "v" and temporaries with "t_", so the two never collide.
+func (g *generator) temp(typ string) local {
+	g.temps++
+	return local{name: fmt.Sprintf("t_%d", g.temps), typ: typ}
+}
+
+// Store an owned object in a temporary that is released after the current statement.
+func (g *generator) owned(typ, expr string) string {
+	t := g.temp(typ)
+	g.pending = append(g.pending, t)
+	g.live = append(g.live, t)
+	return fmt.Sprintf("(%s = %s)", t.name, expr)
+}
+
+// Declare temporaries created while generating the current statement.
+func (g *generator) declarePending() {
+	for _, t := range g.pending {
+		g.emit("%s = NULL;", declaration(t.typ, t.name))
+	}
+	g.pending = nil
+}
+
+// Release temporaries created since mark.
+func (g *generator) releaseLive(mark int) {
+	for _, t := range g.live[mark:] {
+		g.emit("lx_release(%s);", t.name)
+	}
+	g.live = g.live[:mark]
+}
+
+// Release every object owned by the function, prior to returning.
+func (g *generator) releaseAll() {
+	for _, t := range g.live {
+		g.emit("lx_release(%s);", t.name)
+	}
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		g.releaseScope(g.scopes[i])
+	}
+}
+
+func (g *generator) releaseScope(scope []local) {
+	for i := len(scope) - 1; i >= 0; i-- {
+		if isObject(scope[i].typ) {
+			g.emit("lx_release(%s);", scope[i].name)
+		}
+	}
+}
+
+// Returns true if the function owns objects that must be released before returning.
+func (g *generator) ownsObjects() bool {
+	if len(g.live) > 0 {
+		return true
+	}
+	for _, scope := range g.scopes {
+		for _, l := range scope {
+			if isObject(l.typ) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Add a local variable to the current scope, returning its C name.
+func (g *generator) local(name, typ string) string {
+	cname := "v_" + name
+	if n := g.names[name]; n > 0 {
+		// Shadowed variable.
+		cname = fmt.Sprintf("v%d_%s", n, name)
+	}
+	g.names[name]++
+	g.scopes[len(g.scopes)-1] = append(g.scopes[len(g.scopes)-1], local{source: name, name: cname, typ: typ})
+	return cname
+}
+
+func (g *generator) resolveLocal(name string) (local, bool) {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		scope := g.scopes[i]
+		for j := len(scope) - 1; j >= 0; j-- {
+			if scope[j].source == name {
+				return scope[j], true
+			}
+		}
+	}
+	return local{}, false
+}
+
+func (g *generator) genFunc(fn *function) error {
+	g.fn = fn
+	g.scopes = [][]local{{}}
+	g.names = map[string]int{}
+	g.live, g.pending = nil, nil
+	g.temps, g.indent = 0, 1
+	g.out.WriteString("\n")
+	body := g.out.Len()
+	params := []string{}
+	i := 0
+	for _, param := range fn.decl.Parameters {
+		for _, name := range param.Names {
+			cname := g.local(name, fn.params[i])
+			params = append(params, declaration(fn.params[i], cname))
+			if isObject(fn.params[i]) {
+				// Parameters are borrowed, but may be reassigned.
+				g.emit("lx_retain(%s);", cname)
+			}
+			i++
+		}
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+	fn.signature = declaration(fn.result, "langx_"+fn.decl.Name) + "(" + strings.Join(params, ", ") + ")"
+	if err := g.genBlock(fn.decl.Body.Statements); err != nil {
+		return err
+	}
+	if !endsWithReturn(fn.decl.Body.Statements) {
+		g.releaseScope(g.scopes[0])
+	}
+	// Insert the signature before the body.
+	code := append([]byte(fn.signature+" {\n"), g.out.Bytes()[body:]...)
+	g.out.Truncate(body)
+	g.out.Write(code)
+	g.out.WriteString("}\n")
+	return nil
+}
+
+func endsWithReturn(stmts []*parser.Stmt) bool {
+	return len(stmts) > 0 && stmts[len(stmts)-1].Return != nil
+}
+
+// Generate a block of statements in a new scope.
+func (g *generator) genBlock(stmts []*parser.Stmt) error {
+	g.scopes = append(g.scopes, nil)
+	for _, stmt := range stmts {
+		if err := g.genStmt(stmt); err != nil {
+			return err
+		}
+	}
+	if !endsWithReturn(stmts) {
+		g.releaseScope(g.scopes[len(g.scopes)-1])
+	}
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	return nil
+}
+
+func (g *generator) genStmt(stmt *parser.Stmt) error {
+	mark := len(g.live)
+	switch {
+	case stmt.Return != nil:
+		if stmt.Return.Value == nil {
+			g.releaseAll()
+			g.emit("return;")
+			return nil
+		}
+		value, err := g.genExpr(stmt.Return.Value, g.fn.result)
+		if err != nil {
+			return err
+		}
+		g.declarePending()
+		if !g.ownsObjects() {
+			g.emit("return %s;", value)
+			return nil
+		}
+		result := g.temp(g.fn.result)
+		if isObject(g.fn.result) {
+			value = fmt.Sprintf("lx_retain(%s)", value)
+		}
+		g.emit("%s = %s;", declaration(result.typ, result.name), value)
+		g.releaseAll()
+		g.emit("return %s;", result.name)
+		g.live = g.live[:mark]
+		return nil
+
+	case stmt.If != nil:
+		if stmt.If.Binding != "" {
+			return participle.Errorf(stmt.Pos, "if let is not supported by the C backend")
+		}
+		cond, err := g.genExpr(stmt.If.Condition, "bool")
+		if err != nil {
+			return err
+		}
+		g.declarePending()
+		g.emit("if (%s) {", unparen(cond))
+		g.indent++
+		if err := g.genBlock(stmt.If.Main.Statements); err != nil {
+			return err
+		}
+		g.indent--
+		if stmt.If.HasElse() {
+			g.emit("} else {")
+			g.indent++
+			if err := g.genBlock(stmt.If.ElseStatements()); err != nil {
+				return err
+			}
+			g.indent--
+		}
+		g.emit("}")
+
+	case stmt.Block != nil:
+		g.emit("{")
+		g.indent++
+		if err := g.genBlock(stmt.Block.Statements); err != nil {
+			return err
+		}
+		g.indent--
+		g.emit("}")
+
+	case stmt.VarDecl != nil:
+		for _, v := range stmt.VarDecl.Vars {
+			if v.Pattern != nil {
+				return participle.Errorf(v.Pos, "destructuring is not supported by the C backend")
+			}
+			ref := g.program.Resolved(v)
+			if ref == nil {
+				return participle.Errorf(v.Pos, "unknown type for %q", v.Name)
+			}
+			typ, err := cType(v.Pos, ref)
+			if err != nil {
+				return err
+			}
+			value := zeroValue(typ)
+			if v.Default != nil {
+				value, err = g.genExpr(v.Default, typ)
+				if err != nil {
+					return err
+				}
+				if isObject(typ) {
+					value = fmt.Sprintf("lx_retain(%s)", value)
+				}
+			}
+			g.declarePending()
+			// Declare after the initialiser, which may refer to a shadowed variable.
+			g.emit("%s = %s;", declaration(typ, g.local(v.Name, typ)), value)
+		}
+
+	case stmt.ExprStmt != nil:
+		if err := g.genExprStmt(stmt.ExprStmt); err != nil {
+			return err
+		}
+
+	default:
+		return participle.Errorf(stmt.Pos, "statement is not supported by the C backend")
+	}
+	g.releaseLive(mark)
+	return nil
+}
+
+// Strip redundant outer parentheses from a C expression.
+func unparen(expr string) string {
+	if !strings.HasPrefix(expr, "(") || !strings.HasSuffix(expr, ")") {
+		return expr
+	}
+	depth := 0
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i != len(expr)-1 {
+				return expr
+			}
+		}
+	}
+	return expr[1 : len(expr)-1]
+}
+
+func zeroValue(typ string) string {
+	switch typ {
+	case "bool":
+		return "false"
+	case "double":
+		return "0.0"
+	case cString, cArray:
+		return "NULL"
+	default:
+		return "0"
+	}
+}
+
+func (g *generator) genExprStmt(stmt *parser.ExprStmt) error {
+	if stmt.RHS == nil {
+		call, result, err := g.genCall(stmt.LHS)
+		if err != nil {
+			return err
+		}
+		g.declarePending()
+		if isObject(result) {
+			g.emit("lx_release(%s);", call)
+		} else {
+			g.emit("%s;", call)
+		}
+		return nil
+	}
+	name := ""
+	if unary := stmt.LHS.Unary; unary != nil && unary.Op == 0 && unary.Reference.Next == nil {
+		name = unary.Reference.Terminal.Ident
+	}
+	l, ok := g.resolveLocal(name)
+	if !ok {
+		return participle.Errorf(stmt.LHS.Pos, "can only assign to local variables in the C backend")
+	}
+	value, err := g.genExpr(stmt.RHS, l.typ)
+	if err != nil {
+		return err
+	}
+	if stmt.Op != parser.OpAsgn {
+		// Strip the trailing "=" from the compound assignment operator.
+		op := stmt.Op.String()
+		value, err = g.genBinaryOp(stmt.Pos, op[:len(op)-1], l.typ, l.name, value)
+		if err != nil {
+			return err
+		}
+	}
+	g.declarePending()
+	if isObject(l.typ) {
+		value = fmt.Sprintf("lx_replace(%s, %s)", l.name, value)
+	}
+	g.emit("%s = %s;", l.name, value)
+	return nil
+}
+
+// Operators by operand type.
+var binaryOps = map[string]map[string]bool{
+	"bool": {
+		"==": true, "!=": true, "&": true, "|": true,
+	},
+	"lx_char": {
+		"==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+	},
+	"int64_t": {
+		"==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+		"+": true, "-": true, "*": true, "/": true, "%": true, "&": true, "|": true,
+	},
+	"double": {
+		"==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+		"+": true, "-": true, "*": true, "/": true,
+	},
+	cString: {
+		"==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+	},
+}
+
+func (g *generator) genBinaryOp(pos lexer.Position, op, typ, lhs, rhs string) (string, error) {
+	switch {
+	case typ == cString && op == "+":
+		return g.owned(typ, fmt.Sprintf("lx_string_concat(%s, %s)", lhs, rhs)), nil
+	case typ == "double" && op == "%":
+		return fmt.Sprintf("fmod(%s, %s)", lhs, rhs), nil
+	case !binaryOps[typ][op]:
+		return "", participle.Errorf(pos, "operator %s is not supported by the C backend", op)
+	case typ == cString:
+		return fmt.Sprintf("(lx_string_cmp(%s, %s) %s 0)", lhs, rhs, op), nil
+	default:
+		return fmt.Sprintf("(%s %s %s)", lhs, op, rhs), nil
+	}
+}
+
+// Generate expr as a C expression of type want.
+func (g *generator) genExpr(expr *parser.Expr, want string) (string, error) {
+	if expr.Unary != nil {
+		return g.genUnary(expr.Unary, want)
+	}
+	if expr.Chained {
+		unchained, err := parser.Unchain(expr)
+		if err != nil {
+			return "", err
+		}
+		return g.genExpr(unchained, want)
+	}
+	typ := want
+	switch expr.Op {
+	case parser.OpAnd, parser.OpOr:
+		if want != "bool" {
+			return "", participle.Errorf(expr.Pos, "result of %s must be a bool", expr.Op)
+		}
+		lhs, err := g.genExpr(expr.Left, "bool")
+		if err != nil {
+			return "", err
+		}
+		// Objects created by the right operand are only assigned if it is evaluated.
+		rhs, err := g.genExpr(expr.Right, "bool")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s %s %s)", lhs, expr.Op, rhs), nil
+
+	case parser.OpEq, parser.OpNe, parser.OpLt, parser.OpGt, parser.OpLe, parser.OpGe:
+		if want != "bool" {
+			return "", participle.Errorf(expr.Pos, "comparison result must be a bool")
+		}
+		var err error
+		typ, err = g.operandType(expr)
+		if err != nil {
+			return "", err
+		}
+	}
+	lhs, err := g.genExpr(expr.Left, typ)
+	if err != nil {
+		return "", err
+	}
+	rhs, err := g.genExpr(expr.Right, typ)
+	if err != nil {
+		return "", err
+	}
+	return g.genBinaryOp(expr.Pos, expr.Op.String(), typ, lhs, rhs)
+}
+
+// Determine the operand type of a comparison.
+//
+// Literals adopt the type of the other operand.
+func (g *generator) operandType(expr *parser.Expr) (string, error) {
+	left, right := g.program.Resolved(expr.Left), g.program.Resolved(expr.Right)
+	if left == nil || right == nil {
+		return "", participle.Errorf(expr.Pos, "unknown operand types")
+	}
+	ref := left
+	switch left.Kind() {
+	case types.KindLiteralInt, types.KindLiteralFloat:
+		ref = right
+	}
+	return cType(expr.Pos, ref)
+}
+
+func (g *generator) genUnary(unary *parser.Unary, want string) (string, error) {
+	value, err := g.genReference(unary.Reference, want)
+	if err != nil {
+		return "", err
+	}
+	switch unary.Op {
+	case parser.OpSub:
+		if want != "int64_t" && want != "double" {
+			return "", participle.Errorf(unary.Pos, "can't negate a non-numeric value")
+		}
+		return fmt.Sprintf("(-%s)", value), nil
+
+	case parser.OpNot:
+		if want != "bool" {
+			return "", participle.Errorf(unary.Pos, "result of ! must be a bool")
+		}
+		return fmt.Sprintf("(!%s)", value), nil
+
+	default:
+		return value, nil
+	}
+}
+
+func (g *generator) genReference(ref *parser.Reference, want string) (string, error) {
+	terminal := ref.Terminal
+	if ref.Next != nil {
+		call, result, err := g.genCall(&parser.Expr{Mixin: ref.Mixin, Unary: &parser.Unary{Mixin: ref.Mixin, Reference: ref}})
+		if err != nil {
+			return "", err
+		}
+		if result != want {
+			return "", participle.Errorf(ref.Pos, "function %q does not return the expected type", terminal.Ident)
+		}
+		if isObject(result) {
+			return g.owned(result, call), nil
+		}
+		return call, nil
+	}
+	switch {
+	case terminal.Tuple != nil && len(terminal.Tuple) == 1:
+		return g.genExpr(terminal.Tuple[0], want)
+
+	case terminal.Ident != "":
+		l, ok := g.resolveLocal(terminal.Ident)
+		if !ok {
+			return "", participle.Errorf(terminal.Pos, "unknown local variable %q", terminal.Ident)
+		}
+		if l.typ != want {
+			return "", participle.Errorf(terminal.Pos, "%q does not have the expected type", terminal.Ident)
+		}
+		return l.name, nil
+
+	case terminal.Literal != nil:
+		return g.genLiteral(terminal.Literal, want)
+
+	default:
+		return "", participle.Errorf(terminal.Pos, "%s is not supported by the C backend", terminal.Describe())
+	}
+}
+
+// Generate a call to a function, returning the call and its result type.
+func (g *generator) genCall(expr *parser.Expr) (string, string, error) {
+	var ref *parser.Reference
+	if expr.Unary != nil && expr.Unary.Op == 0 {
+		ref = expr.Unary.Reference
+	}
+	if ref == nil || ref.Next == nil || ref.Next.Call == nil || ref.Next.Next != nil {
+		return "", "", participle.Errorf(expr.Pos, "expression is not a function call")
+	}
+	fn, ok := g.funcs[ref.Terminal.Ident]
+	if !ok {
+		return "", "", participle.Errorf(ref.Pos, "unknown function %s", ref.Terminal.Describe())
+	}
+	call := ref.Next.Call
+	if call.TrailingClosure != nil {
+		return "", "", participle.Errorf(call.TrailingClosure.Pos, "trailing closures are not supported by the C backend")
+	}
+	if len(call.Parameters) != len(fn.params) {
+		return "", "", participle.Errorf(call.Pos, "%d parameters provided for function that takes %d parameters",
+			len(call.Parameters), len(fn.params))
+	}
+	args := []string{}
+	for i, param := range call.Parameters {
+		arg, err := g.genExpr(param, fn.params[i])
+		if err != nil {
+			return "", "", err
+		}
+		args = append(args, arg)
+	}
+	return fmt.Sprintf("langx_%s(%s)", fn.decl.Name, strings.Join(args, ", ")), fn.result, nil
+}
+
+func (g *generator) genLiteral(literal *parser.Literal, want string) (string, error) {
+	switch {
+	case literal.Number != nil && want == "int64_t":
+		if !literal.Number.IsInt() {
+			return "", participle.Errorf(literal.Pos, "can't use %s as an int", literal.Number)
+		}
+		n, _ := literal.Number.Value.Int64()
+		return fmt.Sprintf("INT64_C(%d)", n), nil
+
+	case literal.Number != nil && want == "double":
+		f, _ := literal.Number.Value.Float64()
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s, nil
+
+	case literal.Bool != nil && want == "bool":
+		return strconv.FormatBool(bool(*literal.Bool)), nil
+
+	case literal.Char != nil && want == "lx_char":
+		return strconv.Itoa(int(*literal.Char)), nil
+
+	case literal.Str != nil && want == cString:
+		s := ""
+		for _, fragment := range literal.Str.Fragments {
+			if fragment.Expr != nil {
+				return "", participle.Errorf(literal.Pos, "string interpolation is not supported by the C backend")
+			}
+			s += fragment.String
+		}
+		return g.stringLiteral(s), nil
+
+	case literal.LitStr != nil && want == cString:
+		return g.stringLiteral(*literal.LitStr), nil
+
+	case literal.Embedded != nil && want == cString:
+		return g.stringLiteral(literal.Embedded.Content), nil
+
+	case literal.Array != nil && want == cArray:
+		return g.genArrayLiteral(literal.Array)
+
+	default:
+		return "", participle.Errorf(literal.Pos, "%s literal is not supported here by the C backend", literal.Describe())
+	}
+}
+
+func (g *generator) genArrayLiteral(array *parser.ArrayLiteral) (string, error) {
+	ref := g.program.Resolved(array)
+	if value, ok := ref.(*types.Value); ok {
+		ref = value.Typ
+	}
+	typ, ok := ref.(types.ArrayType)
+	if !ok {
+		return "", participle.Errorf(array.Pos, "unknown type for array literal")
+	}
+	element, err := cType(array.Pos, typ.Constraints[0].Typ)
+	if err != nil {
+		return "", err
+	}
+	values := []string{}
+	for _, value := range array.Values {
+		v, err := g.genExpr(value, element)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, v)
+	}
+	return g.owned(cArray, fmt.Sprintf("lx_array_of(sizeof(%s), %t, %d, (%s[]){%s})",
+		element, isObject(element), len(values), element, strings.Join(values, ", "))), nil
+}
+
+// Return a pointer to a static string constant with the value s.
+func (g *generator) stringLiteral(s string) string {
+	name, ok := g.strings[s]
+	if !ok {
+		name = fmt.Sprintf("lx_str_%d", len(g.strings))
+		g.strings[s] = name
+		fmt.Fprintf(&g.literals, "static lx_string %s = LX_STRING(%s);\n", name, quote(s))
+	}
+	return "&" + name
+}
+
+// Quote s as a C string literal.
+func quote(s string) string {
+	out := &strings.Builder{}
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c == '\n':
+			out.WriteString(`\n`)
+		case c == '\t':
+			out.WriteString(`\t`)
+		case c < 0x20 || c >= 0x7f || c == '?':
+			// Octal escapes are always exactly three digits, and "?" avoids trigraphs.
+			fmt.Fprintf(out, `\%03o`, c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
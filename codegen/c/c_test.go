@@ -0,0 +1,173 @@
+package c
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output string
+		fail   string
+	}{
+		{name: "Fibonacci",
+			input: `
+				fn fib(n: int): int {
+					if n <= 1 {
+						return n
+					}
+					return fib(n-1) + fib(n-2)
+				}
+			`,
+			output: `
+int64_t langx_fib(int64_t v_n);
+
+int64_t langx_fib(int64_t v_n) {
+  if (v_n <= INT64_C(1)) {
+    return v_n;
+  }
+  return (langx_fib((v_n - INT64_C(1))) + langx_fib((v_n - INT64_C(2))));
+}
+`},
+		{name: "ReferenceCounting",
+			input: `
+				fn greet(name: string, excited: bool): string {
+					let greeting: string = "Hello, "
+					greeting += name
+					if excited {
+						let bang: string = "!"
+						greeting = greeting + bang
+					}
+					return greeting
+				}
+			`,
+			output: `
+static lx_string lx_str_0 = LX_STRING("Hello, ");
+static lx_string lx_str_1 = LX_STRING("!");
+
+lx_string *langx_greet(lx_string *v_name, bool v_excited);
+
+lx_string *langx_greet(lx_string *v_name, bool v_excited) {
+  lx_retain(v_name);
+  lx_string *v_greeting = lx_retain(&lx_str_0);
+  lx_string *t_1 = NULL;
+  v_greeting = lx_replace(v_greeting, (t_1 = lx_string_concat(v_greeting, v_name)));
+  lx_release(t_1);
+  if (v_excited) {
+    lx_string *v_bang = lx_retain(&lx_str_1);
+    lx_string *t_2 = NULL;
+    v_greeting = lx_replace(v_greeting, (t_2 = lx_string_concat(v_greeting, v_bang)));
+    lx_release(t_2);
+    lx_release(v_bang);
+  }
+  lx_string *t_3 = lx_retain(v_greeting);
+  lx_release(v_greeting);
+  lx_release(v_name);
+  return t_3;
+}
+`},
+		{name: "ArraysAndShadowing",
+			input: `
+				fn f(s: string): [string] {
+					let a = [s]
+					{
+						let s = 1.5
+						s = s % 2
+					}
+					return a
+				}
+			`,
+			output: `
+lx_array *langx_f(lx_string *v_s);
+
+lx_array *langx_f(lx_string *v_s) {
+  lx_retain(v_s);
+  lx_array *t_1 = NULL;
+  lx_array *v_a = lx_retain((t_1 = lx_array_of(sizeof(lx_string *), true, 1, (lx_string *[]){v_s})));
+  lx_release(t_1);
+  {
+    double v1_s = 1.5;
+    v1_s = fmod(v1_s, 2.0);
+  }
+  lx_array *t_2 = lx_retain(v_a);
+  lx_release(v_a);
+  lx_release(v_s);
+  return t_2;
+}
+`},
+		{name: "ChainedComparison",
+			input: `
+				fn between(lo: int, n: int, hi: int): bool {
+					return lo <= n < hi
+				}
+			`,
+			output: `
+bool langx_between(int64_t v_lo, int64_t v_n, int64_t v_hi);
+
+bool langx_between(int64_t v_lo, int64_t v_n, int64_t v_hi) {
+  return ((v_lo <= v_n) && (v_n < v_hi));
+}
+`},
+		{name: "ChainedComparisonCall",
+			input: `
+				fn f(): int {
+					return 1
+				}
+				fn g(): bool {
+					return 0 < f() < 2
+				}
+			`,
+			fail: "6:17: chained comparisons of operands other than variables and literals are not supported"},
+		{name: "NonFunction",
+			input: `
+				let a = 1
+			`,
+			fail: "2:5: only functions are supported by the C backend"},
+		{name: "UnsupportedStatement",
+			input: `
+				fn f(a: int) {
+					switch a {
+					case 1:
+					}
+				}
+			`,
+			fail: "3:6: statement is not supported by the C backend"},
+		{name: "StringInterpolation",
+			input: `
+				fn f(a: int): string {
+					return "a is {a}"
+				}
+			`,
+			fail: "3:13: string interpolation is not supported by the C backend"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			program, err := analyser.Analyse(ast)
+			require.NoError(t, err)
+			w := &bytes.Buffer{}
+			err = Generate(w, program)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+			} else {
+				require.NoError(t, err)
+				require.True(t, strings.HasPrefix(w.String(), runtime))
+				require.Equal(t, test.output, strings.TrimPrefix(w.String(), runtime))
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	require.Equal(t, `"a\tb\"c\\d\n"`, quote("a\tb\"c\\d\n"))
+	require.Equal(t, `"\077\000\303\251"`, quote("?\x00é"))
+}
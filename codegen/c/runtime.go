@@ -0,0 +1,174 @@
+package c
+
+// The runtime included at the top of every generated translation unit.
+//
+// Memory management can be redirected by defining LX_MALLOC and LX_FREE, and
+// fatal errors by defining LX_PANIC, before the generated source is compiled.
+const runtime = `#include <math.h>
+#include <stdbool.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+
+#ifndef LX_MALLOC
+#define LX_MALLOC malloc
+#define LX_FREE free
+#endif
+
+#ifndef LX_PANIC
+#define LX_PANIC(msg) abort()
+#endif
+
+#if defined(__GNUC__)
+#define LX_UNUSED __attribute__((unused))
+#else
+#define LX_UNUSED
+#endif
+
+typedef uint32_t lx_char;
+
+/* Header shared by all reference counted objects. */
+typedef struct lx_object {
+  /* Static objects have a negative count and are never freed. */
+  int32_t refs;
+  void (*destroy)(struct lx_object *obj);
+} lx_object;
+
+typedef struct lx_string {
+  lx_object obj;
+  size_t len;
+  /* NUL terminated. */
+  const char *data;
+} lx_string;
+
+typedef struct lx_array {
+  lx_object obj;
+  size_t size;
+  size_t len;
+  /* True if elements are objects. */
+  bool refs;
+  void *data;
+} lx_array;
+
+#define LX_STRING(s) {{-1, NULL}, sizeof(s) - 1, s}
+
+LX_UNUSED static void *lx_alloc(size_t size, void (*destroy)(lx_object *obj)) {
+  lx_object *obj = LX_MALLOC(size);
+  if (obj == NULL) {
+    LX_PANIC("out of memory");
+  }
+  obj->refs = 1;
+  obj->destroy = destroy;
+  return obj;
+}
+
+LX_UNUSED static void *lx_retain(void *ptr) {
+  lx_object *obj = ptr;
+  if (obj != NULL && obj->refs > 0) {
+    obj->refs++;
+  }
+  return ptr;
+}
+
+LX_UNUSED static void lx_release(void *ptr) {
+  lx_object *obj = ptr;
+  if (obj == NULL || obj->refs < 0) {
+    return;
+  }
+  if (--obj->refs == 0) {
+    if (obj->destroy != NULL) {
+      obj->destroy(obj);
+    }
+    LX_FREE(obj);
+  }
+}
+
+/* Replace the value of a variable, returning the new value. */
+LX_UNUSED static void *lx_replace(void *old, void *value) {
+  lx_retain(value);
+  lx_release(old);
+  return value;
+}
+
+LX_UNUSED static size_t lx_string_len(const lx_string *s) {
+  return s == NULL ? 0 : s->len;
+}
+
+/* Allocate a string of len bytes, copying data if it is not NULL. */
+LX_UNUSED static lx_string *lx_string_new(const char *data, size_t len) {
+  lx_string *s = lx_alloc(sizeof(lx_string) + len + 1, NULL);
+  char *buf = (char *)(s + 1);
+  if (data != NULL && len > 0) {
+    memcpy(buf, data, len);
+  }
+  buf[len] = 0;
+  s->len = len;
+  s->data = buf;
+  return s;
+}
+
+LX_UNUSED static lx_string *lx_string_concat(const lx_string *a, const lx_string *b) {
+  size_t alen = lx_string_len(a), blen = lx_string_len(b);
+  lx_string *s = lx_string_new(NULL, alen + blen);
+  char *buf = (char *)(s + 1);
+  if (alen > 0) {
+    memcpy(buf, a->data, alen);
+  }
+  if (blen > 0) {
+    memcpy(buf + alen, b->data, blen);
+  }
+  return s;
+}
+
+LX_UNUSED static int lx_string_cmp(const lx_string *a, const lx_string *b) {
+  size_t alen = lx_string_len(a), blen = lx_string_len(b);
+  int cmp = memcmp(alen > 0 ? a->data : "", blen > 0 ? b->data : "", alen < blen ? alen : blen);
+  if (cmp != 0) {
+    return cmp;
+  }
+  return alen < blen ? -1 : alen > blen ? 1 : 0;
+}
+
+LX_UNUSED static void lx_array_destroy(lx_object *obj) {
+  lx_array *a = (lx_array *)obj;
+  size_t i;
+  if (!a->refs) {
+    return;
+  }
+  for (i = 0; i < a->len; i++) {
+    lx_release(((void **)a->data)[i]);
+  }
+}
+
+/* Create an array of len elements of size bytes, copied from elements. */
+LX_UNUSED static lx_array *lx_array_of(size_t size, bool refs, size_t len, const void *elements) {
+  lx_array *a = lx_alloc(sizeof(lx_array) + size * len, lx_array_destroy);
+  size_t i;
+  a->size = size;
+  a->len = len;
+  a->refs = refs;
+  a->data = a + 1;
+  if (len > 0) {
+    memcpy(a->data, elements, size * len);
+  }
+  if (refs) {
+    for (i = 0; i < len; i++) {
+      lx_retain(((void **)a->data)[i]);
+    }
+  }
+  return a;
+}
+
+LX_UNUSED static size_t lx_array_len(const lx_array *a) {
+  return a == NULL ? 0 : a->len;
+}
+
+/* Pointer to element i of a, which must be in range. */
+LX_UNUSED static void *lx_array_at(const lx_array *a, size_t i) {
+  if (i >= lx_array_len(a)) {
+    LX_PANIC("index out of range");
+  }
+  return (char *)a->data + i * a->size;
+}
+`
@@ -3,7 +3,7 @@ package codegen
 import (
 	"fmt"
 	"io"
-	"math/big"
+	"runtime"
 
 	"github.com/alecthomas/langx/analyser"
 	. "github.com/alecthomas/langx/codegen/wat"
@@ -35,11 +35,7 @@ func Generate(w io.Writer, program *analyser.Program) error {
 			},
 		},
 	}
-	sexpr, err := g.genProgram(program.AST)
-	if err != nil {
-		return err
-	}
-	return Write(w, sexpr)
+	return g.genProgram(w, program.AST)
 }
 
 type generic struct {
@@ -56,22 +52,88 @@ type generator struct {
 	program   *analyser.Program
 }
 
-func (g *generator) genProgram(p *parser.AST) (Node, error) {
+// Generate the module, streaming each top-level declaration to w as it is generated.
+func (g *generator) genProgram(w io.Writer, p *parser.AST) error {
 	root := List{
 		ID("module"),
 		List{ID("memory"), List{ID("export"), String("memory")}, Int(1)},
 	}
 	_ = parser.VisitFunc(p, g.buildDataTable(&root))
-	for _, decl := range p.Decls() {
-		sdecl, err := g.genDecl(nil, decl)
-		if err != nil {
-			return nil, err
+	lw := NewListWriter(w, ID("module"))
+	if err := lw.Add(root[1:]...); err != nil {
+		return err
+	}
+	err := g.genDecls(p.Decls(), func(sdecl List) error {
+		if sdecl == nil {
+			return nil
+		}
+		return lw.Add(sdecl...)
+	})
+	if err != nil {
+		return err
+	}
+	return lw.Close()
+}
+
+// Generate top-level declarations concurrently, one work unit per declaration.
+//
+// Results are passed to emit in declaration order as soon as they, and all
+// preceding declarations, are complete. This keeps output deterministic regardless
+// of scheduling, while only holding results that are waiting on a slower predecessor.
+func (g *generator) genDecls(decls []parser.Decl, emit func(List) error) error {
+	type result struct {
+		sdecl List
+		err   error
+		panic interface{}
+		done  chan struct{}
+	}
+	results := make([]result, len(decls))
+	for i := range results {
+		results[i].done = make(chan struct{})
+	}
+	work := make(chan int)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(work)
+		for i := range decls {
+			select {
+			case work <- i:
+			case <-stop:
+				return
+			}
 		}
-		if sdecl != nil {
-			root.Add(sdecl...)
+	}()
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		go func() {
+			for i := range work {
+				func() {
+					// Panics are propagated to the caller below.
+					defer func() {
+						results[i].panic = recover()
+						close(results[i].done)
+					}()
+					results[i].sdecl, results[i].err = g.genDecl(nil, decls[i])
+				}()
+			}
+		}()
+	}
+
+	for i := range results {
+		result := &results[i]
+		<-result.done
+		if result.panic != nil {
+			panic(result.panic)
 		}
+		if result.err != nil {
+			return result.err
+		}
+		if err := emit(result.sdecl); err != nil {
+			return err
+		}
+		result.sdecl = nil
 	}
-	return root, nil
+	return nil
 }
 
 // Collect all constant strings into global tables.
@@ -95,6 +157,9 @@ func (g *generator) buildDataTable(root *List) parser.VisitorFunc {
 		case lit.LitStr != nil:
 			addGlobal(lit, *lit.LitStr)
 
+		case lit.Embedded != nil:
+			addGlobal(lit, lit.Embedded.Content)
+
 		case lit.Str != nil:
 			for _, frag := range lit.Str.Fragments {
 				if frag.String != "" {
@@ -209,7 +274,7 @@ func (g *generator) typeForTerm(t *parser.Terminal) Node {
 		case "float":
 			return ID("f64")
 
-		case "bool":
+		case "bool", "char":
 			return ID("i32")
 
 		default:
@@ -243,8 +308,8 @@ func (g *generator) genStmt(stmt *parser.Stmt) List {
 		}
 		out.Add(g.genExpr(stmt.If.Condition))
 		out.Add(ID("br_if"), name)
-		if stmt.If.Else != nil {
-			out.Add(g.genBlock(stmt.If.Else)...)
+		if stmt.If.HasElse() {
+			out.Add(g.genBlock(&parser.Block{Statements: stmt.If.ElseStatements()})...)
 			out.Add(ID("br_if"), name)
 		} else {
 			out.Add(g.genBlock(stmt.If.Main)...)
@@ -258,6 +323,9 @@ func (g *generator) genStmt(stmt *parser.Stmt) List {
 }
 
 func (g *generator) genExpr(value *parser.Expr) List {
+	if value.Chained {
+		panic("chained comparisons are not supported")
+	}
 	typ := ""
 	if value.Left != nil {
 		typ = g.typeRef(g.program.Resolved(value.Left))
@@ -332,12 +400,15 @@ func (g *generator) genTerminal(terminal *parser.Terminal) List {
 func (g *generator) genLiteral(literal *parser.Literal) List {
 	switch {
 	case literal.Number != nil:
-		n, _ := (*big.Float)(literal.Number).Int64()
+		n, _ := literal.Number.Value.Int64()
 		return List{
 			ID("i64.const"),
 			Int(n),
 		}
 
+	case literal.Char != nil:
+		return List{ID("i32.const"), Int(*literal.Char)}
+
 	case literal.Bool != nil:
 		if *literal.Bool {
 			return List{ID("i32.const"), Int(1)}
@@ -355,7 +426,7 @@ func (g *generator) typeRef(ref types.Reference) string {
 		return "i64"
 	case types.KindFloat, types.KindLiteralFloat:
 		return "f64"
-	case types.KindString, types.KindClass, types.KindBool:
+	case types.KindString, types.KindClass, types.KindBool, types.KindChar:
 		return "i32"
 	default:
 		panic(ref.Kind().String())
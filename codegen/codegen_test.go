@@ -1,6 +1,8 @@
 package codegen
 
 import (
+	"fmt"
+	"io/ioutil"
 	"strings"
 	"testing"
 
@@ -113,3 +115,50 @@ func TestCodeGen(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateOrderIsDeterministic(t *testing.T) {
+	ast, err := parser.ParseString(syntheticProgram(100))
+	require.NoError(t, err)
+	program, err := analyser.Analyse(ast)
+	require.NoError(t, err)
+	expected := &strings.Builder{}
+	err = Generate(expected, program)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		actual := &strings.Builder{}
+		err = Generate(actual, program)
+		require.NoError(t, err)
+		require.Equal(t, expected.String(), actual.String())
+	}
+	require.Less(t, strings.Index(expected.String(), "$f0\n"), strings.Index(expected.String(), "$f99\n"))
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	ast, err := parser.ParseString(syntheticProgram(2000))
+	require.NoError(b, err)
+	program, err := analyser.Analyse(ast)
+	require.NoError(b, err)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err = Generate(ioutil.Discard, program)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func syntheticProgram(functions int) string {
+	source := &strings.Builder{}
+	for i := 0; i < functions; i++ {
+		fmt.Fprintf(source, `
+			fn f%d(a, b: int): int {
+				if a > b {
+					return a + %d
+				}
+				return a + b
+			}
+		`, i, i)
+	}
+	return source.String()
+}
@@ -0,0 +1,1575 @@
+// Package js generates readable ES2020 JavaScript from the AST.
+//
+// Classes map to JavaScript classes, enums to objects of tagged values in the
+// form {tag: "Case", value: v}, dicts to objects and sets to Sets. Types are
+// erased, so analysis is optional, but without it division of integers is not
+// truncated and the builtin methods of arrays and maps are not lowered to
+// their JavaScript equivalents.
+package js
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// Generate JavaScript for ast.
+//
+// Compile-time conditionals must already have been applied with ApplyConditionals.
+func Generate(w io.Writer, ast *parser.AST) error {
+	return generate(w, &generator{}, ast)
+}
+
+// GenerateProgram generates JavaScript for an analysed program, using its types
+// where JavaScript semantics differ, such as for integer division.
+func GenerateProgram(w io.Writer, program *analyser.Program) error {
+	return generate(w, &generator{program: program}, program.AST)
+}
+
+func generate(w io.Writer, g *generator, ast *parser.AST) error {
+	if err := g.genAST(ast); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, g.out.String())
+	return errors.WithStack(err)
+}
+
+// GenerateWithSourceMap generates JavaScript for ast to w, and a source map for it to sourceMap.
+//
+// "file" is the name of the generated JavaScript file, which is referenced by the
+// source map, and "source" is the name of the source file the AST was parsed from.
+func GenerateWithSourceMap(w, sourceMap io.Writer, file, source string, ast *parser.AST) error {
+	g := &generator{}
+	if err := g.genAST(ast); err != nil {
+		return err
+	}
+	g.print("//# sourceMappingURL=" + file + ".map\n")
+	if _, err := io.WriteString(w, g.out.String()); err != nil {
+		return errors.WithStack(err)
+	}
+	return newSourceMap(file, source, g.mappings).Write(sourceMap)
+}
+
+// Binding precedence of JavaScript binary operators.
+var precedence = map[parser.Op]int{
+	parser.OpOr:     3,
+	parser.OpAnd:    4,
+	parser.OpBitOr:  5,
+	parser.OpBitAnd: 7,
+	parser.OpEq:     8,
+	parser.OpNe:     8,
+	parser.OpLt:     9,
+	parser.OpGt:     9,
+	parser.OpLe:     9,
+	parser.OpGe:     9,
+	parser.OpAdd:    11,
+	parser.OpSub:    11,
+	parser.OpMul:    12,
+	parser.OpDiv:    12,
+	parser.OpMod:    12,
+	parser.OpPow:    13,
+}
+
+type generator struct {
+	// Types of the program, if it has been analysed.
+	program  *analyser.Program
+	out      strings.Builder
+	line     int
+	column   int
+	indent   int
+	mappings []mapping
+	// Module path of the AST, used to resolve relative imports.
+	module string
+	// Members of the enclosing class, mapped to the JavaScript expression used to access them.
+	class map[string]string
+	// Methods of the enclosing class.
+	methods map[string]bool
+	// Local variables, which shadow class members.
+	scopes []map[string]bool
+	// True if html templates are used, requiring the $escapeHTML helper.
+	escapeHTML bool
+	// True if sort() is used without a comparison function, requiring the $compare helper.
+	compare bool
+	// True if a method is referenced without being called, requiring the $bind helper.
+	bind bool
+	// Whether each enum case name is declared with named associated values,
+	// which are held in an array. Cases of the same name must agree.
+	fieldCases map[string]bool
+}
+
+func (g *generator) print(s string) {
+	g.out.WriteString(s)
+	for _, rn := range s {
+		if rn == '\n' {
+			g.line++
+			g.column = 0
+		} else {
+			// Source map columns are in UTF-16 code units.
+			if rn >= 0x10000 {
+				g.column += 2
+			} else {
+				g.column++
+			}
+		}
+	}
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	g.print(fmt.Sprintf(format, args...))
+}
+
+// Map the current output position to pos in the source.
+func (g *generator) mark(pos lexer.Position) {
+	if pos.Line == 0 {
+		return
+	}
+	m := mapping{genLine: g.line, genColumn: g.column, srcLine: pos.Line - 1, srcColumn: pos.Column - 1}
+	if n := len(g.mappings); n > 0 && g.mappings[n-1].genLine == m.genLine && g.mappings[n-1].genColumn == m.genColumn {
+		g.mappings[n-1] = m
+		return
+	}
+	g.mappings = append(g.mappings, m)
+}
+
+func (g *generator) startLine() {
+	g.print(strings.Repeat("  ", g.indent))
+}
+
+func (g *generator) endLine() {
+	g.print("\n")
+}
+
+func (g *generator) pushScope(names ...string) {
+	scope := map[string]bool{}
+	for _, name := range names {
+		scope[name] = true
+	}
+	g.scopes = append(g.scopes, scope)
+}
+
+func (g *generator) popScope() {
+	g.scopes = g.scopes[:len(g.scopes)-1]
+}
+
+func (g *generator) declare(names ...string) {
+	if len(g.scopes) == 0 {
+		return
+	}
+	for _, name := range names {
+		g.scopes[len(g.scopes)-1][name] = true
+	}
+}
+
+// Resolve an identifier to its JavaScript form, which differs for class members.
+func (g *generator) ident(name string) string {
+	if g.class == nil {
+		return name
+	}
+	if name == "self" {
+		return "this"
+	}
+	for _, scope := range g.scopes {
+		if scope[name] {
+			return name
+		}
+	}
+	if access, ok := g.class[name]; ok {
+		return access + name
+	}
+	return name
+}
+
+func (g *generator) genAST(ast *parser.AST) error {
+	if ast.Module != nil {
+		g.module = ast.Module.Name
+	}
+	// Switches may precede the enums they match on.
+	g.fieldCases = map[string]bool{}
+	err := parser.VisitFunc(ast, func(node parser.Node, next parser.Next) error {
+		if cse, ok := node.(*parser.CaseDecl); ok {
+			fields := cse.Fields != nil
+			if other, ok := g.fieldCases[cse.Name]; ok && other != fields {
+				return participle.Errorf(cse.Pos, "enum case %q is declared both with and without named associated values, which is not supported by the JavaScript backend", cse.Name)
+			}
+			g.fieldCases[cse.Name] = fields
+		}
+		return next(nil)
+	})
+	if err != nil {
+		return err
+	}
+	for _, decl := range ast.Declarations {
+		if err := g.genRootDecl(decl); err != nil {
+			return err
+		}
+	}
+	if g.escapeHTML {
+		// Function declarations are hoisted, so the helper can follow its uses.
+		g.print(escapeHTMLHelper)
+	}
+	if g.compare {
+		g.print(compareHelper)
+	}
+	if g.bind {
+		g.print(bindHelper)
+	}
+	return nil
+}
+
+const escapeHTMLHelper = `function $escapeHTML(s) {
+  return String(s).replace(/[&<>"']/g, (c) => "&#" + c.charCodeAt(0) + ";");
+}
+`
+
+// JavaScript sorts by string value by default, so sort() compares with
+// compare() methods or the builtin operators instead.
+const compareHelper = `function $compare(a, b) {
+  if (typeof a.compare === "function") return a.compare(b);
+  return a < b ? -1 : a > b ? 1 : 0;
+}
+`
+
+// Methods lose their receiver when referenced without being called.
+const bindHelper = `function $bind(receiver, method) {
+  return receiver[method].bind(receiver);
+}
+`
+
+func (g *generator) genRootDecl(decl *parser.RootDecl) error {
+	if decl.Import != nil {
+		return g.genImport(decl.Import)
+	}
+	if decl.Cond != nil {
+		return participle.Errorf(decl.Pos, "compile-time conditionals must be applied before generating JavaScript")
+	}
+	g.startLine()
+	g.mark(decl.Pos)
+	if decl.Modifiers.Has(parser.ModifierPublic) {
+		g.print("export ")
+	}
+	var err error
+	switch {
+	case decl.Func != nil:
+		err = g.genFunc("function ", decl.Func)
+
+	case decl.Class != nil:
+		err = g.genClass(decl.Class)
+
+	case decl.Enum != nil:
+		err = g.genEnum(decl.Enum)
+
+	case decl.Var != nil:
+		err = g.genVarDecl(decl.Var)
+
+	default:
+		panic("??")
+	}
+	if err != nil {
+		return err
+	}
+	g.endLine()
+	return nil
+}
+
+func (g *generator) genImport(imp *parser.ImportDecl) error {
+	module := imp.Module()
+	file := strings.TrimSuffix(parser.ModuleFile(module), path.Ext(parser.ModuleFile(module))) + ".js"
+	file = relativePath(path.Dir(parser.ModuleFile(g.module)), file)
+	g.startLine()
+	g.mark(imp.Pos)
+	switch {
+	case imp.Qualified != nil && imp.Qualified.Wildcard:
+		return participle.Errorf(imp.Pos, "wildcard imports are not supported by the JavaScript backend")
+
+	case imp.Qualified != nil && imp.Qualified.Symbols != nil:
+		g.printf("import {%s} from %s;", strings.Join(imp.Qualified.Symbols, ", "), quote(file))
+
+	default:
+		name := imp.Alias
+		if name == "" {
+			name = module[strings.LastIndex(module, ".")+1:]
+		}
+		g.printf("import * as %s from %s;", name, quote(file))
+	}
+	g.endLine()
+	return nil
+}
+
+// Path of target relative to the directory dir, in the form expected by import statements.
+func relativePath(dir, target string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasPrefix(rel, "../") {
+		return rel
+	}
+	return "./" + rel
+}
+
+func (g *generator) genFunc(prefix string, fn *parser.FuncDecl) error {
+	g.print(prefix + fn.Name)
+	g.declare(fn.Name)
+	params := parameterNames(fn.Parameters)
+	g.printf("(%s) ", strings.Join(params, ", "))
+	g.pushScope(params...)
+	defer g.popScope()
+	return g.genBlock(fn.Body)
+}
+
+func parameterNames(parameters []*parser.Parameters) []string {
+	names := []string{}
+	for _, p := range parameters {
+		names = append(names, p.Names...)
+	}
+	return names
+}
+
+func (g *generator) genClass(class *parser.ClassDecl) error {
+	name := class.Type.Type
+	g.declare(name)
+	members := map[string]string{}
+	methods := map[string]bool{}
+	var (
+		fields  []*parser.VarDeclAsgn
+		statics []*parser.VarDeclAsgn
+		init    *parser.InitialiserDecl
+	)
+	for _, member := range class.Members {
+		access := "this."
+		if member.Modifiers.Has(parser.ModifierStatic) {
+			access = name + "."
+		}
+		switch {
+		case member.VarDecl != nil:
+			for _, v := range member.VarDecl.Vars {
+				if v.Pattern != nil {
+					return participle.Errorf(v.Pos, "destructuring is not supported in class fields")
+				}
+				members[v.Name] = access
+				if v.Default == nil {
+					continue
+				}
+				if member.Modifiers.Has(parser.ModifierStatic) {
+					statics = append(statics, v)
+				} else {
+					fields = append(fields, v)
+				}
+			}
+
+		case member.FuncDecl != nil:
+			members[member.FuncDecl.Name] = access
+			methods[member.FuncDecl.Name] = true
+
+		case member.InitialiserDecl != nil:
+			if init != nil {
+				return participle.Errorf(member.Pos, "multiple initialisers are not supported by the JavaScript backend")
+			}
+			init = member.InitialiserDecl
+
+		default:
+			return participle.Errorf(member.Pos, "nested declarations are not supported by the JavaScript backend")
+		}
+	}
+
+	outer, outerMethods, scopes := g.class, g.methods, g.scopes
+	g.class, g.methods, g.scopes = members, methods, nil
+	defer func() { g.class, g.methods, g.scopes = outer, outerMethods, scopes }()
+
+	g.printf("class %s {", name)
+	g.endLine()
+	g.indent++
+	if init != nil || len(fields) > 0 {
+		var params []string
+		if init != nil {
+			params = parameterNames(init.Parameters)
+		}
+		g.startLine()
+		if init != nil {
+			g.mark(init.Pos)
+		}
+		g.printf("constructor(%s) {", strings.Join(params, ", "))
+		g.endLine()
+		g.indent++
+		g.pushScope(params...)
+		for _, field := range fields {
+			g.startLine()
+			if err := g.genField("this.", field); err != nil {
+				return err
+			}
+			g.endLine()
+		}
+		if init != nil {
+			if err := g.genStmts(init.Body.Statements); err != nil {
+				return err
+			}
+		}
+		g.popScope()
+		g.indent--
+		g.startLine()
+		g.print("}")
+		g.endLine()
+	}
+	for _, member := range class.Members {
+		if member.FuncDecl == nil {
+			continue
+		}
+		g.startLine()
+		g.mark(member.Pos)
+		prefix := ""
+		if member.Modifiers.Has(parser.ModifierStatic) {
+			prefix = "static "
+		}
+		if err := g.genFunc(prefix, member.FuncDecl); err != nil {
+			return err
+		}
+		g.endLine()
+	}
+	g.indent--
+	g.startLine()
+	g.print("}")
+	// ES2020 does not support static class fields, so assign them after the class.
+	for _, field := range statics {
+		g.endLine()
+		g.startLine()
+		if err := g.genField(name+".", field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) genField(access string, field *parser.VarDeclAsgn) error {
+	g.mark(field.Pos)
+	g.print(access + field.Name + " = ")
+	if err := g.genExpr(field.Default); err != nil {
+		return err
+	}
+	g.print(";")
+	return nil
+}
+
+func (g *generator) genEnum(enum *parser.EnumDecl) error {
+	g.declare(enum.Type.Type)
+	g.printf("const %s = {", enum.Type.Type)
+	g.endLine()
+	g.indent++
+	for _, member := range enum.Members {
+		if member.CaseDecl == nil {
+			return participle.Errorf(member.Pos, "enum methods are not supported by the JavaScript backend")
+		}
+		cse := member.CaseDecl
+		g.startLine()
+		g.mark(cse.Pos)
+		switch {
+		case cse.Type != nil:
+			g.printf("%s: (value) => ({tag: %s, value}),", cse.Name, quote(cse.Name))
+
+		case cse.Fields != nil:
+			// Named associated values are held in order, to be bound by position.
+			names := []string{}
+			for _, field := range cse.Fields {
+				names = append(names, field.Name)
+			}
+			g.printf("%s: (%s) => ({tag: %s, value: [%s]}),", cse.Name, strings.Join(names, ", "), quote(cse.Name), strings.Join(names, ", "))
+
+		case cse.Value != nil:
+			g.printf("%s: {tag: %s, rawValue: ", cse.Name, quote(cse.Name))
+			if err := g.genExpr(cse.Value); err != nil {
+				return err
+			}
+			g.print("},")
+
+		default:
+			g.printf("%s: {tag: %s},", cse.Name, quote(cse.Name))
+		}
+		g.endLine()
+	}
+	g.indent--
+	g.startLine()
+	g.print("};")
+	return nil
+}
+
+func (g *generator) genVarDecl(decl *parser.VarDecl) error {
+	if decl.Const {
+		g.print("const ")
+	} else {
+		g.print("let ")
+	}
+	for i, v := range decl.Vars {
+		if i > 0 {
+			g.print(", ")
+		}
+		g.mark(v.Pos)
+		switch {
+		case v.Pattern != nil && v.Pattern.Array != nil:
+			elements := []string{}
+			for _, element := range v.Pattern.Array.Elements {
+				if element.Rest {
+					elements = append(elements, "..."+element.Name)
+				} else {
+					elements = append(elements, element.Name)
+				}
+			}
+			g.printf("[%s]", strings.Join(elements, ", "))
+
+		case v.Pattern != nil && v.Pattern.Dict != nil:
+			g.printf("{%s}", strings.Join(v.Pattern.Dict.Keys, ", "))
+
+		default:
+			g.print(v.Name)
+		}
+		if v.Default != nil {
+			g.print(" = ")
+			if err := g.genExpr(v.Default); err != nil {
+				return err
+			}
+		}
+		if v.Pattern != nil {
+			g.declare(v.Pattern.Names()...)
+		} else {
+			g.declare(v.Name)
+		}
+	}
+	g.print(";")
+	return nil
+}
+
+// Generate a block, starting on the current line.
+func (g *generator) genBlock(block *parser.Block) error {
+	g.print("{")
+	g.endLine()
+	g.indent++
+	g.pushScope()
+	if err := g.genStmts(block.Statements); err != nil {
+		return err
+	}
+	g.popScope()
+	g.indent--
+	g.startLine()
+	g.print("}")
+	return nil
+}
+
+func (g *generator) genStmts(stmts []*parser.Stmt) error {
+	for _, stmt := range stmts {
+		if err := g.genStmt(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) genStmt(stmt *parser.Stmt) error {
+	g.startLine()
+	g.mark(stmt.Pos)
+	if stmt.Label != "" {
+		g.printf("%s: ", stmt.Label)
+	}
+	var err error
+	switch {
+	case stmt.Return != nil:
+		g.print("return")
+		if stmt.Return.Value != nil {
+			g.print(" ")
+			err = g.genExpr(stmt.Return.Value)
+		}
+		g.print(";")
+
+	case stmt.If != nil:
+		err = g.genIf(stmt.If)
+
+	case stmt.Break != nil:
+		g.print("break")
+		if stmt.Break.Label != "" {
+			g.print(" " + stmt.Break.Label)
+		}
+		g.print(";")
+
+	case stmt.Continue != nil:
+		g.print("continue")
+		if stmt.Continue.Label != "" {
+			g.print(" " + stmt.Continue.Label)
+		}
+		g.print(";")
+
+	case stmt.For != nil:
+		err = g.genFor(stmt.For)
+
+	case stmt.Switch != nil:
+		err = g.genSwitch(stmt.Switch)
+
+	case stmt.Block != nil:
+		err = g.genBlock(stmt.Block)
+
+	case stmt.VarDecl != nil:
+		err = g.genVarDecl(stmt.VarDecl)
+
+	case stmt.FuncDecl != nil:
+		err = g.genFunc("function ", stmt.FuncDecl)
+
+	case stmt.ClassDecl != nil:
+		err = g.genClass(stmt.ClassDecl)
+
+	case stmt.EnumDecl != nil:
+		err = g.genEnum(stmt.EnumDecl)
+
+	case stmt.ExprStmt != nil:
+		err = g.genExprStmt(stmt.ExprStmt)
+
+	default:
+		panic("??")
+	}
+	if err != nil {
+		return err
+	}
+	g.endLine()
+	return nil
+}
+
+func (g *generator) genIf(stmt *parser.IfStmt) error {
+	if stmt.Binding != "" {
+		return g.genIfLet(stmt)
+	}
+	g.print("if (")
+	if err := g.genExpr(stmt.Condition); err != nil {
+		return err
+	}
+	g.print(") ")
+	if err := g.genBlock(stmt.Main); err != nil {
+		return err
+	}
+	return g.genElse(stmt)
+}
+
+func (g *generator) genElse(stmt *parser.IfStmt) error {
+	switch {
+	case stmt.ElseIf != nil:
+		g.print(" else ")
+		return g.genIf(stmt.ElseIf)
+
+	case stmt.Else != nil:
+		g.print(" else ")
+		return g.genBlock(stmt.Else)
+	}
+	return nil
+}
+
+// Generate an "if let", which holds the value in a temporary so that the
+// binding may shadow a variable referenced by the condition.
+func (g *generator) genIfLet(stmt *parser.IfStmt) error {
+	g.print("{")
+	g.endLine()
+	g.indent++
+	g.startLine()
+	g.print("const $let = ")
+	if err := g.genExpr(stmt.Condition); err != nil {
+		return err
+	}
+	g.print(";")
+	g.endLine()
+	g.startLine()
+	g.print("if ($let != null) {")
+	g.endLine()
+	g.indent++
+	g.pushScope()
+	g.startLine()
+	g.printf("const %s = $let;", stmt.Binding)
+	g.endLine()
+	g.declare(stmt.Binding)
+	if err := g.genStmts(stmt.Main.Statements); err != nil {
+		return err
+	}
+	g.popScope()
+	g.indent--
+	g.startLine()
+	g.print("}")
+	if err := g.genElse(stmt); err != nil {
+		return err
+	}
+	g.endLine()
+	g.indent--
+	g.startLine()
+	g.print("}")
+	return nil
+}
+
+func (g *generator) genFor(stmt *parser.ForStmt) error {
+	target := stmt.Target.Terminal.Ident
+	if target == "" || stmt.Target.Next != nil {
+		return participle.Errorf(stmt.Target.Pos, "for loop target must be an identifier")
+	}
+	g.printf("for (const %s of ", target)
+	if err := g.genExpr(stmt.Source); err != nil {
+		return err
+	}
+	g.print(") ")
+	g.pushScope(target)
+	defer g.popScope()
+	return g.genBlock(stmt.Body)
+}
+
+// Generate a switch statement.
+//
+// Switches on enum cases select on the tag of the value, which is held in a
+// temporary so that the values of cases can be bound.
+func (g *generator) genSwitch(stmt *parser.SwitchStmt) error {
+	onEnum := false
+	for _, cse := range stmt.Cases {
+		if cse.Case != nil && cse.Case.EnumCase != nil {
+			onEnum = true
+		}
+	}
+	if onEnum {
+		g.print("{")
+		g.endLine()
+		g.indent++
+		g.startLine()
+		g.print("const $switch = ")
+		if err := g.genExpr(stmt.Target); err != nil {
+			return err
+		}
+		g.print(";")
+		g.endLine()
+		g.startLine()
+		g.print("switch ($switch.tag) {")
+	} else {
+		g.print("switch (")
+		if err := g.genExpr(stmt.Target); err != nil {
+			return err
+		}
+		g.print(") {")
+	}
+	g.endLine()
+	g.indent++
+	for _, cse := range stmt.Cases {
+		g.startLine()
+		g.mark(cse.Pos)
+		var bind []string
+		switch {
+		case cse.Default:
+			g.print("default: {")
+
+		case cse.Case.EnumCase != nil:
+			g.printf("case %s: {", quote(cse.Case.EnumCase.Case))
+			if cse.Case.EnumCase.Var != "" {
+				bind = append([]string{cse.Case.EnumCase.Var}, cse.Case.EnumCase.Rest...)
+			}
+
+		default:
+			g.print("case ")
+			if err := g.genExpr(cse.Case.ExprCase); err != nil {
+				return err
+			}
+			g.print(": {")
+		}
+		g.endLine()
+		g.indent++
+		g.pushScope()
+		// Values bound to "_" are ignored, leaving holes when destructuring.
+		names := []string{}
+		for _, name := range bind {
+			if name == "_" {
+				name = ""
+			} else {
+				g.declare(name)
+			}
+			names = append(names, name)
+		}
+		switch {
+		case len(names) == 1 && names[0] != "" && !g.fieldCases[cse.Case.EnumCase.Case]:
+			g.startLine()
+			g.printf("const %s = $switch.value;", names[0])
+			g.endLine()
+
+		case strings.Join(names, "") != "":
+			g.startLine()
+			g.printf("const [%s] = $switch.value;", strings.Join(names, ", "))
+			g.endLine()
+		}
+		if err := g.genStmts(cse.Body); err != nil {
+			return err
+		}
+		g.popScope()
+		if !terminates(cse.Body) {
+			g.startLine()
+			g.print("break;")
+			g.endLine()
+		}
+		g.indent--
+		g.startLine()
+		g.print("}")
+		g.endLine()
+	}
+	g.indent--
+	g.startLine()
+	g.print("}")
+	if onEnum {
+		g.endLine()
+		g.indent--
+		g.startLine()
+		g.print("}")
+	}
+	return nil
+}
+
+// Returns true if control can not flow past the end of stmts.
+func terminates(stmts []*parser.Stmt) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	last := stmts[len(stmts)-1]
+	return last.Return != nil || last.Break != nil || last.Continue != nil
+}
+
+func (g *generator) genExprStmt(stmt *parser.ExprStmt) error {
+	if stmt.Op == parser.OpDivAsgn && g.isInt(stmt.LHS) && g.isInt(stmt.RHS) {
+		return g.genIntDivAsgn(stmt)
+	}
+	if err := g.genExpr(stmt.LHS); err != nil {
+		return err
+	}
+	if stmt.RHS != nil {
+		op := stmt.Op.String()
+		if stmt.Op == parser.OpPowAsgn {
+			op = "**="
+		}
+		g.printf(" %s ", op)
+		if err := g.genExpr(stmt.RHS); err != nil {
+			return err
+		}
+	}
+	g.print(";")
+	return nil
+}
+
+func (g *generator) genExpr(expr *parser.Expr) error {
+	if expr.Unary != nil {
+		return g.genUnary(expr.Unary)
+	}
+	if _, ok := precedence[expr.Op]; !ok {
+		return participle.Errorf(expr.Pos, "operator %s is not supported by the JavaScript backend", expr.Op)
+	}
+	if expr.Chained {
+		return g.genChain(expr)
+	}
+	if g.isIntDivision(expr) {
+		// JavaScript numbers are floats.
+		g.print("Math.trunc(")
+		if err := g.genOperand(expr.Left, expr.Op, false); err != nil {
+			return err
+		}
+		g.print(" / ")
+		if err := g.genOperand(expr.Right, expr.Op, true); err != nil {
+			return err
+		}
+		g.print(")")
+		return nil
+	}
+	if err := g.genOperand(expr.Left, expr.Op, false); err != nil {
+		return err
+	}
+	g.genOp(expr.Op)
+	return g.genOperand(expr.Right, expr.Op, true)
+}
+
+func (g *generator) genOp(op parser.Op) {
+	switch op {
+	case parser.OpEq:
+		g.print(" === ")
+	case parser.OpNe:
+		g.print(" !== ")
+	case parser.OpPow:
+		g.print(" ** ")
+	default:
+		g.printf(" %s ", op)
+	}
+}
+
+// Chained comparisons become a conjunction of comparisons, eg. "a < b < c"
+// becomes "a < b && b < c". Operands other than variables and literals are
+// passed to arrow functions, so that each is evaluated once and in order:
+//
+//	(($0, $1) => $0 < $1 && $1 < c())(a(), b())
+func (g *generator) genChain(expr *parser.Expr) error {
+	var (
+		operands []*parser.Expr
+		ops      []parser.Op
+	)
+	for e := expr; ; e = e.Left {
+		operands = append([]*parser.Expr{e.Right}, operands...)
+		ops = append([]parser.Op{e.Op}, ops...)
+		if !e.Chained {
+			operands = append([]*parser.Expr{e.Left}, operands...)
+			break
+		}
+	}
+	// The JavaScript for each operand, once it has been bound to a parameter.
+	bound := make([]string, len(operands))
+	operand := func(i int, op parser.Op, right bool) error {
+		if bound[i] != "" {
+			g.print(bound[i])
+			return nil
+		}
+		return g.genOperand(operands[i], op, right)
+	}
+	var gen func(i int) error
+	// Generate the comparisons from operand i onwards.
+	gen = func(i int) error {
+		var params []int
+		if i < len(operands)-2 && !operands[i+1].Repeatable() {
+			// Evaluating the next operand first would reorder it before this one.
+			if i == 0 && !operands[0].Repeatable() {
+				params = append(params, 0)
+			}
+			params = append(params, i+1)
+		}
+		if len(params) > 0 {
+			names := []string{}
+			for _, param := range params {
+				bound[param] = fmt.Sprintf("$%d", param)
+				names = append(names, bound[param])
+			}
+			g.printf("((%s) => ", strings.Join(names, ", "))
+		}
+		if err := operand(i, ops[i], false); err != nil {
+			return err
+		}
+		g.genOp(ops[i])
+		if err := operand(i+1, ops[i], true); err != nil {
+			return err
+		}
+		if i+2 < len(operands) {
+			g.print(" && ")
+			if err := gen(i + 1); err != nil {
+				return err
+			}
+		}
+		if len(params) > 0 {
+			g.print(")(")
+			for j, param := range params {
+				if j > 0 {
+					g.print(", ")
+				}
+				if err := g.genExpr(operands[param]); err != nil {
+					return err
+				}
+			}
+			g.print(")")
+		}
+		return nil
+	}
+	return gen(0)
+}
+
+// Integer division assignments are truncated, eg. "a /= 2" becomes
+// "a = Math.trunc(a / 2)", so the target is evaluated twice.
+func (g *generator) genIntDivAsgn(stmt *parser.ExprStmt) error {
+	if !isRepeatableTarget(stmt.LHS) {
+		return participle.Errorf(stmt.LHS.Pos, "integer division assigned to a target with side effects is not supported by the JavaScript backend, it must be desugared first")
+	}
+	if err := g.genExpr(stmt.LHS); err != nil {
+		return err
+	}
+	g.print(" = Math.trunc(")
+	if err := g.genExpr(stmt.LHS); err != nil {
+		return err
+	}
+	g.print(" / ")
+	if err := g.genOperand(stmt.RHS, parser.OpDiv, true); err != nil {
+		return err
+	}
+	g.print(");")
+	return nil
+}
+
+// Returns true if evaluating the assignment target expr has no side effects.
+func isRepeatableTarget(expr *parser.Expr) bool {
+	if expr.Unary == nil {
+		return false
+	}
+	ref := expr.Unary.Reference
+	if ref.Terminal.Ident == "" {
+		return false
+	}
+	for next := ref.Next; next != nil; next = next.Next {
+		switch {
+		case next.Reference != nil:
+		case next.Subscript != nil && next.Subscript.Repeatable():
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if expr divides integers, according to the program's types.
+func (g *generator) isIntDivision(expr *parser.Expr) bool {
+	return expr.Op == parser.OpDiv && g.isInt(expr.Left) && g.isInt(expr.Right)
+}
+
+// Returns true if expr is an integer, according to the program's types.
+func (g *generator) isInt(expr *parser.Expr) bool {
+	if g.program == nil {
+		return false
+	}
+	ref := g.program.Resolved(expr)
+	if ref == nil {
+		return false
+	}
+	switch ref.Kind() {
+	case types.KindInt, types.KindLiteralInt:
+		return true
+	}
+	return false
+}
+
+// Generate an operand of a binary operator, parenthesising it if required.
+func (g *generator) genOperand(operand *parser.Expr, op parser.Op, right bool) error {
+	parens := false
+	switch {
+	case g.isIntDivision(operand):
+		// Truncation is a call, which binds tighter than any operator.
+	case operand.Unary == nil:
+		// All operators are left associative, except for exponentiation.
+		parens = precedence[operand.Op] < precedence[op] ||
+			(precedence[operand.Op] == precedence[op] && right != (op == parser.OpPow))
+	case operand.Unary.Op != 0 && op == parser.OpPow && !right:
+		// JavaScript forbids a unary operator on the left of "**".
+		parens = true
+	}
+	if parens {
+		g.print("(")
+	}
+	if err := g.genExpr(operand); err != nil {
+		return err
+	}
+	if parens {
+		g.print(")")
+	}
+	return nil
+}
+
+func (g *generator) genUnary(unary *parser.Unary) error {
+	if unary.Op != 0 {
+		g.print(unary.Op.String())
+	}
+	return g.genReference(unary.Reference)
+}
+
+func (g *generator) genReference(ref *parser.Reference) error {
+	if method := g.unboundMethod(ref); method != "" {
+		g.bind = true
+		g.print("$bind(")
+		if ref.Next == nil {
+			g.mark(ref.Terminal.Pos)
+			g.print(strings.TrimSuffix(g.class[method], "."))
+		} else if err := g.genReferenceUntil(ref, lastNext(ref)); err != nil {
+			return err
+		}
+		g.printf(", %q)", method)
+		return nil
+	}
+	return g.genReferenceUntil(ref, nil)
+}
+
+// Returns the name of the method ref refers to without calling it, if any.
+//
+// Members of the enclosing class are known to be methods, but the program's
+// types are needed to tell a method from a field of other values.
+func (g *generator) unboundMethod(ref *parser.Reference) string {
+	if ref.Next == nil {
+		name := ref.Terminal.Ident
+		if name == "" || !g.methods[name] || g.ident(name) == name {
+			return ""
+		}
+		return name
+	}
+	last := lastNext(ref)
+	if last.Reference == nil || g.program == nil {
+		return ""
+	}
+	field := g.program.Resolved(last.Reference)
+	if field == nil || field.Kind() != types.KindFunc {
+		return ""
+	}
+	return last.Reference.Ident
+}
+
+func lastNext(ref *parser.Reference) *parser.ReferenceNext {
+	last := ref.Next
+	for last.Next != nil {
+		last = last.Next
+	}
+	return last
+}
+
+// Generate ref up to, but excluding, stop.
+func (g *generator) genReferenceUntil(ref *parser.Reference, stop *parser.ReferenceNext) error {
+	// Maps are objects, so keys() and values() wrap their receiver.
+	var wrap *parser.ReferenceNext
+	for next := ref.Next; next != stop; next = next.Next {
+		if g.isMapMethod(next) {
+			wrap = next
+		}
+	}
+	start := ref.Next
+	if wrap != nil {
+		g.mark(wrap.Reference.Pos)
+		g.printf("Object.%s(", wrap.Reference.Ident)
+		if err := g.genReferenceUntil(ref, wrap); err != nil {
+			return err
+		}
+		g.print(")")
+		start = wrap.Next.Next
+	} else if err := g.genTerminal(ref.Terminal); err != nil {
+		return err
+	}
+	for next := start; next != stop; next = next.Next {
+		switch {
+		case next.Subscript != nil:
+			g.print("[")
+			if err := g.genExpr(next.Subscript); err != nil {
+				return err
+			}
+			g.print("]")
+
+		case next.Reference != nil:
+			if next.Reference.Ident == "" {
+				return participle.Errorf(next.Reference.Pos, "invalid field reference via %s", next.Reference.Describe())
+			}
+			g.print(".")
+			g.mark(next.Reference.Pos)
+			g.print(next.Reference.Ident)
+			if g.isArrayMethod(next, "sort") && next.Next.Call.Arity() == 0 {
+				g.compare = true
+				g.print("($compare)")
+				next = next.Next
+			} else if g.isArrayMethod(next, "reduce") {
+				// JavaScript takes the initial value last.
+				if err := g.genReduceCall(next.Next.Call); err != nil {
+					return err
+				}
+				next = next.Next
+			}
+
+		case next.Call != nil:
+			if err := g.genCall(next.Call); err != nil {
+				return err
+			}
+
+		case next.Specialisation != nil:
+			// Types are erased.
+
+		default:
+			panic("??")
+		}
+	}
+	return nil
+}
+
+// Returns true if next calls the keys() or values() method of a map.
+func (g *generator) isMapMethod(next *parser.ReferenceNext) bool {
+	if next.Reference == nil || next.Next == nil || next.Next.Call == nil || g.program == nil {
+		return false
+	}
+	if _, ok := g.program.Owner(next.Reference).(*types.MapType); !ok {
+		return false
+	}
+	return next.Reference.Ident == "keys" || next.Reference.Ident == "values"
+}
+
+// Returns true if next calls the named method of an array.
+func (g *generator) isArrayMethod(next *parser.ReferenceNext, name string) bool {
+	if next.Reference == nil || next.Reference.Ident != name || next.Next == nil || next.Next.Call == nil || g.program == nil {
+		return false
+	}
+	_, ok := g.program.Owner(next.Reference).(types.ArrayType)
+	return ok
+}
+
+func (g *generator) genReduceCall(call *parser.Call) error {
+	if len(call.Parameters) == 0 || call.Arity() != 2 {
+		return participle.Errorf(call.Pos, "reduce() requires an initial value and a combining function")
+	}
+	g.print("(")
+	var err error
+	if call.TrailingClosure != nil {
+		err = g.genClosure(call.TrailingClosure)
+	} else {
+		err = g.genExpr(call.Parameters[1])
+	}
+	if err != nil {
+		return err
+	}
+	g.print(", ")
+	if err := g.genExpr(call.Parameters[0]); err != nil {
+		return err
+	}
+	g.print(")")
+	return nil
+}
+
+func (g *generator) genCall(call *parser.Call) error {
+	g.print("(")
+	for i, param := range call.Parameters {
+		if i > 0 {
+			g.print(", ")
+		}
+		if err := g.genExpr(param); err != nil {
+			return err
+		}
+	}
+	if call.TrailingClosure != nil {
+		if len(call.Parameters) > 0 {
+			g.print(", ")
+		}
+		if err := g.genClosure(call.TrailingClosure); err != nil {
+			return err
+		}
+	}
+	g.print(")")
+	return nil
+}
+
+// Closures become arrow functions, returning their result.
+func (g *generator) genClosure(closure *parser.Closure) error {
+	g.mark(closure.Pos)
+	g.printf("(%s) => ", strings.Join(closure.Parameters, ", "))
+	g.pushScope(closure.Parameters...)
+	defer g.popScope()
+	result := closure.Result()
+	switch {
+	case len(closure.Body) == 0:
+		g.print("{}")
+		return nil
+	case result != nil && len(closure.Body) == 1:
+		return g.genExpr(result)
+	}
+	stmts := closure.Body
+	if result != nil {
+		stmts = stmts[:len(stmts)-1]
+	}
+	g.print("{")
+	g.endLine()
+	g.indent++
+	if err := g.genStmts(stmts); err != nil {
+		return err
+	}
+	if result != nil {
+		g.startLine()
+		g.mark(result.Pos)
+		g.print("return ")
+		if err := g.genExpr(result); err != nil {
+			return err
+		}
+		g.print(";")
+		g.endLine()
+	}
+	g.indent--
+	g.startLine()
+	g.print("}")
+	return nil
+}
+
+func (g *generator) genTerminal(terminal *parser.Terminal) error {
+	g.mark(terminal.Pos)
+	switch {
+	case terminal.Tuple != nil:
+		// Sub-expressions are parenthesised, and tuples become arrays.
+		open, close := "[", "]"
+		if len(terminal.Tuple) == 1 {
+			open, close = "(", ")"
+		}
+		g.print(open)
+		for i, expr := range terminal.Tuple {
+			if i > 0 {
+				g.print(", ")
+			}
+			if err := g.genExpr(expr); err != nil {
+				return err
+			}
+		}
+		g.print(close)
+		return nil
+
+	case terminal.New != nil:
+		g.print("new ")
+		if err := g.genReference(terminal.New.Type); err != nil {
+			return err
+		}
+		if terminal.New.Call == nil {
+			g.print("()")
+			return nil
+		}
+		return g.genCall(terminal.New.Call)
+
+	case terminal.Do != nil:
+		return g.genDo(terminal.Do)
+
+	case terminal.Func != nil:
+		return participle.Errorf(terminal.Pos, "function types are not values")
+
+	case terminal.Literal != nil:
+		return g.genLiteral(terminal.Literal)
+
+	case terminal.Ident != "":
+		g.print(g.ident(terminal.Ident))
+		return nil
+
+	default:
+		panic("??")
+	}
+}
+
+// Do blocks become immediately invoked arrow functions.
+func (g *generator) genDo(do *parser.DoExpr) error {
+	result := do.Result()
+	if result == nil {
+		return participle.Errorf(do.Pos, "do block must end with an expression")
+	}
+	stmts := do.Body.Statements
+	g.print("(() => {")
+	g.endLine()
+	g.indent++
+	g.pushScope()
+	if err := g.genStmts(stmts[:len(stmts)-1]); err != nil {
+		return err
+	}
+	g.startLine()
+	g.mark(result.Pos)
+	g.print("return ")
+	if err := g.genExpr(result); err != nil {
+		return err
+	}
+	g.print(";")
+	g.endLine()
+	g.popScope()
+	g.indent--
+	g.startLine()
+	g.print("})()")
+	return nil
+}
+
+func (g *generator) genLiteral(literal *parser.Literal) error {
+	switch {
+	case literal.Number != nil:
+		g.print(formatNumber(literal.Number))
+
+	case literal.Str != nil:
+		return g.genString(literal.Str, "")
+
+	case literal.Template != nil:
+		if literal.Template.Tag != "html" {
+			return participle.Errorf(literal.Pos, "unknown template tag %q", literal.Template.Tag)
+		}
+		g.escapeHTML = true
+		return g.genString(literal.Template.Str, "$escapeHTML")
+
+	case literal.LitStr != nil:
+		g.print(quote(*literal.LitStr))
+
+	case literal.Embedded != nil:
+		g.print(quote(literal.Embedded.Content))
+
+	case literal.Char != nil:
+		// JavaScript has no character type.
+		g.print(quote(string(*literal.Char)))
+
+	case literal.Bool != nil:
+		g.printf("%v", bool(*literal.Bool))
+
+	case literal.Nil:
+		g.print("null")
+
+	case literal.DictOrSet != nil:
+		if literal.DictOrSet.Entries[0].Value != nil {
+			return g.genDict(literal.DictOrSet)
+		}
+		g.print("new Set([")
+		for i, entry := range literal.DictOrSet.Entries {
+			if i > 0 {
+				g.print(", ")
+			}
+			if err := g.genExpr(entry.Key); err != nil {
+				return err
+			}
+		}
+		g.print("])")
+
+	case literal.Array != nil:
+		g.print("[")
+		for i, value := range literal.Array.Values {
+			if i > 0 {
+				g.print(", ")
+			}
+			if err := g.genExpr(value); err != nil {
+				return err
+			}
+		}
+		g.print("]")
+
+	default:
+		panic("??")
+	}
+	return nil
+}
+
+// Dicts become objects, so they can be destructured and subscripted.
+func (g *generator) genDict(dict *parser.DictOrSetLiteral) error {
+	g.print("{")
+	for i, entry := range dict.Entries {
+		if i > 0 {
+			g.print(", ")
+		}
+		if key, ok := literalKey(entry.Key); ok {
+			g.print(key)
+		} else {
+			g.print("[")
+			if err := g.genExpr(entry.Key); err != nil {
+				return err
+			}
+			g.print("]")
+		}
+		g.print(": ")
+		if err := g.genExpr(entry.Value); err != nil {
+			return err
+		}
+	}
+	g.print("}")
+	return nil
+}
+
+// Returns the JavaScript property name for a constant key, if it is one.
+func literalKey(expr *parser.Expr) (string, bool) {
+	if expr.Unary == nil || expr.Unary.Op != 0 || expr.Unary.Reference.Next != nil {
+		return "", false
+	}
+	literal := expr.Unary.Reference.Terminal.Literal
+	switch {
+	case literal == nil:
+		return "", false
+
+	case literal.Number != nil:
+		return formatNumber(literal.Number), true
+
+	case literal.LitStr != nil:
+		return quote(*literal.LitStr), true
+
+	case literal.Embedded != nil:
+		return quote(literal.Embedded.Content), true
+
+	case literal.Str != nil:
+		text := ""
+		for _, fragment := range literal.Str.Fragments {
+			if fragment.Expr != nil {
+				return "", false
+			}
+			text += fragment.String
+		}
+		return quote(text), true
+
+	default:
+		return "", false
+	}
+}
+
+// Strings with interpolated expressions become template literals.
+//
+// If wrap is not empty, interpolated values are passed through the function of that name.
+func (g *generator) genString(str *parser.String, wrap string) error {
+	interpolated := false
+	text := ""
+	for _, fragment := range str.Fragments {
+		if fragment.Expr != nil {
+			interpolated = true
+		}
+		text += fragment.String
+	}
+	if !interpolated {
+		g.print(quote(text))
+		return nil
+	}
+	g.print("`")
+	for _, fragment := range str.Fragments {
+		if fragment.Expr == nil {
+			g.print(escape(fragment.String, '`'))
+			continue
+		}
+		g.print("${" + wrap)
+		if wrap != "" {
+			g.print("(")
+		}
+		if err := g.genExpr(fragment.Expr); err != nil {
+			return err
+		}
+		if wrap != "" {
+			g.print(")")
+		}
+		g.print("}")
+	}
+	g.print("`")
+	return nil
+}
+
+func formatNumber(n *parser.Number) string {
+	if !n.IsInt() {
+		return n.Value.Text('g', -1)
+	}
+	i, _ := n.Value.Int(nil)
+	switch n.Radix {
+	case 16:
+		return "0x" + i.Text(16)
+	case 8:
+		return "0o" + i.Text(8)
+	case 2:
+		return "0b" + i.Text(2)
+	default:
+		return i.String()
+	}
+}
+
+// Quote s as a JavaScript string literal.
+func quote(s string) string {
+	return `"` + escape(s, '"') + `"`
+}
+
+// Escape s for inclusion in a JavaScript string or template literal delimited by delim.
+func escape(s string, delim rune) string {
+	out := &strings.Builder{}
+	for i, rn := range s {
+		switch {
+		case rn == delim || rn == '\\':
+			out.WriteRune('\\')
+			out.WriteRune(rn)
+		case rn == '$' && delim == '`' && strings.HasPrefix(s[i+utf8.RuneLen(rn):], "{"):
+			out.WriteString(`\$`)
+		case rn == '\n':
+			out.WriteString(`\n`)
+		case rn == '\r':
+			out.WriteString(`\r`)
+		case rn == '\t':
+			out.WriteString(`\t`)
+		case rn < 0x20 || rn == 0x7f:
+			fmt.Fprintf(out, `\x%02x`, rn)
+		case rn == 0x2028 || rn == 0x2029:
+			fmt.Fprintf(out, `\u%04x`, rn)
+		default:
+			out.WriteRune(rn)
+		}
+	}
+	return out.String()
+}
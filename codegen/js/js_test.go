@@ -0,0 +1,612 @@
+package js
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output string
+		fail   string
+	}{
+		{name: "Function",
+			input: `
+				pub fn fib(n: int): int {
+					if n <= 1 {
+						return n
+					}
+					return fib(n-1) + fib(n-2)
+				}
+			`,
+			output: `
+export function fib(n) {
+  if (n <= 1) {
+    return n;
+  }
+  return fib(n - 1) + fib(n - 2);
+}
+`},
+		{name: "ChainedComparison",
+			input: `
+				let a = 0 < x <= 10
+				let b = f() < g() < h() < i()
+				let c = 0 < g() < 2 == true
+			`,
+			output: `
+let a = 0 < x && x <= 10;
+let b = (($0, $1) => $0 < $1 && (($2) => $1 < $2 && $2 < i())(h()))(f(), g());
+let c = (($1) => 0 < $1 && $1 < 2 && 2 === true)(g());
+`},
+		{name: "Class",
+			input: `
+				class Point {
+					let x = 0
+					let y: int
+					static let origin = 1
+					init(y: int) {
+						self.y = y
+					}
+					fn scale(x: int): int {
+						return x * y + sq(x)
+					}
+					static fn sq(n: int): int { return n ^ 2 }
+				}
+				let p = new Point(1)
+				let s = new Point(2).scale(3)
+			`,
+			output: `
+class Point {
+  constructor(y) {
+    this.x = 0;
+    this.y = y;
+  }
+  scale(x) {
+    return x * this.y + Point.sq(x);
+  }
+  static sq(n) {
+    return n ** 2;
+  }
+}
+Point.origin = 1;
+let p = new Point(1);
+let s = new Point(2).scale(3);
+`},
+		{name: "EnumSwitch",
+			input: `
+				enum Shape {
+					case None
+					case Circle(int)
+				}
+				fn area(s: Shape): int {
+					switch s {
+					case .None:
+						return 0
+					case .Circle(r):
+						let a = r * r * 3
+						g = a
+					}
+					return g
+				}
+				let g = 0
+			`,
+			output: `
+const Shape = {
+  None: {tag: "None"},
+  Circle: (value) => ({tag: "Circle", value}),
+};
+function area(s) {
+  {
+    const $switch = s;
+    switch ($switch.tag) {
+      case "None": {
+        return 0;
+      }
+      case "Circle": {
+        const r = $switch.value;
+        let a = r * r * 3;
+        g = a;
+        break;
+      }
+    }
+  }
+  return g;
+}
+let g = 0;
+`},
+		{name: "LabelledLoops",
+			input: `
+				fn f(xs: [int]) {
+					outer: for x in xs {
+						switch x {
+						case 1:
+							continue outer
+						default:
+							break outer
+						}
+					}
+				}
+			`,
+			output: `
+function f(xs) {
+  outer: for (const x of xs) {
+    switch (x) {
+      case 1: {
+        continue outer;
+      }
+      default: {
+        break outer;
+      }
+    }
+  }
+}
+`},
+		{name: "Literals",
+			input: `
+				let s = "hi {a + 1} $\{x\}", t = "plain\n"
+				let n = 0xff + 1.5 + 1_000_000
+				let c = 'x'
+				let d = {"k": 1, a: 2}, e = {1, 2}
+				let [a, ...rest] = [1, 2, 3]
+				const {k} = d
+				let z = nil
+			`,
+			output: `
+let s = ` + "`hi ${a + 1} \\${x}`" + `, t = "plain\n";
+let n = 0xff + 1.5 + 1000000;
+let c = "x";
+let d = {"k": 1, [a]: 2}, e = new Set([1, 2]);
+let [a, ...rest] = [1, 2, 3];
+const {k} = d;
+let z = null;
+`},
+		{name: "Precedence",
+			input: `
+				let p = (1 + 2) * 3 - 4 ^ 2 ^ 3
+				let q = -a ^ 2
+				let r = a - (b - c)
+				let s = 1 < 2 < 3
+				let t = a == b
+				let u = a | b == c
+			`,
+			output: `
+let p = (1 + 2) * 3 - 4 ** 2 ** 3;
+let q = (-a) ** 2;
+let r = a - (b - c);
+let s = 1 < 2 && 2 < 3;
+let t = a === b;
+let u = (a | b) === c;
+`},
+		{name: "DoExpr",
+			input: `
+				let a = do {
+					let t = f()
+					t * t
+				}
+			`,
+			output: `
+let a = (() => {
+  let t = f();
+  return t * t;
+})();
+`},
+		{name: "TrailingClosures",
+			input: `
+				let a = xs.map { x -> x * 2 }
+				let b = xs.reduce(0) { sum, x ->
+					let y = x * x
+					sum + y
+				}
+				let c = f { -> }
+			`,
+			output: `
+let a = xs.map((x) => x * 2);
+let b = xs.reduce(0, (sum, x) => {
+  let y = x * x;
+  return sum + y;
+});
+let c = f(() => {});
+`},
+		{name: "Imports",
+			input: `
+				module app.main
+				import foo.bar
+				import baz.{A, B}
+				import fb "app/util"
+			`,
+			output: `
+import * as bar from "../foo/bar.js";
+import {A, B} from "../baz.js";
+import * as fb from "./util.js";
+`},
+		{name: "WildcardImport",
+			input: `import foo.*`,
+			fail:  "1:1: wildcard imports are not supported by the JavaScript backend"},
+		{name: "EnumAssociatedAndRawValues",
+			input: `
+				enum Shape {
+					case Point(x: int, y: int)
+				}
+				enum Colour {
+					case Red = 1
+					case Green = 2
+				}
+				fn f(s: Shape): int {
+					switch s {
+					case .Point(a, b):
+						return a + b
+					}
+				}
+				fn g(s: Shape): int {
+					switch s {
+					case .Point(_, let y):
+						return y
+					}
+				}
+			`,
+			output: `
+const Shape = {
+  Point: (x, y) => ({tag: "Point", value: [x, y]}),
+};
+const Colour = {
+  Red: {tag: "Red", rawValue: 1},
+  Green: {tag: "Green", rawValue: 2},
+};
+function f(s) {
+  {
+    const $switch = s;
+    switch ($switch.tag) {
+      case "Point": {
+        const [a, b] = $switch.value;
+        return a + b;
+      }
+    }
+  }
+}
+function g(s) {
+  {
+    const $switch = s;
+    switch ($switch.tag) {
+      case "Point": {
+        const [, y] = $switch.value;
+        return y;
+      }
+    }
+  }
+}
+`},
+		{name: "ElseIf",
+			input: `
+				fn find(n: int): int? {
+					return nil
+				}
+				fn sign(n: int): int {
+					if n > 0 {
+						return 1
+					} else if let m = find(n) {
+						return m
+					} else if n < 0 {
+						return -1
+					} else {
+						return 0
+					}
+				}
+			`,
+			output: `
+function find(n) {
+  return null;
+}
+function sign(n) {
+  if (n > 0) {
+    return 1;
+  } else {
+    const $let = find(n);
+    if ($let != null) {
+      const m = $let;
+      return m;
+    } else if (n < 0) {
+      return -1;
+    } else {
+      return 0;
+    }
+  }
+}
+`},
+		{name: "IfLet",
+			input: `
+				fn find(key: int): int? {
+					return nil
+				}
+				fn get(key: int): int {
+					if let key = find(key) {
+						return key
+					} else {
+						return 0
+					}
+				}
+			`,
+			output: `
+function find(key) {
+  return null;
+}
+function get(key) {
+  {
+    const $let = find(key);
+    if ($let != null) {
+      const key = $let;
+      return key;
+    } else {
+      return 0;
+    }
+  }
+}
+`},
+		{name: "EnumMethod",
+			input: `
+				enum E {
+					case A
+					fn f() {}
+				}
+			`,
+			fail: "4:6: enum methods are not supported by the JavaScript backend"},
+		{name: "HTMLTemplate",
+			input: `
+				fn link(url: string, text: string): string {
+					return html"<a href=\"{url}\">{text}</a>"
+				}
+			`,
+			output: `
+function link(url, text) {
+  return ` + "`<a href=\"${$escapeHTML(url)}\">${$escapeHTML(text)}</a>`" + `;
+}
+function $escapeHTML(s) {
+  return String(s).replace(/[&<>"']/g, (c) => "&#" + c.charCodeAt(0) + ";");
+}
+`},
+		{name: "UnknownTemplate",
+			input: `
+				let a = sql"SELECT 1"
+			`,
+			fail: "2:13: unknown template tag \"sql\""},
+		{name: "UnappliedConditional",
+			input: `
+				#if target(js) {
+					fn f() {}
+				}
+			`,
+			fail: "2:5: compile-time conditionals must be applied before generating JavaScript"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			w := &strings.Builder{}
+			err = Generate(w, ast)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, strings.TrimSpace(test.output), strings.TrimSpace(w.String()))
+		})
+	}
+}
+
+func TestGenerateProgram(t *testing.T) {
+	ast, err := parser.ParseString(`
+		fn f(a: int, b: int, x: float): float {
+			let q = a / b
+			let r = 7 / 2
+			let s = (a + 1) / 2 * 3
+			let t = a
+			t /= b + 1
+			return x / 2
+		}
+	`)
+	require.NoError(t, err)
+	program, err := analyser.Analyse(ast)
+	require.NoError(t, err)
+	w := &strings.Builder{}
+	err = GenerateProgram(w, program)
+	require.NoError(t, err)
+	require.Equal(t, `function f(a, b, x) {
+  let q = Math.trunc(a / b);
+  let r = Math.trunc(7 / 2);
+  let s = Math.trunc((a + 1) / 2) * 3;
+  let t = a;
+  t = Math.trunc(t / (b + 1));
+  return x / 2;
+}
+`, w.String())
+}
+
+func TestGenerateWithSourceMap(t *testing.T) {
+	ast, err := parser.ParseString(`fn f(): int {
+  return 1
+}
+`)
+	require.NoError(t, err)
+	w := &strings.Builder{}
+	sm := &strings.Builder{}
+	err = GenerateWithSourceMap(w, sm, "main.js", "main.langx", ast)
+	require.NoError(t, err)
+	require.Equal(t, `function f() {
+  return 1;
+}
+//# sourceMappingURL=main.js.map
+`, w.String())
+	actual := &SourceMap{}
+	err = json.Unmarshal([]byte(sm.String()), actual)
+	require.NoError(t, err)
+	require.Equal(t, &SourceMap{
+		Version:  3,
+		File:     "main.js",
+		Sources:  []string{"main.langx"},
+		Names:    []string{},
+		Mappings: "AAAA;EACE,OAAO",
+	}, actual)
+}
+
+func TestEncodeVLQ(t *testing.T) {
+	tests := map[int]string{0: "A", 1: "C", -1: "D", 15: "e", 16: "gB", 123: "2H", -123: "3H"}
+	for n, expected := range tests {
+		w := &strings.Builder{}
+		encodeVLQ(w, n)
+		require.Equal(t, expected, w.String(), "%d", n)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+	tests := []struct {
+		name    string
+		input   string
+		analyse bool
+		output  string
+	}{
+		{name: "SingleNamedAssociatedValue",
+			input: `
+				enum Shape {
+					case circle(r: int)
+					case rect(w: int, h: int)
+				}
+				fn area(s: Shape): int {
+					switch s {
+					case .circle(let r):
+						return r + 1
+					case .rect(let w, let h):
+						return w * h
+					}
+				}
+				fn main(): int {
+					return area(Shape.circle(2)) * 10 + area(Shape.rect(2, 3))
+				}
+			`,
+			output: "36"},
+		{name: "UnboundMethod",
+			input: `
+				class Counter {
+					let n = 0
+					fn incr(): int {
+						n = n + 1
+						return n
+					}
+					fn twice(): int {
+						let f = incr
+						f()
+						return f()
+					}
+				}
+				fn main(): int {
+					let c = new Counter()
+					let g = c.incr
+					g()
+					return c.twice() * 10 + g()
+				}
+			`,
+			analyse: true,
+			output:  "34"},
+		{name: "ChainedComparison",
+			input: `
+				class Counter {
+					let n = 0
+					fn next(): int {
+						n = n + 1
+						return n
+					}
+				}
+				fn main(): string {
+					let c = new Counter()
+					let a = 0 < c.next() < 2 <= c.next()
+					let b = c.next() < 0 < c.next()
+					return "{a} {b} {c.n}"
+				}
+			`,
+			output: "true false 3"},
+		{name: "IntDivisionAssignment",
+			input: `
+				fn main(): int {
+					let t = 7
+					t /= 2
+					return t
+				}
+			`,
+			analyse: true,
+			output:  "3"},
+		{name: "ArrayReduce",
+			input: `
+				fn main(): int {
+					let xs = [1, 2, 3]
+					return xs.reduce(10) { acc, x -> acc + x }
+				}
+			`,
+			analyse: true,
+			output:  "16"},
+		{name: "MapKeysAndValues",
+			input: `
+				fn main(): string {
+					let m = {"a": "x", "b": "y"}
+					return m.keys().join(",") + m.values().join(",")
+				}
+			`,
+			analyse: true,
+			output:  "a,bx,y"},
+		{name: "Sort",
+			input: `
+				class Hand {
+					fn sort(): int {
+						return 0
+					}
+				}
+				fn byDescending(a: int, b: int): int {
+					return b - a
+				}
+				fn main(): string {
+					let numbers = [10, 9, 1]
+					numbers.sort()
+					let descending = [1, 10, 9]
+					descending.sort(byDescending)
+					let hand = new Hand()
+					return "{numbers[0]},{numbers[2]} {descending[0]},{descending[2]} {hand.sort()}"
+				}
+			`,
+			analyse: true,
+			output:  "1,10 10,1 0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			w := &strings.Builder{}
+			if test.analyse {
+				program, err := analyser.Analyse(ast)
+				require.NoError(t, err)
+				err = GenerateProgram(w, program)
+				require.NoError(t, err)
+			} else {
+				err = Generate(w, ast)
+				require.NoError(t, err)
+			}
+			path := filepath.Join(t.TempDir(), "main.mjs")
+			err = ioutil.WriteFile(path, []byte(w.String()+"\nconsole.log(main());\n"), 0600)
+			require.NoError(t, err)
+			output, err := exec.Command(node, path).CombinedOutput()
+			require.NoError(t, err, "%s\n%s", output, w)
+			require.Equal(t, test.output, strings.TrimSpace(string(output)))
+		})
+	}
+}
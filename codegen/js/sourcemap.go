@@ -0,0 +1,90 @@
+package js
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A mapping from a position in the generated output to a position in the source.
+//
+// All positions are zero-based.
+type mapping struct {
+	genLine, genColumn int
+	srcLine, srcColumn int
+}
+
+// SourceMap in the version 3 format.
+type SourceMap struct {
+	Version  int      `json:"version"`
+	File     string   `json:"file"`
+	Sources  []string `json:"sources"`
+	Names    []string `json:"names"`
+	Mappings string   `json:"mappings"`
+}
+
+func newSourceMap(file, source string, mappings []mapping) *SourceMap {
+	return &SourceMap{
+		Version:  3,
+		File:     file,
+		Sources:  []string{source},
+		Names:    []string{},
+		Mappings: encodeMappings(mappings),
+	}
+}
+
+// Write the source map to w as JSON.
+func (s *SourceMap) Write(w io.Writer) error {
+	return errors.WithStack(json.NewEncoder(w).Encode(s))
+}
+
+// Encode mappings, which must be ordered by generated position, into the
+// semicolon and comma separated VLQ form.
+func encodeMappings(mappings []mapping) string {
+	out := &strings.Builder{}
+	line := 0
+	prev := mapping{}
+	first := true
+	for _, m := range mappings {
+		for line < m.genLine {
+			out.WriteByte(';')
+			line++
+			prev.genColumn = 0
+			first = true
+		}
+		if !first {
+			out.WriteByte(',')
+		}
+		first = false
+		encodeVLQ(out, m.genColumn-prev.genColumn)
+		// Index into sources, which is always the single source.
+		encodeVLQ(out, 0)
+		encodeVLQ(out, m.srcLine-prev.srcLine)
+		encodeVLQ(out, m.srcColumn-prev.srcColumn)
+		prev = m
+	}
+	return out.String()
+}
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// Encode n as a base64 VLQ, with the sign in the least significant bit.
+func encodeVLQ(w *strings.Builder, n int) {
+	v := n << 1
+	if n < 0 {
+		v = (-n << 1) | 1
+	}
+	for {
+		digit := v & 31
+		v >>= 5
+		if v > 0 {
+			digit |= 32
+		}
+		w.WriteByte(base64Digits[digit])
+		if v == 0 {
+			return
+		}
+	}
+}
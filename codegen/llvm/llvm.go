@@ -0,0 +1,586 @@
+//go:build llvm
+// +build llvm
+
+// Package llvm lowers typed langx functions to textual LLVM IR for ahead-of-time
+// compilation, eg. with llc.
+//
+// Only the numeric and control-flow subset of the language is supported: functions
+// over int, float, bool and char values, local variables, assignment, if/else,
+// return and calls between functions. Locals are allocated on the stack and
+// are expected to be promoted to registers by the mem2reg pass.
+//
+// The package is only built with the "llvm" build tag.
+package llvm
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// Generate LLVM IR for program.
+func Generate(w io.Writer, program *analyser.Program) error {
+	g := &generator{program: program, funcs: map[string]*function{}}
+	for _, decl := range program.AST.Declarations {
+		if decl.Func == nil {
+			return participle.Errorf(decl.Pos, "only functions are supported by the LLVM backend")
+		}
+		if err := g.declare(decl.Func); err != nil {
+			return err
+		}
+	}
+	for i, fn := range g.order {
+		if i > 0 {
+			g.out.WriteString("\n")
+		}
+		if err := g.genFunc(fn); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, g.out.String())
+	return errors.WithStack(err)
+}
+
+type function struct {
+	decl   *parser.FuncDecl
+	params []string
+	result string
+}
+
+// A local variable, held in a stack slot.
+type local struct {
+	slot string
+	typ  string
+}
+
+type generator struct {
+	program *analyser.Program
+	funcs   map[string]*function
+	order   []*function
+	out     strings.Builder
+
+	// State for the function being generated.
+	fn     *function
+	scopes []map[string]local
+	// Stack slots, which are allocated in the entry block.
+	allocas strings.Builder
+	body    strings.Builder
+	slots   map[string]int
+	// Label of the current basic block, and whether it has been terminated.
+	block      string
+	terminated bool
+	temps      int
+	labels     int
+}
+
+func (g *generator) declare(decl *parser.FuncDecl) error {
+	fnt, ok := g.program.Root.ResolveType(decl.Name).(*types.Function)
+	if !ok {
+		return participle.Errorf(decl.Pos, "unknown function %q", decl.Name)
+	}
+	fn := &function{decl: decl, result: "void"}
+	for _, param := range fnt.Parameters {
+		typ, err := irType(decl.Pos, param.Typ)
+		if err != nil {
+			return err
+		}
+		fn.params = append(fn.params, typ)
+	}
+	if fnt.ReturnType != types.None {
+		typ, err := irType(decl.Return.Pos, fnt.ReturnType)
+		if err != nil {
+			return err
+		}
+		fn.result = typ
+	}
+	g.funcs[decl.Name] = fn
+	g.order = append(g.order, fn)
+	return nil
+}
+
+// Map a langx type to an LLVM type.
+func irType(pos lexer.Position, ref types.Reference) (string, error) {
+	switch ref.Kind() {
+	case types.KindInt, types.KindLiteralInt:
+		return "i64", nil
+	case types.KindFloat, types.KindLiteralFloat:
+		return "double", nil
+	case types.KindBool:
+		return "i1", nil
+	case types.KindChar:
+		return "i32", nil
+	default:
+		return "", participle.Errorf(pos, "%s values are not supported by the LLVM backend", ref.Kind())
+	}
+}
+
+func (g *generator) emit(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, "  "+format+"\n", args...)
+}
+
+// Allocate a temporary value name.
+//
+// All generated names contain a ".", which langx identifiers can not, so they
+// never collide with parameters or variables.
+func (g *generator) temp() string {
+	g.temps++
+	return fmt.Sprintf("%%t.%d", g.temps)
+}
+
+func (g *generator) label(prefix string) string {
+	g.labels++
+	return fmt.Sprintf("%s.%d", prefix, g.labels)
+}
+
+// Start a new basic block.
+func (g *generator) startBlock(label string) {
+	fmt.Fprintf(&g.body, "%s:\n", label)
+	g.block = label
+	g.terminated = false
+}
+
+// Emit a terminator instruction, ending the current basic block.
+func (g *generator) terminate(format string, args ...interface{}) {
+	if g.terminated {
+		return
+	}
+	g.emit(format, args...)
+	g.terminated = true
+}
+
+func (g *generator) genFunc(fn *function) error {
+	g.fn = fn
+	g.scopes = []map[string]local{{}}
+	g.allocas.Reset()
+	g.body.Reset()
+	g.slots = map[string]int{}
+	g.block, g.terminated = "entry.0", false
+	g.temps, g.labels = 0, 0
+	params := []string{}
+	i := 0
+	for _, param := range fn.decl.Parameters {
+		for _, name := range param.Names {
+			params = append(params, fmt.Sprintf("%s %%%s.arg", fn.params[i], name))
+			slot := g.alloca(name, fn.params[i])
+			g.emit("store %s %%%s.arg, ptr %s", fn.params[i], name, slot)
+			i++
+		}
+	}
+	if err := g.genStmts(fn.decl.Body.Statements); err != nil {
+		return err
+	}
+	if fn.result == "void" {
+		g.terminate("ret void")
+	} else {
+		// Every path must have returned a value.
+		g.terminate("unreachable")
+	}
+	fmt.Fprintf(&g.out, "define %s @%s(%s) {\n", fn.result, fn.decl.Name, strings.Join(params, ", "))
+	g.out.WriteString("entry.0:\n")
+	g.out.WriteString(g.allocas.String())
+	g.out.WriteString(g.body.String())
+	g.out.WriteString("}\n")
+	return nil
+}
+
+// Allocate a stack slot for a local variable in the current scope.
+func (g *generator) alloca(name, typ string) string {
+	slot := fmt.Sprintf("%%%s.addr", name)
+	if n := g.slots[name]; n > 0 {
+		// Shadowed variable.
+		slot = fmt.Sprintf("%%%s.addr.%d", name, n)
+	}
+	g.slots[name]++
+	fmt.Fprintf(&g.allocas, "  %s = alloca %s\n", slot, typ)
+	g.scopes[len(g.scopes)-1][name] = local{slot: slot, typ: typ}
+	return slot
+}
+
+func (g *generator) resolveLocal(name string) (local, bool) {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if l, ok := g.scopes[i][name]; ok {
+			return l, true
+		}
+	}
+	return local{}, false
+}
+
+func (g *generator) genStmts(stmts []*parser.Stmt) error {
+	g.scopes = append(g.scopes, map[string]local{})
+	defer func() { g.scopes = g.scopes[:len(g.scopes)-1] }()
+	for _, stmt := range stmts {
+		if g.terminated {
+			// Code following a return is unreachable, but must still be in a block.
+			g.startBlock(g.label("dead"))
+		}
+		if err := g.genStmt(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) genStmt(stmt *parser.Stmt) error {
+	switch {
+	case stmt.Return != nil:
+		if stmt.Return.Value == nil {
+			g.terminate("ret void")
+			return nil
+		}
+		value, err := g.genExpr(stmt.Return.Value, g.fn.result)
+		if err != nil {
+			return err
+		}
+		g.terminate("ret %s %s", g.fn.result, value)
+		return nil
+
+	case stmt.If != nil:
+		if stmt.If.Binding != "" {
+			return participle.Errorf(stmt.Pos, "if let is not supported by the LLVM backend")
+		}
+		cond, err := g.genExpr(stmt.If.Condition, "i1")
+		if err != nil {
+			return err
+		}
+		then, els, end := g.label("then"), g.label("else"), g.label("end")
+		if !stmt.If.HasElse() {
+			els = end
+		}
+		g.terminate("br i1 %s, label %%%s, label %%%s", cond, then, els)
+		g.startBlock(then)
+		if err := g.genStmts(stmt.If.Main.Statements); err != nil {
+			return err
+		}
+		g.terminate("br label %%%s", end)
+		if stmt.If.HasElse() {
+			g.startBlock(els)
+			if err := g.genStmts(stmt.If.ElseStatements()); err != nil {
+				return err
+			}
+			g.terminate("br label %%%s", end)
+		}
+		g.startBlock(end)
+		return nil
+
+	case stmt.Block != nil:
+		return g.genStmts(stmt.Block.Statements)
+
+	case stmt.VarDecl != nil:
+		for _, v := range stmt.VarDecl.Vars {
+			if v.Pattern != nil {
+				return participle.Errorf(v.Pos, "destructuring is not supported by the LLVM backend")
+			}
+			ref := g.program.Resolved(v)
+			if ref == nil {
+				return participle.Errorf(v.Pos, "unknown type for %q", v.Name)
+			}
+			typ, err := irType(v.Pos, ref)
+			if err != nil {
+				return err
+			}
+			var value string
+			if v.Default != nil {
+				value, err = g.genExpr(v.Default, typ)
+				if err != nil {
+					return err
+				}
+			}
+			// Declare after the initialiser, which may refer to a shadowed variable.
+			slot := g.alloca(v.Name, typ)
+			if value != "" {
+				g.emit("store %s %s, ptr %s", typ, value, slot)
+			}
+		}
+		return nil
+
+	case stmt.ExprStmt != nil:
+		return g.genExprStmt(stmt.ExprStmt)
+
+	default:
+		return participle.Errorf(stmt.Pos, "statement is not supported by the LLVM backend")
+	}
+}
+
+func (g *generator) genExprStmt(stmt *parser.ExprStmt) error {
+	if stmt.RHS == nil {
+		_, _, err := g.genCall(stmt.LHS)
+		return err
+	}
+	name := ""
+	if unary := stmt.LHS.Unary; unary != nil && unary.Op == 0 && unary.Reference.Next == nil {
+		name = unary.Reference.Terminal.Ident
+	}
+	l, ok := g.resolveLocal(name)
+	if !ok {
+		return participle.Errorf(stmt.LHS.Pos, "can only assign to local variables in the LLVM backend")
+	}
+	value, err := g.genExpr(stmt.RHS, l.typ)
+	if err != nil {
+		return err
+	}
+	if stmt.Op != parser.OpAsgn {
+		current := g.temp()
+		g.emit("%s = load %s, ptr %s", current, l.typ, l.slot)
+		// Strip the trailing "=" from the compound assignment operator.
+		op := stmt.Op.String()
+		value, err = g.genBinaryOp(stmt.Pos, op[:len(op)-1], l.typ, current, value)
+		if err != nil {
+			return err
+		}
+	}
+	g.emit("store %s %s, ptr %s", l.typ, value, l.slot)
+	return nil
+}
+
+// Instructions for binary operators, by operand type.
+var binaryOps = map[string]map[string]string{
+	"i1": {
+		"==": "icmp eq", "!=": "icmp ne", "&": "and", "|": "or",
+	},
+	"i32": {
+		"==": "icmp eq", "!=": "icmp ne", "<": "icmp slt", ">": "icmp sgt", "<=": "icmp sle", ">=": "icmp sge",
+	},
+	"i64": {
+		"==": "icmp eq", "!=": "icmp ne", "<": "icmp slt", ">": "icmp sgt", "<=": "icmp sle", ">=": "icmp sge",
+		"+": "add", "-": "sub", "*": "mul", "/": "sdiv", "%": "srem", "&": "and", "|": "or",
+	},
+	"double": {
+		"==": "fcmp oeq", "!=": "fcmp one", "<": "fcmp olt", ">": "fcmp ogt", "<=": "fcmp ole", ">=": "fcmp oge",
+		"+": "fadd", "-": "fsub", "*": "fmul", "/": "fdiv", "%": "frem",
+	},
+}
+
+func (g *generator) genBinaryOp(pos lexer.Position, op, typ, lhs, rhs string) (string, error) {
+	instr, ok := binaryOps[typ][op]
+	if !ok {
+		return "", participle.Errorf(pos, "operator %s is not supported by the LLVM backend", op)
+	}
+	result := g.temp()
+	g.emit("%s = %s %s %s, %s", result, instr, typ, lhs, rhs)
+	return result, nil
+}
+
+// Generate expr, returning the value it evaluates to as a value of type want.
+func (g *generator) genExpr(expr *parser.Expr, want string) (string, error) {
+	if expr.Unary != nil {
+		return g.genUnary(expr.Unary, want)
+	}
+	if expr.Chained {
+		unchained, err := parser.Unchain(expr)
+		if err != nil {
+			return "", err
+		}
+		return g.genExpr(unchained, want)
+	}
+	switch expr.Op {
+	case parser.OpAnd, parser.OpOr:
+		// Short-circuit evaluation.
+		lhs, err := g.genExpr(expr.Left, "i1")
+		if err != nil {
+			return "", err
+		}
+		from := g.block
+		rhsLabel, end := g.label("rhs"), g.label("end")
+		short := "false"
+		if expr.Op == parser.OpAnd {
+			g.terminate("br i1 %s, label %%%s, label %%%s", lhs, rhsLabel, end)
+		} else {
+			short = "true"
+			g.terminate("br i1 %s, label %%%s, label %%%s", lhs, end, rhsLabel)
+		}
+		g.startBlock(rhsLabel)
+		rhs, err := g.genExpr(expr.Right, "i1")
+		if err != nil {
+			return "", err
+		}
+		rhsEnd := g.block
+		g.terminate("br label %%%s", end)
+		g.startBlock(end)
+		result := g.temp()
+		g.emit("%s = phi i1 [ %s, %%%s ], [ %s, %%%s ]", result, short, from, rhs, rhsEnd)
+		return result, nil
+
+	case parser.OpEq, parser.OpNe, parser.OpLt, parser.OpGt, parser.OpLe, parser.OpGe:
+		if want != "i1" {
+			return "", participle.Errorf(expr.Pos, "comparison result must be a bool")
+		}
+		typ, err := g.operandType(expr)
+		if err != nil {
+			return "", err
+		}
+		lhs, err := g.genExpr(expr.Left, typ)
+		if err != nil {
+			return "", err
+		}
+		rhs, err := g.genExpr(expr.Right, typ)
+		if err != nil {
+			return "", err
+		}
+		return g.genBinaryOp(expr.Pos, expr.Op.String(), typ, lhs, rhs)
+
+	default:
+		lhs, err := g.genExpr(expr.Left, want)
+		if err != nil {
+			return "", err
+		}
+		rhs, err := g.genExpr(expr.Right, want)
+		if err != nil {
+			return "", err
+		}
+		return g.genBinaryOp(expr.Pos, expr.Op.String(), want, lhs, rhs)
+	}
+}
+
+// Determine the operand type of a comparison.
+//
+// Literals adopt the type of the other operand.
+func (g *generator) operandType(expr *parser.Expr) (string, error) {
+	left, right := g.program.Resolved(expr.Left), g.program.Resolved(expr.Right)
+	if left == nil || right == nil {
+		return "", participle.Errorf(expr.Pos, "unknown operand types")
+	}
+	ref := left
+	switch left.Kind() {
+	case types.KindLiteralInt, types.KindLiteralFloat:
+		ref = right
+	}
+	return irType(expr.Pos, ref)
+}
+
+func (g *generator) genUnary(unary *parser.Unary, want string) (string, error) {
+	value, err := g.genReference(unary.Reference, want)
+	if err != nil || unary.Op == 0 {
+		return value, err
+	}
+	result := g.temp()
+	switch unary.Op {
+	case parser.OpSub:
+		switch want {
+		case "i64":
+			g.emit("%s = sub i64 0, %s", result, value)
+		case "double":
+			g.emit("%s = fneg double %s", result, value)
+		default:
+			return "", participle.Errorf(unary.Pos, "can't negate a non-numeric value")
+		}
+		return result, nil
+
+	case parser.OpNot:
+		if want != "i1" {
+			return "", participle.Errorf(unary.Pos, "result of ! must be a bool")
+		}
+		g.emit("%s = xor i1 %s, true", result, value)
+		return result, nil
+
+	default:
+		panic("??")
+	}
+}
+
+func (g *generator) genReference(ref *parser.Reference, want string) (string, error) {
+	terminal := ref.Terminal
+	if ref.Next != nil {
+		value, typ, err := g.genCall(&parser.Expr{Mixin: ref.Mixin, Unary: &parser.Unary{Mixin: ref.Mixin, Reference: ref}})
+		if err != nil {
+			return "", err
+		}
+		if typ != want {
+			return "", participle.Errorf(ref.Pos, "function %q does not return the expected type", terminal.Ident)
+		}
+		return value, nil
+	}
+	switch {
+	case terminal.Tuple != nil && len(terminal.Tuple) == 1:
+		return g.genExpr(terminal.Tuple[0], want)
+
+	case terminal.Ident != "":
+		l, ok := g.resolveLocal(terminal.Ident)
+		if !ok {
+			return "", participle.Errorf(terminal.Pos, "unknown local variable %q", terminal.Ident)
+		}
+		if l.typ != want {
+			return "", participle.Errorf(terminal.Pos, "%q does not have the expected type", terminal.Ident)
+		}
+		value := g.temp()
+		g.emit("%s = load %s, ptr %s", value, l.typ, l.slot)
+		return value, nil
+
+	case terminal.Literal != nil:
+		return genLiteral(terminal.Literal, want)
+
+	default:
+		return "", participle.Errorf(terminal.Pos, "%s is not supported by the LLVM backend", terminal.Describe())
+	}
+}
+
+// Generate a call to a function, returning its result and result type.
+func (g *generator) genCall(expr *parser.Expr) (string, string, error) {
+	var ref *parser.Reference
+	if expr.Unary != nil && expr.Unary.Op == 0 {
+		ref = expr.Unary.Reference
+	}
+	if ref == nil || ref.Next == nil || ref.Next.Call == nil || ref.Next.Next != nil {
+		return "", "", participle.Errorf(expr.Pos, "expression is not a function call")
+	}
+	fn, ok := g.funcs[ref.Terminal.Ident]
+	if !ok {
+		return "", "", participle.Errorf(ref.Pos, "unknown function %s", ref.Terminal.Describe())
+	}
+	call := ref.Next.Call
+	if call.TrailingClosure != nil {
+		return "", "", participle.Errorf(call.TrailingClosure.Pos, "trailing closures are not supported by the LLVM backend")
+	}
+	if len(call.Parameters) != len(fn.params) {
+		return "", "", participle.Errorf(call.Pos, "%d parameters provided for function that takes %d parameters",
+			len(call.Parameters), len(fn.params))
+	}
+	args := []string{}
+	for i, param := range call.Parameters {
+		value, err := g.genExpr(param, fn.params[i])
+		if err != nil {
+			return "", "", err
+		}
+		args = append(args, fn.params[i]+" "+value)
+	}
+	if fn.result == "void" {
+		g.emit("call void @%s(%s)", fn.decl.Name, strings.Join(args, ", "))
+		return "", fn.result, nil
+	}
+	result := g.temp()
+	g.emit("%s = call %s @%s(%s)", result, fn.result, fn.decl.Name, strings.Join(args, ", "))
+	return result, fn.result, nil
+}
+
+func genLiteral(literal *parser.Literal, want string) (string, error) {
+	switch {
+	case literal.Number != nil && want == "i64":
+		if !literal.Number.IsInt() {
+			return "", participle.Errorf(literal.Pos, "can't use %s as an int", literal.Number)
+		}
+		n, _ := literal.Number.Value.Int64()
+		return fmt.Sprint(n), nil
+
+	case literal.Number != nil && want == "double":
+		// The hexadecimal form is always exact.
+		f, _ := literal.Number.Value.Float64()
+		return fmt.Sprintf("0x%016X", math.Float64bits(f)), nil
+
+	case literal.Bool != nil && want == "i1":
+		return fmt.Sprint(bool(*literal.Bool)), nil
+
+	case literal.Char != nil && want == "i32":
+		return fmt.Sprint(int32(*literal.Char)), nil
+
+	default:
+		return "", participle.Errorf(literal.Pos, "%s literal is not supported here by the LLVM backend", literal.Describe())
+	}
+}
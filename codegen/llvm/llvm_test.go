@@ -0,0 +1,141 @@
+//go:build llvm
+// +build llvm
+
+package llvm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output string
+		fail   string
+	}{
+		{name: "Fibonacci",
+			input: `
+				fn fib(n: int): int {
+					if n <= 1 {
+						return n
+					}
+					return fib(n-1) + fib(n-2)
+				}
+			`,
+			output: `
+define i64 @fib(i64 %n.arg) {
+entry.0:
+  %n.addr = alloca i64
+  store i64 %n.arg, ptr %n.addr
+  %t.1 = load i64, ptr %n.addr
+  %t.2 = icmp sle i64 %t.1, 1
+  br i1 %t.2, label %then.1, label %end.3
+then.1:
+  %t.3 = load i64, ptr %n.addr
+  ret i64 %t.3
+end.3:
+  %t.4 = load i64, ptr %n.addr
+  %t.5 = sub i64 %t.4, 1
+  %t.6 = call i64 @fib(i64 %t.5)
+  %t.7 = load i64, ptr %n.addr
+  %t.8 = sub i64 %t.7, 2
+  %t.9 = call i64 @fib(i64 %t.8)
+  %t.10 = add i64 %t.6, %t.9
+  ret i64 %t.10
+}
+`},
+		{name: "ShortCircuitAndFloats",
+			input: `
+				fn inRange(x, lo, hi: float): bool {
+					return x >= lo && x < hi * 2.0
+				}
+			`,
+			output: `
+define i1 @inRange(double %x.arg, double %lo.arg, double %hi.arg) {
+entry.0:
+  %x.addr = alloca double
+  %lo.addr = alloca double
+  %hi.addr = alloca double
+  store double %x.arg, ptr %x.addr
+  store double %lo.arg, ptr %lo.addr
+  store double %hi.arg, ptr %hi.addr
+  %t.1 = load double, ptr %x.addr
+  %t.2 = load double, ptr %lo.addr
+  %t.3 = fcmp oge double %t.1, %t.2
+  br i1 %t.3, label %rhs.1, label %end.2
+rhs.1:
+  %t.4 = load double, ptr %x.addr
+  %t.5 = load double, ptr %hi.addr
+  %t.6 = fmul double %t.5, 0x4000000000000000
+  %t.7 = fcmp olt double %t.4, %t.6
+  br label %end.2
+end.2:
+  %t.8 = phi i1 [ false, %entry.0 ], [ %t.7, %rhs.1 ]
+  ret i1 %t.8
+}
+`},
+		{name: "ShadowedLocals",
+			input: `
+				fn f(a: int) {
+					let b = a
+					if true {
+						let b = 1.5
+						b += 1
+					}
+				}
+			`,
+			output: `
+define void @f(i64 %a.arg) {
+entry.0:
+  %a.addr = alloca i64
+  %b.addr = alloca i64
+  %b.addr.1 = alloca double
+  store i64 %a.arg, ptr %a.addr
+  %t.1 = load i64, ptr %a.addr
+  store i64 %t.1, ptr %b.addr
+  br i1 true, label %then.1, label %end.3
+then.1:
+  store double 0x3FF8000000000000, ptr %b.addr.1
+  %t.2 = load double, ptr %b.addr.1
+  %t.3 = fadd double %t.2, 0x3FF0000000000000
+  store double %t.3, ptr %b.addr.1
+  br label %end.3
+end.3:
+  ret void
+}
+`},
+		{name: "NonFunction",
+			input: `
+				let a = 1
+			`,
+			fail: "2:5: only functions are supported by the LLVM backend"},
+		{name: "StringParameter",
+			input: `
+				fn f(s: string) {}
+			`,
+			fail: "2:5: string values are not supported by the LLVM backend"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			program, err := analyser.Analyse(ast)
+			require.NoError(t, err)
+			w := &strings.Builder{}
+			err = Generate(w, program)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, strings.TrimSpace(test.output), strings.TrimSpace(w.String()))
+		})
+	}
+}
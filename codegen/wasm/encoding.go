@@ -0,0 +1,155 @@
+package wasm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Value types.
+const (
+	typeI32 byte = 0x7f
+	typeI64 byte = 0x7e
+	typeF64 byte = 0x7c
+)
+
+// Section IDs.
+const (
+	sectionType     byte = 1
+	sectionFunction byte = 3
+	sectionTable    byte = 4
+	sectionExport   byte = 7
+	sectionElement  byte = 9
+	sectionCode     byte = 10
+)
+
+// Export kinds.
+const (
+	exportFunc  byte = 0x00
+	exportTable byte = 0x01
+)
+
+// Instructions.
+const (
+	opUnreachable byte = 0x00
+	opIf          byte = 0x04
+	opElse        byte = 0x05
+	opEnd         byte = 0x0b
+	opReturn      byte = 0x0f
+	opCall        byte = 0x10
+	opDrop        byte = 0x1a
+	opLocalGet    byte = 0x20
+	opLocalSet    byte = 0x21
+	opLocalTee    byte = 0x22
+	opI32Const    byte = 0x41
+	opI64Const    byte = 0x42
+	opF64Const    byte = 0x44
+	opI32Eqz      byte = 0x45
+	opF64Neg      byte = 0x9a
+
+	blockTypeEmpty byte = 0x40
+	typeFunc       byte = 0x60
+	typeFuncRef    byte = 0x70
+)
+
+// Binary operator instructions, by operand type.
+var binaryOps = map[byte]map[string]byte{
+	typeI32: {
+		"==": 0x46, "!=": 0x47, "<": 0x48, ">": 0x4a, "<=": 0x4c, ">=": 0x4e,
+		"&": 0x71, "|": 0x72,
+	},
+	typeI64: {
+		"==": 0x51, "!=": 0x52, "<": 0x53, ">": 0x55, "<=": 0x57, ">=": 0x59,
+		"+": 0x7c, "-": 0x7d, "*": 0x7e, "/": 0x7f, "%": 0x81, "&": 0x83, "|": 0x84,
+	},
+	typeF64: {
+		"==": 0x61, "!=": 0x62, "<": 0x63, ">": 0x64, "<=": 0x65, ">=": 0x66,
+		"+": 0xa0, "-": 0xa1, "*": 0xa2, "/": 0xa3,
+	},
+}
+
+// An encoder for the WebAssembly binary format.
+type encoder struct {
+	bytes.Buffer
+}
+
+// Encode an unsigned LEB128 integer.
+func (e *encoder) u32(v uint32) {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			b |= 0x80
+		}
+		e.WriteByte(b)
+		if v == 0 {
+			return
+		}
+	}
+}
+
+// Encode a signed LEB128 integer.
+func (e *encoder) s64(v int64) {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			e.WriteByte(b)
+			return
+		}
+		e.WriteByte(b | 0x80)
+	}
+}
+
+// Decode an unsigned LEB128 integer, returning it and the number of bytes read,
+// or 0 if b is truncated.
+func readU32(b []byte) (uint32, int) {
+	var v uint32
+	for i, c := range b {
+		v |= uint32(c&0x7f) << (7 * uint(i))
+		if c&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// Decode a signed LEB128 integer, returning it and the number of bytes read,
+// or 0 if b is truncated.
+func readS64(b []byte) (int64, int) {
+	var v int64
+	shift := uint(0)
+	for i, c := range b {
+		v |= int64(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			if shift < 64 && c&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func (e *encoder) f64(v float64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	e.Write(buf[:])
+}
+
+func (e *encoder) name(s string) {
+	e.u32(uint32(len(s)))
+	e.WriteString(s)
+}
+
+// Encode a vector of raw bytes, prefixed by its length.
+func (e *encoder) bytes(b []byte) {
+	e.u32(uint32(len(b)))
+	e.Write(b)
+}
+
+func (e *encoder) section(id byte, content *encoder) {
+	e.WriteByte(id)
+	e.bytes(content.Bytes())
+}
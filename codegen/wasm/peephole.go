@@ -0,0 +1,381 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Peephole optimisation of function bodies.
+//
+// The generator emits naive stack code, which is rewritten to a fixed point by
+// the following passes over short windows of instructions:
+//
+//   - constant folding, eg. "i64.const 1; i64.const 2; i64.add" to "i64.const 3"
+//   - dead store elimination of locals that are never read
+//   - removal of pure values that are immediately dropped
+//   - fusing "local.set n; local.get n" into "local.tee n"
+//   - removal of unreachable code following return
+//
+// There are no branches other than structured if/else, so there are no jumps
+// to thread.
+func optimise(code []instr) []instr {
+	passes := []func([]instr) ([]instr, bool){
+		foldConstants,
+		eliminateDeadStores,
+		eliminateDrops,
+		fuseSetGet,
+		eliminateUnreachable,
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, pass := range passes {
+			var ok bool
+			code, ok = pass(code)
+			changed = changed || ok
+		}
+	}
+	return code
+}
+
+func foldConstants(code []instr) ([]instr, bool) {
+	out := make([]instr, 0, len(code))
+	changed := false
+	for _, in := range code {
+		n := len(out)
+		if n >= 2 {
+			if folded, ok := foldBinary(out[n-2], out[n-1], in.op); ok {
+				out = append(out[:n-2], folded)
+				changed = true
+				continue
+			}
+		}
+		if n >= 1 {
+			if folded, ok := foldUnary(out[n-1], in.op); ok {
+				out[n-1] = folded
+				changed = true
+				continue
+			}
+		}
+		out = append(out, in)
+	}
+	return out, changed
+}
+
+func boolConst(b bool) instr {
+	if b {
+		return instr{op: opI32Const, imm: 1}
+	}
+	return instr{op: opI32Const, imm: 0}
+}
+
+func foldUnary(a instr, op byte) (instr, bool) {
+	switch {
+	case op == opI32Eqz && a.op == opI32Const:
+		return boolConst(a.imm == 0), true
+
+	case op == opF64Neg && a.op == opF64Const:
+		return instr{op: opF64Const, f64: -a.f64}, true
+	}
+	return instr{}, false
+}
+
+// Fold a binary operator applied to two constants.
+//
+// Operations that trap, such as division by zero, are left to trap at runtime.
+func foldBinary(a, b instr, op byte) (instr, bool) {
+	if a.op != b.op {
+		return instr{}, false
+	}
+	switch a.op {
+	case opI32Const:
+		x, y := int32(a.imm), int32(b.imm)
+		switch instrNames[op] {
+		case "i32.eq":
+			return boolConst(x == y), true
+		case "i32.ne":
+			return boolConst(x != y), true
+		case "i32.lt_s":
+			return boolConst(x < y), true
+		case "i32.gt_s":
+			return boolConst(x > y), true
+		case "i32.le_s":
+			return boolConst(x <= y), true
+		case "i32.ge_s":
+			return boolConst(x >= y), true
+		case "i32.and":
+			return instr{op: opI32Const, imm: int64(x & y)}, true
+		case "i32.or":
+			return instr{op: opI32Const, imm: int64(x | y)}, true
+		}
+
+	case opI64Const:
+		x, y := a.imm, b.imm
+		switch instrNames[op] {
+		case "i64.eq":
+			return boolConst(x == y), true
+		case "i64.ne":
+			return boolConst(x != y), true
+		case "i64.lt_s":
+			return boolConst(x < y), true
+		case "i64.gt_s":
+			return boolConst(x > y), true
+		case "i64.le_s":
+			return boolConst(x <= y), true
+		case "i64.ge_s":
+			return boolConst(x >= y), true
+		case "i64.add":
+			return instr{op: opI64Const, imm: x + y}, true
+		case "i64.sub":
+			return instr{op: opI64Const, imm: x - y}, true
+		case "i64.mul":
+			return instr{op: opI64Const, imm: x * y}, true
+		case "i64.div_s":
+			if y != 0 && !(x == math.MinInt64 && y == -1) {
+				return instr{op: opI64Const, imm: x / y}, true
+			}
+		case "i64.rem_s":
+			if y != 0 {
+				return instr{op: opI64Const, imm: x % y}, true
+			}
+		case "i64.and":
+			return instr{op: opI64Const, imm: x & y}, true
+		case "i64.or":
+			return instr{op: opI64Const, imm: x | y}, true
+		}
+
+	case opF64Const:
+		x, y := a.f64, b.f64
+		switch instrNames[op] {
+		case "f64.eq":
+			return boolConst(x == y), true
+		case "f64.ne":
+			return boolConst(x != y), true
+		case "f64.lt":
+			return boolConst(x < y), true
+		case "f64.gt":
+			return boolConst(x > y), true
+		case "f64.le":
+			return boolConst(x <= y), true
+		case "f64.ge":
+			return boolConst(x >= y), true
+		case "f64.add":
+			return instr{op: opF64Const, f64: x + y}, true
+		case "f64.sub":
+			return instr{op: opF64Const, f64: x - y}, true
+		case "f64.mul":
+			return instr{op: opF64Const, f64: x * y}, true
+		case "f64.div":
+			return instr{op: opF64Const, f64: x / y}, true
+		}
+	}
+	return instr{}, false
+}
+
+// Stores to locals that are never read are replaced by drops, or removed if
+// they are tees.
+func eliminateDeadStores(code []instr) ([]instr, bool) {
+	read := map[int64]bool{}
+	for _, in := range code {
+		if in.op == opLocalGet {
+			read[in.imm] = true
+		}
+	}
+	out := make([]instr, 0, len(code))
+	changed := false
+	for _, in := range code {
+		switch {
+		case in.op == opLocalSet && !read[in.imm]:
+			out = append(out, instr{op: opDrop})
+			changed = true
+
+		case in.op == opLocalTee && !read[in.imm]:
+			changed = true
+
+		default:
+			out = append(out, in)
+		}
+	}
+	return out, changed
+}
+
+// Values without side effects that are immediately dropped are removed.
+func eliminateDrops(code []instr) ([]instr, bool) {
+	out := make([]instr, 0, len(code))
+	changed := false
+	for _, in := range code {
+		if n := len(out); in.op == opDrop && n > 0 {
+			switch out[n-1].op {
+			case opI32Const, opI64Const, opF64Const, opLocalGet:
+				out = out[:n-1]
+				changed = true
+				continue
+			}
+		}
+		out = append(out, in)
+	}
+	return out, changed
+}
+
+func fuseSetGet(code []instr) ([]instr, bool) {
+	out := make([]instr, 0, len(code))
+	changed := false
+	for _, in := range code {
+		if n := len(out); in.op == opLocalGet && n > 0 && out[n-1].op == opLocalSet && out[n-1].imm == in.imm {
+			out[n-1].op = opLocalTee
+			changed = true
+			continue
+		}
+		out = append(out, in)
+	}
+	return out, changed
+}
+
+// Instructions following return or unreachable, up to the end of the
+// enclosing block, can never execute.
+func eliminateUnreachable(code []instr) ([]instr, bool) {
+	out := make([]instr, 0, len(code))
+	changed := false
+	for i := 0; i < len(code); i++ {
+		in := code[i]
+		out = append(out, in)
+		if in.op != opReturn && in.op != opUnreachable {
+			continue
+		}
+		depth := 0
+		for i+1 < len(code) {
+			next := code[i+1]
+			if depth == 0 && (next.op == opEnd || next.op == opElse) {
+				break
+			}
+			switch next.op {
+			case opIf:
+				depth++
+			case opEnd:
+				depth--
+			}
+			changed = true
+			i++
+		}
+	}
+	return out, changed
+}
+
+// A decoded instruction.
+type instr struct {
+	op byte
+	// Immediate for instructions with an integer operand: the local or
+	// function index, block type, or constant.
+	imm int64
+	// Immediate for f64.const.
+	f64 float64
+}
+
+var instrNames = map[byte]string{
+	opUnreachable: "unreachable", opIf: "if", opElse: "else", opEnd: "end",
+	opReturn: "return", opCall: "call", opDrop: "drop",
+	opLocalGet: "local.get", opLocalSet: "local.set", opLocalTee: "local.tee",
+	opI32Const: "i32.const", opI64Const: "i64.const", opF64Const: "f64.const",
+	opI32Eqz: "i32.eqz", opF64Neg: "f64.neg",
+
+	0x46: "i32.eq", 0x47: "i32.ne", 0x48: "i32.lt_s", 0x4a: "i32.gt_s", 0x4c: "i32.le_s", 0x4e: "i32.ge_s",
+	0x71: "i32.and", 0x72: "i32.or",
+
+	0x51: "i64.eq", 0x52: "i64.ne", 0x53: "i64.lt_s", 0x55: "i64.gt_s", 0x57: "i64.le_s", 0x59: "i64.ge_s",
+	0x7c: "i64.add", 0x7d: "i64.sub", 0x7e: "i64.mul", 0x7f: "i64.div_s", 0x81: "i64.rem_s",
+	0x83: "i64.and", 0x84: "i64.or",
+
+	0x61: "f64.eq", 0x62: "f64.ne", 0x63: "f64.lt", 0x64: "f64.gt", 0x65: "f64.le", 0x66: "f64.ge",
+	0xa0: "f64.add", 0xa1: "f64.sub", 0xa2: "f64.mul", 0xa3: "f64.div",
+}
+
+// String disassembles the instruction in the WebAssembly text format.
+func (i instr) String() string {
+	name := instrNames[i.op]
+	switch i.op {
+	case opCall, opLocalGet, opLocalSet, opLocalTee, opI32Const, opI64Const:
+		return fmt.Sprintf("%s %d", name, i.imm)
+
+	case opF64Const:
+		return fmt.Sprintf("%s %g", name, i.f64)
+
+	case opIf:
+		switch byte(i.imm) {
+		case typeI32:
+			return "if (result i32)"
+		case typeI64:
+			return "if (result i64)"
+		case typeF64:
+			return "if (result f64)"
+		}
+	}
+	return name
+}
+
+// Decode a function body as emitted by the generator.
+func decode(code []byte) ([]instr, error) {
+	out := []instr{}
+	for len(code) > 0 {
+		in := instr{op: code[0]}
+		if _, ok := instrNames[in.op]; !ok {
+			return nil, errors.Errorf("can't decode instruction 0x%02x", in.op)
+		}
+		code = code[1:]
+		switch in.op {
+		case opCall, opLocalGet, opLocalSet, opLocalTee:
+			v, n := readU32(code)
+			if n == 0 {
+				return nil, errors.Errorf("invalid operand for %s", in)
+			}
+			in.imm = int64(v)
+			code = code[n:]
+
+		case opI32Const, opI64Const:
+			v, n := readS64(code)
+			if n == 0 {
+				return nil, errors.Errorf("invalid operand for %s", in)
+			}
+			in.imm = v
+			code = code[n:]
+
+		case opF64Const:
+			if len(code) < 8 {
+				return nil, errors.Errorf("invalid operand for %s", in)
+			}
+			in.f64 = math.Float64frombits(binary.LittleEndian.Uint64(code))
+			code = code[8:]
+
+		case opIf:
+			if len(code) < 1 {
+				return nil, errors.Errorf("invalid operand for %s", in)
+			}
+			in.imm = int64(code[0])
+			code = code[1:]
+		}
+		out = append(out, in)
+	}
+	return out, nil
+}
+
+func encode(instrs []instr) []byte {
+	e := &encoder{}
+	for _, in := range instrs {
+		e.WriteByte(in.op)
+		switch in.op {
+		case opCall, opLocalGet, opLocalSet, opLocalTee:
+			e.u32(uint32(in.imm))
+
+		case opI32Const, opI64Const:
+			e.s64(in.imm)
+
+		case opF64Const:
+			e.f64(in.f64)
+
+		case opIf:
+			e.WriteByte(byte(in.imm))
+		}
+	}
+	return e.Bytes()
+}
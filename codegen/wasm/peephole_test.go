@@ -0,0 +1,221 @@
+package wasm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+)
+
+// Each test is the diff between the disassembly of the unoptimised and
+// optimised body of the function "f".
+func TestPeephole(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "FoldConstants",
+			input: `
+				fn f(): int {
+					return 1 + 2 * 3
+				}
+			`,
+			expected: `
+- i64.const 1
+- i64.const 2
+- i64.const 3
+- i64.mul
+- i64.add
++ i64.const 7
+  return
+- unreachable
+  end
+`},
+		{name: "FoldComparison",
+			input: `
+				fn f(): bool {
+					return 2.0 > 1.5 && 1 != 2
+				}
+			`,
+			expected: `
+- f64.const 2
+- f64.const 1.5
+- f64.gt
++ i32.const 1
+  if (result i32)
+- i64.const 1
+- i64.const 2
+- i64.ne
++ i32.const 1
+  else
+  i32.const 0
+  end
+  return
+- unreachable
+  end
+`},
+		{name: "DivisionByZeroTraps",
+			input: `
+				fn f(): int {
+					return 1 / 0
+				}
+			`,
+			expected: `
+  i64.const 1
+  i64.const 0
+  i64.div_s
+  return
+- unreachable
+  end
+`},
+		{name: "DeadStore",
+			input: `
+				fn f(a: int): int {
+					let b = a * 2
+					let c = 3
+					return a
+				}
+			`,
+			expected: `
+  local.get 0
+  i64.const 2
+  i64.mul
+- local.set 1
+- i64.const 3
+- local.set 2
++ drop
+  local.get 0
+  return
+- unreachable
+  end
+`},
+		{name: "SetGetToTee",
+			input: `
+				fn g(a: int): int {
+					return a
+				}
+
+				fn f(a: int): int {
+					let b = g(a)
+					return g(b) + b
+				}
+			`,
+			expected: `
+  local.get 0
+  call 0
+- local.set 1
+- local.get 1
++ local.tee 1
+  call 0
+  local.get 1
+  i64.add
+  return
+- unreachable
+  end
+`},
+		{name: "UnreachableInBranch",
+			input: `
+				fn f(a: int): int {
+					let b = a
+					if b > 0 {
+						return b
+						b = 2
+					}
+					return b
+				}
+			`,
+			expected: `
+  local.get 0
+- local.set 1
+- local.get 1
++ local.tee 1
+  i64.const 0
+  i64.gt_s
+  if
+  local.get 1
+  return
+- i64.const 2
+- local.set 1
+  end
+  local.get 1
+  return
+- unreachable
+  end
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			program, err := analyser.Analyse(ast)
+			require.NoError(t, err)
+			g, err := compile(program)
+			require.NoError(t, err)
+			fn := g.funcs["f"]
+			before, err := decode(fn.body.Bytes())
+			require.NoError(t, err)
+			after, err := decode(fn.code)
+			require.NoError(t, err)
+			require.Equal(t, strings.TrimPrefix(test.expected, "\n"), diffInstrs(before, after))
+		})
+	}
+}
+
+// Diff two instruction sequences by their longest common subsequence.
+func diffInstrs(a, b []instr) string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	w := &strings.Builder{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			w.WriteString("  " + a[i].String() + "\n")
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			w.WriteString("- " + a[i].String() + "\n")
+			i++
+		default:
+			w.WriteString("+ " + b[j].String() + "\n")
+			j++
+		}
+	}
+	return w.String()
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	code := []instr{
+		{op: opI64Const, imm: -123456},
+		{op: opI32Const, imm: 64},
+		{op: opF64Const, f64: 1.5},
+		{op: opLocalTee, imm: 300},
+		{op: opIf, imm: int64(blockTypeEmpty)},
+		{op: opCall, imm: 2},
+		{op: opEnd},
+	}
+	decoded, err := decode(encode(code))
+	require.NoError(t, err)
+	require.Equal(t, code, decoded)
+
+	_, err = decode([]byte{0xff})
+	require.EqualError(t, err, "can't decode instruction 0xff")
+}
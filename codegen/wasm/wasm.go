@@ -0,0 +1,572 @@
+// Package wasm compiles typed langx functions directly to a WebAssembly binary module.
+//
+// Only the numeric and control-flow subset of the language is supported: functions
+// over int, float, bool and char values, local variables, assignment, if/else,
+// return and calls between functions. All functions are exported by name, and
+// through a function table exported as "table", in declaration order.
+//
+// Function bodies are peephole optimised before encoding.
+package wasm
+
+import (
+	"io"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// Generate a WebAssembly module for program.
+func Generate(w io.Writer, program *analyser.Program) error {
+	g, err := compile(program)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(g.module())
+	return errors.WithStack(err)
+}
+
+// Compile and optimise every function in program.
+func compile(program *analyser.Program) (*generator, error) {
+	g := &generator{program: program, funcs: map[string]*function{}}
+	for _, decl := range program.AST.Declarations {
+		if decl.Func == nil {
+			return nil, participle.Errorf(decl.Pos, "only functions are supported by the wasm backend")
+		}
+		if err := g.declare(decl.Func); err != nil {
+			return nil, err
+		}
+	}
+	for _, fn := range g.order {
+		if err := g.genFunc(fn); err != nil {
+			return nil, err
+		}
+		code, err := decode(fn.body.Bytes())
+		if err != nil {
+			return nil, participle.Wrapf(fn.decl.Pos, err, "%s", fn.decl.Name)
+		}
+		fn.code = encode(optimise(code))
+	}
+	return g, nil
+}
+
+type function struct {
+	index   uint32
+	decl    *parser.FuncDecl
+	params  []byte
+	results []byte
+	locals  []byte
+	body    encoder
+	// Body after peephole optimisation.
+	code []byte
+}
+
+type generator struct {
+	program *analyser.Program
+	funcs   map[string]*function
+	order   []*function
+
+	// State for the function being generated.
+	fn     *function
+	scopes []map[string]uint32
+}
+
+func (g *generator) declare(decl *parser.FuncDecl) error {
+	fnt, ok := g.program.Root.ResolveType(decl.Name).(*types.Function)
+	if !ok {
+		return participle.Errorf(decl.Pos, "unknown function %q", decl.Name)
+	}
+	fn := &function{index: uint32(len(g.order)), decl: decl}
+	for _, param := range fnt.Parameters {
+		typ, err := valType(decl.Pos, param.Typ)
+		if err != nil {
+			return err
+		}
+		fn.params = append(fn.params, typ)
+	}
+	if fnt.ReturnType != types.None {
+		typ, err := valType(decl.Return.Pos, fnt.ReturnType)
+		if err != nil {
+			return err
+		}
+		fn.results = []byte{typ}
+	}
+	g.funcs[decl.Name] = fn
+	g.order = append(g.order, fn)
+	return nil
+}
+
+// Map a langx type to a WebAssembly value type.
+func valType(pos lexer.Position, ref types.Reference) (byte, error) {
+	switch ref.Kind() {
+	case types.KindInt, types.KindLiteralInt:
+		return typeI64, nil
+	case types.KindFloat, types.KindLiteralFloat:
+		return typeF64, nil
+	case types.KindBool, types.KindChar:
+		return typeI32, nil
+	default:
+		return 0, participle.Errorf(pos, "%s values are not supported by the wasm backend", ref.Kind())
+	}
+}
+
+func (g *generator) genFunc(fn *function) error {
+	g.fn = fn
+	g.scopes = []map[string]uint32{{}}
+	i := uint32(0)
+	for _, param := range fn.decl.Parameters {
+		for _, name := range param.Names {
+			g.scopes[0][name] = i
+			i++
+		}
+	}
+	if err := g.genStmts(fn.decl.Body.Statements); err != nil {
+		return err
+	}
+	if len(fn.results) > 0 {
+		// Every path must have returned a value.
+		fn.body.WriteByte(opUnreachable)
+	}
+	fn.body.WriteByte(opEnd)
+	return nil
+}
+
+// Type of local variable or parameter idx.
+func (g *generator) localType(idx uint32) byte {
+	if int(idx) < len(g.fn.params) {
+		return g.fn.params[idx]
+	}
+	return g.fn.locals[int(idx)-len(g.fn.params)]
+}
+
+func (g *generator) resolveLocal(name string) (uint32, bool) {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if idx, ok := g.scopes[i][name]; ok {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+func (g *generator) genStmts(stmts []*parser.Stmt) error {
+	g.scopes = append(g.scopes, map[string]uint32{})
+	defer func() { g.scopes = g.scopes[:len(g.scopes)-1] }()
+	for _, stmt := range stmts {
+		if err := g.genStmt(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) genStmt(stmt *parser.Stmt) error {
+	body := &g.fn.body
+	switch {
+	case stmt.Return != nil:
+		if stmt.Return.Value != nil {
+			if err := g.genExpr(stmt.Return.Value, g.fn.results[0]); err != nil {
+				return err
+			}
+		}
+		body.WriteByte(opReturn)
+		return nil
+
+	case stmt.If != nil:
+		if stmt.If.Binding != "" {
+			return participle.Errorf(stmt.Pos, "if let is not supported by the wasm backend")
+		}
+		if err := g.genExpr(stmt.If.Condition, typeI32); err != nil {
+			return err
+		}
+		body.WriteByte(opIf)
+		body.WriteByte(blockTypeEmpty)
+		if err := g.genStmts(stmt.If.Main.Statements); err != nil {
+			return err
+		}
+		if stmt.If.HasElse() {
+			body.WriteByte(opElse)
+			if err := g.genStmts(stmt.If.ElseStatements()); err != nil {
+				return err
+			}
+		}
+		body.WriteByte(opEnd)
+		return nil
+
+	case stmt.Block != nil:
+		return g.genStmts(stmt.Block.Statements)
+
+	case stmt.VarDecl != nil:
+		for _, v := range stmt.VarDecl.Vars {
+			if v.Pattern != nil {
+				return participle.Errorf(v.Pos, "destructuring is not supported by the wasm backend")
+			}
+			ref := g.program.Resolved(v)
+			if ref == nil {
+				return participle.Errorf(v.Pos, "unknown type for %q", v.Name)
+			}
+			typ, err := valType(v.Pos, ref)
+			if err != nil {
+				return err
+			}
+			idx := uint32(len(g.fn.params) + len(g.fn.locals))
+			g.fn.locals = append(g.fn.locals, typ)
+			if v.Default != nil {
+				if err := g.genExpr(v.Default, typ); err != nil {
+					return err
+				}
+				body.WriteByte(opLocalSet)
+				body.u32(idx)
+			}
+			g.scopes[len(g.scopes)-1][v.Name] = idx
+		}
+		return nil
+
+	case stmt.ExprStmt != nil:
+		return g.genExprStmt(stmt.ExprStmt)
+
+	default:
+		return participle.Errorf(stmt.Pos, "statement is not supported by the wasm backend")
+	}
+}
+
+func (g *generator) genExprStmt(stmt *parser.ExprStmt) error {
+	body := &g.fn.body
+	if stmt.RHS == nil {
+		results, err := g.genCall(stmt.LHS)
+		if err != nil {
+			return err
+		}
+		if len(results) > 0 {
+			body.WriteByte(opDrop)
+		}
+		return nil
+	}
+	name := ""
+	if unary := stmt.LHS.Unary; unary != nil && unary.Op == 0 && unary.Reference.Next == nil {
+		name = unary.Reference.Terminal.Ident
+	}
+	idx, ok := g.resolveLocal(name)
+	if !ok {
+		return participle.Errorf(stmt.LHS.Pos, "can only assign to local variables in the wasm backend")
+	}
+	typ := g.localType(idx)
+	if stmt.Op != parser.OpAsgn {
+		body.WriteByte(opLocalGet)
+		body.u32(idx)
+	}
+	if err := g.genExpr(stmt.RHS, typ); err != nil {
+		return err
+	}
+	if stmt.Op != parser.OpAsgn {
+		// Strip the trailing "=" from the compound assignment operator.
+		op := stmt.Op.String()
+		if err := g.genBinaryOp(stmt.Pos, op[:len(op)-1], typ); err != nil {
+			return err
+		}
+	}
+	body.WriteByte(opLocalSet)
+	body.u32(idx)
+	return nil
+}
+
+// Generate expr, leaving a value of type want on the stack.
+func (g *generator) genExpr(expr *parser.Expr, want byte) error {
+	body := &g.fn.body
+	if expr.Unary != nil {
+		return g.genUnary(expr.Unary, want)
+	}
+	if expr.Chained {
+		unchained, err := parser.Unchain(expr)
+		if err != nil {
+			return err
+		}
+		return g.genExpr(unchained, want)
+	}
+	switch expr.Op {
+	case parser.OpAnd, parser.OpOr:
+		// Short-circuit evaluation.
+		if err := g.genExpr(expr.Left, typeI32); err != nil {
+			return err
+		}
+		body.WriteByte(opIf)
+		body.WriteByte(typeI32)
+		if expr.Op == parser.OpAnd {
+			if err := g.genExpr(expr.Right, typeI32); err != nil {
+				return err
+			}
+			body.WriteByte(opElse)
+			body.WriteByte(opI32Const)
+			body.s64(0)
+		} else {
+			body.WriteByte(opI32Const)
+			body.s64(1)
+			body.WriteByte(opElse)
+			if err := g.genExpr(expr.Right, typeI32); err != nil {
+				return err
+			}
+		}
+		body.WriteByte(opEnd)
+		return nil
+
+	case parser.OpEq, parser.OpNe, parser.OpLt, parser.OpGt, parser.OpLe, parser.OpGe:
+		if want != typeI32 {
+			return participle.Errorf(expr.Pos, "comparison result must be a bool")
+		}
+		typ, err := g.operandType(expr)
+		if err != nil {
+			return err
+		}
+		if err := g.genExpr(expr.Left, typ); err != nil {
+			return err
+		}
+		if err := g.genExpr(expr.Right, typ); err != nil {
+			return err
+		}
+		return g.genBinaryOp(expr.Pos, expr.Op.String(), typ)
+
+	default:
+		if err := g.genExpr(expr.Left, want); err != nil {
+			return err
+		}
+		if err := g.genExpr(expr.Right, want); err != nil {
+			return err
+		}
+		return g.genBinaryOp(expr.Pos, expr.Op.String(), want)
+	}
+}
+
+func (g *generator) genBinaryOp(pos lexer.Position, op string, typ byte) error {
+	code, ok := binaryOps[typ][op]
+	if !ok {
+		return participle.Errorf(pos, "operator %s is not supported by the wasm backend", op)
+	}
+	g.fn.body.WriteByte(code)
+	return nil
+}
+
+// Determine the operand type of a comparison.
+//
+// Literals adopt the type of the other operand.
+func (g *generator) operandType(expr *parser.Expr) (byte, error) {
+	left, right := g.program.Resolved(expr.Left), g.program.Resolved(expr.Right)
+	if left == nil || right == nil {
+		return 0, participle.Errorf(expr.Pos, "unknown operand types")
+	}
+	ref := left
+	switch left.Kind() {
+	case types.KindLiteralInt, types.KindLiteralFloat:
+		ref = right
+	}
+	return valType(expr.Pos, ref)
+}
+
+func (g *generator) genUnary(unary *parser.Unary, want byte) error {
+	body := &g.fn.body
+	switch unary.Op {
+	case parser.OpSub:
+		if want == typeI64 {
+			body.WriteByte(opI64Const)
+			body.s64(0)
+		}
+		if err := g.genReference(unary.Reference, want); err != nil {
+			return err
+		}
+		switch want {
+		case typeI64:
+			body.WriteByte(binaryOps[typeI64]["-"])
+		case typeF64:
+			body.WriteByte(opF64Neg)
+		default:
+			return participle.Errorf(unary.Pos, "can't negate a non-numeric value")
+		}
+		return nil
+
+	case parser.OpNot:
+		if want != typeI32 {
+			return participle.Errorf(unary.Pos, "result of ! must be a bool")
+		}
+		if err := g.genReference(unary.Reference, want); err != nil {
+			return err
+		}
+		body.WriteByte(opI32Eqz)
+		return nil
+
+	default:
+		return g.genReference(unary.Reference, want)
+	}
+}
+
+func (g *generator) genReference(ref *parser.Reference, want byte) error {
+	body := &g.fn.body
+	terminal := ref.Terminal
+	if ref.Next != nil {
+		results, err := g.genCall(&parser.Expr{Mixin: ref.Mixin, Unary: &parser.Unary{Mixin: ref.Mixin, Reference: ref}})
+		if err != nil {
+			return err
+		}
+		if len(results) != 1 || results[0] != want {
+			return participle.Errorf(ref.Pos, "function %q does not return the expected type", terminal.Ident)
+		}
+		return nil
+	}
+	switch {
+	case terminal.Tuple != nil && len(terminal.Tuple) == 1:
+		return g.genExpr(terminal.Tuple[0], want)
+
+	case terminal.Ident != "":
+		idx, ok := g.resolveLocal(terminal.Ident)
+		if !ok {
+			return participle.Errorf(terminal.Pos, "unknown local variable %q", terminal.Ident)
+		}
+		if g.localType(idx) != want {
+			return participle.Errorf(terminal.Pos, "%q does not have the expected type", terminal.Ident)
+		}
+		body.WriteByte(opLocalGet)
+		body.u32(idx)
+		return nil
+
+	case terminal.Literal != nil:
+		return g.genLiteral(terminal.Literal, want)
+
+	default:
+		return participle.Errorf(terminal.Pos, "%s is not supported by the wasm backend", terminal.Describe())
+	}
+}
+
+// Generate a call to a function, returning its result types.
+func (g *generator) genCall(expr *parser.Expr) ([]byte, error) {
+	var ref *parser.Reference
+	if expr.Unary != nil && expr.Unary.Op == 0 {
+		ref = expr.Unary.Reference
+	}
+	if ref == nil || ref.Next == nil || ref.Next.Call == nil || ref.Next.Next != nil {
+		return nil, participle.Errorf(expr.Pos, "expression is not a function call")
+	}
+	fn, ok := g.funcs[ref.Terminal.Ident]
+	if !ok {
+		return nil, participle.Errorf(ref.Pos, "unknown function %s", ref.Terminal.Describe())
+	}
+	call := ref.Next.Call
+	if call.TrailingClosure != nil {
+		return nil, participle.Errorf(call.TrailingClosure.Pos, "trailing closures are not supported by the wasm backend")
+	}
+	if len(call.Parameters) != len(fn.params) {
+		return nil, participle.Errorf(call.Pos, "%d parameters provided for function that takes %d parameters",
+			len(call.Parameters), len(fn.params))
+	}
+	for i, param := range call.Parameters {
+		if err := g.genExpr(param, fn.params[i]); err != nil {
+			return nil, err
+		}
+	}
+	g.fn.body.WriteByte(opCall)
+	g.fn.body.u32(fn.index)
+	return fn.results, nil
+}
+
+func (g *generator) genLiteral(literal *parser.Literal, want byte) error {
+	body := &g.fn.body
+	switch {
+	case literal.Number != nil && want == typeI64:
+		if !literal.Number.IsInt() {
+			return participle.Errorf(literal.Pos, "can't use %s as an int", literal.Number)
+		}
+		n, _ := literal.Number.Value.Int64()
+		body.WriteByte(opI64Const)
+		body.s64(n)
+
+	case literal.Number != nil && want == typeF64:
+		f, _ := literal.Number.Value.Float64()
+		body.WriteByte(opF64Const)
+		body.f64(f)
+
+	case literal.Bool != nil && want == typeI32:
+		body.WriteByte(opI32Const)
+		if *literal.Bool {
+			body.s64(1)
+		} else {
+			body.s64(0)
+		}
+
+	case literal.Char != nil && want == typeI32:
+		body.WriteByte(opI32Const)
+		body.s64(int64(*literal.Char))
+
+	default:
+		return participle.Errorf(literal.Pos, "%s literal is not supported here by the wasm backend", literal.Describe())
+	}
+	return nil
+}
+
+// Encode the module.
+func (g *generator) module() []byte {
+	out := &encoder{}
+	out.Write([]byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00})
+
+	// One type per function, in function order.
+	section := &encoder{}
+	section.u32(uint32(len(g.order)))
+	for _, fn := range g.order {
+		section.WriteByte(typeFunc)
+		section.bytes(fn.params)
+		section.bytes(fn.results)
+	}
+	out.section(sectionType, section)
+
+	section = &encoder{}
+	section.u32(uint32(len(g.order)))
+	for _, fn := range g.order {
+		section.u32(fn.index)
+	}
+	out.section(sectionFunction, section)
+
+	section = &encoder{}
+	section.u32(1)
+	section.WriteByte(typeFuncRef)
+	section.WriteByte(0x00) // Limits with only a minimum.
+	section.u32(uint32(len(g.order)))
+	out.section(sectionTable, section)
+
+	section = &encoder{}
+	section.u32(uint32(len(g.order) + 1))
+	for _, fn := range g.order {
+		section.name(fn.decl.Name)
+		section.WriteByte(exportFunc)
+		section.u32(fn.index)
+	}
+	section.name("table")
+	section.WriteByte(exportTable)
+	section.u32(0)
+	out.section(sectionExport, section)
+
+	section = &encoder{}
+	section.u32(1)
+	section.u32(0) // Active segment for table 0.
+	section.WriteByte(opI32Const)
+	section.s64(0)
+	section.WriteByte(opEnd)
+	section.u32(uint32(len(g.order)))
+	for _, fn := range g.order {
+		section.u32(fn.index)
+	}
+	out.section(sectionElement, section)
+
+	section = &encoder{}
+	section.u32(uint32(len(g.order)))
+	for _, fn := range g.order {
+		code := &encoder{}
+		code.u32(uint32(len(fn.locals)))
+		for _, local := range fn.locals {
+			code.u32(1)
+			code.WriteByte(local)
+		}
+		code.Write(fn.code)
+		section.bytes(code.Bytes())
+	}
+	out.section(sectionCode, section)
+	return out.Bytes()
+}
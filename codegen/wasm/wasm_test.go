@@ -0,0 +1,139 @@
+package wasm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestGenerate(t *testing.T) {
+	ast, err := parser.ParseString(`
+		fn add(a, b: int): int {
+			return a + b
+		}
+	`)
+	require.NoError(t, err)
+	program, err := analyser.Analyse(ast)
+	require.NoError(t, err)
+	w := &bytes.Buffer{}
+	err = Generate(w, program)
+	require.NoError(t, err)
+	require.Equal(t, []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		// Types: (i64, i64) -> i64
+		0x01, 0x07, 0x01, 0x60, 0x02, 0x7e, 0x7e, 0x01, 0x7e,
+		// Functions
+		0x03, 0x02, 0x01, 0x00,
+		// Table
+		0x04, 0x04, 0x01, 0x70, 0x00, 0x01,
+		// Exports: "add" and "table"
+		0x07, 0x0f, 0x02,
+		0x03, 'a', 'd', 'd', 0x00, 0x00,
+		0x05, 't', 'a', 'b', 'l', 'e', 0x01, 0x00,
+		// Elements
+		0x09, 0x07, 0x01, 0x00, 0x41, 0x00, 0x0b, 0x01, 0x00,
+		// Code: local.get 0, local.get 1, i64.add, return, end
+		0x0a, 0x0a, 0x01, 0x08, 0x00, 0x20, 0x00, 0x20, 0x01, 0x7c, 0x0f, 0x0b,
+	}, w.Bytes())
+}
+
+func TestSupportedSubset(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		fail  string
+	}{
+		{name: "Fibonacci",
+			input: `
+				fn fib(n: int): int {
+					if n <= 1 {
+						return n
+					}
+					return fib(n-1) + fib(n-2)
+				}
+			`},
+		{name: "LocalsAndFloats",
+			input: `
+				fn clamp(x, lo: float): float {
+					let y = x * 2.0
+					if y < lo || y > 5.0 {
+						y = lo
+					}
+					y += 1
+					return -y
+				}
+			`},
+		{name: "NonFunction",
+			input: `
+				let a = 1
+			`,
+			fail: "2:5: only functions are supported by the wasm backend"},
+		{name: "StringParameter",
+			input: `
+				fn f(s: string) {}
+			`,
+			fail: "2:5: string values are not supported by the wasm backend"},
+		{name: "UnsupportedStatement",
+			input: `
+				fn f(a: int) {
+					switch a {
+					case 1:
+					}
+				}
+			`,
+			fail: "3:6: statement is not supported by the wasm backend"},
+		{name: "FloatModulo",
+			input: `
+				fn f(a: float): float {
+					return a % 2.0
+				}
+			`,
+			fail: "3:15: operator % is not supported by the wasm backend"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			program, err := analyser.Analyse(ast)
+			require.NoError(t, err)
+			err = Generate(&bytes.Buffer{}, program)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLEB128(t *testing.T) {
+	unsigned := map[uint32][]byte{
+		0:      {0x00},
+		127:    {0x7f},
+		128:    {0x80, 0x01},
+		624485: {0xe5, 0x8e, 0x26},
+	}
+	for n, expected := range unsigned {
+		e := &encoder{}
+		e.u32(n)
+		require.Equal(t, expected, e.Bytes(), "%d", n)
+	}
+	signed := map[int64][]byte{
+		0:       {0x00},
+		63:      {0x3f},
+		64:      {0xc0, 0x00},
+		-1:      {0x7f},
+		-64:     {0x40},
+		-65:     {0xbf, 0x7f},
+		-123456: {0xc0, 0xbb, 0x78},
+	}
+	for n, expected := range signed {
+		e := &encoder{}
+		e.s64(n)
+		require.Equal(t, expected, e.Bytes(), "%d", n)
+	}
+}
@@ -1,6 +1,7 @@
 package wat
 
 import (
+	"bufio"
 	"fmt"
 	"hash/fnv"
 	"io"
@@ -85,3 +86,48 @@ func (l List) write(indent string, w io.Writer) {
 func (l *List) Add(e ...Node) {
 	*l = append(*l, e...)
 }
+
+// ListWriter writes a List incrementally, flushing each element to the underlying
+// io.Writer as it is added.
+//
+// This allows large outputs, such as a module, to be emitted without first being
+// built in memory. The output is identical to that of Write for the equivalent List.
+type ListWriter struct {
+	w      *bufio.Writer
+	byLine bool
+	empty  bool
+}
+
+// NewListWriter starts a new List on w with "id" as its first element.
+func NewListWriter(w io.Writer, id ID) *ListWriter {
+	l := &ListWriter{w: bufio.NewWriter(w), byLine: oneEntryPerLine[string(id)], empty: true}
+	fmt.Fprint(l.w, "(")
+	l.write(id)
+	return l
+}
+
+// Add elements to the list and flush them to the underlying io.Writer.
+func (l *ListWriter) Add(e ...Node) error {
+	for _, node := range e {
+		l.write(node)
+	}
+	return l.w.Flush()
+}
+
+// Close the list.
+func (l *ListWriter) Close() error {
+	fmt.Fprint(l.w, ")")
+	return l.w.Flush()
+}
+
+func (l *ListWriter) write(node Node) {
+	if !l.empty {
+		if l.byLine {
+			fmt.Fprint(l.w, "\n  ")
+		} else {
+			fmt.Fprint(l.w, " ")
+		}
+	}
+	l.empty = false
+	node.write("  ", l.w)
+}
@@ -35,3 +35,24 @@ func TestSExpr(t *testing.T) {
 		})
 	}
 }
+
+func TestListWriter(t *testing.T) {
+	expected := &strings.Builder{}
+	err := Write(expected, List{
+		ID("module"),
+		List{ID("memory"), Int(1)},
+		List{ID("func"), Var("a"), List{ID("i32.const"), Int(1)}},
+		List{ID("func"), Var("b")},
+	})
+	require.NoError(t, err)
+
+	actual := &strings.Builder{}
+	lw := NewListWriter(actual, ID("module"))
+	err = lw.Add(List{ID("memory"), Int(1)})
+	require.NoError(t, err)
+	err = lw.Add(List{ID("func"), Var("a"), List{ID("i32.const"), Int(1)}}, List{ID("func"), Var("b")})
+	require.NoError(t, err)
+	err = lw.Close()
+	require.NoError(t, err)
+	require.Equal(t, expected.String(), actual.String())
+}
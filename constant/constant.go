@@ -0,0 +1,225 @@
+// Package constant evaluates operators applied to literal operands.
+//
+// It is shared by the analyser, which evaluates constant expressions at check
+// time, and the optimiser, which folds them.
+package constant
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+// Binary evaluates op applied to left and right.
+//
+// The result is nil if op can't be applied to the operands, or if the result
+// depends on how they are used: integer division that is not exact is not
+// evaluated, as integer literals may also be used as floats. An error is
+// returned for division by zero, or if the result overflows.
+func Binary(op parser.Op, left, right *parser.Literal) (*parser.Literal, error) {
+	switch {
+	case left.Number != nil && right.Number != nil:
+		return numbers(op, left.Number, right.Number)
+	case left.Bool != nil && right.Bool != nil:
+		return bools(op, bool(*left.Bool), bool(*right.Bool)), nil
+	case left.Char != nil && right.Char != nil:
+		return compare(op, int(*left.Char)-int(*right.Char)), nil
+	case left.Str != nil && right.Str != nil:
+		return strs(op, left.Str, right.Str), nil
+	}
+	return nil, nil
+}
+
+// Unary evaluates op applied to literal, or returns nil if it can't be
+// applied.
+func Unary(op parser.Op, literal *parser.Literal) *parser.Literal {
+	switch {
+	case op == parser.OpNone:
+		return literal
+
+	case op == parser.OpSub && literal.Number != nil:
+		n := &parser.Number{Radix: literal.Number.Radix, Float: literal.Number.Float}
+		n.Value.Neg(&literal.Number.Value)
+		return &parser.Literal{Number: n}
+
+	case op == parser.OpNot && literal.Bool != nil:
+		return Bool(!bool(*literal.Bool))
+	}
+	return nil
+}
+
+// String returns the value of a constant literal as it would be written in
+// source.
+func String(literal *parser.Literal) string {
+	switch {
+	case literal.Number != nil:
+		return literal.Number.String()
+	case literal.Str != nil:
+		s, _ := stringValue(literal.Str)
+		return strconv.Quote(s)
+	case literal.Char != nil:
+		return strconv.QuoteRune(rune(*literal.Char))
+	default:
+		return strconv.FormatBool(bool(*literal.Bool))
+	}
+}
+
+// Bool returns a boolean literal.
+func Bool(b bool) *parser.Literal {
+	value := parser.Bool(b)
+	return &parser.Literal{Bool: &value}
+}
+
+func numbers(op parser.Op, left, right *parser.Number) (*parser.Literal, error) {
+	if !left.IsInt() || !right.IsInt() {
+		l, _ := left.Value.Float64()
+		r, _ := right.Value.Float64()
+		var result float64
+		switch op {
+		case parser.OpAdd:
+			result = l + r
+		case parser.OpSub:
+			result = l - r
+		case parser.OpMul:
+			result = l * r
+		case parser.OpDiv:
+			if r == 0 {
+				return nil, errors.New("division by zero in constant expression")
+			}
+			result = l / r
+		default:
+			switch {
+			case l < r:
+				return compare(op, -1), nil
+			case l > r:
+				return compare(op, 1), nil
+			}
+			return compare(op, 0), nil
+		}
+		if math.IsInf(result, 0) {
+			return nil, errors.New("constant expression overflows float")
+		}
+		n := &parser.Number{Radix: 10, Float: true}
+		n.Value.SetFloat64(result)
+		return &parser.Literal{Number: n}, nil
+	}
+	l, _ := left.Value.Int(nil)
+	r, _ := right.Value.Int(nil)
+	result := new(big.Int)
+	switch op {
+	case parser.OpAdd:
+		result.Add(l, r)
+	case parser.OpSub:
+		result.Sub(l, r)
+	case parser.OpMul:
+		result.Mul(l, r)
+	case parser.OpDiv, parser.OpMod:
+		if r.Sign() == 0 {
+			return nil, errors.New("division by zero in constant expression")
+		}
+		quo, rem := new(big.Int).QuoRem(l, r, new(big.Int))
+		switch {
+		case op == parser.OpMod:
+			result = rem
+		case rem.Sign() != 0:
+			return nil, nil
+		default:
+			result = quo
+		}
+	case parser.OpBitAnd:
+		result.And(l, r)
+	case parser.OpBitOr:
+		result.Or(l, r)
+	default:
+		return compare(op, l.Cmp(r)), nil
+	}
+	if !result.IsInt64() {
+		return nil, errors.New("constant expression overflows int")
+	}
+	n := &parser.Number{Radix: 10}
+	n.Value.SetInt(result)
+	return &parser.Literal{Number: n}, nil
+}
+
+func bools(op parser.Op, left, right bool) *parser.Literal {
+	switch op {
+	case parser.OpEq:
+		return Bool(left == right)
+	case parser.OpNe:
+		return Bool(left != right)
+	case parser.OpAnd, parser.OpBitAnd:
+		return Bool(left && right)
+	case parser.OpOr, parser.OpBitOr:
+		return Bool(left || right)
+	}
+	return nil
+}
+
+// Concatenation applies to strings with interpolated expressions, but
+// comparison does not.
+func strs(op parser.Op, left, right *parser.String) *parser.Literal {
+	if op == parser.OpAdd {
+		fragments := append([]parser.StringFragment{}, left.Fragments...)
+		for _, fragment := range right.Fragments {
+			last := len(fragments) - 1
+			if last >= 0 && fragments[last].Expr == nil && fragment.Expr == nil {
+				fragments[last].String += fragment.String
+			} else {
+				fragments = append(fragments, fragment)
+			}
+		}
+		return &parser.Literal{Str: &parser.String{Mixin: left.Mixin, Raw: left.Raw + right.Raw, Fragments: fragments}}
+	}
+	l, ok := stringValue(left)
+	if !ok {
+		return nil
+	}
+	r, ok := stringValue(right)
+	if !ok {
+		return nil
+	}
+	switch {
+	case l < r:
+		return compare(op, -1)
+	case l > r:
+		return compare(op, 1)
+	default:
+		return compare(op, 0)
+	}
+}
+
+// Value of a string without interpolated expressions.
+func stringValue(s *parser.String) (string, bool) {
+	out := ""
+	for _, fragment := range s.Fragments {
+		if fragment.Expr != nil {
+			return "", false
+		}
+		out += fragment.String
+	}
+	return out, true
+}
+
+// Evaluate a comparison operator given the sign of left - right, or return
+// nil if op is not a comparison.
+func compare(op parser.Op, cmp int) *parser.Literal {
+	switch op {
+	case parser.OpEq:
+		return Bool(cmp == 0)
+	case parser.OpNe:
+		return Bool(cmp != 0)
+	case parser.OpLt:
+		return Bool(cmp < 0)
+	case parser.OpLe:
+		return Bool(cmp <= 0)
+	case parser.OpGt:
+		return Bool(cmp > 0)
+	case parser.OpGe:
+		return Bool(cmp >= 0)
+	}
+	return nil
+}
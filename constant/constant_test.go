@@ -0,0 +1,52 @@
+package constant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestBinary(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+		fail     string
+	}{
+		{source: `1 + 2`, expected: "3"},
+		{source: `7 / 2`},
+		{source: `7 % 2`, expected: "1"},
+		{source: `1.5 * 2`, expected: "3.0"},
+		{source: `2.0 + 1`, expected: "3.0"},
+		{source: `1 < 2`, expected: "true"},
+		{source: `'a' < 'b'`, expected: "true"},
+		{source: `"a" + "b"`, expected: `"ab"`},
+		{source: `"a" == "b"`, expected: "false"},
+		{source: `true && false`, expected: "false"},
+		{source: `1 + true`},
+		{source: `1 / 0`, fail: "division by zero in constant expression"},
+		{source: `9223372036854775807 + 1`, fail: "constant expression overflows int"},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			ast, err := parser.ParseString("let a = " + test.source + "\n")
+			require.NoError(t, err)
+			expr := ast.Declarations[0].Var.Vars[0].Default
+			literal := func(expr *parser.Expr) *parser.Literal {
+				return expr.Unary.Reference.Terminal.Literal
+			}
+			result, err := Binary(expr.Op, literal(expr.Left), literal(expr.Right))
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+			if test.expected == "" {
+				require.Nil(t, result)
+				return
+			}
+			require.Equal(t, test.expected, String(result))
+		})
+	}
+}
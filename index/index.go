@@ -0,0 +1,335 @@
+// Package index maintains a persistent index of the symbols declared across
+// a workspace, for editors.
+package index
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+// Version of the on-disk format of an index.
+//
+// It must be incremented whenever the format, or the symbols extracted from
+// a file, change. Indexes saved with any other version are discarded by Load.
+const Version = 1
+
+// Kind of a symbol.
+type Kind int
+
+const (
+	KindClass Kind = iota + 1
+	KindEnum
+	KindCase
+	KindFunction
+	KindMethod
+	KindVariable
+	KindConstant
+	KindProperty
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindClass:
+		return "class"
+	case KindEnum:
+		return "enum"
+	case KindCase:
+		return "case"
+	case KindFunction:
+		return "function"
+	case KindMethod:
+		return "method"
+	case KindVariable:
+		return "variable"
+	case KindConstant:
+		return "constant"
+	case KindProperty:
+		return "property"
+	}
+	panic("unknown symbol kind")
+}
+
+// Symbol is a declaration outside of a function body.
+type Symbol struct {
+	Name string `json:"name"`
+	Kind Kind   `json:"kind"`
+	// Container is the dotted path of the classes and enums enclosing the
+	// declaration, if any, eg. "Outer.Inner".
+	Container string `json:"container,omitempty"`
+	// File the symbol is declared in, as passed to Update.
+	File   string         `json:"file"`
+	Pos    lexer.Position `json:"pos"`
+	EndPos lexer.Position `json:"end"`
+}
+
+// Index of the symbols declared in a set of files.
+//
+// It is safe for concurrent use.
+type Index struct {
+	lock  sync.RWMutex
+	files map[string]*file
+}
+
+// An indexed file.
+type file struct {
+	// Modification time and size, which if unchanged are trusted to mean
+	// the content is too.
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	// SHA-256 of the content.
+	Hash    string   `json:"hash"`
+	Symbols []Symbol `json:"symbols"`
+}
+
+type encodedIndex struct {
+	Version int              `json:"version"`
+	Files   map[string]*file `json:"files"`
+}
+
+// New creates an empty index.
+func New() *Index {
+	return &Index{files: map[string]*file{}}
+}
+
+// Load an index saved by Save.
+//
+// An empty index is returned if path does not exist, or was saved by a
+// different Version.
+func Load(path string) (*Index, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return New(), nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	in := &encodedIndex{}
+	if err := json.Unmarshal(data, in); err != nil {
+		return nil, errors.Wrapf(err, "%s", path)
+	}
+	if in.Version != Version || in.Files == nil {
+		return New(), nil
+	}
+	return &Index{files: in.Files}, nil
+}
+
+// Save the index to path.
+//
+// The index is written to a temporary file which then replaces path, so
+// that a concurrent Load never sees a partially written index.
+func (i *Index) Save(path string) error {
+	i.lock.RLock()
+	data, err := json.Marshal(&encodedIndex{Version: Version, Files: i.files})
+	i.lock.RUnlock()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	w, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(w.Name()) // nolint: errcheck
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return errors.WithStack(err)
+	}
+	if err := w.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(w.Name(), path))
+}
+
+// Scan indexes every .langx file below root, and removes indexed files below
+// root that no longer exist.
+//
+// Errors are as for Update.
+func (i *Index) Scan(root string) []error {
+	paths := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".langx" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return []error{errors.WithStack(err)}
+	}
+	prefix := filepath.Clean(root) + string(filepath.Separator)
+	i.lock.RLock()
+	for path := range i.files {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+	i.lock.RUnlock()
+	return i.Update(paths...)
+}
+
+// Update re-indexes the files at paths that have changed since they were last
+// indexed, and removes those that no longer exist.
+//
+// Files that fail to parse retain the symbols they were last indexed with,
+// and their errors are returned in the order of paths.
+func (i *Index) Update(paths ...string) []error {
+	errs := []error{}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if err := i.update(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (i *Index) update(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		i.Remove(path)
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+	i.lock.RLock()
+	indexed := i.files[path]
+	i.lock.RUnlock()
+	if indexed != nil && indexed.ModTime.Equal(info.ModTime()) && indexed.Size == info.Size() {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	sum := sha256.Sum256(data)
+	updated := &file{ModTime: info.ModTime(), Size: info.Size(), Hash: hex.EncodeToString(sum[:])}
+	if indexed != nil && indexed.Hash == updated.Hash {
+		updated.Symbols = indexed.Symbols
+	} else {
+		ast, err := parser.Parse(bytes.NewReader(data))
+		if err != nil {
+			return errors.Wrapf(err, "%s", path)
+		}
+		updated.Symbols = symbols(path, ast)
+	}
+	i.lock.Lock()
+	i.files[path] = updated
+	i.lock.Unlock()
+	return nil
+}
+
+// Remove the files at paths from the index.
+func (i *Index) Remove(paths ...string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for _, path := range paths {
+		delete(i.files, path)
+	}
+}
+
+// Files returns the indexed files, sorted.
+func (i *Index) Files() []string {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	out := make([]string, 0, len(i.files))
+	for path := range i.files {
+		out = append(out, path)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Extract the symbols declared by ast.
+func symbols(path string, ast *parser.AST) []Symbol {
+	out := []Symbol{}
+	add := func(name string, kind Kind, node parser.Node, ancestors []parser.Node) {
+		containers := []string{}
+		for _, ancestor := range ancestors {
+			switch ancestor := ancestor.(type) {
+			case *parser.ClassDecl:
+				containers = append(containers, ancestor.Type.Type)
+
+			case *parser.EnumDecl:
+				containers = append(containers, ancestor.Type.Type)
+			}
+		}
+		out = append(out, Symbol{
+			Name:      name,
+			Kind:      kind,
+			Container: strings.Join(containers, "."),
+			File:      path,
+			Pos:       node.Position(),
+			EndPos:    node.EndPosition(),
+		})
+	}
+	_ = parser.Inspect(ast, func(node parser.Node, ancestors []parser.Node) bool {
+		member := false
+		if len(ancestors) > 0 {
+			switch ancestors[len(ancestors)-1].(type) {
+			case *parser.ClassMember, *parser.EnumMember:
+				member = true
+			}
+		}
+		switch node := node.(type) {
+		case *parser.ClassDecl:
+			add(node.Type.Type, KindClass, node, ancestors)
+
+		case *parser.EnumDecl:
+			add(node.Type.Type, KindEnum, node, ancestors)
+
+		case *parser.CaseDecl:
+			add(node.Name, KindCase, node, ancestors)
+
+		case *parser.FuncDecl:
+			if member {
+				add(node.Name, KindMethod, node, ancestors)
+			} else {
+				add(node.Name, KindFunction, node, ancestors)
+			}
+			// Declarations within functions are local.
+			return false
+
+		case *parser.InitialiserDecl:
+			return false
+
+		case *parser.VarDecl:
+			kind := KindVariable
+			switch {
+			case member:
+				kind = KindProperty
+			case node.Const:
+				kind = KindConstant
+			}
+			for _, asgn := range node.Vars {
+				if asgn.Pattern != nil {
+					for _, name := range asgn.Pattern.Names() {
+						add(name, kind, asgn, ancestors)
+					}
+				} else {
+					add(asgn.Name, kind, asgn, ancestors)
+				}
+			}
+			return false
+		}
+		return true
+	})
+	return out
+}
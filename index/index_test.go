@@ -0,0 +1,141 @@
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, source string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, ioutil.WriteFile(path, []byte(source), 0600))
+		// Ensure the modification time differs from any earlier write.
+		modTime := time.Now().Add(time.Duration(len(source)) * time.Second)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+		return path
+	}
+	shapes := write("shapes.langx", `
+enum Shape {
+	case circle(int)
+	fn area(): int {
+		let local = 1
+		return local
+	}
+}
+class Point {
+	let x, y: int
+}
+`)
+	util := write("util/strings.langx", `
+const separator = ","
+fn getValue(): int {
+	return 1
+}
+let gravity = 1
+`)
+	write("README.md", "let ignored = 1")
+
+	symbolsOf := func(symbols []Symbol) []string {
+		out := []string{}
+		for _, symbol := range symbols {
+			name := symbol.Name
+			if symbol.Container != "" {
+				name = symbol.Container + "." + name
+			}
+			rel, err := filepath.Rel(dir, symbol.File)
+			require.NoError(t, err)
+			out = append(out, fmt.Sprintf("%s %s %s:%d", symbol.Kind, name, filepath.ToSlash(rel), symbol.Pos.Line))
+		}
+		return out
+	}
+
+	index := New()
+	require.Empty(t, index.Scan(dir))
+	require.Equal(t, []string{shapes, util}, index.Files())
+	require.Equal(t, []string{
+		"enum Shape shapes.langx:2",
+		"case Shape.circle shapes.langx:3",
+		"method Shape.area shapes.langx:4",
+		"class Point shapes.langx:9",
+		"property Point.x shapes.langx:10",
+		"property Point.y shapes.langx:10",
+	}, symbolsOf(index.files[shapes].Symbols))
+
+	require.Equal(t, []string{
+		"function getValue util/strings.langx:3",
+		"variable gravity util/strings.langx:6",
+	}, symbolsOf(index.Search("gv", 0)))
+	require.Equal(t, []string{"enum Shape shapes.langx:2"}, symbolsOf(index.Search("shape", 0)))
+	require.Equal(t, []string{"property Point.x shapes.langx:10"}, symbolsOf(index.Search("X", 1)))
+	require.Empty(t, index.Search("zz", 0))
+
+	// Files that fail to parse retain their symbols.
+	write("util/strings.langx", `fn broken(`)
+	errs := index.Update(util)
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Error(), "strings.langx")
+	require.Equal(t, []string{"constant separator util/strings.langx:2"}, symbolsOf(index.Search("separator", 0)))
+
+	write("util/strings.langx", `fn separate() {}`)
+	require.Empty(t, index.Update(util))
+	require.Equal(t, []string{"function separate util/strings.langx:1"}, symbolsOf(index.Search("separ", 0)))
+
+	// Persistence.
+	path := filepath.Join(dir, "index.json")
+	require.NoError(t, index.Save(path))
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, index.Files(), loaded.Files())
+	require.Equal(t, index.Search("", 0), loaded.Search("", 0))
+
+	require.NoError(t, os.Remove(shapes))
+	require.Empty(t, loaded.Scan(dir))
+	require.Equal(t, []string{util}, loaded.Files())
+
+	// Indexes of other versions are discarded.
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"version": 0, "files": {"a.langx": {}}}`), 0600))
+	loaded, err = Load(path)
+	require.NoError(t, err)
+	require.Empty(t, loaded.Files())
+
+	loaded, err = Load(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+	require.Empty(t, loaded.Files())
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{"area", []string{"area", "areas", "myArea", "marea"}},
+		{"gv", []string{"getValue", "get_value", "govern", "giveaway"}},
+		{"pt", []string{"pointTo", "Point", "output"}},
+	}
+	for _, test := range tests {
+		// nolint: scopelint
+		t.Run(test.query, func(t *testing.T) {
+			last := 0
+			for i, name := range test.names {
+				score, ok := fuzzyMatch(test.query, name)
+				require.True(t, ok, name)
+				if i > 0 {
+					require.Less(t, score, last, "%s should rank below %s", name, test.names[i-1])
+				}
+				last = score
+			}
+		})
+	}
+	_, ok := fuzzyMatch("ab", "ba")
+	require.False(t, ok)
+}
@@ -0,0 +1,122 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Search returns up to limit symbols whose names fuzzily match query, best
+// first. A limit of zero or less returns every match.
+//
+// A name matches if it contains the characters of query in order, ignoring
+// case. Exact and prefix matches rank highest, followed by those matching at
+// word boundaries, eg. "gv" matches "getValue" and "get_value" better than
+// "giveaway", then by consecutive characters matched, and shorter names.
+func (i *Index) Search(query string, limit int) []Symbol {
+	type match struct {
+		symbol Symbol
+		score  int
+	}
+	matches := []match{}
+	i.lock.RLock()
+	for _, file := range i.files {
+		for _, symbol := range file.Symbols {
+			if score, ok := fuzzyMatch(query, symbol.Name); ok {
+				matches = append(matches, match{symbol, score})
+			}
+		}
+	}
+	i.lock.RUnlock()
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		switch {
+		case a.score != b.score:
+			return a.score > b.score
+		case a.symbol.Name != b.symbol.Name:
+			return a.symbol.Name < b.symbol.Name
+		case a.symbol.File != b.symbol.File:
+			return a.symbol.File < b.symbol.File
+		}
+		return a.symbol.Pos.Offset < b.symbol.Pos.Offset
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	out := make([]Symbol, 0, len(matches))
+	for _, match := range matches {
+		out = append(out, match.symbol)
+	}
+	return out
+}
+
+// Scores for fuzzyMatch.
+const (
+	scoreExact       = 1000
+	scorePrefix      = 500
+	scoreBoundary    = 20
+	scoreConsecutive = 10
+	scoreCharacter   = 1
+)
+
+// Match query against name, returning a score if it matches.
+//
+// Characters are matched greedily, preferring those at word boundaries.
+func fuzzyMatch(query, name string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+	switch lowerQuery, lowerName := strings.ToLower(query), strings.ToLower(name); {
+	case lowerQuery == lowerName:
+		return scoreExact - len(name), true
+
+	case strings.HasPrefix(lowerName, lowerQuery):
+		return scorePrefix - len(name), true
+	}
+	q := []rune(query)
+	n := []rune(name)
+	score := 0
+	last := -2
+	start := 0
+	for _, r := range q {
+		r = unicode.ToLower(r)
+		// Prefer the next occurrence at a word boundary, falling back to the
+		// next occurrence.
+		found := -1
+		for j := start; j < len(n); j++ {
+			if unicode.ToLower(n[j]) != r {
+				continue
+			}
+			if boundary(n, j) {
+				found = j
+				break
+			}
+			if found == -1 {
+				found = j
+			}
+		}
+		if found == -1 {
+			return 0, false
+		}
+		score += scoreCharacter
+		if boundary(n, found) {
+			score += scoreBoundary
+		}
+		if found == last+1 {
+			score += scoreConsecutive
+		}
+		last, start = found, found+1
+	}
+	return score - utf8.RuneCountInString(name), true
+}
+
+// Returns true if name[i] starts a word, eg. the "V" of "getValue" or the "v"
+// of "get_value".
+func boundary(name []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev := name[i-1]
+	return prev == '_' || (unicode.IsLower(prev) && unicode.IsUpper(name[i]))
+}
@@ -0,0 +1,217 @@
+// Package lint reports likely mistakes in programs that are otherwise valid.
+//
+// Checks are implemented as rules, registered by name. Diagnostics can be
+// suppressed with a comment naming the rules to ignore, either at the end of
+// the offending line or alone on the line preceding it:
+//
+//	// langx:ignore unused-variable
+//	let a = 1
+package lint
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+)
+
+// Machine-readable codes identifying each kind of diagnostic. These are also
+// the names of the rules reporting them.
+const (
+	CodeUnusedVariable = "unused-variable"
+	CodeUnusedImport   = "unused-import"
+)
+
+// Diagnostic is a single lint finding.
+type Diagnostic = parser.Diagnostic
+
+// Fix is a suggested change resolving a diagnostic.
+type Fix = parser.Fix
+
+// Edit replaces a span of source.
+type Edit = parser.Edit
+
+// Rule is a single lint check.
+type Rule interface {
+	// Name of the rule, used to enable, disable and suppress it.
+	Name() string
+	// Doc is a one line description of what the rule reports.
+	Doc() string
+	// Run the rule, reporting diagnostics to the Context.
+	Run(ctx *Context)
+}
+
+// Context is the input to a rule.
+type Context struct {
+	// Source of the linted file.
+	Source string
+	// Program analysed from Source.
+	Program *analyser.Program
+	Config  Config
+
+	rule        string
+	diagnostics []Diagnostic
+}
+
+// Report a diagnostic. Its code defaults to the name of the reporting rule,
+// and its severity to a warning.
+func (c *Context) Report(diagnostic Diagnostic) {
+	if diagnostic.Code == "" {
+		diagnostic.Code = c.rule
+	}
+	if diagnostic.Severity == 0 {
+		diagnostic.Severity = parser.SeverityWarning
+	}
+	c.diagnostics = append(c.diagnostics, diagnostic)
+}
+
+// Config controls which rules are run.
+type Config struct {
+	// Rules enabled or disabled by name, overriding their defaults.
+	Rules map[string]bool
+	// Dictionary of words accepted by the spelling rule.
+	Dictionary []string
+}
+
+type registration struct {
+	rule    Rule
+	enabled bool
+}
+
+var registry = map[string]registration{}
+
+// Register a rule, enabled by default if enabled is true.
+//
+// Registering a rule with the same name as an existing rule replaces it.
+func Register(rule Rule, enabled bool) {
+	registry[rule.Name()] = registration{rule, enabled}
+}
+
+// Rules returns all registered rules, sorted by name.
+func Rules() []Rule {
+	rules := make([]Rule, 0, len(registry))
+	for _, reg := range registry {
+		rules = append(rules, reg.rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name() < rules[j].Name() })
+	return rules
+}
+
+// Enabled returns true if the named rule runs by default.
+func Enabled(name string) bool {
+	return registry[name].enabled
+}
+
+// Run the enabled rules over a program analysed from source, returning
+// unsuppressed diagnostics ordered by position.
+func Run(source string, program *analyser.Program, config Config) (parser.Diagnostics, error) {
+	for name := range config.Rules {
+		if _, ok := registry[name]; !ok {
+			return nil, errors.Errorf("unknown lint rule %q", name)
+		}
+	}
+	ctx := &Context{Source: source, Program: program, Config: config}
+	for _, rule := range Rules() {
+		enabled, ok := config.Rules[rule.Name()]
+		if !ok {
+			enabled = Enabled(rule.Name())
+		}
+		if enabled {
+			ctx.rule = rule.Name()
+			rule.Run(ctx)
+		}
+	}
+	ignored := suppressions(source)
+	diagnostics := parser.Diagnostics{}
+	for _, diagnostic := range ctx.diagnostics {
+		if !ignored[diagnostic.Pos.Line][diagnostic.Code] {
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	diagnostics.Sort()
+	return diagnostics, nil
+}
+
+const ignoreDirective = "langx:ignore"
+
+// Rules ignored on each line of source, from "// langx:ignore <rule>..." comments.
+func suppressions(source string) map[int]map[string]bool {
+	ignored := map[int]map[string]bool{}
+	for i, line := range strings.Split(source, "\n") {
+		comment := strings.Index(line, "//")
+		if comment < 0 {
+			continue
+		}
+		directive := strings.TrimSpace(line[comment+2:])
+		if !strings.HasPrefix(directive, ignoreDirective) {
+			continue
+		}
+		// A comment on its own line applies to the following line.
+		target := i + 1
+		if strings.TrimSpace(line[:comment]) == "" {
+			target++
+		}
+		if ignored[target] == nil {
+			ignored[target] = map[string]bool{}
+		}
+		for _, name := range strings.FieldsFunc(directive[len(ignoreDirective):], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			ignored[target][name] = true
+		}
+	}
+	return ignored
+}
+
+// A Rule implemented by a function.
+type ruleFunc struct {
+	name string
+	doc  string
+	run  func(ctx *Context)
+}
+
+func (r *ruleFunc) Name() string     { return r.name }
+func (r *ruleFunc) Doc() string      { return r.doc }
+func (r *ruleFunc) Run(ctx *Context) { r.run(ctx) }
+
+func init() {
+	Register(&ruleFunc{
+		name: CodeUnusedVariable,
+		doc:  "local and non-public root variables that are never referenced",
+		run: func(ctx *Context) {
+			for _, diagnostic := range unusedVariables(ctx.Program) {
+				ctx.Report(diagnostic)
+			}
+		},
+	}, true)
+	Register(&ruleFunc{
+		name: CodeUnusedImport,
+		doc:  "imports with symbols that are never referenced",
+		run: func(ctx *Context) {
+			for _, diagnostic := range unusedImports(ctx.Program.AST, ctx.Program) {
+				ctx.Report(diagnostic)
+			}
+		},
+	}, true)
+	Register(&ruleFunc{
+		name: CodeSpelling,
+		doc:  "misspelt words in identifiers and strings, according to the configured dictionary",
+		run: func(ctx *Context) {
+			// The source has already been parsed, so can't fail to lex.
+			diagnostics, _ := NewSpelling(ctx.Config.Dictionary...).Check(strings.NewReader(ctx.Source))
+			filename := ctx.Program.AST.Pos.Filename
+			for _, diagnostic := range diagnostics {
+				diagnostic.Pos.Filename = filename
+				diagnostic.EndPos.Filename = filename
+				if fix := diagnostic.SuggestedFix; fix != nil {
+					for i := range fix.Edits {
+						fix.Edits[i].Pos.Filename = filename
+						fix.Edits[i].EndPos.Filename = filename
+					}
+				}
+				ctx.Report(diagnostic)
+			}
+		},
+	}, false)
+}
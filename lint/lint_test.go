@@ -0,0 +1,161 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestRun(t *testing.T) {
+	source := `
+		import foo.bar
+		import baz.{a, b}
+		import qux.*
+
+		let unused = 1
+		pub let exported = 2
+		let used = 3
+
+		class C {
+			let field = 4
+		}
+
+		fn f(x: int): int {
+			let a: int, b: int
+			let _ = x
+			a = used
+			{
+				let a = 5
+			}
+			return a
+		}
+	`
+	require.Equal(t, []string{
+		`2:3: warning: import "foo.bar" is unused [unused-import]`,
+		`3:3: warning: import "baz" is unused [unused-import]`,
+		`6:7: warning: "unused" is declared but never used [unused-variable]`,
+		`15:16: warning: "b" is declared but never used [unused-variable]`,
+		`19:9: warning: "a" is declared but never used [unused-variable]`,
+	}, lint(t, source, Config{}))
+}
+
+func TestRunConfig(t *testing.T) {
+	source := `
+		let vaule = 1
+		let unused = vaule
+	`
+	require.Equal(t, []string{
+		`3:7: warning: "unused" is declared but never used [unused-variable]`,
+	}, lint(t, source, Config{}))
+	require.Equal(t, []string{
+		`2:7: warning: "vaule" in "vaule" is misspelt [spelling]`,
+	}, lint(t, source, Config{Rules: map[string]bool{"spelling": true, "unused-variable": false}, Dictionary: []string{"unused"}}))
+	require.Equal(t, []string{}, lint(t, source, Config{Rules: map[string]bool{"spelling": true, "unused-variable": false}, Dictionary: []string{"unused", "vaule"}}))
+
+	ast, err := parser.ParseString(source)
+	require.NoError(t, err)
+	program, err := analyser.Analyse(ast)
+	require.NoError(t, err)
+	_, err = Run(source, program, Config{Rules: map[string]bool{"speling": true}})
+	require.EqualError(t, err, `unknown lint rule "speling"`)
+}
+
+func TestSuppressions(t *testing.T) {
+	source := `
+		let a = 1 // langx:ignore unused-variable
+		// langx:ignore spelling, unused-variable
+		let b = 2
+		// langx:ignore spelling
+		let c = 3
+		let d = 4 // langx:ignore
+	`
+	require.Equal(t, []string{
+		`6:7: warning: "c" is declared but never used [unused-variable]`,
+		`7:7: warning: "d" is declared but never used [unused-variable]`,
+	}, lint(t, source, Config{}))
+}
+
+func TestRules(t *testing.T) {
+	names := []string{}
+	for _, rule := range Rules() {
+		names = append(names, rule.Name())
+		require.NotEmpty(t, rule.Doc())
+	}
+	require.Equal(t, []string{"spelling", "unused-import", "unused-variable"}, names)
+	require.True(t, Enabled(CodeUnusedVariable))
+	require.False(t, Enabled(CodeSpelling))
+}
+
+func lint(t *testing.T, source string, config Config) []string {
+	t.Helper()
+	ast, err := parser.ParseString(source)
+	require.NoError(t, err)
+	program, err := analyser.Analyse(ast)
+	require.NoError(t, err)
+	diagnostics, err := Run(source, program, config)
+	require.NoError(t, err)
+	actual := []string{}
+	for _, diagnostic := range diagnostics {
+		actual = append(actual, diagnostic.String())
+	}
+	return actual
+}
+
+func TestUnusedImports(t *testing.T) {
+	ast, err := parser.ParseString(`
+		import foo.bar
+		import baz.{A, b, c}
+		import q "qux/quux"
+		import "x/y"
+
+		fn f(x: A): int {
+			return bar.f(x) + b + q.g()
+		}
+	`)
+	require.NoError(t, err)
+	require.Equal(t, []Diagnostic{
+		{Severity: parser.SeverityWarning, Pos: ast.Declarations[1].Import.Pos, Code: CodeUnusedImport, Message: `unused symbols imported from "baz": c`},
+		{Severity: parser.SeverityWarning, Pos: ast.Declarations[3].Import.Pos, Code: CodeUnusedImport, Message: `import "x.y" is unused`},
+	}, unusedImports(ast, nil))
+}
+
+func TestSpelling(t *testing.T) {
+	words, err := ReadDictionary(strings.NewReader("# Test dictionary\nparse\nrequest\ncolour\n\nhello\nworld\nvalue\n"))
+	require.NoError(t, err)
+	spelling := NewSpelling(words...)
+	diagnostics, err := spelling.Check(strings.NewReader(`
+		fn parseHTTPReqest(colour_vaule: int): string {
+			return "Helo, {colour_vaule} wrold\n"
+		}
+		let a = parseHTTPReqest(1)
+	`))
+	require.NoError(t, err)
+	require.Equal(t, []Diagnostic{
+		{Severity: parser.SeverityWarning, Pos: lexer.Position{Offset: 15, Line: 2, Column: 15}, EndPos: lexer.Position{Offset: 21, Line: 2, Column: 21}, Code: CodeSpelling,
+			Message: `"Reqest" in "parseHTTPReqest" is misspelt`,
+			SuggestedFix: &Fix{Description: `Rename "parseHTTPReqest" to "parseHTTPRequest"`, Edits: []Edit{
+				{Pos: lexer.Position{Offset: 6, Line: 2, Column: 6}, EndPos: lexer.Position{Offset: 21, Line: 2, Column: 21}, Text: "parseHTTPRequest"},
+				{Pos: lexer.Position{Offset: 106, Line: 5, Column: 11}, EndPos: lexer.Position{Offset: 121, Line: 5, Column: 26}, Text: "parseHTTPRequest"},
+			}}},
+		{Severity: parser.SeverityWarning, Pos: lexer.Position{Offset: 29, Line: 2, Column: 29}, EndPos: lexer.Position{Offset: 34, Line: 2, Column: 34}, Code: CodeSpelling,
+			Message: `"vaule" in "colour_vaule" is misspelt`,
+			SuggestedFix: &Fix{Description: `Rename "colour_vaule" to "colour_value"`, Edits: []Edit{
+				{Pos: lexer.Position{Offset: 22, Line: 2, Column: 22}, EndPos: lexer.Position{Offset: 34, Line: 2, Column: 34}, Text: "colour_value"},
+			}}},
+		{Severity: parser.SeverityWarning, Pos: lexer.Position{Offset: 62, Line: 3, Column: 12}, EndPos: lexer.Position{Offset: 66, Line: 3, Column: 16}, Code: CodeSpelling,
+			Message: `"Helo" is misspelt`,
+			SuggestedFix: &Fix{Description: `Replace with "Hello"`, Edits: []Edit{
+				{Pos: lexer.Position{Offset: 62, Line: 3, Column: 12}, EndPos: lexer.Position{Offset: 66, Line: 3, Column: 16}, Text: "Hello"},
+			}}},
+		{Severity: parser.SeverityWarning, Pos: lexer.Position{Offset: 83, Line: 3, Column: 33}, EndPos: lexer.Position{Offset: 88, Line: 3, Column: 38}, Code: CodeSpelling,
+			Message: `"wrold" is misspelt`,
+			SuggestedFix: &Fix{Description: `Replace with "world"`, Edits: []Edit{
+				{Pos: lexer.Position{Offset: 83, Line: 3, Column: 33}, EndPos: lexer.Position{Offset: 88, Line: 3, Column: 38}, Text: "world"},
+			}}},
+	}, diagnostics)
+}
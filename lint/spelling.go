@@ -0,0 +1,291 @@
+package lint
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/lexer"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+// CodeSpelling identifies misspelt words.
+const CodeSpelling = "spelling"
+
+// Keywords and builtin types, which are always accepted.
+var builtinWords = []string{
+	"alias", "bool", "break", "case", "char", "class", "const", "continue", "default", "else", "enum", "false",
+	"float", "for", "if", "import", "init", "int", "let", "module", "new", "nil", "override", "pub", "return",
+	"self", "static", "string", "switch", "throws", "true", "void",
+}
+
+// Spelling is an optional pass that checks the spelling of words in
+// identifiers and string literals against a dictionary.
+//
+// Identifiers are split into words at underscores, digits and changes of
+// case, eg. "parseHTTPRequest" is checked as "parse", "HTTP" and "Request".
+// Words are compared case-insensitively, and words shorter than three letters
+// or entirely in upper case are not checked.
+type Spelling struct {
+	words map[string]bool
+}
+
+// NewSpelling creates a spell checker accepting the given words.
+func NewSpelling(words ...string) *Spelling {
+	s := &Spelling{words: map[string]bool{}}
+	for _, word := range append(words, builtinWords...) {
+		s.words[strings.ToLower(word)] = true
+	}
+	return s
+}
+
+// ReadDictionary reads a word list with one word per line. Blank lines and
+// lines starting with # are ignored.
+func ReadDictionary(r io.Reader) ([]string, error) {
+	words := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// Check the source read from r.
+//
+// Misspelt identifiers are reported at their first occurrence, with a fix
+// renaming every occurrence if a correction is found.
+func (s *Spelling) Check(r io.Reader) ([]Diagnostic, error) {
+	tokens, err := parser.Lex(r)
+	if err != nil {
+		return nil, err
+	}
+	occurrences := map[string][]parser.Token{}
+	idents := []string{}
+	diagnostics := []Diagnostic{}
+	for _, token := range tokens {
+		switch {
+		case token.Kind == parser.TokenIdent:
+			if occurrences[token.Value] == nil {
+				idents = append(idents, token.Value)
+			}
+			occurrences[token.Value] = append(occurrences[token.Value], token)
+
+		case token.Kind == parser.TokenTemplate || (token.Kind == parser.TokenString && strings.HasSuffix(token.Value, `"`)):
+			diagnostics = append(diagnostics, s.checkString(token)...)
+		}
+	}
+	for _, ident := range idents {
+		diagnostics = append(diagnostics, s.checkIdent(ident, occurrences[ident])...)
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool { return diagnostics[i].Pos.Offset < diagnostics[j].Pos.Offset })
+	return diagnostics, nil
+}
+
+func (s *Spelling) checkIdent(ident string, tokens []parser.Token) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, w := range splitIdent(ident) {
+		word := ident[w.start:w.end]
+		if s.accepts(word) {
+			continue
+		}
+		diagnostic := Diagnostic{
+			Severity: parser.SeverityWarning,
+			Pos:      advance(tokens[0].Pos, ident[:w.start]),
+			EndPos:   advance(tokens[0].Pos, ident[:w.end]),
+			Code:     CodeSpelling,
+			Message:  fmt.Sprintf("%q in %q is misspelt", word, ident),
+		}
+		if correction := s.correct(word); correction != "" {
+			renamed := ident[:w.start] + correction + ident[w.end:]
+			fix := Fix{Description: fmt.Sprintf("Rename %q to %q", ident, renamed)}
+			for _, token := range tokens {
+				fix.Edits = append(fix.Edits, Edit{Pos: token.Pos, EndPos: advance(token.Pos, ident), Text: renamed})
+			}
+			diagnostic.SuggestedFix = &fix
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
+
+func (s *Spelling) checkString(token parser.Token) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	text := token.Value[strings.IndexByte(token.Value, '"'):]
+	depth := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == '\\':
+			// Skip escapes, eg. \n.
+			i += size + 1
+			continue
+		case r == '{':
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+		case unicode.IsLetter(r) && depth == 0:
+			end := i
+			for end < len(text) {
+				r, size := utf8.DecodeRuneInString(text[end:])
+				if !unicode.IsLetter(r) && r != '\'' {
+					break
+				}
+				end += size
+			}
+			word := strings.TrimSuffix(text[i:end], "'")
+			if !s.accepts(word) {
+				offset := len(token.Value) - len(text) + i
+				pos := advance(token.Pos, token.Value[:offset])
+				diagnostic := Diagnostic{
+					Severity: parser.SeverityWarning,
+					Pos:      pos,
+					EndPos:   advance(pos, word),
+					Code:     CodeSpelling,
+					Message:  fmt.Sprintf("%q is misspelt", word),
+				}
+				if correction := s.correct(word); correction != "" {
+					diagnostic.SuggestedFix = &Fix{
+						Description: fmt.Sprintf("Replace with %q", correction),
+						Edits:       []Edit{{Pos: pos, EndPos: advance(pos, word), Text: correction}},
+					}
+				}
+				diagnostics = append(diagnostics, diagnostic)
+			}
+			i = end
+			continue
+		}
+		i += size
+	}
+	return diagnostics
+}
+
+func (s *Spelling) accepts(word string) bool {
+	if utf8.RuneCountInString(word) < 3 || strings.ToUpper(word) == word {
+		return true
+	}
+	return s.words[strings.ToLower(word)]
+}
+
+// Returns the closest dictionary word to word, in the case of word, or "" if
+// there is no dictionary word within two edits, or one for short words.
+func (s *Spelling) correct(word string) string {
+	lower := strings.ToLower(word)
+	best, bestDistance := "", 3
+	if utf8.RuneCountInString(word) <= 4 {
+		bestDistance = 2
+	}
+	for candidate := range s.words {
+		distance := editDistance(lower, candidate)
+		if distance < bestDistance || (distance == bestDistance && candidate < best) {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	if r, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(r) {
+		return strings.ToUpper(best[:1]) + best[1:]
+	}
+	return best
+}
+
+// Damerau-Levenshtein distance between a and b, counting transpositions of
+// adjacent characters as a single edit.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	d := make([][]int, len(ar)+1)
+	for i := range d {
+		d[i] = make([]int, len(br)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ar[i-1] == br[j-2] && ar[i-2] == br[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ar)][len(br)]
+}
+
+func min(values ...int) int {
+	out := values[0]
+	for _, v := range values[1:] {
+		if v < out {
+			out = v
+		}
+	}
+	return out
+}
+
+// A word within an identifier, as a byte range.
+type span struct{ start, end int }
+
+// Split an identifier into words at underscores, digits and changes of case.
+func splitIdent(ident string) []span {
+	words := []span{}
+	runes := []rune(ident)
+	offsets := make([]int, len(runes)+1)
+	for i, r := range runes {
+		offsets[i+1] = offsets[i] + utf8.RuneLen(r)
+	}
+	start := -1
+	for i, r := range runes {
+		boundary := false
+		switch {
+		case !unicode.IsLetter(r):
+			if start >= 0 {
+				words = append(words, span{offsets[start], offsets[i]})
+			}
+			start = -1
+			continue
+		case start < 0:
+			start = i
+			continue
+		case unicode.IsUpper(r) && unicode.IsLower(runes[i-1]):
+			// fooBar
+			boundary = true
+		case unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]):
+			// HTTPRequest
+			boundary = true
+		}
+		if boundary {
+			words = append(words, span{offsets[start], offsets[i]})
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, span{offsets[start], offsets[len(runes)]})
+	}
+	return words
+}
+
+// Position following text, starting at pos.
+func advance(pos lexer.Position, text string) lexer.Position {
+	for _, r := range text {
+		pos.Offset += utf8.RuneLen(r)
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
@@ -0,0 +1,140 @@
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// A declared variable. Values are shared by names declared together without
+// a type or default, so are qualified by name.
+type variable struct {
+	value types.Reference
+	name  string
+}
+
+// Report local and non-public root variables that are never referenced.
+//
+// Class fields are part of the class's interface, so are not reported.
+func unusedVariables(program *analyser.Program) []Diagnostic {
+	declared := []*parser.VarDeclAsgn{}
+	used := map[variable]bool{}
+	exempt := map[*parser.VarDecl]bool{}
+	_ = parser.VisitFunc(program.AST, func(node parser.Node, next parser.Next) error {
+		switch node := node.(type) {
+		case *parser.RootDecl:
+			if node.Var != nil && node.Modifiers.Has(parser.ModifierPublic) {
+				exempt[node.Var] = true
+			}
+
+		case *parser.ClassMember:
+			if node.VarDecl != nil {
+				exempt[node.VarDecl] = true
+			}
+
+		case *parser.VarDecl:
+			if !exempt[node] {
+				for _, asgn := range node.Vars {
+					if asgn.Pattern == nil && asgn.Name != "_" {
+						declared = append(declared, asgn)
+					}
+				}
+			}
+
+		case *parser.Reference:
+			if ref := program.Actual(node.Terminal); ref != nil {
+				used[variable{ref, node.Terminal.Ident}] = true
+			}
+		}
+		return next(nil)
+	})
+	diagnostics := []Diagnostic{}
+	for _, asgn := range declared {
+		value := program.Resolved(asgn)
+		if value == nil || used[variable{value, asgn.Name}] {
+			continue
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: parser.SeverityWarning,
+			Pos:      asgn.Pos,
+			Code:     CodeUnusedVariable,
+			Message:  fmt.Sprintf("%q is declared but never used", asgn.Name),
+		})
+	}
+	return diagnostics
+}
+
+// Returns true if ref is the symbol imported as name.
+func isImport(program *analyser.Program, name string, ref types.Reference) bool {
+	imported, ok := program.Imports.Symbols()[name]
+	// Some types, such as arrays, can't be compared.
+	return ok && reflect.TypeOf(imported).Comparable() && ref == imported
+}
+
+// Report imports with symbols that are never referenced.
+//
+// References are matched by name, excluding those the analyser resolved to
+// declarations other than imports if program is not nil. Wildcard imports are
+// never reported.
+func unusedImports(ast *parser.AST, program *analyser.Program) []Diagnostic {
+	names := map[string]bool{}
+	_ = parser.VisitFunc(ast, func(node parser.Node, next parser.Next) error {
+		switch node := node.(type) {
+		case *parser.Reference:
+			name := node.Terminal.Ident
+			if program == nil || program.Actual(node.Terminal) == nil || isImport(program, name, program.Actual(node.Terminal)) {
+				names[name] = true
+			}
+
+		case parser.TypeDecl:
+			if node.Named != nil {
+				names[node.Named.Type] = true
+			}
+		}
+		return next(nil)
+	})
+	diagnostics := []Diagnostic{}
+	for _, decl := range ast.Declarations {
+		imp := decl.Import
+		if imp == nil || (imp.Qualified != nil && imp.Qualified.Wildcard) {
+			continue
+		}
+		var symbols []string
+		switch {
+		case imp.Qualified != nil && len(imp.Qualified.Symbols) > 0:
+			symbols = imp.Qualified.Symbols
+		case imp.Alias != "":
+			symbols = []string{imp.Alias}
+		default:
+			module := imp.Module()
+			symbols = []string{module[strings.LastIndex(module, ".")+1:]}
+		}
+		unused := []string{}
+		for _, symbol := range symbols {
+			if !names[symbol] {
+				unused = append(unused, symbol)
+			}
+		}
+		switch {
+		case len(unused) == len(symbols):
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: parser.SeverityWarning,
+				Pos:      imp.Pos,
+				Code:     CodeUnusedImport,
+				Message:  fmt.Sprintf("import %q is unused", imp.Module()),
+			})
+		case len(unused) > 0:
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: parser.SeverityWarning,
+				Pos:      imp.Pos,
+				Code:     CodeUnusedImport,
+				Message:  fmt.Sprintf("unused symbols imported from %q: %s", imp.Module(), strings.Join(unused, ", ")),
+			})
+		}
+	}
+	return diagnostics
+}
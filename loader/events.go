@@ -0,0 +1,72 @@
+package loader
+
+import "fmt"
+
+// EventKind is the kind of a loader lifecycle event.
+type EventKind int
+
+const (
+	// EventDiscovered is emitted when a module is resolved to a file.
+	EventDiscovered EventKind = iota
+	// EventParsed is emitted when a module's file has been parsed.
+	EventParsed
+	// EventResolved is emitted when all of a module's imports have been loaded
+	// and checked against the manifest, including uses of @experimental
+	// declarations. Modules are not type checked by the loader.
+	EventResolved
+	// EventCacheHit is emitted when an import refers to an already loaded module.
+	EventCacheHit
+	// EventDiagnostic is emitted when loading fails.
+	EventDiagnostic
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventDiscovered:
+		return "discovered"
+	case EventParsed:
+		return "parsed"
+	case EventResolved:
+		return "resolved"
+	case EventCacheHit:
+		return "cache hit"
+	case EventDiagnostic:
+		return "diagnostic"
+	}
+	return fmt.Sprintf("EventKind(%d)", k)
+}
+
+// Event is a loader lifecycle event.
+type Event struct {
+	Kind EventKind
+	// Module path, if known.
+	Module string
+	// File the module was loaded from, if known.
+	File string
+	// Error for EventDiagnostic.
+	Err error
+}
+
+// A Subscriber receives loader lifecycle events, eg. to report progress.
+//
+// Events are delivered synchronously, in the order they occur.
+type Subscriber interface {
+	OnEvent(event Event)
+}
+
+// SubscriberFunc is a function implementing Subscriber.
+type SubscriberFunc func(event Event)
+
+// OnEvent calls f.
+func (f SubscriberFunc) OnEvent(event Event) { f(event) }
+
+// Subscribe to lifecycle events.
+func (l *Loader) Subscribe(subscriber Subscriber) {
+	l.subscribers = append(l.subscribers, subscriber)
+}
+
+func (l *Loader) emit(event Event) {
+	for _, subscriber := range l.subscribers {
+		subscriber.OnEvent(event)
+	}
+}
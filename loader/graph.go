@@ -0,0 +1,106 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Graph is a module import graph.
+type Graph struct {
+	// Imports of each module, keyed by module path, in declaration order.
+	Imports map[string][]string
+}
+
+// DependencyGraph returns the import graph of the Program.
+func (p *Program) DependencyGraph() *Graph {
+	g := &Graph{Imports: map[string][]string{}}
+	for path, module := range p.Modules {
+		imports := []string{}
+		for _, decl := range module.AST.Declarations {
+			if decl.Import != nil {
+				imports = append(imports, decl.Import.Module())
+			}
+		}
+		g.Imports[path] = imports
+	}
+	return g
+}
+
+// Modules in the graph, sorted by path.
+func (g *Graph) Modules() []string {
+	modules := make([]string, 0, len(g.Imports))
+	for path := range g.Imports {
+		modules = append(modules, path)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// Sort modules topologically, such that every module comes after all of its imports.
+//
+// Modules with no ordering constraint between them are sorted by path, so the
+// order is stable. An error is returned if the graph contains a cycle.
+func (g *Graph) Sort() ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	stack := []string{}
+	order := []string{}
+	var visit func(path string) error
+	visit = func(path string) error {
+		switch state[path] {
+		case visited:
+			return nil
+		case visiting:
+			for i, p := range stack {
+				if p == path {
+					cycle := append(append([]string{}, stack[i:]...), path)
+					return errors.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+		state[path] = visiting
+		stack = append(stack, path)
+		for _, imp := range g.Imports[path] {
+			if err := visit(imp); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[path] = visited
+		order = append(order, path)
+		return nil
+	}
+	for _, path := range g.Modules() {
+		if err := visit(path); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// WriteDot writes the graph to w in Graphviz dot format.
+func (g *Graph) WriteDot(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph imports {"); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, path := range g.Modules() {
+		if _, err := fmt.Fprintf(w, "  %q;\n", path); err != nil {
+			return errors.WithStack(err)
+		}
+		for _, imp := range g.Imports[path] {
+			if _, err := fmt.Fprintf(w, "  %q -> %q;\n", path, imp); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return errors.WithStack(err)
+}
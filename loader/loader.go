@@ -0,0 +1,244 @@
+// Package loader resolves imports to source files and loads them into a Program.
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+// Program is a root module and all of its transitive imports.
+type Program struct {
+	// Root is the module path of the root file.
+	Root string
+	// Modules keyed by module path.
+	Modules map[string]*Module
+}
+
+// Module is a single loaded source file.
+type Module struct {
+	Path string
+	File string
+	AST  *parser.AST
+}
+
+// Loader resolves and parses modules, caching them by module path.
+type Loader struct {
+	searchPaths []string
+	modules     map[string]*Module
+	// Modules currently being loaded, in import order, for cycle detection.
+	loading     []string
+	manifest    *Manifest
+	subscribers []Subscriber
+	config      parser.BuildConfig
+}
+
+// New creates a new Loader that resolves imports against searchPaths, in order.
+func New(searchPaths ...string) *Loader {
+	return &Loader{
+		searchPaths: searchPaths,
+		modules:     map[string]*Module{},
+	}
+}
+
+// SetManifest enforces the rules of a project manifest on each import.
+//
+// The manifest also opts modules in to using @experimental declarations from
+// other modules, which are otherwise rejected.
+func (l *Loader) SetManifest(manifest *Manifest) {
+	l.manifest = manifest
+}
+
+// SetBuildConfig sets the configuration compile-time conditionals are evaluated
+// against.
+//
+// Conditionals are applied to each module as it is parsed, so only imports
+// within the selected branches are loaded.
+func (l *Loader) SetBuildConfig(config parser.BuildConfig) {
+	l.config = config
+}
+
+// Load the file at root and all of its transitive imports.
+//
+// The directory containing root is searched for imports before any search paths.
+func Load(root string, searchPaths ...string) (*Program, error) {
+	l := New(append([]string{filepath.Dir(root)}, searchPaths...)...)
+	return l.Load(root)
+}
+
+// Load the file at root and all of its transitive imports.
+func (l *Loader) Load(root string) (*Program, error) {
+	path, err := l.loadRoot(root)
+	if err != nil {
+		l.emit(Event{Kind: EventDiagnostic, Err: err})
+		return nil, err
+	}
+	return &Program{Root: path, Modules: l.modules}, nil
+}
+
+func (l *Loader) loadRoot(root string) (string, error) {
+	// The module path of the root is not known until it is parsed.
+	l.emit(Event{Kind: EventDiscovered, File: root})
+	ast, err := l.parseFile(root)
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSuffix(filepath.Base(root), filepath.Ext(root))
+	if ast.Module != nil {
+		path = ast.Module.Name
+	}
+	l.emit(Event{Kind: EventParsed, Module: path, File: root})
+	return path, l.add(path, root, ast)
+}
+
+// Resolve a module path to a file in the search paths.
+func (l *Loader) Resolve(module string) (string, error) {
+	file := parser.ModuleFile(module)
+	for _, dir := range l.searchPaths {
+		path := filepath.Join(dir, file)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.Errorf("module %q not found (looked for %s in %s)", module, file, strings.Join(l.searchPaths, ", "))
+}
+
+func (l *Loader) load(imp *parser.ImportDecl) error {
+	path := imp.Module()
+	for i, loading := range l.loading {
+		if loading == path {
+			cycle := append(append([]string{}, l.loading[i:]...), path)
+			return participle.Errorf(imp.Pos, "import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if module, ok := l.modules[path]; ok {
+		l.emit(Event{Kind: EventCacheHit, Module: path, File: module.File})
+		return nil
+	}
+	file, err := l.Resolve(path)
+	if err != nil {
+		return participle.AnnotateError(imp.Pos, err)
+	}
+	l.emit(Event{Kind: EventDiscovered, Module: path, File: file})
+	ast, err := l.parseFile(file)
+	if err != nil {
+		return err
+	}
+	if ast.Module != nil && ast.Module.Name != path {
+		return participle.Errorf(ast.Module.Pos, "module %q does not match import path %q", ast.Module.Name, path)
+	}
+	l.emit(Event{Kind: EventParsed, Module: path, File: file})
+	return l.add(path, file, ast)
+}
+
+func (l *Loader) add(path, file string, ast *parser.AST) error {
+	l.loading = append(l.loading, path)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+	for _, decl := range ast.Declarations {
+		if decl.Import == nil {
+			continue
+		}
+		if err := l.load(decl.Import); err != nil {
+			return err
+		}
+		if err := l.checkExperimental(path, ast, decl.Import); err != nil {
+			return err
+		}
+		if l.manifest != nil {
+			if err := l.manifest.check(path, decl.Import); err != nil {
+				return err
+			}
+		}
+	}
+	l.modules[path] = &Module{Path: path, File: file, AST: ast}
+	l.emit(Event{Kind: EventResolved, Module: path, File: file})
+	return nil
+}
+
+// Check that module only uses @experimental symbols imported by imp if the
+// manifest allows it.
+//
+// Uses are found syntactically, as modules are not type checked by the loader:
+// references to symbols imported by name or with a wildcard, and to members of
+// a whole-module import. A local declaration shadowing an imported symbol is
+// also treated as a use.
+func (l *Loader) checkExperimental(module string, ast *parser.AST, imp *parser.ImportDecl) error {
+	if l.manifest != nil && l.manifest.allowsExperimental(module) {
+		return nil
+	}
+	imported := l.modules[imp.Module()]
+	experimental := map[string]bool{}
+	for _, decl := range imported.AST.Declarations {
+		if decl.Annotations.Get("experimental") == nil {
+			continue
+		}
+		for _, name := range decl.Names() {
+			experimental[name] = true
+		}
+	}
+	if len(experimental) == 0 {
+		return nil
+	}
+	// Experimental symbols visible in module, either in scope or as members of
+	// a namespace.
+	visible := map[string]bool{}
+	namespace := ""
+	switch {
+	case imp.Qualified != nil && imp.Qualified.Wildcard:
+		visible = experimental
+	case imp.Qualified != nil && len(imp.Qualified.Symbols) > 0:
+		for _, symbol := range imp.Qualified.Symbols {
+			visible[symbol] = experimental[symbol]
+		}
+	default:
+		visible, namespace = experimental, imp.Namespace()
+	}
+	return parser.VisitFunc(ast, func(node parser.Node, next parser.Next) error {
+		var (
+			pos  lexer.Position
+			name string
+		)
+		switch node := node.(type) {
+		case *parser.Reference:
+			switch {
+			case namespace == "":
+				pos, name = node.Terminal.Pos, node.Terminal.Ident
+			case node.Terminal.Ident == namespace && node.Next != nil && node.Next.Reference != nil:
+				pos, name = node.Next.Reference.Pos, node.Next.Reference.Ident
+			}
+
+		case *parser.NamedTypeDecl:
+			if namespace == "" {
+				pos, name = node.Pos, node.Type
+			}
+		}
+		if visible[name] {
+			return participle.Errorf(pos, "%q in module %q is experimental, module %q must opt in to use it in the manifest",
+				name, imported.Path, module)
+		}
+		return next(nil)
+	})
+}
+
+// Parse the file at path and apply its compile-time conditionals.
+func (l *Loader) parseFile(path string) (*parser.AST, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer r.Close()
+	ast, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := ast.ApplyConditionals(l.config); err != nil {
+		return nil, err
+	}
+	return ast, nil
+}
@@ -0,0 +1,284 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		config   parser.BuildConfig
+		manifest string
+		modules  []string
+		fail     string
+	}{
+		{name: "Transitive",
+			files: map[string]string{
+				"main.langx":    "import foo.bar\nimport \"baz\"\n",
+				"foo/bar.langx": "module foo.bar\nimport baz\n",
+				"baz.langx":     "let a = 1\n",
+			},
+			modules: []string{"baz", "foo.bar", "main"}},
+		{name: "RootModuleHeader",
+			files: map[string]string{
+				"main.langx": "module app\n",
+			},
+			modules: []string{"app"}},
+		{name: "Cycle",
+			files: map[string]string{
+				"main.langx": "import a\n",
+				"a.langx":    "import b\n",
+				"b.langx":    "import a\n",
+			},
+			fail: "b.langx:1:1: import cycle: a -> b -> a"},
+		{name: "NotFound",
+			files: map[string]string{
+				"main.langx": "import missing\n",
+			},
+			fail: `main.langx:1:1: module "missing" not found`},
+		{name: "ModuleMismatch",
+			files: map[string]string{
+				"main.langx": "import a\n",
+				"a.langx":    "module b\n",
+			},
+			fail: `a.langx:1:1: module "b" does not match import path "a"`},
+		{name: "ConditionalImport",
+			files: map[string]string{
+				"main.langx": "#if target(js) {\n\timport a\n} #else {\n\timport b\n}\n",
+				"a.langx":    "#if target(js) {\n\timport c\n}\n",
+				"b.langx":    "",
+				"c.langx":    "",
+			},
+			config:  parser.BuildConfig{Target: "js"},
+			modules: []string{"a", "c", "main"}},
+		{name: "ConditionalImportElse",
+			files: map[string]string{
+				"main.langx": "#if target(js) {\n\timport a\n} #else {\n\timport b\n}\n",
+				"a.langx":    "",
+				"b.langx":    "",
+			},
+			modules: []string{"b", "main"}},
+		{name: "Experimental",
+			files: map[string]string{
+				"main.langx": "import a.{f, g}\nfn main() {\n\tf()\n\tg()\n}\n",
+				"a.langx":    "pub fn f() {}\n@experimental\npub fn g() {}\n",
+			},
+			fail: `main.langx:4:2: "g" in module "a" is experimental, module "main" must opt in to use it in the manifest`},
+		{name: "ExperimentalWildcard",
+			files: map[string]string{
+				"main.langx": "import a.*\nlet x: G = G()\n",
+				"a.langx":    "@experimental\npub class G {}\n",
+			},
+			fail: `main.langx:2:8: "G" in module "a" is experimental, module "main" must opt in to use it in the manifest`},
+		{name: "ExperimentalModule",
+			files: map[string]string{
+				"main.langx": "import a\nfn main() {\n\ta.f()\n\ta.g()\n}\n",
+				"a.langx":    "pub fn f() {}\n@experimental\npub fn g() {}\n",
+			},
+			fail: `main.langx:4:4: "g" in module "a" is experimental, module "main" must opt in to use it in the manifest`},
+		{name: "ExperimentalModuleUnused",
+			files: map[string]string{
+				"main.langx": "import a.*\nimport \"a\"\nimport b \"a\"\nfn main() {\n\tf()\n\ta.f()\n\tb.f()\n}\n",
+				"a.langx":    "pub fn f() {}\n@experimental\npub fn g() {}\n",
+			},
+			modules: []string{"a", "main"}},
+		{name: "ExperimentalOptIn",
+			files: map[string]string{
+				"main.langx": "import a.{f, g}\nimport \"a\"\nfn main() {\n\tg()\n\ta.g()\n}\n",
+				"a.langx":    "pub fn f() {}\n@experimental\npub fn g() {}\n",
+			},
+			manifest: "group tools = main\nallow experimental in tools\n",
+			modules:  []string{"a", "main"}},
+		{name: "ExperimentalNotImported",
+			files: map[string]string{
+				"main.langx": "import a.{f}\nfn g() {}\nfn main() {\n\tf()\n\tg()\n}\n",
+				"a.langx":    "pub fn f() {}\n@experimental\npub fn g() {}\n",
+			},
+			modules: []string{"a", "main"}},
+		{name: "Layer",
+			files: map[string]string{
+				"main.langx":     "import ui\n",
+				"ui.langx":       "import db.query\n",
+				"db/query.langx": "module db.query\n",
+			},
+			manifest: "group storage = db, db.*\nui, ui.* must not import storage\n",
+			fail:     `ui.langx:1:1: module "ui" must not import "db.query" (rule at 2:1)`},
+		{name: "Visible",
+			files: map[string]string{
+				"main.langx":  "import api\nimport ui\n",
+				"api.langx":   "import db\n",
+				"ui.langx":    "import db\n",
+				"db.langx":    "import cache\n",
+				"cache.langx": "",
+			},
+			manifest: "# Only the API may touch storage.\ngroup storage = db, cache\nstorage visible to api\n",
+			fail:     `ui.langx:1:1: module "db" in group "storage" is not visible to "ui" (rule at 3:1)`},
+		{name: "VisibleAllowed",
+			files: map[string]string{
+				"main.langx":  "import api\n",
+				"api.langx":   "import db\n",
+				"db.langx":    "import cache\n",
+				"cache.langx": "",
+			},
+			manifest: "group storage = db, cache\nstorage visible to api, main\nmain must not import cache\n",
+			modules:  []string{"api", "cache", "db", "main"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeFiles(t, test.files)
+			defer os.RemoveAll(dir)
+			loader := New(dir)
+			loader.SetBuildConfig(test.config)
+			if test.manifest != "" {
+				manifest, err := ReadManifest(strings.NewReader(test.manifest))
+				require.NoError(t, err)
+				loader.SetManifest(manifest)
+			}
+			program, err := loader.Load(filepath.Join(dir, "main.langx"))
+			if test.fail != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.fail)
+				return
+			}
+			require.NoError(t, err)
+			modules := []string{}
+			for path := range program.Modules {
+				modules = append(modules, path)
+			}
+			sort.Strings(modules)
+			require.Equal(t, test.modules, modules)
+		})
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		fail     string
+	}{
+		{name: "Valid", manifest: "group g = a.*\na, b must not import c\ng visible to a\nallow experimental in g, d\n"},
+		{name: "Syntax", manifest: "a must import b\n", fail: `1:8: unexpected token "import" (expected "not")`},
+		{name: "UnknownGroup", manifest: "group g = a\nh visible to b\n", fail: `2:1: unknown group "h"`},
+		{name: "DuplicateGroup", manifest: "group g = a\ngroup g = b\n", fail: `2:1: group "g" already declared at 1:1`},
+		{name: "InvalidGroup", manifest: "group g.* = a\n", fail: `1:1: invalid group name "g.*"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadManifest(strings.NewReader(test.manifest))
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestDependencyGraph(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.langx":    "import foo.bar\nimport baz\n",
+		"foo/bar.langx": "import baz\n",
+		"baz.langx":     "let a = 1\n",
+	})
+	defer os.RemoveAll(dir)
+	program, err := Load(filepath.Join(dir, "main.langx"))
+	require.NoError(t, err)
+	graph := program.DependencyGraph()
+	require.Equal(t, map[string][]string{
+		"main":    {"foo.bar", "baz"},
+		"foo.bar": {"baz"},
+		"baz":     {},
+	}, graph.Imports)
+
+	order, err := graph.Sort()
+	require.NoError(t, err)
+	require.Equal(t, []string{"baz", "foo.bar", "main"}, order)
+
+	w := &bytes.Buffer{}
+	err = graph.WriteDot(w)
+	require.NoError(t, err)
+	require.Equal(t, `digraph imports {
+  "baz";
+  "foo.bar";
+  "foo.bar" -> "baz";
+  "main";
+  "main" -> "foo.bar";
+  "main" -> "baz";
+}
+`, w.String())
+}
+
+func TestDependencyGraphCycle(t *testing.T) {
+	graph := &Graph{Imports: map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"b"},
+	}}
+	_, err := graph.Sort()
+	require.EqualError(t, err, "import cycle: b -> c -> b")
+}
+
+func TestEvents(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.langx": "import a\nimport b\n",
+		"a.langx":    "import b\n",
+		"b.langx":    "let a = 1\n",
+	})
+	defer os.RemoveAll(dir)
+	events := []string{}
+	loader := New(dir)
+	loader.Subscribe(SubscriberFunc(func(event Event) {
+		rel := ""
+		if event.File != "" {
+			rel, _ = filepath.Rel(dir, event.File)
+		}
+		events = append(events, fmt.Sprintf("%s %s %s", event.Kind, event.Module, rel))
+	}))
+	_, err := loader.Load(filepath.Join(dir, "main.langx"))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"discovered  main.langx",
+		"parsed main main.langx",
+		"discovered a a.langx",
+		"parsed a a.langx",
+		"discovered b b.langx",
+		"parsed b b.langx",
+		"resolved b b.langx",
+		"resolved a a.langx",
+		"cache hit b b.langx",
+		"resolved main main.langx",
+	}, events)
+
+	events = nil
+	_, err = loader.Load(filepath.Join(dir, "missing.langx"))
+	require.Error(t, err)
+	require.Equal(t, []string{"discovered  missing.langx", "diagnostic  "}, events)
+	require.Equal(t, "EventKind(99)", EventKind(99).String())
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "loader-")
+	require.NoError(t, err)
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+		require.NoError(t, err)
+		err = ioutil.WriteFile(path, []byte(source), 0600)
+		require.NoError(t, err)
+	}
+	return dir
+}
@@ -0,0 +1,189 @@
+package loader
+
+import (
+	"io"
+	"strings"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/alecthomas/participle/lexer/regex"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+// ManifestFile is the conventional name of a project manifest, in the
+// directory of the root module.
+const ManifestFile = "langx.manifest"
+
+var manifestParser = participle.MustBuild(&Manifest{},
+	participle.Lexer(lexer.Must(regex.New(`
+		comment = #[^\n]*
+		whitespace = \s+
+
+		Module = [[:alpha:]_]\w*(\.[[:alpha:]_]\w*)*(\.\*)?
+		Punct = [=,]
+	`))),
+	participle.UseLookahead(2),
+)
+
+// Manifest declares architectural rules for a project, enforced on each
+// import as modules are loaded.
+//
+// Rules refer to modules by path, by "path.*" for all modules below a path,
+// or by the name of a group:
+//
+//	# Groups name sets of modules.
+//	group storage = db, db.*, cache
+//	# Layering rules forbid imports.
+//	ui, ui.* must not import storage
+//	# Modules in a group may only be imported by each other and those listed.
+//	storage visible to api
+//	# Modules that may use @experimental declarations from other modules.
+//	allow experimental in tools.*
+type Manifest struct {
+	Pos lexer.Position
+
+	Rules []*ManifestRule `{ @@ }`
+
+	groups map[string]*Group
+}
+
+// ManifestRule is a single manifest declaration.
+type ManifestRule struct {
+	Pos lexer.Position
+
+	Group        *Group        `  @@`
+	Experimental *Experimental `| @@`
+	Layer        *Layer        `| @@`
+	Visible      *Visible      `| @@`
+}
+
+// Group names a set of modules.
+type Group struct {
+	Pos lexer.Position
+
+	Name    string   `"group" @Module "="`
+	Modules []string `@Module { "," @Module }`
+}
+
+// Experimental allows modules to use @experimental declarations from other
+// modules.
+type Experimental struct {
+	Pos lexer.Position
+
+	Modules []string `"allow" "experimental" "in" @Module { "," @Module }`
+}
+
+// Layer forbids modules from importing other modules.
+type Layer struct {
+	Pos lexer.Position
+
+	Importers []string `@Module { "," @Module } "must" "not" "import"`
+	Imported  []string `@Module { "," @Module }`
+}
+
+// Visible restricts the modules that may import members of a group.
+type Visible struct {
+	Pos lexer.Position
+
+	Group     string   `@Module "visible" "to"`
+	Importers []string `@Module { "," @Module }`
+}
+
+// ReadManifest parses and validates a manifest.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	manifest := &Manifest{}
+	if err := manifestParser.Parse(r, manifest); err != nil {
+		return nil, err
+	}
+	manifest.groups = map[string]*Group{}
+	for _, rule := range manifest.Rules {
+		if rule.Group == nil {
+			continue
+		}
+		if strings.HasSuffix(rule.Group.Name, ".*") {
+			return nil, participle.Errorf(rule.Group.Pos, "invalid group name %q", rule.Group.Name)
+		}
+		if prev, ok := manifest.groups[rule.Group.Name]; ok {
+			return nil, participle.Errorf(rule.Group.Pos, "group %q already declared at %s", rule.Group.Name, prev.Pos)
+		}
+		manifest.groups[rule.Group.Name] = rule.Group
+	}
+	for _, rule := range manifest.Rules {
+		if rule.Visible != nil && manifest.groups[rule.Visible.Group] == nil {
+			return nil, participle.Errorf(rule.Visible.Pos, "unknown group %q", rule.Visible.Group)
+		}
+	}
+	return manifest, nil
+}
+
+// Check that the import of imp by module is permitted.
+func (m *Manifest) check(module string, imp *parser.ImportDecl) error {
+	imported := imp.Module()
+	// Visibility rules restricting the import, by group, and whether any allow it.
+	restricted := []*ManifestRule{}
+	allowed := map[*Group]bool{}
+	for _, rule := range m.Rules {
+		switch {
+		case rule.Layer != nil:
+			if m.matches(rule.Layer.Importers, module) && m.matches(rule.Layer.Imported, imported) {
+				return participle.Errorf(imp.Pos, "module %q must not import %q (rule at %s)", module, imported, rule.Pos)
+			}
+
+		case rule.Visible != nil:
+			group := m.groups[rule.Visible.Group]
+			if !group.contains(imported) || group.contains(module) {
+				continue
+			}
+			restricted = append(restricted, rule)
+			allowed[group] = allowed[group] || m.matches(rule.Visible.Importers, module)
+		}
+	}
+	for _, rule := range restricted {
+		if group := m.groups[rule.Visible.Group]; !allowed[group] {
+			return participle.Errorf(imp.Pos, "module %q in group %q is not visible to %q (rule at %s)", imported, group.Name, module, rule.Pos)
+		}
+	}
+	return nil
+}
+
+// Returns true if module may use @experimental declarations from other modules.
+func (m *Manifest) allowsExperimental(module string) bool {
+	for _, rule := range m.Rules {
+		if rule.Experimental != nil && m.matches(rule.Experimental.Modules, module) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if module matches any of patterns, which may name groups.
+func (m *Manifest) matches(patterns []string, module string) bool {
+	for _, pattern := range patterns {
+		if group, ok := m.groups[pattern]; ok {
+			if group.contains(module) {
+				return true
+			}
+		} else if matchModule(pattern, module) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Group) contains(module string) bool {
+	for _, pattern := range g.Modules {
+		if matchModule(pattern, module) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match a module against a path, or "path.*" for all modules below path.
+func matchModule(pattern, module string) bool {
+	if strings.HasSuffix(pattern, ".*") {
+		return strings.HasPrefix(module, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == module
+}
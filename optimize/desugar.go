@@ -0,0 +1,217 @@
+package optimize
+
+import (
+	"github.com/alecthomas/participle/lexer"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+)
+
+// Binary operators applied by compound assignments.
+var compoundOps = map[parser.Op]parser.Op{
+	parser.OpAddAsgn: parser.OpAdd,
+	parser.OpSubAsgn: parser.OpSub,
+	parser.OpMulAsgn: parser.OpMul,
+	parser.OpDivAsgn: parser.OpDiv,
+	parser.OpModAsgn: parser.OpMod,
+	parser.OpPowAsgn: parser.OpPow,
+}
+
+// Desugar rewrites compound assignments in ast into plain assignments, in
+// place, eg. "a += b" becomes "a = a + b".
+//
+// The target of a compound assignment is evaluated once. Where evaluating it
+// has side effects, eg. "f().x += 1" or "a[g()] += 1", the receiver and index
+// are first assigned to temporaries in a new block:
+//
+//	{
+//		let $target = f()
+//		$target.x = $target.x + 1
+//	}
+//
+// Like Fold, Desugar should be applied after analysis. If program is the
+// analysis of ast, the operands of the operators it creates are associated
+// with the types of the assignments they are derived from, so that backends
+// can rely on them, eg. to truncate integer division.
+func Desugar(ast *parser.AST, program *analyser.Program) {
+	_ = parser.VisitFunc(ast, func(node parser.Node, next parser.Next) error {
+		switch node := node.(type) {
+		case parser.Block:
+			desugarStmts(program, node.Statements)
+
+		case parser.CaseStmt:
+			desugarStmts(program, node.Body)
+
+		case *parser.Closure:
+			desugarStmts(program, node.Body)
+		}
+		return next(nil)
+	})
+}
+
+func desugarStmts(program *analyser.Program, stmts []*parser.Stmt) {
+	for _, stmt := range stmts {
+		if stmt.ExprStmt == nil {
+			continue
+		}
+		if op, ok := compoundOps[stmt.ExprStmt.Op]; ok {
+			desugarAssignment(program, stmt, op)
+		}
+	}
+}
+
+func desugarAssignment(program *analyser.Program, stmt *parser.Stmt, op parser.Op) {
+	asgn := stmt.ExprStmt
+	lhs := asgn.LHS
+	// Strip parentheses, eg. "(a) += 1".
+	for lhs.Unary != nil && lhs.Unary.Reference.Next == nil && len(lhs.Unary.Reference.Terminal.Tuple) == 1 {
+		lhs = lhs.Unary.Reference.Terminal.Tuple[0]
+	}
+	ref := lhs.Unary.Reference
+	temporaries := []*parser.Stmt{}
+	if ref.Next != nil {
+		// Split the target into its receiver and the member or subscript assigned.
+		last := ref.Next
+		receiver := &parser.Reference{Mixin: ref.Mixin, Terminal: ref.Terminal}
+		tail := &receiver.Next
+		for next := ref.Next; next.Next != nil; next = next.Next {
+			element := *next
+			element.Next = nil
+			*tail = &element
+			tail = &element.Next
+			last = next.Next
+		}
+		if !isPureReference(receiver) {
+			temporaries = append(temporaries, temporary(ref.Pos, "$target", &parser.Expr{
+				Mixin: ref.Mixin,
+				Unary: &parser.Unary{Mixin: ref.Mixin, Reference: receiver},
+			}))
+			receiver = &parser.Reference{Mixin: ref.Mixin, Terminal: identTerminal(ref.Pos, "$target")}
+		}
+		element := *last
+		if element.Subscript != nil && !isPureExpr(element.Subscript) {
+			temporaries = append(temporaries, temporary(element.Subscript.Pos, "$index", element.Subscript))
+			element.Subscript = identExpr(element.Subscript.Pos, "$index")
+		}
+		tail = &receiver.Next
+		for *tail != nil {
+			tail = &(*tail).Next
+		}
+		*tail = &element
+		ref = receiver
+	}
+	rhs := asgn.RHS
+	if rhs.Unary == nil {
+		// Retain the precedence of the right-hand side, eg. "a -= b - c".
+		rhs = &parser.Expr{
+			Mixin: rhs.Mixin,
+			Unary: &parser.Unary{Mixin: rhs.Mixin, Reference: &parser.Reference{
+				Mixin:    rhs.Mixin,
+				Terminal: &parser.Terminal{Mixin: rhs.Mixin, Tuple: []*parser.Expr{rhs}},
+			}},
+		}
+	}
+	target := &parser.Expr{Mixin: lhs.Mixin, Unary: &parser.Unary{Mixin: lhs.Mixin, Reference: ref}}
+	value := &parser.Expr{Mixin: lhs.Mixin, Unary: &parser.Unary{Mixin: lhs.Mixin, Reference: copyReference(ref)}}
+	binary := &parser.Expr{Mixin: asgn.Mixin, Left: value, Op: op, Right: rhs}
+	if program != nil {
+		program.Derive(target, asgn.LHS)
+		program.Derive(value, asgn.LHS)
+		program.Derive(binary, asgn.LHS)
+		program.Derive(rhs, asgn.RHS)
+	}
+	desugared := &parser.ExprStmt{
+		Mixin: asgn.Mixin,
+		LHS:   target,
+		Op:    parser.OpAsgn,
+		RHS:   binary,
+	}
+	if len(temporaries) == 0 {
+		stmt.ExprStmt = desugared
+		return
+	}
+	stmt.ExprStmt = nil
+	stmt.Block = &parser.Block{
+		Mixin:      stmt.Mixin,
+		Statements: append(temporaries, &parser.Stmt{Mixin: stmt.Mixin, ExprStmt: desugared}),
+	}
+}
+
+// Returns true if evaluating ref has no side effects.
+func isPureReference(ref *parser.Reference) bool {
+	if ref.Terminal.Ident == "" || ref.Optional {
+		return false
+	}
+	for next := ref.Next; next != nil; next = next.Next {
+		switch {
+		case next.Reference != nil:
+		case next.Subscript != nil && isPureExpr(next.Subscript):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if expr is a literal or a reference to a variable.
+func isPureExpr(expr *parser.Expr) bool {
+	if expr.Unary == nil || expr.Unary.Op != parser.OpNone {
+		return false
+	}
+	ref := expr.Unary.Reference
+	return ref.Next == nil && !ref.Optional && (ref.Terminal.Ident != "" || ref.Terminal.Literal != nil)
+}
+
+// Copy a pure reference, so that it may appear in the AST more than once.
+func copyReference(ref *parser.Reference) *parser.Reference {
+	out := *ref
+	terminal := *ref.Terminal
+	out.Terminal = &terminal
+	tail := &out.Next
+	for next := ref.Next; next != nil; next = next.Next {
+		element := *next
+		if element.Subscript != nil {
+			element.Subscript = copyExpr(element.Subscript)
+		}
+		if element.Reference != nil {
+			member := *element.Reference
+			element.Reference = &member
+		}
+		*tail = &element
+		tail = &element.Next
+	}
+	return &out
+}
+
+// Copy a pure expression.
+func copyExpr(expr *parser.Expr) *parser.Expr {
+	out := *expr
+	unary := *expr.Unary
+	unary.Reference = copyReference(expr.Unary.Reference)
+	out.Unary = &unary
+	return &out
+}
+
+// A let statement declaring name.
+func temporary(pos lexer.Position, name string, value *parser.Expr) *parser.Stmt {
+	mixin := parser.Mixin{Pos: pos}
+	return &parser.Stmt{
+		Mixin: mixin,
+		VarDecl: &parser.VarDecl{
+			Mixin: mixin,
+			Vars:  []*parser.VarDeclAsgn{{Mixin: mixin, Name: name, Default: value}},
+		},
+	}
+}
+
+func identExpr(pos lexer.Position, name string) *parser.Expr {
+	mixin := parser.Mixin{Pos: pos}
+	return &parser.Expr{
+		Mixin: mixin,
+		Unary: &parser.Unary{Mixin: mixin, Reference: &parser.Reference{Mixin: mixin, Terminal: identTerminal(pos, name)}},
+	}
+}
+
+func identTerminal(pos lexer.Position, name string) *parser.Terminal {
+	return &parser.Terminal{Mixin: parser.Mixin{Pos: pos}, Ident: name}
+}
@@ -0,0 +1,154 @@
+package optimize
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/codegen/js"
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestDesugar(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{name: "Variable",
+			input: `
+				fn f(a: int, b: int) {
+					a += 1
+					(a) *= b - 1
+					a ^= 2
+					a = 3
+				}
+			`,
+			output: `
+function f(a, b) {
+  a = a + 1;
+  a = a * (b - 1);
+  a = a ** 2;
+  a = 3;
+}
+`},
+		{name: "PureTarget",
+			input: `
+				fn f(a: [A], i: int) {
+					a[i].x -= 1
+					a[0].y[i] *= 2
+				}
+			`,
+			output: `
+function f(a, i) {
+  a[i].x = a[i].x - 1;
+  a[0].y[i] = a[0].y[i] * 2;
+}
+`},
+		{name: "SingleEvaluation",
+			input: `
+				fn f(a: [int]) {
+					g().x += 1
+					a[h()] /= 2
+					g().a[h()] += 3
+				}
+			`,
+			output: `
+function f(a) {
+  {
+    let $target = g();
+    $target.x = $target.x + 1;
+  }
+  {
+    let $index = h();
+    a[$index] = a[$index] / 2;
+  }
+  {
+    let $target = g().a;
+    let $index = h();
+    $target[$index] = $target[$index] + 3;
+  }
+}
+`},
+		{name: "Closure",
+			input: `
+				fn f(xs: [int]): [int] {
+					return xs.map { x ->
+						let y = x
+						y *= 2
+						y
+					}
+				}
+			`,
+			output: `
+function f(xs) {
+  return xs.map((x) => {
+    let y = x;
+    y = y * 2;
+    return y;
+  });
+}
+`},
+		{name: "Nested",
+			input: `
+				fn f(x: int) {
+					if x > 1 {
+						x -= 1
+					}
+					switch x {
+					case 1:
+						x += 1
+					}
+				}
+			`,
+			output: `
+function f(x) {
+  if (x > 1) {
+    x = x - 1;
+  }
+  switch (x) {
+    case 1: {
+      x = x + 1;
+      break;
+    }
+  }
+}
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			Desugar(ast, nil)
+			w := &bytes.Buffer{}
+			err = js.Generate(w, ast)
+			require.NoError(t, err)
+			require.Equal(t, test.output[1:], w.String())
+		})
+	}
+}
+
+func TestDesugarRetainsTypes(t *testing.T) {
+	ast, err := parser.ParseString(`
+		fn f(n: int): int {
+			let t = n
+			t /= 2
+			return t
+		}
+	`)
+	require.NoError(t, err)
+	program, err := analyser.Analyse(ast)
+	require.NoError(t, err)
+	Desugar(ast, program)
+	w := &bytes.Buffer{}
+	err = js.GenerateProgram(w, program)
+	require.NoError(t, err)
+	require.Equal(t, `function f(n) {
+  let t = n;
+  t = Math.trunc(t / 2);
+  return t;
+}
+`, w.String())
+}
@@ -0,0 +1,246 @@
+// Package optimize implements optimisation and desugaring passes over the AST.
+package optimize
+
+import (
+	"github.com/alecthomas/langx/constant"
+	"github.com/alecthomas/langx/parser"
+)
+
+// Fold performs constant folding and simplification on ast, in place.
+//
+// Operators applied to literal operands are evaluated, including concatenation
+// of string literals. Logical operators with a constant operand are simplified
+// where doing so does not change which operands are evaluated. If statements
+// with a constant condition are replaced by the branch taken, and statements
+// following a return, break or continue are removed.
+//
+// Expressions whose evaluation would fail, such as division by zero or integer
+// overflow, are left as is. Fold preserves the behaviour of programs that have
+// been successfully analysed, but not the errors of invalid programs, so it
+// should be applied after analysis. Folded expressions retain their resolved
+// types.
+func Fold(ast *parser.AST) {
+	// Comparisons extended by a chained comparison, which must retain their
+	// right operand.
+	extended := map[*parser.Expr]bool{}
+	_ = parser.VisitFunc(ast, func(node parser.Node, next parser.Next) error {
+		if expr, ok := node.(*parser.Expr); ok && expr.Chained {
+			extended[expr.Left] = true
+		}
+		// Fold children first, so that folded operands can be folded in turn.
+		if err := next(nil); err != nil {
+			return err
+		}
+		switch node := node.(type) {
+		case *parser.Expr:
+			switch {
+			case node.Chained:
+				foldChain(node, extended[node])
+			case !extended[node]:
+				foldExpr(node)
+			}
+
+		case parser.Stmt:
+			simplifyBlock(node.Block)
+			for stmt := node.If; stmt != nil; stmt = stmt.ElseIf {
+				simplifyBlock(stmt.Main)
+				simplifyBlock(stmt.Else)
+			}
+			if node.For != nil {
+				simplifyBlock(node.For.Body)
+			}
+			if node.Switch != nil {
+				for _, c := range node.Switch.Cases {
+					c.Body = simplifyStmts(c.Body)
+				}
+			}
+
+		case *parser.FuncDecl:
+			simplifyBlock(node.Body)
+
+		case *parser.InitialiserDecl:
+			simplifyBlock(node.Body)
+
+		case *parser.DoExpr:
+			simplifyBlock(node.Body)
+		}
+		return nil
+	})
+}
+
+func simplifyBlock(block *parser.Block) {
+	if block != nil {
+		block.Statements = simplifyStmts(block.Statements)
+	}
+}
+
+func simplifyStmts(stmts []*parser.Stmt) []*parser.Stmt {
+	out := make([]*parser.Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		if stmt = selectBranch(stmt); stmt == nil {
+			continue
+		}
+		out = append(out, stmt)
+		if terminates(stmt) {
+			// Anything further is unreachable.
+			break
+		}
+	}
+	return out
+}
+
+// Replace a conditional whose condition is constant with the branch taken, or
+// nil if there is none.
+func selectBranch(stmt *parser.Stmt) *parser.Stmt {
+	for stmt.If != nil && stmt.If.Binding == "" {
+		cond := literalOf(stmt.If.Condition)
+		if cond == nil || cond.Bool == nil {
+			return stmt
+		}
+		// Blocks are retained to preserve scoping.
+		switch {
+		case bool(*cond.Bool):
+			return &parser.Stmt{Mixin: stmt.Mixin, Block: stmt.If.Main}
+		case stmt.If.ElseIf != nil:
+			stmt = &parser.Stmt{Mixin: stmt.Mixin, If: stmt.If.ElseIf}
+		case stmt.If.Else != nil:
+			return &parser.Stmt{Mixin: stmt.Mixin, Block: stmt.If.Else}
+		default:
+			return nil
+		}
+	}
+	return stmt
+}
+
+// Returns true if control never proceeds past stmt.
+func terminates(stmt *parser.Stmt) bool {
+	switch {
+	case stmt.Return != nil, stmt.Break != nil, stmt.Continue != nil:
+		return true
+	case stmt.Block != nil:
+		return blockTerminates(stmt.Block)
+	case stmt.If != nil:
+		if stmt.If.ElseIf != nil {
+			return blockTerminates(stmt.If.Main) && terminates(&parser.Stmt{If: stmt.If.ElseIf})
+		}
+		return blockTerminates(stmt.If.Main) && blockTerminates(stmt.If.Else)
+	default:
+		return false
+	}
+}
+
+func blockTerminates(block *parser.Block) bool {
+	if block == nil || len(block.Statements) == 0 {
+		return false
+	}
+	return terminates(block.Statements[len(block.Statements)-1])
+}
+
+// Returns the literal value of expr, or nil if it is not a literal.
+func literalOf(expr *parser.Expr) *parser.Literal {
+	if expr == nil || expr.Unary == nil || expr.Unary.Op != parser.OpNone {
+		return nil
+	}
+	ref := expr.Unary.Reference
+	if ref.Next != nil || ref.Optional {
+		return nil
+	}
+	return ref.Terminal.Literal
+}
+
+// Replace expr with a literal.
+func replaceWithLiteral(expr *parser.Expr, literal *parser.Literal) {
+	mixin := expr.Mixin
+	literal.Mixin = mixin
+	*expr = parser.Expr{
+		Mixin: mixin,
+		Unary: &parser.Unary{
+			Mixin: mixin,
+			Reference: &parser.Reference{
+				Mixin:    mixin,
+				Terminal: &parser.Terminal{Mixin: mixin, Literal: literal},
+			},
+		},
+	}
+}
+
+func foldExpr(expr *parser.Expr) {
+	if expr.Unary != nil {
+		foldUnary(expr)
+		return
+	}
+	left, right := literalOf(expr.Left), literalOf(expr.Right)
+	if left != nil && left.Bool != nil && (expr.Op == parser.OpAnd || expr.Op == parser.OpOr) {
+		// Short-circuit: "true || x" and "false && x" never evaluate x.
+		if *left.Bool == (expr.Op == parser.OpOr) {
+			replaceWithLiteral(expr, left)
+		} else {
+			*expr = *expr.Right
+		}
+		return
+	}
+	if right != nil && right.Bool != nil && *right.Bool == (expr.Op == parser.OpAnd) &&
+		(expr.Op == parser.OpAnd || expr.Op == parser.OpOr) {
+		// "x && true" and "x || false" are x.
+		*expr = *expr.Left
+		return
+	}
+	if left == nil || right == nil {
+		return
+	}
+	// Expressions that fail to evaluate are left for the runtime.
+	if folded, err := constant.Binary(expr.Op, left, right); err == nil && folded != nil {
+		replaceWithLiteral(expr, folded)
+	}
+}
+
+// Fold a chained comparison whose first comparison is constant. If it is
+// extended by a further comparison, only dropping a comparison that is true
+// retains its right operand.
+func foldChain(expr *parser.Expr, extended bool) {
+	first := expr.Left
+	if first.Chained {
+		return
+	}
+	left, right := literalOf(first.Left), literalOf(first.Right)
+	if left == nil || right == nil {
+		return
+	}
+	folded, err := constant.Binary(first.Op, left, right)
+	if err != nil || folded == nil || folded.Bool == nil {
+		return
+	}
+	if !*folded.Bool {
+		if !extended {
+			replaceWithLiteral(expr, folded)
+		}
+		return
+	}
+	expr.Left, expr.Chained = first.Right, false
+	if !extended {
+		foldExpr(expr)
+	}
+}
+
+func foldUnary(expr *parser.Expr) {
+	unary := expr.Unary
+	ref := unary.Reference
+	if ref.Next != nil || ref.Optional {
+		return
+	}
+	// Strip parentheses from literals, eg. (1 + 2) once folded.
+	if tuple := ref.Terminal.Tuple; len(tuple) == 1 && literalOf(tuple[0]) != nil {
+		unary.Reference = tuple[0].Unary.Reference
+		ref = unary.Reference
+	}
+	literal := ref.Terminal.Literal
+	if literal == nil {
+		return
+	}
+	if unary.Op == parser.OpNone {
+		return
+	}
+	if folded := constant.Unary(unary.Op, literal); folded != nil {
+		replaceWithLiteral(expr, folded)
+	}
+}
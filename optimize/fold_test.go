@@ -0,0 +1,196 @@
+package optimize
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/codegen/js"
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{name: "Arithmetic",
+			input: `
+				let a = (1 + 2) * 3 - -4
+				let b = 8 / 2 % 3
+				let c = 0x0f & 6 | 1
+				let d = 1.5 * 3
+			`,
+			output: `
+let a = 13;
+let b = 1;
+let c = 7;
+let d = 4.5;
+`},
+		{name: "Unfoldable",
+			input: `
+				let a = 7 / 2
+				let b = 1 / 0
+				let c = 4611686018427387904 * 2
+			`,
+			output: `
+let a = 7 / 2;
+let b = 1 / 0;
+let c = 4611686018427387904 * 2;
+`},
+		{name: "Strings",
+			input: `
+				fn f(x: int): string {
+					return "a{x}" + "b" + "c"
+				}
+				let a = "abc" < "abd"
+			`,
+			output: `
+function f(x) {
+  return ` + "`a${x}bc`" + `;
+}
+let a = true;
+`},
+		{name: "ChainedComparison",
+			input: `
+				let a = 1 < 2 < 3
+				let b = 2 < 1 < x
+				let c = 0 < 1 < x
+				let d = 0 < 1 < 2 < x
+				let e = x < 1 < 2
+			`,
+			output: `
+let a = true;
+let b = false;
+let c = 1 < x;
+let d = 2 < x;
+let e = x < 1 && 1 < 2;
+`},
+		{name: "Logic",
+			input: `
+				fn f(x: bool): bool {
+					let a = !true || x
+					let b = x && true
+					let c = 'a' != 'b' && x
+					return true || x
+				}
+			`,
+			output: `
+function f(x) {
+  let a = x;
+  let b = x;
+  let c = x;
+  return true;
+}
+`},
+		{name: "ConstantConditions",
+			input: `
+				fn f(x: int): int {
+					if false {
+						return 1
+					}
+					if 2 > 1 {
+						let x = 2
+						x = 3
+					} else {
+						return 4
+					}
+					if 1 == 2 {
+						return 5
+					} else {
+						return x
+					}
+					return 6
+				}
+			`,
+			output: `
+function f(x) {
+  {
+    let x = 2;
+    x = 3;
+  }
+  {
+    return x;
+  }
+}
+`},
+		{name: "ElseIfChain",
+			input: `
+				fn f(x: int): int {
+					if false {
+						return 1
+					} else if x > 1 {
+						return 2
+					} else if true {
+						return 3
+					}
+					if 1 > 2 {
+						return 4
+					} else if 2 > 3 {
+						return 5
+					}
+					return 6
+				}
+			`,
+			output: `
+function f(x) {
+  if (x > 1) {
+    return 2;
+  } else if (true) {
+    return 3;
+  }
+  return 6;
+}
+`},
+		{name: "Unreachable",
+			input: `
+				fn f(x: int): int {
+					if x > 1 {
+						return 1
+						x = 2
+					} else {
+						return 2
+					}
+					x = 3
+				}
+			`,
+			output: `
+function f(x) {
+  if (x > 1) {
+    return 1;
+  } else {
+    return 2;
+  }
+}
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			Fold(ast)
+			w := &bytes.Buffer{}
+			err = js.Generate(w, ast)
+			require.NoError(t, err)
+			require.Equal(t, test.output[1:], w.String())
+		})
+	}
+}
+
+func TestFoldRetainsTypes(t *testing.T) {
+	ast, err := parser.ParseString(`
+		let a = 1 + 2
+	`)
+	require.NoError(t, err)
+	program, err := analyser.Analyse(ast)
+	require.NoError(t, err)
+	value := ast.Declarations[0].Var.Vars[0].Default
+	before := program.Resolved(value)
+	require.NotNil(t, before)
+	Fold(ast)
+	require.Equal(t, "3", value.Unary.Reference.Terminal.Literal.Number.String())
+	require.Equal(t, before, program.Resolved(value))
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
+)
+
+// An Option for Parse.
+type Option func(o *options) error
+
+type options struct {
+	aliases        map[string]lexer.Token
+	semicolons     *semicolons
+	trailingCommas TrailingCommaPolicy
+}
+
+// KeywordAlias registers alias as an alternative spelling of keyword, eg.
+//
+//	KeywordAlias("func", "fn")
+//
+// Aliases are replaced with their canonical keywords during lexing, so the AST only
+// ever contains the canonical forms. An aliased word can not be used as an identifier.
+//
+// keyword must be a keyword or modifier.
+func KeywordAlias(alias, keyword string) Option {
+	return func(o *options) error {
+		tokens, err := lexString(alias)
+		if err != nil || len(tokens) != 2 || tokens[0].Type != identToken {
+			return errors.Errorf("keyword alias %q must be an identifier", alias)
+		}
+		tokens, err = lexString(keyword)
+		if err != nil || len(tokens) != 2 || !isKeyword(tokens[0]) {
+			return errors.Errorf("invalid keyword %q for alias %q", keyword, alias)
+		}
+		o.aliases[alias] = tokens[0]
+		return nil
+	}
+}
+
+// Keywords the grammar matches by value, which are lexed as identifiers.
+var contextualKeywords = map[string]bool{"class": true, "else": true, "init": true}
+
+func isKeyword(token lexer.Token) bool {
+	switch token.Type {
+	case keywordToken, modifierToken:
+		return true
+	case identToken:
+		return contextualKeywords[token.Value]
+	}
+	return false
+}
+
+// Lex s into tokens, including the trailing EOF.
+func lexString(s string) ([]lexer.Token, error) {
+	l, err := lex.Lex(strings.NewReader(s))
+	if err != nil {
+		return nil, err
+	}
+	return lexer.ConsumeAll(l)
+}
+
+// A Lexer that replaces keyword aliases with their canonical tokens.
+type aliasLexer struct {
+	lexer   lexer.Lexer
+	aliases map[string]lexer.Token
+}
+
+func (a *aliasLexer) Next() (lexer.Token, error) {
+	token, err := a.lexer.Next()
+	if err != nil || token.Type != identToken {
+		return token, err
+	}
+	canonical, ok := a.aliases[token.Value]
+	if !ok {
+		return token, nil
+	}
+	canonical.Pos = token.Pos
+	return canonical, nil
+}
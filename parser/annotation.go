@@ -0,0 +1,39 @@
+package parser
+
+// Annotation on a declaration, eg.
+//
+//	@deprecated("use g")
+//	fn f() {}
+type Annotation struct {
+	Mixin
+
+	Name      string  `"@" @Ident`
+	Arguments []*Expr `( "(" ( @@ ( "," @@ )* ","? )? ")" )?`
+}
+
+func (a *Annotation) accept(visitor VisitorFunc) error {
+	return visitor(a, func(err error) error {
+		if err != nil {
+			return err
+		}
+		for _, arg := range a.Arguments {
+			if err = VisitFunc(arg, visitor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Annotations on a declaration.
+type Annotations []*Annotation
+
+// Get the annotation with the given name, or nil.
+func (a Annotations) Get(name string) *Annotation {
+	for _, annotation := range a {
+		if annotation.Name == name {
+			return annotation
+		}
+	}
+	return nil
+}
@@ -1,9 +1,14 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/alecthomas/participle"
 	"github.com/alecthomas/participle/lexer"
@@ -12,41 +17,96 @@ import (
 
 var (
 	// Note: "lex" is in this file to ensure correct initialisation ordering.
-	lex = lexer.Must(regex.New(`
+	lex = lexer.Must(regex.New(lexRules))
+	// As lex, but retaining comments for Lex.
+	commentLex = lexer.Must(regex.New(strings.Replace(lexRules, "comment =", "Comment =", 1)))
+	lexRules   = `
 		comment = //.*|(?s:/\*.*?\*/)
-		backslash = \\
+		Backslash = \\
 		whitespace = [\r\t ]+
 	
 		Modifier = \b(pub|override|static)\b
-		Keyword = \b(in|switch|case|default|if|enum|alias|let|fn|break|continue|for|throws|import|new)\b
+		Keyword = \b(in|switch|case|default|if|enum|alias|let|fn|break|continue|for|throws|import|new|nil|do|const|module|return)\b
+		Embedded = [[:alpha:]_]\w*` + "`(?s:.*?)`" + `
+		Template = [[:alpha:]_]\w*"(\\.|[^"])*"
+		Bool = \b(true|false)\b
 		Ident = \b([[:alpha:]_]\w*)\b
-		Number = \b(\d+(\.\d+)?)\b
+		Number = \b(0[xX][[:xdigit:]_]+|0[oO][0-7_]+|0[bB][01_]+|\d[\d_]*(\.\d[\d_]*)?([eE][-+]?\d+)?)\b
 		String = "(\\.|[^"])*"
-		LiteralString = ` + "`.*?`|'.*?'" + `
+		Char = '(\\.|[^'])*'
+		LiteralString = ` + "`.*?`" + `
 		Newline = \n
-		Operator = ->|%=|>=|<=|&&|\|\||==|!=
+		Operator = \.\.\.|->|%=|>=|<=|&&|\|\||==|!=
 		Assignment = (\^=|\+=|-=|\*=|/=|\|=|&=|%=|=)
 		SingleOperator = [-+*/<>%^!|&]
 		Punct = []` + "`" + `~[()@#${}:;?.,]
-	`))
+	`
 	parser = participle.MustBuild(&AST{},
 		participle.Lexer(&fixupLexerDefinition{}),
 		participle.UseLookahead(1),
 		unquoteLiteral(),
-		participle.Unquote(),
+		unquoteChar(),
+		validateNumber(),
+		validateString(),
 	)
 	unaryParser = participle.MustBuild(&Unary{},
 		participle.Lexer(&fixupLexerDefinition{}),
 		participle.UseLookahead(1),
 		unquoteLiteral(),
-		participle.Unquote(),
+		unquoteChar(),
+		validateNumber(),
+		validateString(),
+	)
+	newExprParser = participle.MustBuild(&newExpr{},
+		participle.Lexer(&fixupLexerDefinition{}),
+		participle.UseLookahead(1),
+		unquoteLiteral(),
+		unquoteChar(),
+		validateNumber(),
+		validateString(),
+	)
+	typeArgumentsParser = participle.MustBuild(&typeArguments{},
+		participle.Lexer(&fixupLexerDefinition{}),
+		participle.UseLookahead(1),
+		unquoteLiteral(),
+		unquoteChar(),
+		validateNumber(),
+		validateString(),
+	)
+	closureParser = participle.MustBuild(&closure{},
+		participle.Lexer(&fixupLexerDefinition{}),
+		participle.UseLookahead(1),
+		unquoteLiteral(),
+		unquoteChar(),
+		validateNumber(),
+		validateString(),
+	)
+	moduleDeclParser = participle.MustBuild(&ModuleDecl{},
+		participle.Lexer(&fixupLexerDefinition{}),
+		participle.UseLookahead(1),
+	)
+	rootDeclParser = participle.MustBuild(&RootDecl{},
+		participle.Lexer(&fixupLexerDefinition{}),
+		participle.UseLookahead(1),
+		unquoteLiteral(),
+		unquoteChar(),
+		validateNumber(),
+		validateString(),
 	)
 
 	identToken          = lex.Symbols()["Ident"]
+	embeddedToken       = lex.Symbols()["Embedded"]
+	templateToken       = lex.Symbols()["Template"]
+	boolToken           = lex.Symbols()["Bool"]
 	stringToken         = lex.Symbols()["String"]
+	charToken           = lex.Symbols()["Char"]
 	numberToken         = lex.Symbols()["Number"]
 	operatorToken       = lex.Symbols()["Operator"]
 	singleOperatorToken = lex.Symbols()["SingleOperator"]
+	modifierToken       = lex.Symbols()["Modifier"]
+	keywordToken        = lex.Symbols()["Keyword"]
+	commentToken        = commentLex.Symbols()["Comment"]
+	backslashToken      = lex.Symbols()["Backslash"]
 )
 
 func unquoteLiteral() participle.Option {
@@ -56,6 +116,77 @@ func unquoteLiteral() participle.Option {
 	}, "LiteralString")
 }
 
+// Decode and validate character literals, eg. 'a', '\n' or '\u{e9}'.
+//
+// Escapes are the same as those of strings (see decodeEscape).
+func unquoteChar() participle.Option {
+	return participle.Map(func(token lexer.Token) (lexer.Token, error) {
+		str := token.Value[1 : len(token.Value)-1]
+		if strings.HasPrefix(str, "\\") {
+			decoded, size, err := decodeEscape(str)
+			if err != nil {
+				return token, participle.AnnotateError(advancePos(token.Pos, "'"), err)
+			}
+			if size != len(str) {
+				return token, participle.Errorf(token.Pos, "invalid character literal %s", token.Value)
+			}
+			str = decoded
+		}
+		if utf8.RuneCountInString(str) != 1 {
+			return token, participle.Errorf(token.Pos, "invalid character literal %s", token.Value)
+		}
+		token.Value = str
+		return token, nil
+	}, "Char")
+}
+
+// Validate escape sequences in strings in the lexer so errors are reported at the
+// position of the offending escape.
+//
+// Decoding is deferred to String.Capture, as it needs to distinguish \{ from {.
+func validateString() participle.Option {
+	return participle.Map(func(token lexer.Token) (lexer.Token, error) {
+		// Skip the tag of templates.
+		start := strings.IndexByte(token.Value, '"') + 1
+		str := token.Value[start : len(token.Value)-1]
+		for i := 0; i < len(str); i++ {
+			if str[i] != '\\' {
+				continue
+			}
+			_, size, err := decodeEscape(str[i:])
+			if err != nil {
+				return token, participle.AnnotateError(advancePos(token.Pos, token.Value[:start+i]), err)
+			}
+			i += size - 1
+		}
+		return token, nil
+	}, "String", "Template")
+}
+
+// Advance pos past text.
+func advancePos(pos lexer.Position, text string) lexer.Position {
+	for _, rn := range text {
+		pos.Offset += utf8.RuneLen(rn)
+		if rn == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
+
+// Validate numeric literals in the lexer so errors are reported at the correct position.
+func validateNumber() participle.Option {
+	return participle.Map(func(token lexer.Token) (lexer.Token, error) {
+		if _, err := parseNumber(token.Value); err != nil {
+			return token, participle.AnnotateError(token.Pos, err)
+		}
+		return token, nil
+	}, "Number")
+}
+
 // Decls is a group of declarations.
 type Decls interface {
 	Decls() []Decl
@@ -64,6 +195,7 @@ type Decls interface {
 type AST struct {
 	Mixin
 
+	Module       *ModuleDecl `@@?`
 	Declarations []*RootDecl `@@*`
 }
 
@@ -72,6 +204,9 @@ func (a *AST) accept(visitor VisitorFunc) error {
 		if err != nil {
 			return err
 		}
+		if err = VisitFunc(a.Module, visitor); err != nil {
+			return err
+		}
 		for _, decl := range a.Declarations {
 			err = VisitFunc(decl, visitor)
 			if err != nil {
@@ -94,13 +229,15 @@ func (a *AST) Decls() []Decl {
 type RootDecl struct {
 	Mixin
 
-	Modifiers Modifiers `@Modifier*`
+	Annotations Annotations `( @@ ";"? )*`
+	Modifiers   Modifiers   `@@?`
 
 	Class  *ClassDecl  `(   @@ ";"?`
 	Import *ImportDecl `  | @@ ";"?`
 	Enum   *EnumDecl   `  | @@ ";"?`
 	Var    *VarDecl    `  | @@ ";"`
-	Func   *FuncDecl   `  | @@ ";"? ) `
+	Func   *FuncDecl   `  | @@ ";"?`
+	Cond   *CondDecl   `  | @@ ";"? ) `
 }
 
 func (r *RootDecl) accept(visitor VisitorFunc) error {
@@ -108,11 +245,31 @@ func (r *RootDecl) accept(visitor VisitorFunc) error {
 		if err != nil {
 			return err
 		}
-		return VisitFunc(r.Decl(), visitor)
+		for _, annotation := range r.Annotations {
+			if err = VisitFunc(annotation, visitor); err != nil {
+				return err
+			}
+		}
+		decl := r.selected()
+		if decl == nil {
+			return invalidNode(r)
+		}
+		return VisitFunc(decl, visitor)
 	})
 }
 
+// Decl returns the declaration.
+//
+// It panics if r is invalid (see Validate).
 func (r *RootDecl) Decl() Decl {
+	decl := r.selected()
+	if decl == nil {
+		panic(invalidNode(r))
+	}
+	return decl
+}
+
+func (r *RootDecl) selected() Decl {
 	switch {
 	case r.Class != nil:
 		return r.Class
@@ -129,16 +286,169 @@ func (r *RootDecl) Decl() Decl {
 	case r.Func != nil:
 		return r.Func
 
+	case r.Cond != nil:
+		return r.Cond
+
+	default:
+		return nil
+	}
+}
+
+// Names of the symbols declared by this declaration.
+func (r *RootDecl) Names() []string {
+	switch {
+	case r.Func != nil:
+		return []string{r.Func.Name}
+
+	case r.Class != nil:
+		return []string{r.Class.Type.Type}
+
+	case r.Enum != nil:
+		return []string{r.Enum.Type.Type}
+
+	case r.Var != nil:
+		names := []string{}
+		for _, v := range r.Var.Vars {
+			if v.Pattern != nil {
+				names = append(names, v.Pattern.Names()...)
+			} else {
+				names = append(names, v.Name)
+			}
+		}
+		return names
+
 	default:
-		panic("?")
+		return nil
 	}
 }
 
+// ModuleDecl is the optional module header of a file, eg.
+//
+//	module foo.bar
+type ModuleDecl struct {
+	Mixin
+
+	Name string `"module" @Ident ( @"." @Ident )* ";"`
+}
+
+func (m *ModuleDecl) accept(visitor VisitorFunc) error {
+	return visitor(m, func(err error) error { return err })
+}
+
+// ImportDecl imports a module, in one of the forms:
+//
+//	import "foo/bar"          // Legacy path import.
+//	import fb "foo/bar"       // Legacy path import with alias.
+//	import foo.bar            // Qualified import.
+//	import foo.bar.{Baz, Waz} // Import selected symbols.
+//	import foo.bar.*          // Import all symbols.
 type ImportDecl struct {
 	Mixin
 
-	Alias  string `"import" @Ident?`
-	Import string `@String`
+	Qualified *QualifiedImport `"import" ( @@`
+	Alias     string           `         | @Ident?`
+	Import    Quoted           `           @String )`
+}
+
+// Module returns the dotted module path being imported.
+func (i *ImportDecl) Module() string {
+	if i.Qualified != nil {
+		return i.Qualified.Module
+	}
+	return strings.ReplaceAll(string(i.Import), "/", ".")
+}
+
+// Namespace returns the name a whole-module import is declared as: its alias,
+// or the last component of the module path.
+func (i *ImportDecl) Namespace() string {
+	if i.Alias != "" {
+		return i.Alias
+	}
+	module := i.Module()
+	return module[strings.LastIndex(module, ".")+1:]
+}
+
+// File returns the path of the source file for the imported module, relative to a search path.
+func (i *ImportDecl) File() string {
+	return ModuleFile(i.Module())
+}
+
+// ModuleFile maps a dotted module path to a source file path, eg. foo.bar -> foo/bar.langx
+func ModuleFile(module string) string {
+	return filepath.Join(strings.Split(module, ".")...) + ".langx"
+}
+
+// QualifiedImport is a dotted module path with optional selected or wildcard symbols.
+type QualifiedImport struct {
+	Mixin
+
+	Module   string
+	Symbols  []string
+	Wildcard bool
+}
+
+func (q *QualifiedImport) Parse(lex *lexer.PeekingLexer) error {
+	token, err := lex.Peek(0)
+	if err != nil {
+		return err
+	}
+	// Legacy aliased import, eg. import alias "foo/bar"
+	next, err := lex.Peek(1)
+	if err != nil {
+		return err
+	}
+	if token.Type != identToken || next.Type == stringToken {
+		return participle.NextMatch
+	}
+	*q = QualifiedImport{Mixin: Mixin{Pos: token.Pos}}
+	parts := []string{}
+	for {
+		token, _ = lex.Next()
+		if token.Type != identToken {
+			return participle.Errorf(token.Pos, "expected module name but got %q", token.Value)
+		}
+		parts = append(parts, token.Value)
+		q.Module = strings.Join(parts, ".")
+		if next, _ := lex.Peek(0); next.Value != "." {
+			return nil
+		}
+		_, _ = lex.Next()
+		next, _ := lex.Peek(0)
+		switch next.Value {
+		case "*":
+			_, _ = lex.Next()
+			q.Wildcard = true
+			return nil
+
+		case "{":
+			_, _ = lex.Next()
+			return q.parseSymbols(lex)
+		}
+	}
+}
+
+func (q *QualifiedImport) parseSymbols(lex *lexer.PeekingLexer) error {
+	for {
+		token, _ := lex.Next()
+		switch {
+		case token.Value == "}" && len(q.Symbols) > 0:
+			return nil
+
+		case token.Type != identToken:
+			return participle.Errorf(token.Pos, "expected imported symbol but got %q", token.Value)
+		}
+		q.Symbols = append(q.Symbols, token.Value)
+		token, _ = lex.Next()
+		switch token.Value {
+		case "}":
+			return nil
+
+		case ",":
+
+		default:
+			return participle.Errorf(token.Pos, "expected \",\" or \"}\" but got %q", token.Value)
+		}
+	}
 }
 
 func (i *ImportDecl) accept(visitor VisitorFunc) error {
@@ -184,7 +494,7 @@ func (e *EnumDecl) decl() {}
 type EnumMember struct {
 	Mixin
 
-	Modifiers Modifiers `@Modifier*`
+	Modifiers Modifiers `@@?`
 
 	CaseDecl *CaseDecl `(  @@`
 	FuncDecl *FuncDecl ` | @@ )`
@@ -195,7 +505,11 @@ func (e *EnumMember) accept(visitor VisitorFunc) error {
 		if err != nil {
 			return err
 		}
-		return VisitFunc(e.Decl(), visitor)
+		decl := e.selected()
+		if decl == nil {
+			return invalidNode(e)
+		}
+		return VisitFunc(decl, visitor)
 	})
 }
 
@@ -205,24 +519,56 @@ type Decl interface {
 	decl()
 }
 
+// Decl returns the declaration.
+//
+// It panics if e is invalid (see Validate).
 func (e *EnumMember) Decl() Decl {
+	decl := e.selected()
+	if decl == nil {
+		panic(invalidNode(e))
+	}
+	return decl
+}
+
+func (e *EnumMember) selected() Decl {
 	switch {
 	case e.CaseDecl != nil:
 		return e.CaseDecl
 
+	case e.FuncDecl != nil:
+		return e.FuncDecl
+
 	default:
-		panic("??")
+		return nil
 	}
 }
 
+// CaseDecl is a case of an enum, eg.
+//
+//	case circle(float)
+//	case point(x: int, y: int)
+//	case red = 1
+//
+// A case has either a single unnamed associated value (Type), one or more named
+// associated values (Fields), or none, and may have a raw value (Value).
 type CaseDecl struct {
 	Mixin
 
-	Name string    `"case" @Ident`
-	Type *TypeDecl `( "(" @@ ")" )?`
+	Name   string       `"case" @Ident`
+	Fields []*CaseField `( "(" ( @@ ( "," @@ )* ")"`
+	Type   *TypeDecl    `      | @@ ")" ) )?`
+	Value  *Expr        `( "=" @@ )?`
 }
 
-func (c *CaseDecl) accept(visitor VisitorFunc) error {
+// CaseField is a named associated value of an enum case.
+type CaseField struct {
+	Mixin
+
+	Name string    `@Ident ":"`
+	Type *TypeDecl `@@`
+}
+
+func (c *CaseField) accept(visitor VisitorFunc) error {
 	return visitor(c, func(err error) error {
 		if err != nil {
 			return err
@@ -231,6 +577,23 @@ func (c *CaseDecl) accept(visitor VisitorFunc) error {
 	})
 }
 
+func (c *CaseDecl) accept(visitor VisitorFunc) error {
+	return visitor(c, func(err error) error {
+		if err != nil {
+			return err
+		}
+		for _, field := range c.Fields {
+			if err := VisitFunc(field, visitor); err != nil {
+				return err
+			}
+		}
+		if err := VisitFunc(c.Type, visitor); err != nil {
+			return err
+		}
+		return VisitFunc(c.Value, visitor)
+	})
+}
+
 func (c *CaseDecl) decl() {}
 
 type ClassDecl struct {
@@ -270,7 +633,7 @@ func (c *ClassDecl) decl() {}
 type ClassMember struct {
 	Mixin
 
-	Modifiers Modifiers `@Modifier*`
+	Modifiers Modifiers `@@?`
 
 	VarDecl         *VarDecl         `(  @@`
 	FuncDecl        *FuncDecl        ` | @@`
@@ -284,11 +647,26 @@ func (c *ClassMember) accept(visitor VisitorFunc) error {
 		if err != nil {
 			return err
 		}
-		return VisitFunc(c.Decl(), visitor)
+		decl := c.selected()
+		if decl == nil {
+			return invalidNode(c)
+		}
+		return VisitFunc(decl, visitor)
 	})
 }
 
+// Decl returns the declaration.
+//
+// It panics if c is invalid (see Validate).
 func (c *ClassMember) Decl() Decl {
+	decl := c.selected()
+	if decl == nil {
+		panic(invalidNode(c))
+	}
+	return decl
+}
+
+func (c *ClassMember) selected() Decl {
 	switch {
 	case c.VarDecl != nil:
 		return c.VarDecl
@@ -306,14 +684,14 @@ func (c *ClassMember) Decl() Decl {
 		return c.InitialiserDecl
 
 	default:
-		panic("??")
+		return nil
 	}
 }
 
 type InitialiserDecl struct {
 	Mixin
 
-	Parameters []*Parameters `"init" "(" ( @@ ( "," @@ )* )? ","? ")"`
+	Parameters []*Parameters `"init" "(" ( @@ ( "," @@ )* ","? )? ")"`
 	Throws     bool          `@"throws"?`
 	Body       *Block        `@@`
 }
@@ -351,7 +729,8 @@ func (t *TypeDecl) String() string {
 	case t.DictOrSet != nil:
 		return t.DictOrSet.String()
 	default:
-		panic("??")
+		// Only reachable for a TypeDecl built by hand; see Validate.
+		return "invalid type"
 	}
 }
 
@@ -364,8 +743,14 @@ func (t TypeDecl) accept(visitor VisitorFunc) error {
 		case t.Named != nil:
 			return t.Named.accept(visitor)
 
+		case t.Array != nil:
+			return t.Array.accept(visitor)
+
+		case t.DictOrSet != nil:
+			return t.DictOrSet.accept(visitor)
+
 		default:
-			panic("??")
+			return invalidNode(t)
 		}
 	})
 }
@@ -514,7 +899,9 @@ type VarDecl struct {
 	// let a, b, c int
 	// let a = 1, b = 2
 	// let a int = 1, b int = 2
-	Vars []*VarDeclAsgn `"let" @@ ( "," @@ )*`
+	// const a = 1
+	Const bool           `( "let" | @"const" )`
+	Vars  []*VarDeclAsgn `@@ ( "," @@ )*`
 }
 
 func (v *VarDecl) accept(visitor VisitorFunc) error {
@@ -536,9 +923,10 @@ func (v *VarDecl) decl() {}
 type VarDeclAsgn struct {
 	Mixin
 
-	Name    string `@Ident`
-	Type    *Expr  `( ":" @@ )?`
-	Default *Expr  `( "=" @@ )?`
+	Name    string   `(  @Ident`
+	Pattern *Pattern ` | @@ )`
+	Type    *Expr    `( ":" @@ )?`
+	Default *Expr    `( "=" @@ )?`
 }
 
 func (v VarDeclAsgn) accept(visitor VisitorFunc) error {
@@ -546,6 +934,9 @@ func (v VarDeclAsgn) accept(visitor VisitorFunc) error {
 		if err != nil {
 			return err
 		}
+		if err = VisitFunc(v.Pattern, visitor); err != nil {
+			return err
+		}
 		if err = VisitFunc(v.Type, visitor); err != nil {
 			return err
 		}
@@ -582,16 +973,21 @@ func (a *ExprStmt) accept(visitor VisitorFunc) error {
 type Stmt struct {
 	Mixin
 
-	Return    *ReturnStmt `  @@`
-	If        *IfStmt     `| @@`
-	For       *ForStmt    `| @@`
-	Switch    *SwitchStmt `| @@`
-	Block     *Block      `| @@`
-	VarDecl   *VarDecl    `| @@`
-	FuncDecl  *FuncDecl   `| @@`
-	ClassDecl *ClassDecl  `| @@`
-	EnumDecl  *EnumDecl   `| @@`
-	ExprStmt  *ExprStmt   `| @@`
+	// Label is only valid on for and switch statements.
+	Label Label `@@?`
+
+	Return    *ReturnStmt   `(   @@`
+	If        *IfStmt       `  | @@`
+	Break     *BreakStmt    `  | @@`
+	Continue  *ContinueStmt `  | @@`
+	For       *ForStmt      `  | @@`
+	Switch    *SwitchStmt   `  | @@`
+	Block     *Block        `  | @@`
+	VarDecl   *VarDecl      `  | @@`
+	FuncDecl  *FuncDecl     `  | @@`
+	ClassDecl *ClassDecl    `  | @@`
+	EnumDecl  *EnumDecl     `  | @@`
+	ExprStmt  *ExprStmt     `  | @@ )`
 }
 
 func (s Stmt) accept(visitor VisitorFunc) error {
@@ -604,6 +1000,10 @@ func (s Stmt) accept(visitor VisitorFunc) error {
 			return VisitFunc(s.Return, visitor)
 		case s.If != nil:
 			return VisitFunc(s.If, visitor)
+		case s.Break != nil:
+			return VisitFunc(s.Break, visitor)
+		case s.Continue != nil:
+			return VisitFunc(s.Continue, visitor)
 		case s.For != nil:
 			return VisitFunc(s.For, visitor)
 		case s.Switch != nil:
@@ -621,7 +1021,7 @@ func (s Stmt) accept(visitor VisitorFunc) error {
 		case s.ExprStmt != nil:
 			return VisitFunc(s.ExprStmt, visitor)
 		default:
-			panic("??")
+			return invalidNode(s)
 		}
 	})
 }
@@ -646,6 +1046,51 @@ func (b Block) accept(visitor VisitorFunc) error {
 	})
 }
 
+// Label is a statement label in the form "<ident>:", eg.
+//
+//	outer: for x in xs { ... }
+type Label string
+
+func (l *Label) Parse(lex *lexer.PeekingLexer) error {
+	name, err := lex.Peek(0)
+	if err != nil {
+		return err
+	}
+	colon, err := lex.Peek(1)
+	if err != nil {
+		return err
+	}
+	if name.Type != identToken || colon.Value != ":" {
+		return participle.NextMatch
+	}
+	_, _ = lex.Next()
+	_, _ = lex.Next()
+	*l = Label(name.Value)
+	return nil
+}
+
+// BreakStmt in the form "break [<label>]".
+type BreakStmt struct {
+	Mixin
+
+	Label string `"break" @Ident?`
+}
+
+func (b BreakStmt) accept(visitor VisitorFunc) error {
+	return visitor(b, func(err error) error { return err })
+}
+
+// ContinueStmt in the form "continue [<label>]".
+type ContinueStmt struct {
+	Mixin
+
+	Label string `"continue" @Ident?`
+}
+
+func (c ContinueStmt) accept(visitor VisitorFunc) error {
+	return visitor(c, func(err error) error { return err })
+}
+
 type ForStmt struct {
 	Mixin
 
@@ -672,12 +1117,20 @@ func (i ForStmt) accept(visitor VisitorFunc) error {
 	})
 }
 
+// IfStmt is a conditional, or an optional binding such as
+// "if let value = lookup(key) { ... }", where Main is only executed if the
+// Condition is not nil, with its value bound to Binding.
+//
+// It is followed by at most one of an Else block, or an ElseIf chaining
+// another conditional, as in "if a { ... } else if b { ... }".
 type IfStmt struct {
 	Mixin
 
-	Condition *Expr  `"if" @@`
-	Main      *Block `@@`
-	Else      *Block `( "else" @@ )?`
+	Binding   string  `"if" ( "let" @Ident "=" )?`
+	Condition *Expr   `@@`
+	Main      *Block  `@@`
+	Else      *Block  `( "else" ( @@`
+	ElseIf    *IfStmt `        | @@ ) )?`
 }
 
 func (i IfStmt) accept(visitor VisitorFunc) error {
@@ -694,10 +1147,27 @@ func (i IfStmt) accept(visitor VisitorFunc) error {
 		if err = VisitFunc(i.Else, visitor); err != nil {
 			return err
 		}
-		return nil
+		return VisitFunc(i.ElseIf, visitor)
 	})
 }
 
+// HasElse returns true if the conditional has an Else or ElseIf.
+func (i *IfStmt) HasElse() bool {
+	return i.Else != nil || i.ElseIf != nil
+}
+
+// ElseStatements returns the statements of the Else block, or for an ElseIf a
+// single statement holding it, as if it were written "else { if ... }".
+func (i *IfStmt) ElseStatements() []*Stmt {
+	if i.ElseIf != nil {
+		return []*Stmt{{Mixin: i.ElseIf.Mixin, If: i.ElseIf}}
+	}
+	if i.Else != nil {
+		return i.Else.Statements
+	}
+	return nil
+}
+
 type SwitchStmt struct {
 	Mixin
 
@@ -766,11 +1236,18 @@ func (c CaseSelect) accept(visitor VisitorFunc) error {
 	})
 }
 
+// EnumCase is a pattern matching a case of an enum, binding its associated
+// values in order, eg. ".point(x, y)" or ".point(let x, _)".
+//
+// A binding of "_" ignores the associated value.
 type EnumCase struct {
 	Mixin
 
 	Case string `"." @Ident`
-	Var  string `( "(" @Ident ")" )?`
+	Var  string `( "(" "let"? @Ident`
+	// Rest are the variables bound to the second and subsequent associated
+	// values of a case with named associated values.
+	Rest []string `( "," "let"? @Ident )* ")" )?`
 }
 
 func (e EnumCase) accept(visitor VisitorFunc) error {
@@ -796,7 +1273,7 @@ type FuncDecl struct {
 	Mixin
 
 	Name       string        `"fn" @Ident "("`
-	Parameters []*Parameters `( @@ ( "," @@ )* )? ","? ")"`
+	Parameters []*Parameters `( @@ ( "," @@ )* ","? )? ")"`
 	Throws     bool          `@"throws"?`
 	Return     *Expr         `( ":" @@ )?`
 	Body       *Block        `@@`
@@ -821,12 +1298,86 @@ func (f *FuncDecl) accept(visitor VisitorFunc) error {
 
 func (f *FuncDecl) decl() {}
 
-func Parse(r io.Reader) (*AST, error) {
-	ast := &AST{}
-	return ast, parser.Parse(r, ast)
+// Parse langx source. Errors are returned as *Diagnostic.
+func Parse(r io.Reader, opts ...Option) (*AST, error) {
+	ast, err := parse(r, opts...)
+	if err != nil {
+		return ast, ToDiagnostic(err)
+	}
+	return ast, nil
 }
 
-func ParseString(s string) (*AST, error) {
+func parse(r io.Reader, opts ...Option) (*AST, error) {
 	ast := &AST{}
-	return ast, parser.ParseString(s, ast)
+	o, source, err := readSource(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.aliases) == 0 {
+		err = parser.Parse(source(), ast)
+	} else {
+		err = parseWithAliases(source(), ast, o.aliases)
+	}
+	if err != nil {
+		return ast, err
+	}
+	if err = validateModifiers(ast); err != nil {
+		return ast, err
+	}
+	ends, err := newEndPositions(source())
+	if err != nil {
+		return ast, err
+	}
+	if err = checkTrailingCommas(ends.tokens, o.trailingCommas); err != nil {
+		return ast, err
+	}
+	ends.walk(reflect.ValueOf(ast))
+	return ast, nil
+}
+
+// Apply opts and read the source from r, returning a function to reread it.
+//
+// Sources are read twice, once to parse and once to record end positions.
+func readSource(r io.Reader, opts []Option) (*options, func() io.Reader, error) {
+	o := &options{aliases: map[string]lexer.Token{}}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, nil, err
+		}
+	}
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	source := func() io.Reader {
+		return &namedReader{Reader: bytes.NewReader(src), name: lexer.NameOfReader(r), semicolons: o.semicolons}
+	}
+	return o, source, nil
+}
+
+func parseWithAliases(r io.Reader, ast *AST, aliases map[string]lexer.Token) error {
+	lex, err := parser.Lexer().Lex(r)
+	if err != nil {
+		return err
+	}
+	peeker, err := lexer.Upgrade(&aliasLexer{lexer: lex, aliases: aliases})
+	if err != nil {
+		return err
+	}
+	return parser.ParseFromLexer(peeker, ast)
+}
+
+// A reader retaining the filename of the reader it was created from.
+type namedReader struct {
+	*bytes.Reader
+	name string
+	// The parsers share a single lexer definition, so the semi-colon policy
+	// of a parse is passed to it with the source.
+	semicolons *semicolons
+}
+
+func (n *namedReader) Name() string { return n.name }
+
+func ParseString(s string, opts ...Option) (*AST, error) {
+	return Parse(strings.NewReader(s), opts...)
 }
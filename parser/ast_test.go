@@ -2,9 +2,16 @@ package parser
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
+	"github.com/alecthomas/participle/lexer"
 	"github.com/alecthomas/repr"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -65,6 +72,8 @@ fn test() {
 	let dict = new {string: int}()
 	let array = {string}()
 	let result = Result.value("hello world")
+	let lengths = ["a", "bc"].map { s -> s.length() }
+	let measure: fn(string): int = length
 
 	for v in result {
 	}
@@ -124,6 +133,12 @@ func TestParse(t *testing.T) {
 		// 		let a: Pair<string, int>
 		// 	`,
 		// },
+		{name: "GenericInstantiation",
+			source: `
+				let a = List<int>()
+				let b = Map<string, List<int>>.empty()
+			`,
+		},
 		{name: "OptionalValue",
 			source: `
 				let a: string? = "hello"
@@ -141,10 +156,111 @@ func TestParse(t *testing.T) {
 			`},
 		{name: "AnonymousEnum",
 			source: `fn f(): string|int {}`},
+		{name: "BoolLiteral",
+			source: `
+				let a = true
+				let b = false
+			`,
+		},
+		{name: "CharLiteral",
+			source: `
+				let a = 'a'
+				let b = '\n'
+				let c = '世'
+			`,
+		},
+		{name: "InvalidCharLiteral",
+			source: `let a = 'ab'`,
+			fail:   `1:9: invalid character literal 'ab'`,
+		},
+		{name: "AssignmentInCondition",
+			source: `
+				fn f() {
+					if a = 1 {
+					}
+				}
+			`,
+			fail: `3:11: unexpected token "=" (expected "{")`,
+		},
+		{name: "NilLiteral",
+			source: `
+				let a: string? = nil
+			`,
+		},
 		{name: "InterpolatedString",
 			source: `
 				let a = "Hello {user}, how are you?"
 			`},
+		{name: "Destructuring",
+			source: `
+				let [a, b, ...rest] = xs, {x, y} = point
+			`},
+		{name: "Const",
+			source: `
+				const a = 1, b: string = "b"
+				fn f() {
+					const c = a
+				}
+			`},
+		{name: "DoExpr",
+			source: `
+				let a = 1 + do {
+					let t = f()
+					t * t
+				}
+			`},
+		{name: "TrailingClosure",
+			source: `
+				fn f() {
+					let a = xs.map { x -> x * 2 }
+					let b = xs.reduce(0) { sum, x ->
+						let next = sum + x
+						next
+					}
+					g { -> h() }
+					if ready() {
+						a = b
+					}
+				}
+			`},
+		{name: "FunctionTypes",
+			source: `
+				fn apply(n: int, f: fn(int): int): int {
+					let g: fn() = h
+					let k: fn(int, string,): fn(): bool? = m
+					return f(n)
+				}
+			`},
+		{name: "LabelledLoops",
+			source: `
+				fn f() {
+					outer: for x in xs {
+						for y in ys {
+							if y {
+								continue outer
+							}
+							break outer
+						}
+						continue
+					}
+					sw: switch x {
+					case 1:
+						break sw
+					}
+				}
+			`},
+		{name: "ConditionalCompilation",
+			source: `
+				#if target(js) {
+					fn f() {}
+				} #else {
+					fn f() {}
+				}
+
+				#if !feature(fast) {
+					let a = 1
+				}
+			`},
 		{name: "FullSource",
 			source: testSource},
 	}
@@ -163,3 +279,937 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyConditionals(t *testing.T) {
+	source := `
+		#if target(js) {
+			fn js() {}
+		} #else {
+			fn other() {}
+			#if feature(debug) {
+				fn debug() {}
+			}
+		}
+	`
+	tests := []struct {
+		name     string
+		config   BuildConfig
+		expected []string
+	}{
+		{name: "Then",
+			config:   BuildConfig{Target: "js"},
+			expected: []string{"js"}},
+		{name: "Else",
+			config:   BuildConfig{Target: "wat"},
+			expected: []string{"other"}},
+		{name: "Nested",
+			config:   BuildConfig{Target: "wat", Features: []string{"debug"}},
+			expected: []string{"other", "debug"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := ParseString(source)
+			require.NoError(t, err)
+			err = ast.ApplyConditionals(test.config)
+			require.NoError(t, err)
+			actual := []string{}
+			for _, decl := range ast.Declarations {
+				actual = append(actual, decl.Func.Name)
+			}
+			require.Equal(t, test.expected, actual)
+		})
+	}
+
+	ast, err := ParseString(`#if os(linux) {}`)
+	require.NoError(t, err)
+	err = ast.ApplyConditionals(BuildConfig{})
+	require.EqualError(t, err, `1:5: unknown compile-time condition "os"`)
+}
+
+func TestNumberLiteral(t *testing.T) {
+	tests := []struct {
+		source string
+		value  string
+		radix  int
+		fail   string
+	}{
+		{source: "1234", value: "1234", radix: 10},
+		{source: "1_000_000", value: "1000000", radix: 10},
+		{source: "1234567891", value: "1234567891", radix: 10},
+		{source: "9223372036854775808", value: "9223372036854775808", radix: 10},
+		{source: "0.1", value: "0.1", radix: 10},
+		{source: "1.5", value: "1.5", radix: 10},
+		{source: "1e9", value: "1e+09", radix: 10},
+		{source: "1.0", value: "1.0", radix: 10},
+		{source: "25E-1", value: "2.5", radix: 10},
+		{source: "0xFF", value: "255", radix: 16},
+		{source: "0o77", value: "63", radix: 8},
+		{source: "0b1010", value: "10", radix: 2},
+		{source: "0xdead_beef", value: "3735928559", radix: 16},
+		{source: "1__0", fail: `1:9: invalid number "1__0": '_' must separate successive digits`},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			ast, err := ParseString("let a = " + test.source + "\n")
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+			number := ast.Declarations[0].Var.Vars[0].Default.Unary.Reference.Terminal.Literal.Number
+			require.Equal(t, test.value, number.String())
+			require.Equal(t, test.radix, number.Radix)
+		})
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		source    string
+		raw       string
+		fragments []string
+		char      rune
+		fail      string
+	}{
+		{source: `"a\tb\nc"`, raw: `a\tb\nc`, fragments: []string{"a\tb\nc"}},
+		{source: `"\"quoted\" \\"`, raw: `\"quoted\" \\`, fragments: []string{`"quoted" \`}},
+		{source: `"\x41\x7f"`, raw: `\x41\x7f`, fragments: []string{"A\x7f"}},
+		{source: `"\u{1F600} \u{e9}"`, raw: `\u{1F600} \u{e9}`, fragments: []string{"\U0001F600 é"}},
+		{source: `"\{not} {a}"`, raw: `\{not} {a}`, fragments: []string{"{not} ", "<expr>"}},
+		{source: `"abc\q"`, fail: `1:13: invalid escape sequence \q`},
+		{source: `"ab\x80"`, fail: `1:12: \x80 is out of range, must be in the range 00-7F`},
+		{source: `"\xZZ"`, fail: `1:10: \x must be followed by two hex digits`},
+		{source: `"\u1234"`, fail: `1:10: \u must be followed by a code point in the form {XXXX}`},
+		{source: `"\u{D800}"`, fail: `1:10: invalid unicode escape \u{D800}`},
+		{source: `"\u{1234567}"`, fail: `1:10: invalid unicode escape \u{1234567}, must have 1-6 hex digits`},
+		{source: `'\n'`, char: '\n'},
+		{source: `'\''`, char: '\''},
+		{source: `'\u{e9}'`, char: 'é'},
+		{source: `'\x41'`, char: 'A'},
+		{source: `'\x80'`, fail: `1:10: \x80 is out of range, must be in the range 00-7F`},
+		{source: `'\q'`, fail: `1:10: invalid escape sequence \q`},
+		{source: `'\u{e9}x'`, fail: `1:9: invalid character literal '\u{e9}x'`},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			ast, err := ParseString("let a = " + test.source + "\n")
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+			literal := ast.Declarations[0].Var.Vars[0].Default.Unary.Reference.Terminal.Literal
+			if test.char != 0 {
+				require.Equal(t, Char(test.char), *literal.Char)
+				return
+			}
+			str := literal.Str
+			require.Equal(t, test.raw, str.Raw)
+			fragments := []string{}
+			for _, fragment := range str.Fragments {
+				if fragment.Expr != nil {
+					fragments = append(fragments, "<expr>")
+				} else {
+					fragments = append(fragments, fragment.String)
+				}
+			}
+			require.Equal(t, test.fragments, fragments)
+		})
+	}
+}
+
+func TestTypeArgumentsAmbiguity(t *testing.T) {
+	tests := []struct {
+		source  string
+		generic bool
+	}{
+		{source: "List<int>()", generic: true},
+		{source: "Map<string, int>.empty()", generic: true},
+		{source: "a < b", generic: false},
+		{source: "a < b > c", generic: false},
+		{source: "f(a < b, c > d)", generic: false},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			ast, err := ParseString("let a = " + test.source + "\n")
+			require.NoError(t, err)
+			generic := false
+			err = VisitFunc(ast, func(node Node, next Next) error {
+				if ref, ok := node.(*ReferenceNext); ok && ref.Specialisation != nil {
+					generic = true
+				}
+				return next(nil)
+			})
+			require.NoError(t, err)
+			require.Equal(t, test.generic, generic)
+		})
+	}
+}
+
+func TestNewExpr(t *testing.T) {
+	ast, err := ParseString(`let a = new Pair<string, int>("a", 1)` + "\n")
+	require.NoError(t, err)
+	expr := ast.Declarations[0].Var.Vars[0].Default.Unary.Reference.Terminal.New
+	require.NotNil(t, expr)
+	require.Equal(t, "Pair", expr.Type.Terminal.Ident)
+	require.NotNil(t, expr.Type.Next.Specialisation)
+	require.Nil(t, expr.Type.Next.Next)
+	require.NotNil(t, expr.Call)
+	require.Len(t, expr.Call.Parameters, 2)
+
+	ast, err = ParseString("let a = new Foo\n")
+	require.NoError(t, err)
+	expr = ast.Declarations[0].Var.Vars[0].Default.Unary.Reference.Terminal.New
+	require.Nil(t, expr.Call)
+
+	ast, err = ParseString("let a = new foo.Foo(1).bar(2)\n")
+	require.NoError(t, err)
+	ref := ast.Declarations[0].Var.Vars[0].Default.Unary.Reference
+	expr = ref.Terminal.New
+	require.Equal(t, "foo", expr.Type.Terminal.Ident)
+	require.Equal(t, "Foo", expr.Type.Next.Reference.Ident)
+	require.Nil(t, expr.Type.Next.Next)
+	require.Len(t, expr.Call.Parameters, 1)
+	require.Equal(t, "bar", ref.Next.Reference.Ident)
+	require.Len(t, ref.Next.Next.Call.Parameters, 1)
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{source: "a + b * c", expected: "(a + (b * c))"},
+		{source: "a < b && c > d || e", expected: "(((a < b) && (c > d)) || e)"},
+		{source: "a + 1 == b", expected: "((a + 1) == b)"},
+		{source: "a < b < c", expected: "((a < b) && (b < c))"},
+		{source: "a < b <= c == d", expected: "(((a < b) && (b <= c)) && (c == d))"},
+		{source: "x && a < b < c", expected: "(x && ((a < b) && (b < c)))"},
+		{source: "(a < b) == c", expected: "((a < b) == c)"},
+	}
+	// Chained comparisons are described as the comparisons they are true for.
+	var describe func(e *Expr) string
+	describe = func(e *Expr) string {
+		e, _ = Unchain(e)
+		if e.Unary != nil {
+			if tuple := e.Unary.Reference.Terminal.Tuple; len(tuple) == 1 {
+				return describe(tuple[0])
+			}
+			if literal := e.Unary.Reference.Terminal.Literal; literal != nil {
+				return literal.Number.String()
+			}
+			return e.Unary.Reference.Terminal.Ident
+		}
+		return "(" + describe(e.Left) + " " + e.Op.String() + " " + describe(e.Right) + ")"
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			ast, err := ParseString("let v = " + test.source + "\n")
+			require.NoError(t, err)
+			require.Equal(t, test.expected, describe(ast.Declarations[0].Var.Vars[0].Default))
+		})
+	}
+	// Every pair of operators associates as their precedence dictates.
+	for _, left := range BinaryOperators() {
+		for _, right := range BinaryOperators() {
+			if isComparison(left) && isComparison(right) {
+				continue
+			}
+			l, _ := BinaryPrecedence(left)
+			r, _ := BinaryPrecedence(right)
+			source := fmt.Sprintf("a %s b %s c", left, right)
+			expected := fmt.Sprintf("((a %s b) %s c)", left, right)
+			if r.Priority > l.Priority || (r.Priority == l.Priority && r.RightAssociative) {
+				expected = fmt.Sprintf("(a %s (b %s c))", left, right)
+			}
+			ast, err := ParseString("let v = " + source + "\n")
+			require.NoError(t, err, source)
+			require.Equal(t, expected, describe(ast.Declarations[0].Var.Vars[0].Default), source)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	tests := []struct {
+		source   string
+		module   string
+		file     string
+		symbols  []string
+		wildcard bool
+		fail     string
+	}{
+		{source: `import "foo/bar"`, module: "foo.bar", file: "foo/bar.langx"},
+		{source: `import fb "foo/bar"`, module: "foo.bar", file: "foo/bar.langx"},
+		{source: `import foo.bar`, module: "foo.bar", file: "foo/bar.langx"},
+		{source: `import foo.bar.{Baz, Waz}`, module: "foo.bar", file: "foo/bar.langx", symbols: []string{"Baz", "Waz"}},
+		{source: `import foo.*`, module: "foo", file: "foo.langx", wildcard: true},
+		{source: `import foo.{}`, fail: `2:13: expected imported symbol but got "}"`},
+		{source: `import foo.{a b}`, fail: `2:15: expected "," or "}" but got "b"`},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			ast, err := ParseString("module test\n" + test.source + "\n")
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "test", ast.Module.Name)
+			imp := ast.Declarations[0].Import
+			require.Equal(t, test.module, imp.Module())
+			require.Equal(t, test.file, imp.File())
+			if imp.Qualified != nil {
+				require.Equal(t, test.symbols, imp.Qualified.Symbols)
+				require.Equal(t, test.wildcard, imp.Qualified.Wildcard)
+			}
+		})
+	}
+}
+
+func TestKeywordAliases(t *testing.T) {
+	ast, err := ParseString(`
+		func f(a: int): int {
+			var b = a
+			return b
+		}
+	`, KeywordAlias("func", "fn"), KeywordAlias("var", "let"))
+	require.NoError(t, err)
+	fn := ast.Declarations[0].Func
+	require.NotNil(t, fn)
+	require.Equal(t, "f", fn.Name)
+	require.Equal(t, "b", fn.Body.Statements[0].VarDecl.Vars[0].Name)
+	require.Equal(t, 3, fn.Body.Statements[0].Pos.Line)
+
+	_, err = ParseString(`fn f() {}`, KeywordAlias("fn", "fn"))
+	require.EqualError(t, err, `keyword alias "fn" must be an identifier`)
+
+	_, err = ParseString(`fn f() {}`, KeywordAlias("def", "fn let"))
+	require.EqualError(t, err, `invalid keyword "fn let" for alias "def"`)
+
+	_, err = ParseString(`fn f() {}`, KeywordAlias("def", "foo"))
+	require.EqualError(t, err, `invalid keyword "foo" for alias "def"`)
+
+	_, err = ParseString(`fn f() {}`, KeywordAlias("def", "+"))
+	require.EqualError(t, err, `invalid keyword "+" for alias "def"`)
+
+	ast, err = ParseString(`
+		public func f(): int {
+			give 1
+		}
+	`, KeywordAlias("public", "pub"), KeywordAlias("func", "fn"), KeywordAlias("give", "return"))
+	require.NoError(t, err)
+	require.NotNil(t, ast.Declarations[0].Func.Body.Statements[0].Return)
+}
+
+func TestEmbedded(t *testing.T) {
+	ast, err := ParseString("let q = sql`\n  SELECT *\n  FROM users`\nlet n = 1\n")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(ast.Declarations))
+	embedded := ast.Declarations[0].Var.Vars[0].Default.Unary.Reference.Terminal.Literal.Embedded
+	require.NotNil(t, embedded)
+	require.Equal(t, "sql", embedded.Tag)
+	require.Equal(t, "\n  SELECT *\n  FROM users", embedded.Content)
+	require.Equal(t, "1:9", embedded.Pos.String())
+	require.Equal(t, "1:13", embedded.ContentPos.String())
+	require.Equal(t, "3:3", embedded.PositionOf(strings.Index(embedded.Content, "FROM")).String())
+}
+
+func TestTemplate(t *testing.T) {
+	ast, err := ParseString(`let a = html"<p>{name}</p>\n"` + "\n")
+	require.NoError(t, err)
+	template := ast.Declarations[0].Var.Vars[0].Default.Unary.Reference.Terminal.Literal.Template
+	require.NotNil(t, template)
+	require.Equal(t, "html", template.Tag)
+	require.Equal(t, "1:9", template.Pos.String())
+	require.Equal(t, "1:13", template.Str.Pos.String())
+	require.Equal(t, 3, len(template.Str.Fragments))
+	require.Equal(t, "<p>", template.Str.Fragments[0].String)
+	require.NotNil(t, template.Str.Fragments[1].Expr)
+	require.Equal(t, "</p>\n", template.Str.Fragments[2].String)
+
+	_, err = ParseString(`let a = html"<p>\q</p>"` + "\n")
+	require.EqualError(t, err, `1:17: invalid escape sequence \q`)
+}
+
+func TestEndPositions(t *testing.T) {
+	source := `module test.mod
+import a.b.{c, d}
+@deprecated("old")
+class Box<T: Comparable<T>> {
+	fn get(): T? {
+		return nil
+	}
+}
+class Empty {}
+enum Shape {
+	case Circle(float)
+	case Square
+	case Point(x: int, y: int)
+}
+enum Code {
+	case OK = 200
+}
+#if !target(js) {
+	fn g() {}
+} #else {}
+fn f(shape: Shape): int {
+	outer: for item in [1, 2] {
+		switch shape {
+		case .Circle(r):
+			break outer
+		case .Point(let px, _):
+		default:
+		}
+	}
+	let [x, ...rest] = [1]
+	let doubled = rest.map { y -> y * 2 }
+	let curried: fn(int): fn() = g
+	return f(shape, {"a": 1})
+}
+`
+	ast, err := ParseString(source)
+	require.NoError(t, err)
+	actual := map[string]bool{}
+	err = VisitFunc(ast, func(node Node, next Next) error {
+		if node.EndPosition().Line != 0 {
+			actual[fmt.Sprintf("%T %s", node, source[node.Position().Offset:node.EndPosition().Offset])] = true
+		}
+		return next(nil)
+	})
+	require.NoError(t, err)
+	expected := []string{
+		"*parser.ModuleDecl module test.mod",
+		"*parser.ImportDecl import a.b.{c, d}",
+		`*parser.Annotation @deprecated("old")`,
+		"*parser.NamedTypeDecl Box<T: Comparable<T>>",
+		"parser.TypeParamDecl T: Comparable<T>",
+		"*parser.Reference T?",
+		"*parser.FuncDecl fn get(): T? {\n\t\treturn nil\n\t}",
+		"*parser.ClassDecl class Empty {}",
+		"*parser.CaseDecl case Circle(float)",
+		"*parser.CaseDecl case Square",
+		"*parser.CaseDecl case Point(x: int, y: int)",
+		"*parser.CaseField y: int",
+		"*parser.CaseDecl case OK = 200",
+		"parser.EnumCase .Point(let px, _)",
+		"*parser.CondDecl #if !target(js) {\n\tfn g() {}\n} #else {}",
+		"parser.Stmt outer: for item in [1, 2] {\n\t\tswitch shape {\n\t\tcase .Circle(r):\n\t\t\tbreak outer\n\t\tcase .Point(let px, _):\n\t\tdefault:\n\t\t}\n\t}",
+		"parser.ArrayLiteral [1, 2]",
+		"parser.CaseStmt case .Circle(r):\n\t\t\tbreak outer",
+		"parser.EnumCase .Circle(r)",
+		"parser.BreakStmt break outer",
+		"parser.CaseStmt default:",
+		"*parser.Pattern [x, ...rest]",
+		"parser.Call { y -> y * 2 }",
+		"*parser.Closure { y -> y * 2 }",
+		"*parser.FuncType fn(int): fn()",
+		"*parser.FuncType fn()",
+		`*parser.Reference f(shape, {"a": 1})`,
+		`parser.Call (shape, {"a": 1})`,
+		`parser.DictOrSetLiteral {"a": 1}`,
+		"parser.Block {}",
+	}
+	for _, node := range expected {
+		require.True(t, actual[node], "%q not found", node)
+	}
+	require.Equal(t, lexer.Position{Offset: len(source) - 1, Line: 34, Column: 2}, ast.EndPos)
+}
+
+func TestNodeAt(t *testing.T) {
+	source := `fn f(a: int): int {
+	if a > 1 {
+		return f(a - 1) * 2
+	}
+	return 1
+}
+`
+	ast, err := ParseString(source)
+	require.NoError(t, err)
+	tests := []struct {
+		line, column int
+		node         string
+		path         string
+	}{
+		{line: 1, column: 1, node: "*parser.FuncDecl",
+			path: "*parser.AST *parser.RootDecl"},
+		{line: 1, column: 9, node: "parser.Terminal",
+			path: "*parser.AST *parser.RootDecl *parser.FuncDecl parser.Parameters *parser.Reference"},
+		{line: 2, column: 5, node: "parser.Terminal",
+			path: "*parser.AST *parser.RootDecl *parser.FuncDecl parser.Block parser.Stmt parser.IfStmt *parser.Expr *parser.Expr *parser.Unary *parser.Reference"},
+		{line: 2, column: 7, node: "*parser.Expr",
+			path: "*parser.AST *parser.RootDecl *parser.FuncDecl parser.Block parser.Stmt parser.IfStmt"},
+		{line: 3, column: 12, node: "parser.Terminal",
+			path: "*parser.AST *parser.RootDecl *parser.FuncDecl parser.Block parser.Stmt parser.IfStmt parser.Block parser.Stmt parser.ReturnStmt *parser.Expr *parser.Expr *parser.Unary *parser.Reference *parser.ReferenceNext parser.Call *parser.Expr *parser.Expr *parser.Unary *parser.Reference"},
+		{line: 3, column: 17, node: "parser.Call",
+			path: "*parser.AST *parser.RootDecl *parser.FuncDecl parser.Block parser.Stmt parser.IfStmt parser.Block parser.Stmt parser.ReturnStmt *parser.Expr *parser.Expr *parser.Unary *parser.Reference *parser.ReferenceNext"},
+		{line: 4, column: 2, node: "parser.Block",
+			path: "*parser.AST *parser.RootDecl *parser.FuncDecl parser.Block parser.Stmt parser.IfStmt"},
+		{line: 6, column: 2, node: ""},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d:%d", test.line, test.column), func(t *testing.T) {
+			path, node := NodeAt(ast, test.line, test.column)
+			if test.node == "" {
+				require.Nil(t, node)
+				require.Empty(t, path)
+				return
+			}
+			types := []string{}
+			for _, ancestor := range path {
+				types = append(types, fmt.Sprintf("%T", ancestor))
+			}
+			require.Equal(t, test.node, fmt.Sprintf("%T", node))
+			require.Equal(t, test.path, strings.Join(types, " "))
+		})
+	}
+}
+
+func TestCloneAndEqual(t *testing.T) {
+	ast, err := ParseString(testSource)
+	require.NoError(t, err)
+	clone := Clone(ast).(*AST)
+	require.True(t, Equal(ast, clone))
+	require.Equal(t, ast, clone)
+
+	// The clone is independent of the original.
+	clone.Declarations[0].Import.Alias = "changed"
+	require.False(t, Equal(ast, clone))
+	require.Equal(t, "", ast.Declarations[0].Import.Alias)
+
+	// Positions are ignored.
+	a, err := ParseString("let a = f(1.5, [b])\n")
+	require.NoError(t, err)
+	b, err := ParseString("\n\n  let a   =   f( 1.5,[ b ] );")
+	require.NoError(t, err)
+	require.True(t, Equal(a, b))
+	require.True(t, Equal(a.Declarations[0].Var, b.Declarations[0].Var))
+	c, err := ParseString("let a = f(1.25, [b])\n")
+	require.NoError(t, err)
+	require.False(t, Equal(a, c))
+	require.False(t, Equal(a, a.Declarations[0]))
+	require.True(t, Equal(nil, nil))
+
+	// Chained comparisons share no nodes, so each is visited once.
+	chain, err := ParseString("let a = 1 < b < 3\n")
+	require.NoError(t, err)
+	exprs := 0
+	_ = VisitFunc(Clone(chain), func(node Node, next Next) error {
+		if _, ok := node.(*Expr); ok {
+			exprs++
+		}
+		return next(nil)
+	})
+	require.Equal(t, 5, exprs)
+}
+
+func TestReparse(t *testing.T) {
+	source := `module app.main
+
+import foo.bar
+
+fn f(a: int): int {
+	return a * 2
+}
+
+let x = 1 < y < 3; let z = "s{x}"
+// Comment
+class C {
+	let n: int
+}
+`
+	tests := []struct {
+		name   string
+		at     string
+		length int
+		text   string
+		// Number of leading declarations reused from the previous AST.
+		reused int
+		fail   string
+	}{
+		{name: "WithinFunction", at: "* 2", length: 3, text: "+ f(a - 1)", reused: 1},
+		{name: "AddLines", at: "return", length: 0, text: "let b = 1\n\t", reused: 1},
+		{name: "SameLine", at: `"s{x}"`, length: 1, text: `"t `, reused: 3},
+		{name: "FollowingOnSameLine", at: "y <", length: 1, text: "yy", reused: 2},
+		{name: "NewDeclaration", at: "// Comment", length: 0, text: "fn g() {}\n", reused: 4},
+		{name: "JoinDeclarations", at: "; let", length: 1, text: " ", reused: 2,
+			fail: "9:20: unexpected token \"let\" (expected \";\")"},
+		{name: "RemoveDeclaration", at: "fn f", length: len("fn f(a: int): int {\n\treturn a * 2\n}\n"), reused: 1},
+		{name: "RemoveLastDeclaration", at: "class", length: len("class C {\n\tlet n: int\n}\n"), reused: 4},
+		{name: "ModuleName", at: "main", length: 4, text: "test", reused: 0},
+		{name: "LastDeclaration", at: "n: int", length: 1, text: "m", reused: 4},
+		{name: "Unterminated", at: "fn f", length: 0, text: "/* ", reused: 0,
+			fail: "5:1: unexpected token \"/\""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			offset := strings.Index(source, test.at)
+			require.NotEqual(t, -1, offset)
+			updated := source[:offset] + test.text + source[offset+test.length:]
+			previous, err := ParseString(source)
+			require.NoError(t, err)
+			decls := append([]*RootDecl{}, previous.Declarations...)
+			expected, expectedErr := ParseString(updated)
+			actual, err := Reparse(previous, source, offset, test.length, test.text)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				require.EqualError(t, expectedErr, test.fail)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, expectedErr)
+			require.Equal(t, expected, actual)
+			for i := 0; i < test.reused; i++ {
+				require.True(t, decls[i] == actual.Declarations[i], "declaration %d was not reused", i)
+			}
+		})
+	}
+
+	// Without a module declaration, the AST starts at the first declaration.
+	previous, err := ParseString("\n\nlet a = 1\n")
+	require.NoError(t, err)
+	actual, err := Reparse(previous, "\n\nlet a = 1\n", 1, 0, "fn f() {}")
+	require.NoError(t, err)
+	expected, err := ParseString("\nfn f() {}\nlet a = 1\n")
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+
+	_, err = Reparse(&AST{}, "", 1, 0, "")
+	require.EqualError(t, err, "edit of 0 bytes at offset 1 is outside the source")
+}
+
+func TestParseFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parser-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.langx":   "let a = 1\n",
+		"b.langx":   "fn b() {}\n",
+		"bad.langx": "let = 1\n",
+	}
+	paths := []string{}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		err = ioutil.WriteFile(path, []byte(source), 0600)
+		require.NoError(t, err)
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	paths = append(paths, filepath.Join(dir, "missing.langx"))
+
+	asts, errs := ParseFiles(paths)
+	require.Len(t, errs, 2)
+	require.EqualError(t, errs[0], filepath.Join(dir, "bad.langx")+`:1:5: unexpected token "=" (expected <ident> | "[" | "{")`)
+	require.True(t, os.IsNotExist(errors.Cause(errs[1])))
+	require.Len(t, asts, 2)
+	for _, name := range []string{"a.langx", "b.langx"} {
+		path := filepath.Join(dir, name)
+		expected, err := ParseString(files[name])
+		require.NoError(t, err)
+		require.True(t, Equal(expected, asts[path]))
+		require.Equal(t, path, asts[path].Pos.Filename)
+	}
+}
+
+func TestModifiers(t *testing.T) {
+	require.Equal(t, "", Modifiers(0).String())
+	require.Equal(t, "pub override static", (ModifierStatic | ModifierPublic | ModifierOverride).String())
+	require.True(t, (ModifierPublic | ModifierStatic).Has(ModifierStatic))
+	require.False(t, ModifierPublic.Has(ModifierPublic|ModifierStatic))
+
+	tests := []struct {
+		name   string
+		source string
+		fail   string
+	}{
+		{name: "TopLevel", source: "pub fn f() {}\npub let a = 1\npub class C {}\npub enum E { case A }\n"},
+		{name: "ClassMembers", source: `
+			class C {
+				pub static let a = 1
+				pub init() {}
+				pub static override fn f() {}
+				pub class D {}
+			}
+		`},
+		{name: "EnumMembers", source: "enum E {\n\tcase A\n\tpub static fn f() {}\n}\n"},
+		{name: "Duplicate", source: "pub static pub fn f() {}\n", fail: `1:12: duplicate modifier "pub"`},
+		{name: "StaticImport", source: "static import foo\n", fail: `1:1: "static" is not valid on imports`},
+		{name: "PublicConditional", source: "pub #if target(js) {}\n", fail: `1:1: "pub" is not valid on compile-time conditionals`},
+		{name: "OverrideFunction", source: "override fn f() {}\n", fail: `1:1: "override" is not valid on top-level declarations`},
+		{name: "OverrideField", source: "class C {\n\toverride let a = 1\n}\n", fail: `2:2: "override" is not valid on fields`},
+		{name: "StaticInitialiser", source: "class C {\n\tstatic init() {}\n}\n", fail: `2:2: "static" is not valid on initialisers`},
+		{name: "StaticNestedClass", source: "class C {\n\tstatic class D {}\n}\n", fail: `2:2: "static" is not valid on nested types`},
+		{name: "PublicCase", source: "enum E {\n\tpub case A\n}\n", fail: `2:2: "pub" is not valid on enum cases`},
+		{name: "Nested", source: "#if target(js) {\n\tstatic fn f() {}\n}\n", fail: `2:2: "static" is not valid on top-level declarations`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseString(test.source)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseDecls(t *testing.T) {
+	source := "module app.main\n\npub fn f() {}\nlet a = `raw`; let b = \"s{a}\"\n\nclass C {\n\tlet n: int\n}\n"
+	expected, err := ParseString(source)
+	require.NoError(t, err)
+	decls := []*RootDecl{}
+	module, err := ParseDecls(strings.NewReader(source), func(decl *RootDecl) error {
+		decls = append(decls, decl)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected.Module, module)
+	require.Equal(t, expected.Declarations, decls)
+
+	// Declarations are yielded until an error.
+	names := []string{}
+	_, err = ParseDecls(strings.NewReader("fn f() {}\nfn g() {}\nlet = 1\nfn h() {}\n"), func(decl *RootDecl) error {
+		names = append(names, decl.Names()...)
+		return nil
+	})
+	require.EqualError(t, err, `3:5: unexpected token "=" (expected <ident> | "[" | "{")`)
+	require.IsType(t, &Diagnostic{}, err)
+	require.Equal(t, []string{"f", "g"}, names)
+
+	stop := errors.New("stop")
+	_, err = ParseDecls(strings.NewReader("fn f() {}\nfn g() {}\n"), func(decl *RootDecl) error { return stop })
+	require.Equal(t, stop, err)
+
+	_, err = ParseDecls(strings.NewReader("static fn f() {}\n"), func(decl *RootDecl) error { return nil })
+	require.EqualError(t, err, `1:1: "static" is not valid on top-level declarations`)
+}
+
+func TestTrailingCommas(t *testing.T) {
+	lists := map[string]string{
+		"Call":            "let a = f(1, 2,)\n",
+		"Tuple":           "let a = (1, 2,)\n",
+		"Array":           "let a = [1, 2,]\n",
+		"DictOrSet":       "let a = {1, 2,}\n",
+		"TypeArguments":   "let a: Map<int, string,> = b\n",
+		"Parameters":      "fn f(a: int, b: int,) {}\n",
+		"Initialiser":     "class C {\n\tinit(a: int, b: int,) {}\n}\n",
+		"TypeParameters":  "class C<T, U,> {}\n",
+		"Annotation":      "@a(1, 2,)\nfn f() {}\n",
+		"ArrayPattern":    "let [a, b,] = c\n",
+		"DictPattern":     "let {a, b,} = c\n",
+		"ImportedSymbols": "import foo.{A, B,}\n",
+	}
+	for name, source := range lists {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseString(source)
+			require.NoError(t, err)
+			_, err = ParseString(source, TrailingCommas(TrailingCommasMultiline))
+			require.Error(t, err)
+			_, err = ParseString(source, TrailingCommas(TrailingCommasForbidden))
+			require.Error(t, err)
+		})
+	}
+
+	multiline := "let a = f(\n\t1,\n\t2,\n)\n"
+	_, err := ParseString(multiline, TrailingCommas(TrailingCommasMultiline))
+	require.NoError(t, err)
+	_, err = ParseString(multiline, TrailingCommas(TrailingCommasForbidden))
+	require.EqualError(t, err, "3:3: trailing comma is not allowed")
+	_, err = ParseString("let a = [1, 2,]\n", TrailingCommas(TrailingCommasMultiline))
+	require.EqualError(t, err, `1:14: trailing comma is only allowed before a closing "]" on a new line`)
+
+	// A comma is only accepted after an element.
+	for _, source := range []string{"let a = f(,)\n", "let a = [,]\n", "fn f(,) {}\n"} {
+		_, err = ParseString(source)
+		require.Error(t, err, source)
+	}
+
+	_, err = ParseDecls(strings.NewReader("fn f() {}\nlet a = [1,]\n"), func(*RootDecl) error { return nil },
+		TrailingCommas(TrailingCommasForbidden))
+	require.EqualError(t, err, "2:11: trailing comma is not allowed")
+}
+
+func TestASTVersion(t *testing.T) {
+	// The fixtures of every earlier version must decode to what their source
+	// parses to now.
+	fixtures, err := filepath.Glob("testdata/ast/*.json")
+	require.NoError(t, err)
+	require.Contains(t, fixtures, filepath.Join("testdata", "ast", ASTVersion+".json"), "missing fixture for the current AST version")
+	for _, fixture := range fixtures {
+		version := strings.TrimSuffix(filepath.Base(fixture), ".json")
+		t.Run(version, func(t *testing.T) {
+			r, err := os.Open(fixture)
+			require.NoError(t, err)
+			defer r.Close()
+			decoded, err := DecodeAST(r)
+			require.NoError(t, err)
+			source, err := os.Open(strings.TrimSuffix(fixture, ".json") + ".langx")
+			require.NoError(t, err)
+			defer source.Close()
+			parsed, err := Parse(source)
+			require.NoError(t, err)
+			require.True(t, Equal(parsed, decoded))
+			require.Equal(t, parsed.EndPos, decoded.EndPos)
+		})
+	}
+
+	ast, err := ParseString(testSource)
+	require.NoError(t, err)
+	w := &strings.Builder{}
+	require.NoError(t, EncodeAST(w, ast))
+	decoded, err := DecodeAST(strings.NewReader(w.String()))
+	require.NoError(t, err)
+	require.True(t, Equal(ast, decoded))
+
+	for _, version := range []string{"0.9", "1.99", "2.0", "1", "1.0.1", "v1.0", ""} {
+		encoded := strings.Replace(w.String(), `"version":"`+ASTVersion+`"`, `"version":"`+version+`"`, 1)
+		_, err = DecodeAST(strings.NewReader(encoded))
+		require.Error(t, err, version)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ast, err := ParseString(testSource)
+	require.NoError(t, err)
+	require.NoError(t, Validate(ast))
+
+	pos := lexer.Position{Line: 2, Column: 1}
+	tests := []struct {
+		name string
+		node Node
+		fail string
+	}{
+		{name: "Empty", node: &AST{Declarations: []*RootDecl{{Mixin: Mixin{Pos: pos}}}},
+			fail: "2:1: invalid RootDecl: exactly one of Class, Import, Enum, Var, Func or Cond must be set"},
+		{name: "Ambiguous", node: &RootDecl{Mixin: Mixin{Pos: pos}, Func: &FuncDecl{Name: "f"}, Var: &VarDecl{}},
+			fail: "2:1: invalid RootDecl: exactly one of Class, Import, Enum, Var, Func or Cond must be set"},
+		{name: "Nested", node: &RootDecl{Func: &FuncDecl{Name: "f", Body: &Block{Statements: []*Stmt{{Mixin: Mixin{Pos: pos}}}}}},
+			fail: "2:1: invalid Stmt: exactly one of Return, If, Break, Continue, For, Switch, Block, VarDecl, FuncDecl, ClassDecl, EnumDecl or ExprStmt must be set"},
+		{name: "Member", node: &EnumDecl{Type: &NamedTypeDecl{Type: "E"}, Members: []*EnumMember{{Mixin: Mixin{Pos: pos}}}},
+			fail: "2:1: invalid EnumMember: exactly one of CaseDecl or FuncDecl must be set"},
+		{name: "Chain", node: &Expr{Mixin: Mixin{Pos: pos}, Left: &Expr{Unary: &Unary{}}, Op: OpLt, Right: &Expr{Unary: &Unary{}}, Chained: true},
+			fail: "2:1: invalid Expr: a chained comparison must extend a comparison"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.EqualError(t, Validate(test.node), test.fail)
+		})
+	}
+
+	// Walking invalid nodes fails rather than panicking.
+	invalid := &AST{Declarations: []*RootDecl{{Mixin: Mixin{Pos: pos}}}}
+	err = VisitFunc(invalid, func(node Node, next Next) error { return next(nil) })
+	require.EqualError(t, err, tests[0].fail)
+	require.Panics(t, func() { invalid.Decls() })
+
+	// Describing invalid nodes doesn't panic either.
+	require.Equal(t, "invalid type", (&TypeDecl{}).String())
+	require.Equal(t, "invalid terminal", (&Terminal{}).Describe())
+	require.Equal(t, "invalid reference call", (&ReferenceNext{Next: &ReferenceNext{Call: &Call{}}}).Describe())
+	require.Equal(t, "invalid literal", (&Literal{}).Describe())
+}
+
+// Records the scopes entered and left, and the depth of each.
+type scopeWalker struct {
+	scope  string
+	depth  int
+	scopes *[]string
+}
+
+func (s scopeWalker) Visit(node Node) Walker {
+	name := ""
+	switch node := node.(type) {
+	case nil:
+		if s.scope != "" {
+			*s.scopes = append(*s.scopes, fmt.Sprintf("%d:/%s", s.depth-1, s.scope))
+		}
+		return nil
+
+	case *FuncDecl:
+		name = node.Name
+
+	case *ClassDecl:
+		name = node.Type.Type
+
+	case *EnumDecl:
+		// Prune.
+		return nil
+
+	default:
+		return scopeWalker{depth: s.depth, scopes: s.scopes}
+	}
+	*s.scopes = append(*s.scopes, fmt.Sprintf("%d:%s", s.depth, name))
+	return scopeWalker{scope: name, depth: s.depth + 1, scopes: s.scopes}
+}
+
+func TestWalk(t *testing.T) {
+	ast, err := ParseString(`
+class C {
+	fn f() {
+		fn g() {}
+	}
+	fn h() {}
+}
+enum E {
+	fn i() {}
+}
+fn j() {}
+`)
+	require.NoError(t, err)
+	scopes := []string{}
+	require.NoError(t, Walk(scopeWalker{scopes: &scopes}, ast))
+	require.Equal(t, []string{
+		"0:C", "1:f", "2:g", "2:/g", "1:/f", "1:h", "1:/h", "0:/C",
+		"0:j", "0:/j",
+	}, scopes)
+
+	invalid := &AST{Declarations: []*RootDecl{{}}}
+	require.Error(t, Walk(scopeWalker{scopes: &scopes}, invalid))
+}
+
+func TestInspect(t *testing.T) {
+	ast, err := ParseString(`
+class C {
+	fn f() {
+		return 1
+	}
+}
+enum E {
+	case a
+}
+`)
+	require.NoError(t, err)
+	paths := []string{}
+	require.NoError(t, Inspect(ast, func(node Node, ancestors []Node) bool {
+		switch node.(type) {
+		case ReturnStmt, *CaseDecl:
+			path := []string{}
+			for _, ancestor := range ancestors {
+				path = append(path, strings.TrimPrefix(strings.TrimPrefix(fmt.Sprintf("%T", ancestor), "*"), "parser."))
+			}
+			paths = append(paths, strings.Join(path, " "))
+
+		case *EnumDecl:
+			// Prune, but only once the enum itself has been seen.
+			paths = append(paths, fmt.Sprintf("%d", len(ancestors)))
+			return false
+		}
+		return true
+	}))
+	require.Equal(t, []string{
+		"AST RootDecl ClassDecl ClassMember FuncDecl Block Stmt",
+		"2",
+	}, paths)
+
+	invalid := &AST{Declarations: []*RootDecl{{}}}
+	require.Error(t, Inspect(invalid, func(Node, []Node) bool { return true }))
+}
+
+func BenchmarkVisitFunc(b *testing.B) {
+	ast, err := ParseString(testSource)
+	require.NoError(b, err)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = VisitFunc(ast, func(node Node, next Next) error { return next(nil) })
+	}
+}
@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"math/big"
+	"reflect"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+var (
+	positionType = reflect.TypeOf(lexer.Position{})
+	bigFloatType = reflect.TypeOf(big.Float{})
+)
+
+// Clone returns a deep copy of node.
+//
+// Nodes shared within node are also shared within the copy.
+func Clone(node Node) Node {
+	if node == nil {
+		return nil
+	}
+	c := &cloner{seen: map[cloned]reflect.Value{}}
+	return c.clone(reflect.ValueOf(node)).Interface().(Node)
+}
+
+type cloned struct {
+	typ reflect.Type
+	ptr uintptr
+}
+
+type cloner struct {
+	seen map[cloned]reflect.Value
+}
+
+func (c *cloner) clone(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := cloned{v.Type(), v.Pointer()}
+		if out, ok := c.seen[key]; ok {
+			return out
+		}
+		out := reflect.New(v.Type().Elem())
+		c.seen[key] = out
+		out.Elem().Set(c.clone(v.Elem()))
+		return out
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(c.clone(v.Elem()))
+		return out
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(c.clone(v.Index(i)))
+		}
+		return out
+
+	case reflect.Struct:
+		if v.Type() == bigFloatType {
+			f := v.Interface().(big.Float)
+			return reflect.ValueOf(new(big.Float).Copy(&f)).Elem()
+		}
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			out.Field(i).Set(c.clone(v.Field(i)))
+		}
+		return out
+	}
+	return v
+}
+
+// Equal returns true if a and b are structurally identical, ignoring positions.
+func Equal(a, b Node) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return equal(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+func equal(a, b reflect.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() && b.IsNil()
+		}
+		return equal(a.Elem(), b.Elem())
+
+	case reflect.Slice:
+		// Empty and nil slices are equivalent, as participle does not
+		// distinguish them.
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equal(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Struct:
+		switch a.Type() {
+		case positionType:
+			return true
+
+		case bigFloatType:
+			af, bf := a.Interface().(big.Float), b.Interface().(big.Float)
+			return af.Cmp(&bf) == 0
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !equal(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return a.Interface() == b.Interface()
+}
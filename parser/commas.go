@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+)
+
+// TrailingCommaPolicy determines whether a comma may follow the last element
+// of a bracketed list, such as the arguments of a call or the elements of an
+// array.
+type TrailingCommaPolicy int
+
+const (
+	// TrailingCommasAllowed accepts trailing commas in any list. This is the
+	// default.
+	TrailingCommasAllowed TrailingCommaPolicy = iota
+	// TrailingCommasMultiline only accepts trailing commas in lists that are
+	// closed on a later line than their last element.
+	TrailingCommasMultiline
+	// TrailingCommasForbidden rejects all trailing commas.
+	TrailingCommasForbidden
+)
+
+// TrailingCommas sets the policy for trailing commas.
+func TrailingCommas(policy TrailingCommaPolicy) Option {
+	return func(o *options) error {
+		o.trailingCommas = policy
+		return nil
+	}
+}
+
+// Check the trailing commas of lists in tokens against policy.
+//
+// Every list production accepts a trailing comma, so one is any comma
+// followed by a closing bracket.
+func checkTrailingCommas(tokens []lexer.Token, policy TrailingCommaPolicy) error {
+	if policy == TrailingCommasAllowed {
+		return nil
+	}
+	for i := 0; i+1 < len(tokens); i++ {
+		comma, closing := tokens[i], tokens[i+1]
+		if comma.Value != "," {
+			continue
+		}
+		switch closing.Value {
+		case ")", "]", "}", ">":
+		default:
+			continue
+		}
+		if policy == TrailingCommasMultiline && closing.Pos.Line > comma.Pos.Line {
+			continue
+		}
+		if policy == TrailingCommasMultiline {
+			return participle.Errorf(comma.Pos, "trailing comma is only allowed before a closing %q on a new line", closing.Value)
+		}
+		return participle.Errorf(comma.Pos, "trailing comma is not allowed")
+	}
+	return nil
+}
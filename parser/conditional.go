@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"github.com/alecthomas/participle"
+)
+
+// BuildConfig is the set of symbols that compile-time conditionals are evaluated against.
+type BuildConfig struct {
+	// Target backend, eg. "wat" or "js".
+	Target string
+	// Edition of the language.
+	Edition string
+	// Features explicitly enabled for this build.
+	Features []string
+}
+
+func (b BuildConfig) hasFeature(feature string) bool {
+	for _, f := range b.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// CondDecl is a compile-time conditional in the form:
+//
+//	#if target(js) {
+//	    ...
+//	} #else {
+//	    ...
+//	}
+//
+// Both branches are always parsed, but only the selected branch is retained
+// by ApplyConditionals.
+type CondDecl struct {
+	Mixin
+
+	Condition *CondExpr   `"#" "if" @@ "{"`
+	Then      []*RootDecl `@@* "}"`
+	Else      []*RootDecl `( "#" "else" "{" @@* "}" )?`
+}
+
+func (c *CondDecl) accept(visitor VisitorFunc) error {
+	return visitor(c, func(err error) error {
+		if err != nil {
+			return err
+		}
+		for _, decl := range c.Then {
+			if err = VisitFunc(decl, visitor); err != nil {
+				return err
+			}
+		}
+		for _, decl := range c.Else {
+			if err = VisitFunc(decl, visitor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *CondDecl) decl() {}
+
+// CondExpr is a compile-time condition in the form [!]<kind>(<value>)
+//
+// Where <kind> is one of "target", "edition" or "feature".
+type CondExpr struct {
+	Mixin
+
+	Not   bool   `@"!"?`
+	Kind  string `@Ident "("`
+	Value string `@Ident ")"`
+}
+
+// Eval evaluates the condition against the build configuration.
+func (c *CondExpr) Eval(config BuildConfig) (bool, error) {
+	var result bool
+	switch c.Kind {
+	case "target":
+		result = config.Target == c.Value
+
+	case "edition":
+		result = config.Edition == c.Value
+
+	case "feature":
+		result = config.hasFeature(c.Value)
+
+	default:
+		return false, participle.Errorf(c.Pos, "unknown compile-time condition %q", c.Kind)
+	}
+	return result != c.Not, nil
+}
+
+// ApplyConditionals evaluates all top-level compile-time conditionals against config,
+// splicing the selected branches into the AST in place.
+func (a *AST) ApplyConditionals(config BuildConfig) error {
+	decls, err := applyConditionals(a.Declarations, config)
+	if err != nil {
+		return err
+	}
+	a.Declarations = decls
+	return nil
+}
+
+func applyConditionals(decls []*RootDecl, config BuildConfig) ([]*RootDecl, error) {
+	out := make([]*RootDecl, 0, len(decls))
+	for _, decl := range decls {
+		if decl.Cond == nil {
+			out = append(out, decl)
+			continue
+		}
+		ok, err := decl.Cond.Condition.Eval(config)
+		if err != nil {
+			return nil, err
+		}
+		selected := decl.Cond.Else
+		if ok {
+			selected = decl.Cond.Then
+		}
+		selected, err = applyConditionals(selected, config)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, selected...)
+	}
+	return out, nil
+}
@@ -0,0 +1,227 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+)
+
+// Severity of a Diagnostic.
+//
+// Values match those of the Language Server Protocol.
+type Severity int
+
+const (
+	SeverityError Severity = iota + 1
+	SeverityWarning
+	SeverityInfo
+	SeverityHint
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	case SeverityHint:
+		return "hint"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// MarshalText renders the severity by name.
+func (s Severity) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// Diagnostic is a finding reported by any pass, from syntax errors to lint.
+//
+// Diagnostic implements error, formatted in the same way as participle errors.
+type Diagnostic struct {
+	Severity Severity
+	// Code is a stable identifier for the kind of finding, eg. "unused-variable".
+	Code    string
+	Message string
+	Pos     lexer.Position
+	// EndPos is the end of the offending source, if known.
+	EndPos lexer.Position
+	// RelatedInfo points to other source relevant to the diagnostic.
+	RelatedInfo []RelatedInfo
+	// SuggestedFix resolves the diagnostic, if one is known.
+	SuggestedFix *Fix
+}
+
+// RelatedInfo is a source position relevant to a diagnostic, eg. a previous declaration.
+type RelatedInfo struct {
+	Pos     lexer.Position
+	Message string
+}
+
+// Fix is a suggested change resolving a diagnostic.
+type Fix struct {
+	Description string
+	Edits       []Edit
+}
+
+// Edit replaces the source from Pos up to EndPos with Text.
+type Edit struct {
+	Pos    lexer.Position
+	EndPos lexer.Position
+	Text   string
+}
+
+func (d Diagnostic) Error() string { return lexer.FormatError(d.Pos, d.Message) }
+
+// String renders the diagnostic as a line of text, eg.
+//
+//	main.langx:3:5: warning: "a" is declared but never used [unused-variable]
+func (d Diagnostic) String() string {
+	out := fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+	if d.Code != "" {
+		out += " [" + d.Code + "]"
+	}
+	return out
+}
+
+// ToDiagnostic converts an error to an error Diagnostic, retaining the
+// position of participle errors.
+func ToDiagnostic(err error) *Diagnostic {
+	switch err := err.(type) {
+	case *Diagnostic:
+		return err
+
+	case Diagnostic:
+		return &err
+
+	case participle.Error:
+		return &Diagnostic{Severity: SeverityError, Message: err.Message(), Pos: err.Token().Pos}
+	}
+	return &Diagnostic{Severity: SeverityError, Message: err.Error()}
+}
+
+// Diagnostics is a collection of diagnostics.
+type Diagnostics []Diagnostic
+
+// Sort diagnostics by file and position, then by severity.
+func (d Diagnostics) Sort() {
+	sort.SliceStable(d, func(i, j int) bool {
+		a, b := d[i], d[j]
+		switch {
+		case a.Pos.Filename != b.Pos.Filename:
+			return a.Pos.Filename < b.Pos.Filename
+		case a.Pos.Offset != b.Pos.Offset:
+			return a.Pos.Offset < b.Pos.Offset
+		}
+		return a.Severity < b.Severity
+	})
+}
+
+// HasErrors returns true if any diagnostic has SeverityError.
+func (d Diagnostics) HasErrors() bool {
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes each diagnostic as a line of text, followed by any related information.
+func (d Diagnostics) WriteText(w io.Writer) error {
+	for _, diagnostic := range d {
+		if _, err := fmt.Fprintln(w, diagnostic.String()); err != nil {
+			return err
+		}
+		for _, related := range diagnostic.RelatedInfo {
+			if _, err := fmt.Fprintf(w, "  %s: %s\n", related.Pos, related.Message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the diagnostics as a JSON array.
+func (d Diagnostics) WriteJSON(w io.Writer) error {
+	out := make([]jsonDiagnostic, 0, len(d))
+	for _, diagnostic := range d {
+		jd := jsonDiagnostic{
+			Severity: diagnostic.Severity,
+			Code:     diagnostic.Code,
+			Message:  diagnostic.Message,
+			Pos:      toJSONPosition(diagnostic.Pos),
+			EndPos:   toJSONPosition(diagnostic.EndPos),
+		}
+		for _, related := range diagnostic.RelatedInfo {
+			jd.RelatedInfo = append(jd.RelatedInfo, jsonRelatedInfo{Pos: toJSONPosition(related.Pos), Message: related.Message})
+		}
+		if fix := diagnostic.SuggestedFix; fix != nil {
+			jd.SuggestedFix = &jsonFix{Description: fix.Description}
+			for _, edit := range fix.Edits {
+				jd.SuggestedFix.Edits = append(jd.SuggestedFix.Edits, jsonEdit{
+					Pos:    toJSONPosition(edit.Pos),
+					EndPos: toJSONPosition(edit.EndPos),
+					Text:   edit.Text,
+				})
+			}
+		}
+		out = append(out, jd)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func (d Diagnostics) Error() string {
+	lines := make([]string, 0, len(d))
+	for _, diagnostic := range d {
+		lines = append(lines, diagnostic.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type jsonPosition struct {
+	File   string `json:"file,omitempty"`
+	Offset int    `json:"offset"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+func toJSONPosition(pos lexer.Position) *jsonPosition {
+	if pos == (lexer.Position{}) {
+		return nil
+	}
+	return &jsonPosition{File: pos.Filename, Offset: pos.Offset, Line: pos.Line, Column: pos.Column}
+}
+
+type jsonRelatedInfo struct {
+	Pos     *jsonPosition `json:"pos"`
+	Message string        `json:"message"`
+}
+
+type jsonEdit struct {
+	Pos    *jsonPosition `json:"pos"`
+	EndPos *jsonPosition `json:"endPos"`
+	Text   string        `json:"text"`
+}
+
+type jsonFix struct {
+	Description string     `json:"description"`
+	Edits       []jsonEdit `json:"edits"`
+}
+
+type jsonDiagnostic struct {
+	Severity     Severity          `json:"severity"`
+	Code         string            `json:"code,omitempty"`
+	Message      string            `json:"message"`
+	Pos          *jsonPosition     `json:"pos,omitempty"`
+	EndPos       *jsonPosition     `json:"endPos,omitempty"`
+	RelatedInfo  []jsonRelatedInfo `json:"relatedInfo,omitempty"`
+	SuggestedFix *jsonFix          `json:"suggestedFix,omitempty"`
+}
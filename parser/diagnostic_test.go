@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseErrorIsDiagnostic(t *testing.T) {
+	_, err := ParseString("let a = ")
+	require.Error(t, err)
+	diagnostic, ok := err.(*Diagnostic)
+	require.True(t, ok, "%T", err)
+	require.Equal(t, SeverityError, diagnostic.Severity)
+	require.Equal(t, 1, diagnostic.Pos.Line)
+	require.Equal(t, lexer.FormatError(diagnostic.Pos, diagnostic.Message), err.Error())
+}
+
+func TestToDiagnostic(t *testing.T) {
+	require.Equal(t, &Diagnostic{Severity: SeverityError, Message: "boom"}, ToDiagnostic(errors.New("boom")))
+	diagnostic := &Diagnostic{Severity: SeverityWarning, Message: "careful"}
+	require.Equal(t, diagnostic, ToDiagnostic(diagnostic))
+}
+
+func TestDiagnostics(t *testing.T) {
+	diagnostics := Diagnostics{
+		{Severity: SeverityWarning, Code: "unused-variable", Message: `"a" is declared but never used`,
+			Pos: lexer.Position{Filename: "b.langx", Offset: 4, Line: 1, Column: 5}},
+		{Severity: SeverityError, Message: "missing return",
+			Pos: lexer.Position{Filename: "a.langx", Offset: 10, Line: 2, Column: 1},
+			RelatedInfo: []RelatedInfo{
+				{Pos: lexer.Position{Filename: "a.langx", Offset: 20, Line: 3, Column: 3}, Message: "path ends without returning"},
+			}},
+		{Severity: SeverityHint, Code: "spelling", Message: `"vaule" is misspelt`,
+			Pos:    lexer.Position{Filename: "a.langx", Offset: 10, Line: 2, Column: 1},
+			EndPos: lexer.Position{Filename: "a.langx", Offset: 15, Line: 2, Column: 6},
+			SuggestedFix: &Fix{Description: `Replace with "value"`, Edits: []Edit{{
+				Pos:    lexer.Position{Filename: "a.langx", Offset: 10, Line: 2, Column: 1},
+				EndPos: lexer.Position{Filename: "a.langx", Offset: 15, Line: 2, Column: 6},
+				Text:   "value",
+			}}}},
+	}
+	require.True(t, diagnostics.HasErrors())
+	require.False(t, diagnostics[:1].HasErrors())
+
+	diagnostics.Sort()
+	w := &bytes.Buffer{}
+	err := diagnostics.WriteText(w)
+	require.NoError(t, err)
+	require.Equal(t, `a.langx:2:1: error: missing return
+  a.langx:3:3: path ends without returning
+a.langx:2:1: hint: "vaule" is misspelt [spelling]
+b.langx:1:5: warning: "a" is declared but never used [unused-variable]
+`, w.String())
+
+	w.Reset()
+	err = diagnostics[1:2].WriteJSON(w)
+	require.NoError(t, err)
+	require.JSONEq(t, `[{
+		"severity": "hint",
+		"code": "spelling",
+		"message": "\"vaule\" is misspelt",
+		"pos": {"file": "a.langx", "offset": 10, "line": 2, "column": 1},
+		"endPos": {"file": "a.langx", "offset": 15, "line": 2, "column": 6},
+		"suggestedFix": {
+			"description": "Replace with \"value\"",
+			"edits": [{
+				"pos": {"file": "a.langx", "offset": 10, "line": 2, "column": 1},
+				"endPos": {"file": "a.langx", "offset": 15, "line": 2, "column": 6},
+				"text": "value"
+			}]
+		}
+	}]`, w.String())
+}
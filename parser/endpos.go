@@ -0,0 +1,319 @@
+package parser
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// Records the end position of every node parsed from r.
+//
+// participle only records where each node starts, so the end is derived from
+// the tokens of the source: a node covers its own first token and the tokens
+// of its children, extended over any brackets opened within it and over
+// trailing tokens matched by its own grammar, such as the "?" of an optional
+// type or the label of a break.
+type endPositions struct {
+	tokens []lexer.Token
+	// Index of each token by its offset.
+	starts map[int]int
+	// Index of each token by the offset immediately after it.
+	ends map[int]int
+}
+
+// Anything embedding Mixin, including elements of nodes that are not
+// themselves nodes, such as type arguments.
+type spanned interface {
+	Position() lexer.Position
+	EndPosition() lexer.Position
+}
+
+func newEndPositions(r io.Reader) (*endPositions, error) {
+	tokens, err := sourceTokens(r)
+	if err != nil {
+		return nil, err
+	}
+	e := &endPositions{tokens: tokens, starts: map[int]int{}, ends: map[int]int{}}
+	for i, token := range tokens {
+		e.starts[token.Pos.Offset] = i
+		e.ends[e.end(i).Offset] = i
+	}
+	return e, nil
+}
+
+// The tokens of r as seen by the parser, with their source text intact.
+func sourceTokens(r io.Reader) ([]lexer.Token, error) {
+	elided := map[rune]bool{}
+	for name, symbol := range lex.Symbols() {
+		if unicode.IsLower([]rune(name)[0]) {
+			elided[symbol] = true
+		}
+	}
+	l, err := (&fixupLexerDefinition{}).Lex(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens := []lexer.Token{}
+	for {
+		token, err := l.Next()
+		if err != nil {
+			return nil, err
+		}
+		if token.EOF() {
+			return tokens, nil
+		}
+		if !elided[token.Type] {
+			tokens = append(tokens, token)
+		}
+	}
+}
+
+// Position immediately after token i.
+func (e *endPositions) end(i int) lexer.Position {
+	token := e.tokens[i]
+	return advancePos(token.Pos, token.Value)
+}
+
+// Returns true if token i has the given value.
+func (e *endPositions) is(i int, value string) bool {
+	return i < len(e.tokens) && e.tokens[i].Value == value
+}
+
+// Index of the last token of a node that has already been walked.
+func (e *endPositions) last(node spanned) int {
+	if i, ok := e.ends[node.EndPosition().Offset]; ok && node.EndPosition().Line != 0 {
+		return i
+	}
+	return -1
+}
+
+// Walk v, recording end positions and returning the index of the last token
+// of any nodes within it, or -1.
+func (e *endPositions) walk(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return -1
+		}
+		return e.walk(v.Elem())
+
+	case reflect.Slice:
+		last := -1
+		for i := 0; i < v.Len(); i++ {
+			last = max(last, e.walk(v.Index(i)))
+		}
+		return last
+
+	case reflect.Struct:
+		mixin := v.FieldByName("Mixin")
+		if !mixin.IsValid() || !v.CanAddr() {
+			return e.walkFields(v)
+		}
+		node := v.Addr().Interface().(spanned)
+		start, ok := e.starts[node.Position().Offset]
+		if !ok || node.Position().Line == 0 {
+			// Synthesised, or parsed from within a token such as an interpolated string.
+			return -1
+		}
+		last := start
+		if _, ok := node.(*String); !ok {
+			last = max(last, e.walkFields(v))
+		}
+		last = e.trailing(node, start, last)
+		mixin.Addr().Interface().(*Mixin).EndPos = e.end(last)
+		return last
+	}
+	return -1
+}
+
+func (e *endPositions) walkFields(v reflect.Value) int {
+	last := -1
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" || field.Name == "Mixin" {
+			continue
+		}
+		last = max(last, e.walk(v.Field(i)))
+	}
+	return last
+}
+
+// Extend the last token of node over tokens matched by its own grammar,
+// after its children.
+func (e *endPositions) trailing(node spanned, start, last int) int {
+	switch node := node.(type) {
+	case *ModuleDecl:
+		last = start + 2*len(strings.Split(node.Name, ".")) - 1
+
+	case *ImportDecl:
+		if node.Qualified == nil {
+			for last < len(e.tokens)-1 && e.tokens[last].Type != stringToken {
+				last++
+			}
+		}
+
+	case *QualifiedImport:
+		for e.is(last+1, ".") {
+			last += 2
+		}
+
+	case *BreakStmt:
+		if node.Label != "" {
+			last++
+		}
+
+	case *ContinueStmt:
+		if node.Label != "" {
+			last++
+		}
+
+	case *EnumCase:
+		last = start + 1
+		if node.Var != "" {
+			// Bindings may be preceded by "let".
+			for !e.is(last, ")") {
+				last++
+			}
+		}
+
+	case *ArrayPatternElement:
+		if node.Rest {
+			last++
+		}
+
+	case *CondExpr:
+		last = start + 3
+		if node.Not {
+			last++
+		}
+
+	case *CaseDecl:
+		last = max(last, start+1)
+
+	case *CaseStmt:
+		if node.Case != nil {
+			last = max(last, e.last(node.Case)+1)
+		} else {
+			last = max(last, start+1)
+		}
+
+	case *Annotation:
+		last = max(last, start+1)
+		if e.is(last+1, "(") {
+			last++
+		}
+
+	case *NamedTypeDecl:
+		if len(node.TypeParameter) > 0 {
+			last = e.find(last, ">")
+		}
+
+	case *TypeArguments:
+		last = e.find(last, ">")
+
+	case *FuncType:
+		last = max(last, start+1)
+
+	// The opening brace follows the header, and is only within the
+	// children if the body is not empty.
+	case *ClassDecl:
+		last = max(last, e.last(node.Type)+1)
+
+	case *EnumDecl:
+		last = max(last, e.last(node.Type)+1)
+
+	case *SwitchStmt:
+		last = max(last, e.last(node.Target)+1)
+
+	case *CondDecl:
+		last = max(last, e.last(node.Condition)+1)
+		last = e.balance(start, last)
+		if e.is(last+1, "#") && e.is(last+2, "else") {
+			last += 3
+		}
+	}
+	last = e.balance(start, last)
+	if ref, ok := node.(*Reference); ok && ref.Optional {
+		last++
+	}
+	return last
+}
+
+// Index of the first token after i with the given value.
+func (e *endPositions) find(i int, value string) int {
+	for i+1 < len(e.tokens) {
+		i++
+		if e.tokens[i].Value == value {
+			break
+		}
+	}
+	return i
+}
+
+// Extend last until all brackets opened from start are closed.
+func (e *endPositions) balance(start, last int) int {
+	depth := 0
+	for i := start; i < len(e.tokens) && (i <= last || depth > 0); i++ {
+		switch e.tokens[i].Value {
+		case "(", "[", "{":
+			depth++
+
+		case ")", "]", "}":
+			if depth > 0 {
+				depth--
+			}
+		}
+		last = max(last, i)
+	}
+	return last
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// NodeAt returns the innermost node of ast covering the given line and
+// column, and the path of its ancestors from ast, outermost first.
+//
+// Positions are 1-based, and a node covers everything from its start up to,
+// but excluding, its EndPos. If no node covers the position, node is nil.
+func NodeAt(ast *AST, line, column int) (path []Node, node Node) {
+	_ = Inspect(ast, func(n Node, ancestors []Node) bool {
+		if !covers(n, line, column) {
+			return false
+		}
+		path = append(append(path[:0], ancestors...), n)
+		return true
+	})
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return path[:len(path)-1], path[len(path)-1]
+}
+
+func covers(node Node, line, column int) bool {
+	start, end := nodeStart(node), node.EndPosition()
+	if end.Line == 0 {
+		return false
+	}
+	after := line > start.Line || (line == start.Line && column >= start.Column)
+	before := line < end.Line || (line == end.Line && column < end.Column)
+	return after && before
+}
+
+// The position of the first token of node.
+//
+// This differs from Position() for binary expressions, which are positioned
+// at their operator.
+func nodeStart(node Node) lexer.Position {
+	if expr, ok := node.(*Expr); ok && expr.Left != nil {
+		return nodeStart(expr.Left)
+	}
+	return node.Position()
+}
@@ -3,6 +3,8 @@ package parser
 import (
 	"fmt"
 	"math/big"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
@@ -21,6 +23,10 @@ type Expr struct {
 	Left  *Expr
 	Op    Op
 	Right *Expr
+	// Chained is true for a comparison extending the comparison on its Left,
+	// eg. "a < b < c", which compares the right operand of Left with Right.
+	// It is true if both comparisons are, and each operand is evaluated once.
+	Chained bool
 }
 
 func (e *Expr) accept(visitor VisitorFunc) error {
@@ -58,20 +64,115 @@ func (e *Expr) Parse(lex *lexer.PeekingLexer) error {
 	return nil
 }
 
-type opInfo struct {
-	RightAssociative bool
+// Precedence of a binary operator.
+type Precedence struct {
+	// Priority of the operator. Operators of higher priority bind more tightly.
 	Priority         int
+	RightAssociative bool
+}
+
+// Binary operators parsed by Expr.
+//
+// Adding an operator requires only an entry here, in addition to its Op and
+// lexer token.
+var precedence = map[Op]Precedence{
+	OpOr:     {Priority: 1},
+	OpAnd:    {Priority: 2},
+	OpEq:     {Priority: 3},
+	OpNe:     {Priority: 3},
+	OpLt:     {Priority: 3},
+	OpLe:     {Priority: 3},
+	OpGt:     {Priority: 3},
+	OpGe:     {Priority: 3},
+	OpAdd:    {Priority: 4},
+	OpSub:    {Priority: 4},
+	OpMul:    {Priority: 5},
+	OpDiv:    {Priority: 5},
+	OpMod:    {Priority: 5},
+	OpPow:    {RightAssociative: true, Priority: 6},
+	OpBitOr:  {Priority: 7},
+	OpBitAnd: {Priority: 7},
+}
+
+// BinaryPrecedence returns the precedence of a binary operator, eg. for
+// tools that need to parenthesise expressions.
+func BinaryPrecedence(op Op) (Precedence, bool) {
+	p, ok := precedence[op]
+	return p, ok
+}
+
+// BinaryOperators returns the binary operators, ordered from loosest to
+// tightest binding.
+func BinaryOperators() []Op {
+	ops := make([]Op, 0, len(precedence))
+	for op := range precedence {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if precedence[ops[i]].Priority != precedence[ops[j]].Priority {
+			return precedence[ops[i]].Priority < precedence[ops[j]].Priority
+		}
+		return ops[i] < ops[j]
+	})
+	return ops
+}
+
+func isComparison(op Op) bool {
+	switch op {
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe:
+		return true
+	}
+	return false
+}
+
+// Operand returns the left operand of a comparison, which for a chained
+// comparison is the right operand of the comparison it extends.
+func (e *Expr) Operand() *Expr {
+	if e.Chained {
+		return e.Left.Right
+	}
+	return e.Left
 }
 
-var info = map[Op]opInfo{
-	OpAdd:    {Priority: 1},
-	OpSub:    {Priority: 1},
-	OpMul:    {Priority: 2},
-	OpDiv:    {Priority: 2},
-	OpMod:    {Priority: 2},
-	OpPow:    {RightAssociative: true, Priority: 3},
-	OpBitOr:  {Priority: 4},
-	OpBitAnd: {Priority: 4},
+// Repeatable returns true if e is a variable or a scalar literal, which can
+// be evaluated more than once without changing behaviour.
+func (e *Expr) Repeatable() bool {
+	if e.Unary == nil || e.Unary.Op != OpNone {
+		return false
+	}
+	ref := e.Unary.Reference
+	if ref.Next != nil || ref.Optional {
+		return false
+	}
+	literal := ref.Terminal.Literal
+	return ref.Terminal.Ident != "" ||
+		literal != nil && (literal.Number != nil || literal.Char != nil || literal.Bool != nil)
+}
+
+// Unchain returns a chained comparison as a conjunction of comparisons, eg.
+// "a < b < c" as "a < b && b < c", or expr itself if it is not chained.
+//
+// The operands in the middle of the chain are shared by two comparisons of
+// the result, so are evaluated twice. This is for backends that can't
+// evaluate them once, and an error is returned if any is not Repeatable.
+func Unchain(expr *Expr) (*Expr, error) {
+	if !expr.Chained {
+		return expr, nil
+	}
+	operand := expr.Operand()
+	if !operand.Repeatable() {
+		return nil, participle.Errorf(operand.Pos, "chained comparisons of operands other than variables and literals are not supported")
+	}
+	left, err := Unchain(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{
+		Mixin: expr.Mixin,
+		Left:  left,
+		Op:    OpAnd,
+		Right: &Expr{Mixin: expr.Mixin, Left: operand, Op: expr.Op, Right: expr.Right},
+	}, nil
 }
 
 // Precedence climbing implementation based on
@@ -86,7 +187,7 @@ func parseExpr(lex *lexer.PeekingLexer, minPrec int) (*Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr := &Expr{Mixin: Mixin{token.Pos}}
+		expr := &Expr{Mixin: Mixin{Pos: token.Pos}}
 		if token.Type != operatorToken && token.Type != singleOperatorToken {
 			break
 		}
@@ -94,18 +195,22 @@ func parseExpr(lex *lexer.PeekingLexer, minPrec int) (*Expr, error) {
 		if err != nil {
 			return lhs, nil
 		}
-		if info[expr.Op].Priority < minPrec {
+		prec := precedence[expr.Op]
+		if prec.Priority < minPrec {
 			break
 		}
 		_, _ = lex.Next()
-		nextMinPrec := info[expr.Op].Priority
-		if !info[expr.Op].RightAssociative {
+		nextMinPrec := prec.Priority
+		if !prec.RightAssociative {
 			nextMinPrec++
 		}
 		rhs, err := parseExpr(lex, nextMinPrec)
 		if err != nil {
 			return nil, err
 		}
+		// Lower precedence operators are consumed by the caller, so an unparenthesised
+		// comparison on the left must be part of a chain.
+		expr.Chained = isComparison(expr.Op) && isComparison(lhs.Op)
 		expr.Left = lhs
 		expr.Right = rhs
 		lhs = expr
@@ -115,12 +220,12 @@ func parseExpr(lex *lexer.PeekingLexer, minPrec int) (*Expr, error) {
 
 func parseOperand(lex *lexer.PeekingLexer) (*Expr, error) {
 	pos := peekPos(lex)
-	u := &Unary{Mixin: Mixin{pos}}
+	u := &Unary{Mixin: Mixin{Pos: pos}}
 	err := unaryParser.ParseFromLexer(lex, u, participle.AllowTrailing(true))
 	if err != nil {
 		return nil, err
 	}
-	return &Expr{Mixin: Mixin{pos}, Unary: u}, nil
+	return &Expr{Mixin: Mixin{Pos: pos}, Unary: u}, nil
 }
 
 type Unary struct {
@@ -146,53 +251,149 @@ func (u *Unary) String() string {
 	return u.Reference.Describe()
 }
 
-type InitParameter struct {
+// NewExpr constructs a value of a type, eg. new Foo(1, 2)
+//
+// The first call following the type is the constructor call. Anything after
+// it applies to the constructed value, eg. new Foo(1).bar()
+type NewExpr struct {
 	Mixin
 
-	Name  string `@Ident`
-	Value *Expr  `"=" @@`
+	Type *Reference
+	Call *Call
+}
+
+type newExpr struct {
+	Type *Reference `"new" @@`
+}
+
+func (n *NewExpr) Parse(lex *lexer.PeekingLexer) error {
+	token, err := lex.Peek(0)
+	if err != nil {
+		return err
+	}
+	if token.Value != "new" {
+		return participle.NextMatch
+	}
+	branch := lex.Clone()
+	expr := &newExpr{}
+	if err := newExprParser.ParseFromLexer(lex, expr, participle.AllowTrailing(true)); err != nil {
+		return err
+	}
+	*n = NewExpr{Mixin: Mixin{Pos: token.Pos}, Type: expr.Type}
+	// Detach the constructor call from the type.
+	for parent := &expr.Type.Next; *parent != nil; parent = &(*parent).Next {
+		if (*parent).Call == nil {
+			continue
+		}
+		n.Call = (*parent).Call
+		rest := (*parent).Next
+		*parent = nil
+		if rest == nil {
+			return nil
+		}
+		// Rewind to the end of the call, leaving the rest to the enclosing reference.
+		expr.Type.Optional = false
+		for {
+			next, err := branch.Peek(0)
+			if err != nil {
+				return err
+			}
+			if next.EOF() || next.Pos.Offset == rest.Pos.Offset {
+				break
+			}
+			if _, err := branch.Next(); err != nil {
+				return err
+			}
+		}
+		*lex = *branch
+		return nil
+	}
+	return nil
 }
 
-func (i *InitParameter) accept(visitor VisitorFunc) error {
-	return visitor(i, func(err error) error {
+func (n *NewExpr) accept(visitor VisitorFunc) error {
+	return visitor(n, func(err error) error {
 		if err != nil {
 			return err
 		}
-		return VisitFunc(i.Value, visitor)
+		if err = VisitFunc(n.Type, visitor); err != nil {
+			return err
+		}
+		if n.Call != nil {
+			return VisitFunc(*n.Call, visitor)
+		}
+		return nil
 	})
 }
 
-type NewExpr struct {
+// DoExpr is a block expression that evaluates to the value of its final
+// expression, eg.
+//
+//	let a = do { let t = f(); t * t }
+//
+// break, continue and return can not leave a do block.
+type DoExpr struct {
 	Mixin
 
-	Type *Reference       `"new" @@`
-	Init []*InitParameter `( "(" ( @@ ( "," @@ )* ","? )? ")" )?`
+	Body *Block `"do" @@`
 }
 
-func (n *NewExpr) accept(visitor VisitorFunc) error {
-	return visitor(n, func(err error) error {
+func (d *DoExpr) accept(visitor VisitorFunc) error {
+	return visitor(d, func(err error) error {
 		if err != nil {
 			return err
 		}
-		if err = VisitFunc(n.Type, visitor); err != nil {
+		return VisitFunc(d.Body, visitor)
+	})
+}
+
+// Result returns the expression the block evaluates to, or nil if the last
+// statement is not a plain expression.
+func (d *DoExpr) Result() *Expr {
+	stmts := d.Body.Statements
+	if len(stmts) == 0 {
+		return nil
+	}
+	last := stmts[len(stmts)-1]
+	if last.ExprStmt == nil || last.ExprStmt.RHS != nil {
+		return nil
+	}
+	return last.ExprStmt.LHS
+}
+
+// FuncType is the type of a function value, eg.
+//
+//	let f: fn(int, int): int = max
+type FuncType struct {
+	Mixin
+
+	Parameters []*Reference `"fn" "(" ( @@ ( "," @@ )* ","? )? ")"`
+	Return     *Reference   `( ":" @@ )?`
+}
+
+func (f *FuncType) accept(visitor VisitorFunc) error {
+	return visitor(f, func(err error) error {
+		if err != nil {
 			return err
 		}
-		for _, param := range n.Init {
-			if err = VisitFunc(param, visitor); err != nil {
+		for _, p := range f.Parameters {
+			if err = VisitFunc(p, visitor); err != nil {
 				return err
 			}
 		}
-		return nil
+		return VisitFunc(f.Return, visitor)
 	})
 }
 
 type Terminal struct {
 	Mixin
 
-	Tuple   []*Expr  `  "(" @@ ( "," @@ )* ")"`
-	New     *NewExpr `| @@`
-	Literal *Literal `| @@`
-	Ident   string   `| @Ident`
+	Tuple   []*Expr   `  "(" @@ ( "," @@ )* ","? ")"`
+	New     *NewExpr  `| @@`
+	Do      *DoExpr   `| @@`
+	Func    *FuncType `| @@`
+	Literal *Literal  `| @@`
+	Ident   string    `| @Ident`
 }
 
 func (t Terminal) accept(visitor VisitorFunc) error {
@@ -214,11 +415,17 @@ func (t Terminal) accept(visitor VisitorFunc) error {
 		case t.New != nil:
 			return VisitFunc(t.New, visitor)
 
+		case t.Do != nil:
+			return VisitFunc(t.Do, visitor)
+
+		case t.Func != nil:
+			return VisitFunc(t.Func, visitor)
+
 		case t.Ident != "":
 			return nil
 
 		default:
-			panic("??")
+			return invalidNode(t)
 		}
 		return nil
 	})
@@ -229,6 +436,12 @@ func (t *Terminal) Describe() string {
 	case t.New != nil:
 		return "new"
 
+	case t.Do != nil:
+		return "do block"
+
+	case t.Func != nil:
+		return "function type"
+
 	case t.Tuple != nil:
 		return "tuple/subexpression"
 
@@ -238,7 +451,7 @@ func (t *Terminal) Describe() string {
 	case t.Literal != nil:
 		return fmt.Sprintf("literal %s", t.Literal.Describe())
 	}
-	panic("??")
+	return "invalid terminal"
 }
 
 // A Reference to a value or a type.
@@ -276,10 +489,10 @@ func (t *Reference) Describe() string {
 type ReferenceNext struct {
 	Mixin
 
-	Subscript      *Expr        `(   "[" @@ "]"`
-	Reference      *Terminal    `  | "." @@`
-	Specialisation []*Reference `  | "<" @@ ( "," @@ )* ","? ">"`
-	Call           *Call        `  | @@ )`
+	Subscript      *Expr          `(   "[" @@ "]"`
+	Reference      *Terminal      `  | "." @@`
+	Specialisation *TypeArguments `  | @@`
+	Call           *Call          `  | @@ )`
 
 	Next *ReferenceNext `@@?`
 }
@@ -292,9 +505,11 @@ func (r *ReferenceNext) accept(visitor VisitorFunc) error {
 		if err = VisitFunc(r.Subscript, visitor); err != nil {
 			return err
 		}
-		for _, ref := range r.Specialisation {
-			if err = VisitFunc(ref, visitor); err != nil {
-				return err
+		if r.Specialisation != nil {
+			for _, ref := range r.Specialisation.Types {
+				if err = VisitFunc(ref, visitor); err != nil {
+					return err
+				}
 			}
 		}
 		if err = VisitFunc(r.Reference, visitor); err != nil {
@@ -326,7 +541,7 @@ func (r *ReferenceNext) Describe() string {
 		description = "specialisation"
 
 	default:
-		panic("??")
+		description = "invalid reference"
 	}
 
 	if r.Next != nil {
@@ -335,43 +550,168 @@ func (r *ReferenceNext) Describe() string {
 	return description
 }
 
+// TypeArguments are explicit generic type arguments, eg. List<int>() or Map<string, int>.empty()
+//
+// As "<" is ambiguous with the less-than operator, the arguments are only parsed as such if
+// they are followed by a token that can not continue a comparison, otherwise "<" is left
+// for the expression parser.
+type TypeArguments struct {
+	Mixin
+
+	Types []*Reference
+}
+
+type typeArguments struct {
+	Types []*Reference `"<" @@ ( "," @@ )* ","? ">"`
+}
+
+// Tokens that may follow type arguments.
+var typeArgumentsFollow = map[string]bool{
+	"(": true, ")": true, ".": true, ",": true, ";": true, "]": true,
+	"}": true, "{": true, "?": true, ">": true, "=": true,
+}
+
+func (t *TypeArguments) Parse(lex *lexer.PeekingLexer) error {
+	token, err := lex.Peek(0)
+	if err != nil {
+		return err
+	}
+	if token.Value != "<" {
+		return participle.NextMatch
+	}
+	branch := lex.Clone()
+	args := &typeArguments{}
+	if err := typeArgumentsParser.ParseFromLexer(branch, args, participle.AllowTrailing(true)); err != nil {
+		return participle.NextMatch
+	}
+	next, err := branch.Peek(0)
+	if err != nil {
+		return err
+	}
+	if !next.EOF() && !typeArgumentsFollow[next.Value] {
+		return participle.NextMatch
+	}
+	*lex = *branch
+	*t = TypeArguments{Mixin: Mixin{Pos: token.Pos}, Types: args.Types}
+	return nil
+}
+
 // A Number is an arbitrary precision number.
-type Number big.Float
+//
+// Numbers may be written in decimal (optionally with a fraction and exponent), or as
+// hexadecimal (0xFF), octal (0o77) or binary (0b1010) integers. Digits may be
+// separated by underscores, eg. 1_000_000.
+type Number struct {
+	Value big.Float
+	// Radix the number was written in: 2, 8, 10 or 16.
+	Radix int
+	// Float is true if the number was written with a fraction or exponent,
+	// even if its value is integral, eg. 1.5e3.
+	Float bool
+}
+
+// IsInt returns true if the number is an integer: written without a fraction
+// or exponent.
+func (n *Number) IsInt() bool {
+	return !n.Float && n.Value.IsInt()
+}
 
 func (n *Number) GoString() string {
 	return fmt.Sprintf("parser.Number(%s)", n.String())
 }
 
 func (n *Number) String() string {
-	return (*big.Float)(n).String()
+	if n.IsInt() {
+		i, _ := n.Value.Int(nil)
+		return i.String()
+	}
+	text := n.Value.Text('g', -1)
+	if !strings.ContainsAny(text, ".e") {
+		text += ".0"
+	}
+	return text
 }
 
 func (n *Number) Capture(values []string) error {
-	f, _, err := big.ParseFloat(values[0], 10, 30, big.ToZero)
+	number, err := parseNumber(values[0])
 	if err != nil {
 		return err
 	}
-	*n = Number(*f)
+	*n = *number
 	return nil
 }
 
+func parseNumber(value string) (*Number, error) {
+	n := &Number{Radix: 10}
+	if len(value) > 2 && value[0] == '0' {
+		switch value[1] {
+		case 'x', 'X':
+			n.Radix = 16
+		case 'o', 'O':
+			n.Radix = 8
+		case 'b', 'B':
+			n.Radix = 2
+		}
+	}
+	if n.Radix != 10 {
+		i, ok := new(big.Int).SetString(value, 0)
+		if !ok {
+			return nil, errors.Errorf("invalid number %q", value)
+		}
+		n.Value.SetInt(i)
+		return n, nil
+	}
+	f, _, err := big.ParseFloat(value, 0, 53, big.ToNearestEven)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid number %q", value)
+	}
+	if strings.ContainsAny(value, ".eE") {
+		n.Value = *f
+		n.Float = true
+		return n, nil
+	}
+	// Integers are exact, regardless of their size.
+	i, ok := new(big.Int).SetString(strings.ReplaceAll(value, "_", ""), 10)
+	if !ok {
+		return nil, errors.Errorf("invalid number %q", value)
+	}
+	n.Value.SetInt(i)
+	return n, nil
+}
+
 // String with interpolated expressions.
 //
 // eg.
 //
-//    "A string with expressions {1 + 2 / 3} {function()} calls and {variables}."
+//	"A string with expressions {1 + 2 / 3} {function()} calls and {variables}."
+//
+// Literal braces can be included with the escapes \{ and \}.
 type String struct {
 	Mixin
 
+	// Raw source of the string, excluding quotes and with escapes intact.
+	Raw string
+	// Fragments with escapes decoded.
 	Fragments []StringFragment
 }
 
 func (s *String) Capture(values []string) error {
 	// This just isn't robust - it needs proper support in Participle.
 	// For example the string "Foo {"bar"}" will error.
-	str := values[0]
+	s.Raw = values[0][1 : len(values[0])-1]
+	str := s.Raw
 	frag := ""
 	for str != "" {
+		if str[0] == '\\' {
+			// Escapes have already been validated by the lexer.
+			decoded, size, err := decodeEscape(str)
+			if err != nil {
+				return err
+			}
+			frag += decoded
+			str = str[size:]
+			continue
+		}
 		rn, size := utf8.DecodeRuneInString(str)
 		str = str[size:]
 		if rn != '{' {
@@ -400,6 +740,96 @@ func (s *String) Capture(values []string) error {
 	return nil
 }
 
+// Quoted is a plain double-quoted string with escapes decoded, but no interpolation.
+type Quoted string
+
+func (q *Quoted) Capture(values []string) error {
+	str, err := unescape(values[0][1 : len(values[0])-1])
+	if err != nil {
+		return err
+	}
+	*q = Quoted(str)
+	return nil
+}
+
+// Decode all escape sequences in str.
+func unescape(str string) (string, error) {
+	out := strings.Builder{}
+	for str != "" {
+		if str[0] != '\\' {
+			rn, size := utf8.DecodeRuneInString(str)
+			out.WriteRune(rn)
+			str = str[size:]
+			continue
+		}
+		decoded, size, err := decodeEscape(str)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(decoded)
+		str = str[size:]
+	}
+	return out.String(), nil
+}
+
+// Decode the escape sequence at the start of str, returning the decoded value and the
+// number of bytes consumed.
+//
+// Supported escapes are \n, \r, \t, \0, \\, \", \', \{, \}, \xNN (00-7F) and \u{XXXXXX}.
+func decodeEscape(str string) (string, int, error) {
+	if len(str) < 2 {
+		return "", 0, errors.New("unterminated escape sequence")
+	}
+	switch str[1] {
+	case 'n':
+		return "\n", 2, nil
+
+	case 'r':
+		return "\r", 2, nil
+
+	case 't':
+		return "\t", 2, nil
+
+	case '0':
+		return "\x00", 2, nil
+
+	case '\\', '"', '\'', '{', '}':
+		return str[1:2], 2, nil
+
+	case 'x':
+		if len(str) < 4 {
+			return "", 0, errors.New("\\x must be followed by two hex digits")
+		}
+		value, err := strconv.ParseUint(str[2:4], 16, 8)
+		if err != nil {
+			return "", 0, errors.New("\\x must be followed by two hex digits")
+		}
+		if value > 0x7f {
+			return "", 0, errors.Errorf("\\x%s is out of range, must be in the range 00-7F", str[2:4])
+		}
+		return string(rune(value)), 4, nil
+
+	case 'u':
+		end := strings.IndexByte(str, '}')
+		if len(str) < 3 || str[2] != '{' || end == -1 {
+			return "", 0, errors.New("\\u must be followed by a code point in the form {XXXX}")
+		}
+		digits := str[3:end]
+		if len(digits) == 0 || len(digits) > 6 {
+			return "", 0, errors.Errorf("invalid unicode escape \\u{%s}, must have 1-6 hex digits", digits)
+		}
+		value, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || !utf8.ValidRune(rune(value)) {
+			return "", 0, errors.Errorf("invalid unicode escape \\u{%s}", digits)
+		}
+		return string(rune(value)), end + 1, nil
+
+	default:
+		rn, _ := utf8.DecodeRuneInString(str[1:])
+		return "", 0, errors.Errorf("invalid escape sequence \\%c", rn)
+	}
+}
+
 func (s *String) accept(visitor VisitorFunc) error {
 	return visitor(s, func(err error) error {
 		if err != nil {
@@ -421,6 +851,103 @@ type StringFragment struct {
 	Expr   *Expr
 }
 
+// Embedded is a tagged block of verbatim text in another language, eg.
+//
+//	sql`SELECT * FROM users WHERE id = ?`
+//
+// The content is not interpreted by the parser and may span multiple lines. It
+// can be checked by validators registered for the tag with the analyser.
+type Embedded struct {
+	Mixin
+
+	Tag     string
+	Content string
+	// Position of the first character of Content.
+	ContentPos lexer.Position
+}
+
+func (e *Embedded) Parse(lex *lexer.PeekingLexer) error {
+	token, err := lex.Peek(0)
+	if err != nil {
+		return err
+	}
+	if token.Type != embeddedToken {
+		return participle.NextMatch
+	}
+	_, _ = lex.Next()
+	quote := strings.IndexByte(token.Value, '`')
+	*e = Embedded{
+		Mixin:      Mixin{Pos: token.Pos},
+		Tag:        token.Value[:quote],
+		Content:    token.Value[quote+1 : len(token.Value)-1],
+		ContentPos: advancePos(token.Pos, token.Value[:quote+1]),
+	}
+	return nil
+}
+
+// PositionOf returns the source position of the given byte offset into Content.
+func (e *Embedded) PositionOf(offset int) lexer.Position {
+	return advancePos(e.ContentPos, e.Content[:offset])
+}
+
+func (e *Embedded) accept(visitor VisitorFunc) error {
+	return visitor(e, func(err error) error { return err })
+}
+
+// Template is a tagged string with interpolated expressions, eg.
+//
+//	html"<p>Hello {name}</p>"
+//
+// The tag determines how interpolated values are inserted into the string.
+type Template struct {
+	Mixin
+
+	Tag string
+	Str *String
+}
+
+func (t *Template) Parse(lex *lexer.PeekingLexer) error {
+	token, err := lex.Peek(0)
+	if err != nil {
+		return err
+	}
+	if token.Type != templateToken {
+		return participle.NextMatch
+	}
+	_, _ = lex.Next()
+	quote := strings.IndexByte(token.Value, '"')
+	str := &String{Mixin: Mixin{Pos: advancePos(token.Pos, token.Value[:quote])}}
+	if err := str.Capture([]string{token.Value[quote:]}); err != nil {
+		return participle.AnnotateError(str.Pos, err)
+	}
+	*t = Template{Mixin: Mixin{Pos: token.Pos}, Tag: token.Value[:quote], Str: str}
+	return nil
+}
+
+func (t *Template) accept(visitor VisitorFunc) error {
+	return visitor(t, func(err error) error {
+		if err != nil {
+			return err
+		}
+		return VisitFunc(t.Str, visitor)
+	})
+}
+
+// Char is a single unicode code point, eg. 'a' or '\n'.
+//
+// Escapes are decoded and validated by the lexer (see unquoteChar).
+type Char rune
+
+func (c *Char) Capture(values []string) error {
+	rn, _ := utf8.DecodeRuneInString(values[0])
+	*c = Char(rn)
+	return nil
+}
+
+func (c Char) GoString() string {
+	return fmt.Sprintf("parser.Char(%q)", rune(c))
+}
+
 type Bool bool
 
 func (b *Bool) Capture(values []string) error {
@@ -434,7 +961,11 @@ type Literal struct {
 	Number    *Number           `  @Number`
 	Str       *String           `| @String`
 	LitStr    *string           `| @LiteralString`
-	Bool      *Bool             `| @("true" | "false")`
+	Embedded  *Embedded         `| @@`
+	Template  *Template         `| @@`
+	Char      *Char             `| @Char`
+	Bool      *Bool             `| @Bool`
+	Nil       bool              `| @"nil"`
 	DictOrSet *DictOrSetLiteral `| @@`
 	Array     *ArrayLiteral     `| @@`
 }
@@ -454,9 +985,21 @@ func (l *Literal) accept(visitor VisitorFunc) error {
 		case l.LitStr != nil:
 			return nil
 
+		case l.Embedded != nil:
+			return VisitFunc(l.Embedded, visitor)
+
+		case l.Template != nil:
+			return VisitFunc(l.Template, visitor)
+
+		case l.Char != nil:
+			return nil
+
 		case l.Bool != nil:
 			return nil
 
+		case l.Nil:
+			return nil
+
 		case l.DictOrSet != nil:
 			return VisitFunc(l.DictOrSet, visitor)
 
@@ -464,7 +1007,7 @@ func (l *Literal) accept(visitor VisitorFunc) error {
 			return VisitFunc(l.Array, visitor)
 
 		default:
-			panic("??")
+			return invalidNode(l)
 		}
 	})
 }
@@ -480,20 +1023,32 @@ func (l *Literal) Describe() string {
 	case l.LitStr != nil:
 		return "literal string"
 
+	case l.Embedded != nil:
+		return "embedded " + l.Embedded.Tag
+
+	case l.Template != nil:
+		return l.Template.Tag + " template"
+
+	case l.Char != nil:
+		return "char"
+
 	case l.Bool != nil:
 		return "bool"
 
+	case l.Nil:
+		return "nil"
+
 	case l.DictOrSet != nil:
-		if l.DictOrSet.Entries[0].Value != nil {
-			return "dict"
+		if len(l.DictOrSet.Entries) > 0 && l.DictOrSet.Entries[0].Value == nil {
+			return "set"
 		}
-		return "set"
+		return "dict"
 
 	case l.Array != nil:
 		return "array"
 
 	default:
-		panic("??")
+		return "invalid literal"
 	}
 }
 
@@ -546,7 +1101,7 @@ func (d DictOrSetEntryLiteral) accept(visitor VisitorFunc) error {
 type ArrayLiteral struct {
 	Mixin
 
-	Values []*Expr `"[" ( @@ ( "," @@ )* )? ","? "]"`
+	Values []*Expr `"[" ( @@ ( "," @@ )* ","? )? "]"`
 }
 
 func (a ArrayLiteral) accept(visitor VisitorFunc) error {
@@ -567,7 +1122,7 @@ func (a ArrayLiteral) accept(visitor VisitorFunc) error {
 type ClassLiteral struct {
 	Mixin
 
-	Fields []*ClassLiteralField `"{" ( @@ ( "," @@ )* )? ","? "}"`
+	Fields []*ClassLiteralField `"{" ( @@ ( "," @@ )* ","? )? "}"`
 }
 
 type ClassLiteralField struct {
@@ -579,10 +1134,17 @@ type ClassLiteralField struct {
 	Value  *Expr         ` | @@ )`
 }
 
+// Call is a parenthesised argument list, optionally followed by a trailing
+// closure passed as the last argument, eg.
+//
+//	list.reduce(0) { total, x -> total + x }
+//
+// The parentheses may be omitted if the closure is the only argument.
 type Call struct {
 	Mixin
 
-	Parameters []*Expr `"(" ( @@ ( "," @@ )* )? ","? ")"`
+	Parameters      []*Expr  `( "(" ( @@ ( "," @@ )* ","? )? ")"`
+	TrailingClosure *Closure `  @@? | @@ )`
 }
 
 func (c Call) accept(visitor VisitorFunc) error {
@@ -595,10 +1157,104 @@ func (c Call) accept(visitor VisitorFunc) error {
 				return err
 			}
 		}
+		return VisitFunc(c.TrailingClosure, visitor)
+	})
+}
+
+// Arity is the number of arguments passed, including any trailing closure.
+func (c *Call) Arity() int {
+	if c.TrailingClosure != nil {
+		return len(c.Parameters) + 1
+	}
+	return len(c.Parameters)
+}
+
+// Closure is an anonymous function, eg.
+//
+//	{ x -> x * 2 }
+//
+// The types of its parameters are those expected by the function it is passed
+// to, and it evaluates to its last expression. The arrow is required, even
+// without parameters, so that the block following a condition is never
+// mistaken for a closure.
+type Closure struct {
+	Mixin
+
+	Parameters []string
+	Body       []*Stmt
+}
+
+type closure struct {
+	Parameters []string `"{" ( @Ident ( "," @Ident )* )? "->"`
+	Body       []*Stmt  `( @@ ( ";" @@ )* ";"? )? "}"`
+}
+
+func (c *Closure) Parse(lex *lexer.PeekingLexer) error {
+	token, err := lex.Peek(0)
+	if err != nil {
+		return err
+	}
+	if token.Value != "{" || !closureFollows(lex.Clone()) {
+		return participle.NextMatch
+	}
+	parsed := &closure{}
+	if err := closureParser.ParseFromLexer(lex, parsed, participle.AllowTrailing(true)); err != nil {
+		return err
+	}
+	*c = Closure{Mixin: Mixin{Pos: token.Pos}, Parameters: parsed.Parameters, Body: parsed.Body}
+	return nil
+}
+
+// Returns true if the tokens following an opening brace are the parameters of
+// a closure.
+func closureFollows(lex *lexer.PeekingLexer) bool {
+	_, _ = lex.Next()
+	for {
+		token, err := lex.Next()
+		switch {
+		case err != nil:
+			return false
+		case token.Value == "->":
+			return true
+		case token.Type != identToken:
+			return false
+		}
+		if token, err = lex.Next(); err != nil || token.Value == "->" {
+			return err == nil
+		}
+		if token.Value != "," {
+			return false
+		}
+	}
+}
+
+func (c *Closure) accept(visitor VisitorFunc) error {
+	return visitor(c, func(err error) error {
+		if err != nil {
+			return err
+		}
+		for _, stmt := range c.Body {
+			if err = VisitFunc(stmt, visitor); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 }
 
+// Result returns the expression the closure evaluates to, or nil if the last
+// statement is not a plain expression.
+func (c *Closure) Result() *Expr {
+	if len(c.Body) == 0 {
+		return nil
+	}
+	last := c.Body[len(c.Body)-1]
+	if last.ExprStmt == nil || last.ExprStmt.RHS != nil {
+		return nil
+	}
+	return last.ExprStmt.LHS
+}
+
 func peekPos(lex *lexer.PeekingLexer) lexer.Position {
 	tok, _ := lex.Peek(0)
 	return tok.Pos
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ParseFiles parses the files at paths concurrently, keyed by path.
+//
+// At most GOMAXPROCS files are parsed at once. Files that fail to open or
+// parse are omitted from the result, and their errors returned in the order
+// of paths.
+func ParseFiles(paths []string, opts ...Option) (map[string]*AST, []error) {
+	type result struct {
+		ast *AST
+		err error
+	}
+	results := make([]result, len(paths))
+	work := make(chan int)
+	wg := sync.WaitGroup{}
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				ast, err := parseFile(paths[i], opts...)
+				results[i] = result{ast, err}
+			}
+		}()
+	}
+	for i := range paths {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	asts := map[string]*AST{}
+	errs := []error{}
+	for i, result := range results {
+		if result.err != nil {
+			errs = append(errs, result.err)
+			continue
+		}
+		asts[paths[i]] = result.ast
+	}
+	return asts, errs
+}
+
+func parseFile(path string, opts ...Option) (*AST, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer r.Close()
+	return Parse(r, opts...)
+}
@@ -0,0 +1,126 @@
+// Command genvisitor generates the reflection-free dispatch used by
+// parser.Visit and parser.VisitFunc.
+//
+// It is run by "go generate" in the parser package, and finds every node type
+// by its accept method, and the Visitor method for each.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+const output = "visitor_gen.go"
+
+type node struct {
+	// Type as it appears in the receiver of accept, eg. "*AST" or "Block".
+	typ    string
+	method string
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "genvisitor: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != output
+	}, 0)
+	if err != nil {
+		return err
+	}
+	pkg, ok := pkgs["parser"]
+	if !ok {
+		return fmt.Errorf("package parser not found")
+	}
+
+	receivers := []string{}
+	methods := map[string]string{}
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Name.Name == "accept" && decl.Recv != nil {
+					receivers = append(receivers, typeString(decl.Recv.List[0].Type))
+				}
+
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					spec, ok := spec.(*ast.TypeSpec)
+					if !ok || spec.Name.Name != "Visitor" {
+						continue
+					}
+					for _, method := range spec.Type.(*ast.InterfaceType).Methods.List {
+						params := method.Type.(*ast.FuncType).Params.List
+						methods[typeString(params[0].Type)] = method.Names[0].Name
+					}
+				}
+			}
+		}
+	}
+	if len(methods) == 0 {
+		return fmt.Errorf("Visitor interface not found")
+	}
+
+	nodes := []node{}
+	for _, receiver := range receivers {
+		method, ok := methods[receiver]
+		if !ok {
+			return fmt.Errorf("no Visitor method for %s", receiver)
+		}
+		nodes = append(nodes, node{typ: receiver, method: method})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return strings.TrimPrefix(nodes[i].typ, "*") < strings.TrimPrefix(nodes[j].typ, "*")
+	})
+
+	w := &bytes.Buffer{}
+	fmt.Fprintln(w, "// Code generated by genvisitor; DO NOT EDIT.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "package parser")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "// Returns true if node is nil, or a nil pointer to a node.")
+	fmt.Fprintln(w, "func isNil(node Node) bool {")
+	fmt.Fprintln(w, "\tswitch node := node.(type) {")
+	fmt.Fprintln(w, "\tcase nil:")
+	fmt.Fprintln(w, "\t\treturn true")
+	for _, n := range nodes {
+		fmt.Fprintf(w, "\tcase *%s:\n", strings.TrimPrefix(n.typ, "*"))
+		fmt.Fprintln(w, "\t\treturn node == nil")
+	}
+	fmt.Fprintln(w, "\t}")
+	fmt.Fprintln(w, "\treturn false")
+	fmt.Fprintln(w, "}")
+	for _, n := range nodes {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "func (n %s) visit(visitor Visitor) error { return visitor.%s(n) }\n", n.typ, n.method)
+	}
+	source, err := format.Source(w.Bytes())
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output, source, 0644)
+}
+
+func typeString(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + typeString(expr.X)
+
+	case *ast.Ident:
+		return expr.Name
+	}
+	panic(fmt.Sprintf("unsupported type %T", expr))
+}
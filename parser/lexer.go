@@ -1,20 +1,95 @@
 package parser
 
 import (
+	"fmt"
 	"io"
+	"unicode"
 
 	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
 )
 
+// SemicolonPolicy determines which newlines terminate statements and
+// declarations.
+//
+// Semi-colons are inserted during lexing, replacing each newline that follows
+// a token with one of the values or kinds of the policy. Other newlines are
+// discarded. Comments are ignored when considering the preceding token, and a
+// backslash before a newline discards both, joining the lines.
+type SemicolonPolicy struct {
+	// Values of tokens, eg. ")" or "return".
+	Values []string
+	// Kinds of tokens, by the name of their lexer rule, eg. "Ident".
+	Kinds []string
+}
+
+// DefaultSemicolonPolicy is the policy of the langx grammar.
+var DefaultSemicolonPolicy = SemicolonPolicy{
+	Values: []string{"break", "continue", "fallthrough", "return", "nil", "++", "--", ")", "}", "]"},
+	Kinds:  []string{"Number", "String", "Char", "Ident", "Bool", "Embedded", "Template"},
+}
+
+// Semicolons replaces DefaultSemicolonPolicy with policy.
+func Semicolons(policy SemicolonPolicy) Option {
+	return func(o *options) error {
+		compiled, err := policy.compile()
+		if err != nil {
+			return err
+		}
+		o.semicolons = compiled
+		return nil
+	}
+}
+
+var defaultSemicolons = func() *semicolons {
+	compiled, err := DefaultSemicolonPolicy.compile()
+	if err != nil {
+		panic(err)
+	}
+	return compiled
+}()
+
+// A SemicolonPolicy resolved against the lexer.
+type semicolons struct {
+	values map[string]bool
+	kinds  map[rune]bool
+}
+
+func (p SemicolonPolicy) compile() (*semicolons, error) {
+	compiled := &semicolons{values: map[string]bool{}, kinds: map[rune]bool{}}
+	for _, value := range p.Values {
+		compiled.values[value] = true
+	}
+	for _, kind := range p.Kinds {
+		symbol, ok := lex.Symbols()[kind]
+		if !ok || kind == "EOF" || unicode.IsLower([]rune(kind)[0]) {
+			return nil, errors.Errorf("unknown token kind %q in semi-colon policy", kind)
+		}
+		compiled.kinds[symbol] = true
+	}
+	return compiled, nil
+}
+
+// Returns true if a newline following token should be replaced by a semi-colon.
+func (s *semicolons) after(token lexer.Token) bool {
+	return s.values[token.Value] || s.kinds[token.Type]
+}
+
 // A Lexer that inserts semi-colons and collapses \-separated lines.
+//
+// The semi-colon policy is that of the source, if it is a namedReader.
 type fixupLexerDefinition struct{}
 
 func (l *fixupLexerDefinition) Lex(r io.Reader) (lexer.Lexer, error) { // nolint: golint
+	var semicolons *semicolons
+	if named, ok := r.(*namedReader); ok {
+		semicolons = named.semicolons
+	}
 	ll, err := lex.Lex(r)
 	if err != nil {
 		return nil, err
 	}
-	return &fixupLexer{lexer: ll}, nil
+	return newFixupLexer(ll, semicolons), nil
 }
 
 func (l *fixupLexerDefinition) Symbols() map[string]rune { // nolint: golint
@@ -22,44 +97,159 @@ func (l *fixupLexerDefinition) Symbols() map[string]rune { // nolint: golint
 }
 
 type fixupLexer struct {
-	lexer lexer.Lexer
-	last  lexer.Token
+	lexer      lexer.Lexer
+	semicolons *semicolons
+	last       lexer.Token
+}
+
+func newFixupLexer(l lexer.Lexer, semicolons *semicolons) *fixupLexer {
+	if semicolons == nil {
+		semicolons = defaultSemicolons
+	}
+	return &fixupLexer{lexer: l, semicolons: semicolons}
 }
 
 func (l *fixupLexer) Next() (lexer.Token, error) {
-next:
 	for {
 		token, err := l.lexer.Next()
 		if err != nil {
 			return token, err
 		}
-		if token.Value != "\n" {
-			l.last = token
+		switch {
+		case token.Type == commentToken:
+			// Comments are transparent to semi-colon insertion.
 			return token, nil
-		}
 
-		// Do we need to insert a semi-colon?
-		switch l.last.Value {
-		case "\\":
+		case token.Type == backslashToken:
+			l.last = token
+			continue
+
+		case token.Value != "\n":
 			l.last = token
-			continue next
+			return token, nil
 
-		case "break", "continue", "fallthrough", "return", "++", "--", ")", "}", "]":
+		case l.last.Type != backslashToken && l.semicolons.after(l.last):
 			token.Value = ";"
 			token.Type = ';'
+			l.last = token
+			return token, nil
+		}
+		l.last = token
+	}
+}
+
+// TokenKind classifies a Token for syntax highlighting.
+type TokenKind int
+
+const (
+	TokenComment TokenKind = iota + 1
+	TokenKeyword
+	TokenIdent
+	TokenBool
+	TokenNumber
+	TokenString
+	TokenChar
+	TokenTemplate
+	TokenEmbedded
+	TokenOperator
+	TokenPunct
+)
+
+var tokenKinds = map[string]TokenKind{
+	"Comment":        TokenComment,
+	"Modifier":       TokenKeyword,
+	"Keyword":        TokenKeyword,
+	"Ident":          TokenIdent,
+	"Bool":           TokenBool,
+	"Number":         TokenNumber,
+	"String":         TokenString,
+	"LiteralString":  TokenString,
+	"Char":           TokenChar,
+	"Template":       TokenTemplate,
+	"Embedded":       TokenEmbedded,
+	"Operator":       TokenOperator,
+	"Assignment":     TokenOperator,
+	"SingleOperator": TokenOperator,
+	"Punct":          TokenPunct,
+}
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokenComment:
+		return "comment"
+	case TokenKeyword:
+		return "keyword"
+	case TokenIdent:
+		return "ident"
+	case TokenBool:
+		return "bool"
+	case TokenNumber:
+		return "number"
+	case TokenString:
+		return "string"
+	case TokenChar:
+		return "char"
+	case TokenTemplate:
+		return "template"
+	case TokenEmbedded:
+		return "embedded"
+	case TokenOperator:
+		return "operator"
+	case TokenPunct:
+		return "punct"
+	}
+	return fmt.Sprintf("token(%d)", int(k))
+}
+
+// MarshalText renders the kind by name.
+func (k TokenKind) MarshalText() ([]byte, error) { return []byte(k.String()), nil }
+
+// A Token of source code.
+type Token struct {
+	Kind TokenKind
+	// Value is the source text of the token, or ";" for an inserted semi-colon.
+	Value string
+	Pos   lexer.Position
+	// EndPos is immediately after the token. Inserted semi-colons are empty,
+	// positioned at the newline they replace.
+	EndPos lexer.Position
+}
+
+// Lex returns the tokens of r as seen by the parser, including comments and
+// inserted semi-colons, up to but excluding EOF.
+//
+// Literals are not decoded or validated, so source that fails to parse can
+// still be highlighted.
+func Lex(r io.Reader) ([]Token, error) {
+	kinds := map[rune]TokenKind{}
+	for name, symbol := range commentLex.Symbols() {
+		kinds[symbol] = tokenKinds[name]
+	}
+	ll, err := commentLex.Lex(r)
+	if err != nil {
+		return nil, err
+	}
+	l := newFixupLexer(ll, nil)
+	tokens := []Token{}
+	for {
+		token, err := l.Next()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case token.EOF():
+			return tokens, nil
 
-		default:
-			switch l.last.Type {
-			case numberToken, stringToken, identToken:
-				token.Value = ";"
-				token.Type = ';'
+		case token.Type == ';':
+			tokens = append(tokens, Token{Kind: TokenPunct, Value: token.Value, Pos: token.Pos, EndPos: token.Pos})
 
-			default:
-				l.last = token
-				continue next
-			}
+		case kinds[token.Type] != 0:
+			tokens = append(tokens, Token{
+				Kind:   kinds[token.Type],
+				Value:  token.Value,
+				Pos:    token.Pos,
+				EndPos: advancePos(token.Pos, token.Value),
+			})
 		}
-		l.last = token
-		return token, nil
 	}
 }
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -29,8 +30,113 @@ func TestLexer(t *testing.T) {
 		actual = append(actual, token.Value)
 	}
 	expected := []string{
-		"fn", "foo", "(", ")", "{", "if", "true", "{", "print", "(", "hello", ")", ";", "}", ";", "a", "+=",
+		"fn", "foo", "(", ")", "{", "if", "true", "{", "print", "(", `"hello"`, ")", ";", "}", ";", "a", "+=",
 		"1", "+", "2", ";", "b", "=", "literal string", "}", ";", "",
 	}
 	require.Equal(t, expected, actual)
 }
+
+func TestLex(t *testing.T) {
+	tokens, err := Lex(strings.NewReader("let a = 1 + \\\n\t2 // one\nb /* c */ += 'x'\n"))
+	require.NoError(t, err)
+	actual := []string{}
+	for _, token := range tokens {
+		actual = append(actual, fmt.Sprintf("%d:%d-%d:%d %s %q",
+			token.Pos.Line, token.Pos.Column, token.EndPos.Line, token.EndPos.Column, token.Kind, token.Value))
+	}
+	require.Equal(t, []string{
+		`1:1-1:4 keyword "let"`,
+		`1:5-1:6 ident "a"`,
+		`1:7-1:8 operator "="`,
+		`1:9-1:10 number "1"`,
+		`1:11-1:12 operator "+"`,
+		`2:2-2:3 number "2"`,
+		`2:4-2:10 comment "// one"`,
+		`2:10-2:10 punct ";"`,
+		`3:1-3:2 ident "b"`,
+		`3:3-3:10 comment "/* c */"`,
+		`3:11-3:13 operator "+="`,
+		`3:14-3:17 char "'x'"`,
+		`3:17-3:17 punct ";"`,
+	}, actual)
+
+	// Keywords are not template or embedded tags.
+	tokens, err = Lex(strings.NewReader("return\"x\"\nin`y` for_`z`\n"))
+	require.NoError(t, err)
+	actual = []string{}
+	for _, token := range tokens {
+		actual = append(actual, fmt.Sprintf("%s %q", token.Kind, token.Value))
+	}
+	require.Equal(t, []string{
+		`keyword "return"`,
+		`string "\"x\""`,
+		`punct ";"`,
+		`keyword "in"`,
+		`string "` + "`y`" + `"`,
+		`embedded "for_` + "`z`" + `"`,
+		`punct ";"`,
+	}, actual)
+}
+
+func TestSemicolonPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"Ident", "a\nb\n", "a ; b ;"},
+		{"Number", "1\n", "1 ;"},
+		{"String", "\"s\"\n", "\"s\" ;"},
+		{"Char", "'c'\n", "'c' ;"},
+		{"Bool", "true\n", "true ;"},
+		{"Template", "html\"<p>\"\n", "html\"<p>\" ;"},
+		{"Embedded", "sql`SELECT 1`\n", "sql`SELECT 1` ;"},
+		{"LiteralString", "`raw`\n", "`raw`"},
+		{"Keywords", "break\ncontinue\nfallthrough\nreturn\nnil\n", "break ; continue ; fallthrough ; return ; nil ;"},
+		{"OtherKeywords", "let\nfn\n", "let fn"},
+		{"Brackets", "(\n)\n[\n]\n{\n}\n", "( ) ; [ ] ; { } ;"},
+		{"Operators", "a +\nb\n", "a + b ;"},
+		{"Punctuation", "a,\nb.\nc?\n", "a , b . c ?"},
+		{"BlankLines", "a\n\n\nb\n", "a ; b ;"},
+		{"ExplicitSemicolon", "a;\nb\n", "a ; b ;"},
+		{"LineComment", "a // c\nb\n", "a // c ; b ;"},
+		{"BlockComment", "a + /* c */\nb\n", "a + /* c */ b ;"},
+		{"Backslash", "a \\\n+ b\n", "a + b ;"},
+		{"NoTrailingNewline", "a", "a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := Lex(strings.NewReader(test.source))
+			require.NoError(t, err)
+			actual := []string{}
+			for _, token := range tokens {
+				actual = append(actual, token.Value)
+			}
+			require.Equal(t, test.expected, strings.Join(actual, " "))
+		})
+	}
+}
+
+func TestSemicolonsOption(t *testing.T) {
+	// Without semi-colon insertion, statements must be terminated explicitly.
+	policy := Semicolons(SemicolonPolicy{})
+	_, err := ParseString("let a = 1\n", policy)
+	require.EqualError(t, err, `2:1: unexpected token "<EOF>" (expected ";")`)
+	ast, err := ParseString("let a = 1\n+ 2;\n", policy)
+	require.NoError(t, err)
+	expected, err := ParseString("let a = 1 + 2\n")
+	require.NoError(t, err)
+	require.True(t, Equal(expected, ast))
+
+	// Tokens are decoded as usual.
+	ast, err = ParseString("var a = `raw` + 'c';\n", policy, KeywordAlias("var", "let"))
+	require.NoError(t, err)
+	expected, err = ParseString("let a = `raw` + 'c'\n")
+	require.NoError(t, err)
+	require.True(t, Equal(expected, ast))
+
+	_, err = ParseString("", Semicolons(SemicolonPolicy{Kinds: []string{"Identifier"}}))
+	require.EqualError(t, err, `unknown token kind "Identifier" in semi-colon policy`)
+	_, err = ParseString("", Semicolons(SemicolonPolicy{Kinds: []string{"whitespace"}}))
+	require.EqualError(t, err, `unknown token kind "whitespace" in semi-colon policy`)
+}
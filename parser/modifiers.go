@@ -1,25 +1,48 @@
 package parser
 
 import (
+	"encoding/json"
 	"strings"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
 )
 
 // Modifiers for a symbol, as a bit-field.
 type Modifiers int
 
-//go:generate stringer -linecomment -type Modifiers
-
 const (
-	ModifierPublic   Modifiers = 1 << (2 * iota) // pub
-	ModifierOverride                             // override
-	ModifierStatic                               // static
+	ModifierPublic Modifiers = 1 << (2 * iota)
+	ModifierOverride
+	ModifierStatic
 )
 
+var modifierNames = []struct {
+	modifier Modifiers
+	name     string
+}{
+	{ModifierPublic, "pub"},
+	{ModifierOverride, "override"},
+	{ModifierStatic, "static"},
+}
+
 // Has all of the given modifiers set.
 func (m Modifiers) Has(modifier Modifiers) bool {
 	return m&modifier == modifier
 }
 
+// String renders the modifiers as they would appear in source, eg. "pub static".
+func (m Modifiers) String() string {
+	var modifiers []string
+	for _, modifier := range modifierNames {
+		if m.Has(modifier.modifier) {
+			modifiers = append(modifiers, modifier.name)
+		}
+	}
+	return strings.Join(modifiers, " ")
+}
+
 func (m Modifiers) GoString() string {
 	var modifiers []string
 	if m&ModifierStatic != 0 {
@@ -34,19 +57,113 @@ func (m Modifiers) GoString() string {
 	return strings.Join(modifiers, "|")
 }
 
-func (m *Modifiers) Capture(values []string) error {
-	switch values[0] {
-	case "pub":
-		*m |= ModifierPublic
-
-	case "override":
-		*m |= ModifierOverride
+// Modifiers are encoded in JSON as they would appear in source.
+//
+// This is not done with encoding.TextUnmarshaler as participle would use it in
+// preference to Parse.
+func (m Modifiers) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
 
-	case "static":
-		*m |= ModifierStatic
+func (m *Modifiers) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return errors.WithStack(err)
+	}
+	*m = 0
+next:
+	for _, name := range strings.Fields(text) {
+		for _, modifier := range modifierNames {
+			if modifier.name == name {
+				*m |= modifier.modifier
+				continue next
+			}
+		}
+		return errors.Errorf("unknown modifier %q", name)
+	}
+	return nil
+}
 
-	default:
+func (m *Modifiers) Parse(lex *lexer.PeekingLexer) error {
+	*m = 0
+next:
+	for {
+		token, err := lex.Peek(0)
+		if err != nil {
+			return err
+		}
+		if token.Type != modifierToken {
+			break
+		}
+		_, _ = lex.Next()
+		for _, modifier := range modifierNames {
+			if modifier.name != token.Value {
+				continue
+			}
+			if m.Has(modifier.modifier) {
+				return participle.Errorf(token.Pos, "duplicate modifier %q", token.Value)
+			}
+			*m |= modifier.modifier
+			continue next
+		}
 		panic("??")
 	}
+	if *m == 0 {
+		return participle.NextMatch
+	}
 	return nil
 }
+
+// Reject modifiers that are not meaningful on the declarations they are
+// applied to.
+func validateModifiers(node Node) error {
+	return VisitFunc(node, func(node Node, next Next) error {
+		var (
+			modifiers Modifiers
+			allowed   Modifiers
+			kind      string
+		)
+		switch node := node.(type) {
+		case *RootDecl:
+			modifiers = node.Modifiers
+			switch {
+			case node.Import != nil:
+				kind = "imports"
+			case node.Cond != nil:
+				kind = "compile-time conditionals"
+			default:
+				kind, allowed = "top-level declarations", ModifierPublic
+			}
+
+		case *ClassMember:
+			modifiers = node.Modifiers
+			switch {
+			case node.FuncDecl != nil:
+				kind, allowed = "methods", ModifierPublic|ModifierStatic|ModifierOverride
+			case node.VarDecl != nil:
+				kind, allowed = "fields", ModifierPublic|ModifierStatic
+			case node.InitialiserDecl != nil:
+				kind, allowed = "initialisers", ModifierPublic
+			default:
+				kind, allowed = "nested types", ModifierPublic
+			}
+
+		case *EnumMember:
+			modifiers = node.Modifiers
+			if node.CaseDecl != nil {
+				kind = "enum cases"
+			} else {
+				kind, allowed = "enum methods", ModifierPublic|ModifierStatic
+			}
+
+		default:
+			return next(nil)
+		}
+		for _, modifier := range modifierNames {
+			if modifiers.Has(modifier.modifier) && !allowed.Has(modifier.modifier) {
+				return participle.Errorf(node.Position(), "%q is not valid on %s", modifier.name, kind)
+			}
+		}
+		return next(nil)
+	})
+}
@@ -94,6 +94,22 @@ func (o Op) GoString() string {
 	}
 }
 
+func (o Op) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *Op) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "":
+		*o = OpNone
+	case "->":
+		*o = OpSend
+	default:
+		return o.Capture([]string{string(text)})
+	}
+	return nil
+}
+
 func (o *Op) Capture(values []string) error {
 	switch values[0] {
 	case "%=":
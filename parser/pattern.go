@@ -0,0 +1,54 @@
+package parser
+
+// Pattern is a destructuring pattern on the left hand side of a variable declaration.
+//
+//	let [a, b, ...rest] = xs
+//	let {x, y} = point
+type Pattern struct {
+	Mixin
+
+	Array *ArrayPattern `  @@`
+	Dict  *DictPattern  `| @@`
+}
+
+func (p *Pattern) accept(visitor VisitorFunc) error {
+	return visitor(p, func(err error) error { return err })
+}
+
+// Names returns the names bound by the pattern, in order.
+func (p *Pattern) Names() []string {
+	names := []string{}
+	switch {
+	case p.Array != nil:
+		for _, element := range p.Array.Elements {
+			names = append(names, element.Name)
+		}
+
+	case p.Dict != nil:
+		names = append(names, p.Dict.Keys...)
+	}
+	return names
+}
+
+// ArrayPattern destructures the elements of an array, with an optional trailing
+// "...<name>" capturing the remaining elements.
+type ArrayPattern struct {
+	Mixin
+
+	Elements []*ArrayPatternElement `"[" ( @@ ( "," @@ )* ","? )? "]"`
+}
+
+// ArrayPatternElement is a single name in an ArrayPattern.
+type ArrayPatternElement struct {
+	Mixin
+
+	Rest bool   `@"..."?`
+	Name string `@Ident`
+}
+
+// DictPattern destructures the named keys of a dict, or fields of a class.
+type DictPattern struct {
+	Mixin
+
+	Keys []string `"{" @Ident ( "," @Ident )* ","? "}"`
+}
@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ANSI escape sequences used when rendering with colour.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiBlue   = "\x1b[34m"
+	ansiCyan   = "\x1b[36m"
+)
+
+type renderOptions struct {
+	colour  bool
+	context int
+}
+
+// RenderOption configures RenderDiagnostic.
+type RenderOption func(*renderOptions)
+
+// WithColour renders using ANSI colours.
+func WithColour() RenderOption {
+	return func(o *renderOptions) { o.colour = true }
+}
+
+// WithContext renders n lines of source before and after the offending line.
+// The default is 1.
+func WithContext(n int) RenderOption {
+	return func(o *renderOptions) { o.context = n }
+}
+
+// RenderDiagnostic formats a diagnostic with the offending source from src,
+// the span from Pos to EndPos underlined, eg.
+//
+//	warning[spelling]: "vaule" is misspelt
+//	 --> main.langx:2:7
+//	  |
+//	1 | fn f() {
+//	2 |   let vaule = 1
+//	  |       ^^^^^
+//	3 | }
+//	  |
+//	  = help: Rename "vaule" to "value"
+//
+// If the diagnostic has no position, or it is outside src, only the message
+// is rendered.
+func RenderDiagnostic(src string, diag Diagnostic, opts ...RenderOption) string {
+	o := &renderOptions{context: 1}
+	for _, opt := range opts {
+		opt(o)
+	}
+	paint := func(style, text string) string {
+		if !o.colour {
+			return text
+		}
+		return style + text + ansiReset
+	}
+	severity := diag.Severity
+	if severity == 0 {
+		severity = SeverityError
+	}
+	style := severityStyle(severity)
+
+	w := &strings.Builder{}
+	header := severity.String()
+	if diag.Code != "" {
+		header += "[" + diag.Code + "]"
+	}
+	fmt.Fprintf(w, "%s%s\n", paint(ansiBold+style, header), paint(ansiBold, ": "+diag.Message))
+
+	lines := strings.Split(src, "\n")
+	line := diag.Pos.Line
+	if line < 1 || line > len(lines) {
+		renderNotes(w, diag, paint)
+		return w.String()
+	}
+	first, last := line-o.context, line+o.context
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	width := len(strconv.Itoa(last))
+	gutter := func(label string) string {
+		return paint(ansiBold+ansiBlue, fmt.Sprintf("%*s |", width, label))
+	}
+
+	fmt.Fprintf(w, "%s %s\n", paint(ansiBold+ansiBlue, strings.Repeat(" ", width)+"-->"), diag.Pos)
+	fmt.Fprintln(w, gutter(""))
+	for i := first; i <= last; i++ {
+		text := strings.TrimSuffix(lines[i-1], "\r")
+		fmt.Fprintf(w, "%s %s\n", gutter(strconv.Itoa(i)), text)
+		if i == line {
+			start, end := underline(text, diag)
+			fmt.Fprintf(w, "%s %s%s\n", gutter(""), indent(text, start), paint(ansiBold+style, strings.Repeat("^", end-start)))
+		}
+	}
+	fmt.Fprintln(w, gutter(""))
+	renderNotes(w, diag, paint)
+	return w.String()
+}
+
+func renderNotes(w *strings.Builder, diag Diagnostic, paint func(style, text string) string) {
+	for _, related := range diag.RelatedInfo {
+		fmt.Fprintf(w, "  %s %s: %s\n", paint(ansiBold, "= note:"), related.Pos, related.Message)
+	}
+	if diag.SuggestedFix != nil {
+		fmt.Fprintf(w, "  %s %s\n", paint(ansiBold, "= help:"), diag.SuggestedFix.Description)
+	}
+}
+
+func severityStyle(severity Severity) string {
+	switch severity {
+	case SeverityWarning:
+		return ansiYellow
+	case SeverityInfo:
+		return ansiBlue
+	case SeverityHint:
+		return ansiCyan
+	}
+	return ansiRed
+}
+
+// The span of the diagnostic on its first line, as zero-based rune columns.
+//
+// Spans ending on a later line are underlined to the end of the line, and
+// diagnostics without an end are underlined with a single caret.
+func underline(text string, diag Diagnostic) (start, end int) {
+	length := utf8.RuneCountInString(text)
+	start = diag.Pos.Column - 1
+	if start > length {
+		start = length
+	}
+	if start < 0 {
+		start = 0
+	}
+	switch {
+	case diag.EndPos.Line > diag.Pos.Line:
+		end = length
+	case diag.EndPos.Line == diag.Pos.Line:
+		end = diag.EndPos.Column - 1
+	}
+	if end > length {
+		end = length
+	}
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// Whitespace aligning with column n of text, preserving tabs.
+func indent(text string, n int) string {
+	out := &strings.Builder{}
+	for _, r := range text {
+		if n == 0 {
+			break
+		}
+		if r == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+		n--
+	}
+	out.WriteString(strings.Repeat(" ", n))
+	return out.String()
+}
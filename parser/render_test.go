@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderDiagnostic(t *testing.T) {
+	src := "fn f() {\n\tlet vaule = 1\n}\n"
+	tests := []struct {
+		name     string
+		diag     Diagnostic
+		opts     []RenderOption
+		expected string
+	}{
+		{name: "Span",
+			diag: Diagnostic{Severity: SeverityWarning, Code: "spelling", Message: `"vaule" is misspelt`,
+				Pos:          lexer.Position{Filename: "main.langx", Line: 2, Column: 6},
+				EndPos:       lexer.Position{Filename: "main.langx", Line: 2, Column: 11},
+				SuggestedFix: &Fix{Description: `Rename "vaule" to "value"`}},
+			expected: "" +
+				"warning[spelling]: \"vaule\" is misspelt\n" +
+				" --> main.langx:2:6\n" +
+				"  |\n" +
+				"1 | fn f() {\n" +
+				"2 | \tlet vaule = 1\n" +
+				"  | \t    ^^^^^\n" +
+				"3 | }\n" +
+				"  |\n" +
+				"  = help: Rename \"vaule\" to \"value\"\n"},
+		{name: "Caret",
+			diag: Diagnostic{Severity: SeverityError, Message: "missing return",
+				Pos: lexer.Position{Line: 1, Column: 1},
+				RelatedInfo: []RelatedInfo{
+					{Pos: lexer.Position{Line: 2, Column: 2}, Message: "path ends without returning"},
+				}},
+			opts: []RenderOption{WithContext(0)},
+			expected: "" +
+				"error: missing return\n" +
+				" --> 1:1\n" +
+				"  |\n" +
+				"1 | fn f() {\n" +
+				"  | ^\n" +
+				"  |\n" +
+				"  = note: 2:2: path ends without returning\n"},
+		{name: "MultiLine",
+			diag: Diagnostic{Severity: SeverityError, Message: "bad block",
+				Pos:    lexer.Position{Line: 1, Column: 8},
+				EndPos: lexer.Position{Line: 3, Column: 2}},
+			opts: []RenderOption{WithContext(0)},
+			expected: "" +
+				"error: bad block\n" +
+				" --> 1:8\n" +
+				"  |\n" +
+				"1 | fn f() {\n" +
+				"  |        ^\n" +
+				"  |\n"},
+		{name: "NoPosition",
+			diag:     Diagnostic{Severity: SeverityError, Message: "boom"},
+			expected: "error: boom\n"},
+		{name: "Colour",
+			diag: Diagnostic{Severity: SeverityError, Message: "boom", Pos: lexer.Position{Line: 3, Column: 1}},
+			opts: []RenderOption{WithColour(), WithContext(0)},
+			expected: "" +
+				"\x1b[1m\x1b[31merror\x1b[0m\x1b[1m: boom\x1b[0m\n" +
+				"\x1b[1m\x1b[34m -->\x1b[0m 3:1\n" +
+				"\x1b[1m\x1b[34m  |\x1b[0m\n" +
+				"\x1b[1m\x1b[34m3 |\x1b[0m }\n" +
+				"\x1b[1m\x1b[34m  |\x1b[0m \x1b[1m\x1b[31m^\x1b[0m\n" +
+				"\x1b[1m\x1b[34m  |\x1b[0m\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, RenderDiagnostic(src, test.diag, test.opts...))
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package parser
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
+)
+
+// Reparse returns the AST of source after replacing length bytes at offset
+// with text, given previous, the AST of source as returned by Parse.
+//
+// Only the top-level declarations touched by the edit are re-lexed and
+// re-parsed, and spliced between the unaffected declarations of previous. The
+// unaffected declarations are reused and those following the edit are
+// repositioned in place, so previous must not be used afterwards.
+//
+// If the affected declarations do not parse in isolation, such as when the
+// edit opens a block comment, the whole of the new source is parsed instead so
+// that errors are identical to those of Parse.
+func Reparse(previous *AST, source string, offset, length int, text string, opts ...Option) (*AST, error) {
+	if offset < 0 || length < 0 || offset+length > len(source) {
+		return nil, errors.Errorf("edit of %d bytes at offset %d is outside the source", length, offset)
+	}
+	updated := source[:offset] + text + source[offset+length:]
+	filename := previous.Pos.Filename
+	full := func() (*AST, error) {
+		return Parse(&namedReader{Reader: bytes.NewReader([]byte(updated)), name: filename}, opts...)
+	}
+
+	// Declarations before the edit, and the offset at which the region to
+	// re-parse starts.
+	before := 0
+	start := 0
+	if previous.Module != nil {
+		if start = separated(source, previous.Module, offset); start < 0 {
+			return full()
+		}
+	}
+	for _, decl := range previous.Declarations {
+		end := separated(source, decl, offset)
+		if end < 0 {
+			break
+		}
+		before, start = before+1, end
+	}
+	// Declarations following the edit, and the offset at which they start.
+	after := len(previous.Declarations)
+	end := len(source)
+	for after > before && previous.Declarations[after-1].Pos.Offset > offset+length {
+		after--
+		end = previous.Declarations[after].Pos.Offset
+	}
+
+	region, err := parse(&namedReader{Reader: bytes.NewReader([]byte(updated[start : end+len(text)-length])), name: filename}, opts...)
+	if err != nil || region.Module != nil {
+		return full()
+	}
+
+	// Position the region within the new source.
+	base := lexer.Position{Filename: filename, Line: 1, Column: 1}
+	if start > 0 {
+		last := previous.Module.EndPos
+		if before > 0 {
+			last = previous.Declarations[before-1].EndPos
+		}
+		base = advancePos(last, source[last.Offset:start])
+	}
+	mapPositions(region, func(pos *lexer.Position) {
+		if pos.Line == 1 {
+			pos.Column += base.Column - 1
+		}
+		pos.Line += base.Line - 1
+		pos.Offset += base.Offset
+	})
+
+	// Reposition everything after the edit.
+	oldEnd := advancePos(base, source[start:offset+length])
+	newEnd := advancePos(base, updated[start:offset+len(text)])
+	following := previous.Declarations[after:]
+	mapPositions(following, func(pos *lexer.Position) {
+		if pos.Line == oldEnd.Line {
+			pos.Column += newEnd.Column - oldEnd.Column
+		}
+		pos.Line += newEnd.Line - oldEnd.Line
+		pos.Offset += newEnd.Offset - oldEnd.Offset
+	})
+
+	ast := &AST{Mixin: previous.Mixin, Module: previous.Module}
+	ast.Declarations = append(ast.Declarations, previous.Declarations[:before]...)
+	ast.Declarations = append(ast.Declarations, region.Declarations...)
+	ast.Declarations = append(ast.Declarations, following...)
+	n := len(ast.Declarations)
+	switch {
+	case ast.Module != nil && n == 0:
+		ast.EndPos = ast.Module.EndPos
+
+	case ast.Module != nil:
+		ast.EndPos = ast.Declarations[n-1].EndPos
+
+	case n > 0:
+		ast.Pos, ast.EndPos = ast.Declarations[0].Pos, ast.Declarations[n-1].EndPos
+
+	default:
+		return full()
+	}
+	return ast, nil
+}
+
+// Returns the offset immediately after the separator terminating node if it
+// precedes offset in source, or -1 if the node may be affected by an edit at
+// offset.
+//
+// A node is separated by a newline or semi-colon following it on the same
+// line, after which a declaration starts afresh.
+func separated(source string, node Node, offset int) int {
+	for i := node.EndPosition().Offset; i < offset; i++ {
+		switch source[i] {
+		case ' ', '\t', '\r':
+		case '\n':
+			return i
+		case ';':
+			return i + 1
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+var stringType = reflect.TypeOf(String{})
+
+// Apply fn to every position within v, including those of nodes shared by
+// desugaring, once.
+func mapPositions(v interface{}, fn func(pos *lexer.Position)) {
+	m := &positionMapper{fn: fn, seen: map[cloned]bool{}}
+	m.walk(reflect.ValueOf(v))
+}
+
+type positionMapper struct {
+	fn   func(pos *lexer.Position)
+	seen map[cloned]bool
+}
+
+func (m *positionMapper) walk(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		key := cloned{v.Type(), v.Pointer()}
+		if m.seen[key] {
+			return
+		}
+		m.seen[key] = true
+		m.walk(v.Elem())
+
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			m.walk(v.Index(i))
+		}
+
+	case reflect.Struct:
+		if v.Type() == positionType {
+			if pos := v.Addr().Interface().(*lexer.Position); pos.Line != 0 {
+				m.fn(pos)
+			}
+			return
+		}
+		if v.Type() == stringType {
+			// Interpolated expressions are positioned within the string.
+			m.walk(v.FieldByName("Mixin"))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				m.walk(v.Field(i))
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+)
+
+// ParseDecls parses langx source, calling fn with each top-level declaration
+// as soon as it is parsed, and returning the module declaration, if any.
+//
+// Declarations are not retained, so memory is bounded by the source and its
+// tokens rather than its AST. Parsing stops at the first error, which is
+// returned as a *Diagnostic unless it was returned by fn.
+func ParseDecls(r io.Reader, fn func(*RootDecl) error, opts ...Option) (*ModuleDecl, error) {
+	var fnErr error
+	module, err := parseDecls(r, func(decl *RootDecl) error {
+		fnErr = fn(decl)
+		return fnErr
+	}, opts...)
+	switch {
+	case fnErr != nil:
+		return module, fnErr
+	case err != nil:
+		return module, ToDiagnostic(err)
+	}
+	return module, nil
+}
+
+func parseDecls(r io.Reader, fn func(*RootDecl) error, opts ...Option) (*ModuleDecl, error) {
+	o, source, err := readSource(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	lex, err := rootDeclParser.Lexer().Lex(source())
+	if err != nil {
+		return nil, err
+	}
+	if len(o.aliases) > 0 {
+		lex = &aliasLexer{lexer: lex, aliases: o.aliases}
+	}
+	peeker, err := lexer.Upgrade(lex)
+	if err != nil {
+		return nil, err
+	}
+	ends, err := newEndPositions(source())
+	if err != nil {
+		return nil, err
+	}
+
+	var module *ModuleDecl
+	if token, _ := peeker.Peek(0); token.Value == "module" {
+		module = &ModuleDecl{}
+		if err := moduleDeclParser.ParseFromLexer(peeker, module, participle.AllowTrailing(true)); err != nil {
+			return nil, err
+		}
+		ends.walk(reflect.ValueOf(module))
+	}
+	for {
+		if token, _ := peeker.Peek(0); token.EOF() {
+			return module, nil
+		}
+		decl := &RootDecl{}
+		if err := rootDeclParser.ParseFromLexer(peeker, decl, participle.AllowTrailing(true)); err != nil {
+			return module, err
+		}
+		if err := validateModifiers(decl); err != nil {
+			return module, err
+		}
+		ends.walk(reflect.ValueOf(decl))
+		if err := checkTrailingCommas(ends.tokens[ends.starts[decl.Pos.Offset]:ends.last(decl)+1], o.trailingCommas); err != nil {
+			return module, err
+		}
+		if err := fn(decl); err != nil {
+			return module, err
+		}
+	}
+}
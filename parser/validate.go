@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/alecthomas/participle"
+)
+
+// Nodes that are exactly one of several alternatives, with the fields holding
+// each alternative.
+var alternatives = map[reflect.Type][]string{
+	reflect.TypeOf(RootDecl{}):      {"Class", "Import", "Enum", "Var", "Func", "Cond"},
+	reflect.TypeOf(EnumMember{}):    {"CaseDecl", "FuncDecl"},
+	reflect.TypeOf(ClassMember{}):   {"VarDecl", "FuncDecl", "ClassDecl", "EnumDecl", "InitialiserDecl"},
+	reflect.TypeOf(TypeDecl{}):      {"Named", "Array", "DictOrSet"},
+	reflect.TypeOf(Stmt{}):          {"Return", "If", "Break", "Continue", "For", "Switch", "Block", "VarDecl", "FuncDecl", "ClassDecl", "EnumDecl", "ExprStmt"},
+	reflect.TypeOf(Terminal{}):      {"Tuple", "New", "Do", "Func", "Literal", "Ident"},
+	reflect.TypeOf(ReferenceNext{}): {"Subscript", "Reference", "Specialisation", "Call"},
+	reflect.TypeOf(Literal{}):       {"Number", "Str", "LitStr", "Embedded", "Template", "Char", "Bool", "Nil", "DictOrSet", "Array"},
+	reflect.TypeOf(Pattern{}):       {"Array", "Dict"},
+}
+
+// Validate checks that every node within node has exactly one alternative
+// set, where it is one of several, such as a RootDecl or Stmt, and that
+// chained comparisons extend a comparison.
+//
+// ASTs returned by Parse are always valid, but those constructed or modified
+// by hand may not be. Methods such as RootDecl.Decl panic on invalid nodes,
+// so ASTs from elsewhere should be validated before use.
+func Validate(node Node) error {
+	if node == nil {
+		return nil
+	}
+	v := &validator{seen: map[cloned]bool{}}
+	return v.validate(reflect.ValueOf(node))
+}
+
+type validator struct {
+	seen map[cloned]bool
+}
+
+func (v *validator) validate(value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return nil
+		}
+		key := cloned{value.Type(), value.Pointer()}
+		if v.seen[key] {
+			return nil
+		}
+		v.seen[key] = true
+		return v.validate(value.Elem())
+
+	case reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return v.validate(value.Elem())
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if err := v.validate(value.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		if err := checkAlternatives(value); err != nil {
+			return err
+		}
+		if err := checkChain(value); err != nil {
+			return err
+		}
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if err := v.validate(value.Field(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkAlternatives(value reflect.Value) error {
+	fields, ok := alternatives[value.Type()]
+	if !ok {
+		return nil
+	}
+	set := 0
+	for _, field := range fields {
+		if !value.FieldByName(field).IsZero() {
+			set++
+		}
+	}
+	if set == 1 {
+		return nil
+	}
+	pos := value.FieldByName("Mixin").Interface().(Mixin).Pos
+	return participle.Errorf(pos, "invalid %s: exactly one of %s or %s must be set",
+		value.Type().Name(), strings.Join(fields[:len(fields)-1], ", "), fields[len(fields)-1])
+}
+
+func checkChain(value reflect.Value) error {
+	expr, ok := value.Interface().(Expr)
+	if !ok || !expr.Chained {
+		return nil
+	}
+	if !isComparison(expr.Op) || expr.Left == nil || !isComparison(expr.Left.Op) {
+		return participle.Errorf(expr.Pos, "invalid Expr: a chained comparison must extend a comparison")
+	}
+	return nil
+}
+
+// The error for a node with no alternative set, encountered while walking.
+func invalidNode(node Node) error {
+	value := reflect.Indirect(reflect.ValueOf(node))
+	if err := checkAlternatives(value); err != nil {
+		return err
+	}
+	return participle.Errorf(node.Position(), "invalid %s", value.Type().Name())
+}
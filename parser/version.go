@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ASTVersion is the version of the shape of the AST, as "major.minor".
+//
+// The minor version is incremented when nodes or fields are added, and the
+// major version when they are removed, renamed or change meaning. A field
+// being replaced is retained, marked Deprecated and populated alongside its
+// replacement, until the next major version.
+//
+// Each version has a fixture in testdata/ast which must continue to decode.
+const ASTVersion = "1.7"
+
+type versionedAST struct {
+	Version string `json:"version"`
+	AST     *AST   `json:"ast"`
+}
+
+// EncodeAST writes ast to w as JSON, tagged with ASTVersion.
+func EncodeAST(w io.Writer, ast *AST) error {
+	return errors.WithStack(json.NewEncoder(w).Encode(&versionedAST{Version: ASTVersion, AST: ast}))
+}
+
+// DecodeAST reads an AST written by EncodeAST.
+//
+// ASTs written by any earlier minor version of the current major version are
+// accepted. Later versions are rejected rather than silently dropping nodes
+// this version does not know about.
+func DecodeAST(r io.Reader) (*AST, error) {
+	in := &versionedAST{}
+	if err := json.NewDecoder(r).Decode(in); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	major, minor, err := parseASTVersion(in.Version)
+	if err != nil {
+		return nil, err
+	}
+	currentMajor, currentMinor, _ := parseASTVersion(ASTVersion)
+	if major != currentMajor || minor > currentMinor {
+		return nil, errors.Errorf("can't decode AST version %s, expected %d.0 to %s", in.Version, currentMajor, ASTVersion)
+	}
+	if in.AST == nil {
+		return nil, errors.New("missing AST")
+	}
+	return in.AST, nil
+}
+
+func parseASTVersion(version string) (major, minor int, err error) {
+	parts := strings.Split(version, ".")
+	if len(parts) == 2 {
+		major, err = strconv.Atoi(parts[0])
+		if err == nil {
+			minor, err = strconv.Atoi(parts[1])
+		}
+	}
+	if len(parts) != 2 || err != nil || major < 0 || minor < 0 {
+		return 0, 0, errors.Errorf("invalid AST version %q", version)
+	}
+	return major, minor, nil
+}
@@ -1,24 +1,32 @@
 package parser
 
 import (
-	"errors"
-	"reflect"
-
 	"github.com/alecthomas/participle/lexer"
+	"github.com/pkg/errors"
 )
 
+//go:generate go run ./internal/genvisitor
+
 // go-sumtype:decl Node
 
 type Mixin struct {
 	Pos lexer.Position
+	// EndPos is the position immediately after the last token of the node.
+	//
+	// It is only recorded by Parse, and not for expressions interpolated
+	// into strings.
+	EndPos lexer.Position
 }
 
-func (p Mixin) Position() lexer.Position { return p.Pos }
+func (p Mixin) Position() lexer.Position    { return p.Pos }
+func (p Mixin) EndPosition() lexer.Position { return p.EndPos }
 
 // A Node in the AST.
 type Node interface {
 	Position() lexer.Position
+	EndPosition() lexer.Position
 	accept(visitor VisitorFunc) error
+	visit(visitor Visitor) error
 }
 
 // Next should be called by VisitorFunc to proceed with the walk.
@@ -31,28 +39,86 @@ type VisitorFunc func(node Node, next Next) error
 
 // VisitFunc calls the visitor function on all nodes.
 func VisitFunc(node Node, visit VisitorFunc) error {
-	if node == nil || (reflect.ValueOf(node).Kind() == reflect.Ptr && reflect.ValueOf(node).IsNil()) {
+	if isNil(node) {
 		return nil
 	}
 	return node.accept(visit)
 }
 
+// A Walker's Visit method is called by Walk for each node. If the result w is
+// not nil, Walk visits each of the children of node with w, followed by a
+// call of w.Visit(nil).
+//
+// This allows passes to leave scopes or compute synthesised attributes after
+// a node's children, without maintaining their own stacks.
+type Walker interface {
+	Visit(node Node) (w Walker)
+}
+
+// Walk traverses the AST in depth-first order, as go/ast.Walk does.
+//
+// An error is only returned for invalid nodes (see Validate).
+func Walk(w Walker, node Node) error {
+	walkers := []Walker{w}
+	return VisitFunc(node, func(node Node, next Next) error {
+		w := walkers[len(walkers)-1].Visit(node)
+		if w == nil {
+			return nil
+		}
+		walkers = append(walkers, w)
+		err := next(nil)
+		walkers = walkers[:len(walkers)-1]
+		if err != nil {
+			return err
+		}
+		w.Visit(nil)
+		return nil
+	})
+}
+
+// Inspect traverses the AST in depth-first order, calling f for each node with
+// its ancestors, outermost first. The children of a node are only visited if
+// f returns true.
+//
+// ancestors is reused, so must be copied to be retained after f returns. An
+// error is only returned for invalid nodes (see Validate).
+func Inspect(node Node, f func(node Node, ancestors []Node) bool) error {
+	ancestors := []Node{}
+	return VisitFunc(node, func(node Node, next Next) error {
+		if !f(node, ancestors) {
+			return nil
+		}
+		ancestors = append(ancestors, node)
+		err := next(nil)
+		ancestors = ancestors[:len(ancestors)-1]
+		return err
+	})
+}
+
 // Visitor type-safe interface.
 //
 // Any method may return TerminateRecursion to stop recursion but continue with traversal.
 type Visitor interface {
 	VisitAST(n *AST) error
+	VisitAnnotation(n *Annotation) error
 	VisitExprStmt(n *ExprStmt) error
 	VisitArrayLiteral(n ArrayLiteral) error
 	VisitBlock(n Block) error
+	VisitBreakStmt(n BreakStmt) error
 	VisitCall(n Call) error
 	VisitCaseDecl(n *CaseDecl) error
+	VisitCaseField(n *CaseField) error
 	VisitCaseSelect(n CaseSelect) error
 	VisitCaseStmt(n CaseStmt) error
 	VisitClassDecl(n *ClassDecl) error
 	VisitClassMember(n *ClassMember) error
+	VisitClosure(n *Closure) error
+	VisitContinueStmt(n ContinueStmt) error
+	VisitCondDecl(n *CondDecl) error
+	VisitDoExpr(n *DoExpr) error
 	VisitDictOrSetEntryLiteral(n DictOrSetEntryLiteral) error
 	VisitDictOrSetLiteral(n DictOrSetLiteral) error
+	VisitEmbedded(n *Embedded) error
 	VisitEnumCase(n EnumCase) error
 	VisitEnumDecl(n *EnumDecl) error
 	VisitEnumMember(n *EnumMember) error
@@ -61,11 +127,14 @@ type Visitor interface {
 	VisitNew(n *NewExpr) error
 	VisitForStmt(n ForStmt) error
 	VisitFuncDecl(n *FuncDecl) error
+	VisitFuncType(n *FuncType) error
 	VisitIfStmt(n IfStmt) error
 	VisitImportDecl(n *ImportDecl) error
 	VisitInitialiserDecl(n *InitialiserDecl) error
 	VisitLiteral(n *Literal) error
+	VisitModuleDecl(n *ModuleDecl) error
 	VisitParameters(n Parameters) error
+	VisitPattern(n *Pattern) error
 	VisitReference(n *Reference) error
 	VisitReferenceNext(n *ReferenceNext) error
 	VisitReturnStmt(n ReturnStmt) error
@@ -73,6 +142,7 @@ type Visitor interface {
 	VisitStmt(n Stmt) error
 	VisitSwitchStmt(n SwitchStmt) error
 	VisitTerminal(n Terminal) error
+	VisitTemplate(n *Template) error
 	VisitTypeDecl(n TypeDecl) error
 	VisitArrayTypeDecl(n *ArrayTypeDecl) error
 	VisitDictOrSetTypeDecl(n *DictOrSetTypeDecl) error
@@ -89,96 +159,10 @@ var TerminateRecursion = errors.New("no recurse")
 // Visit walks the AST calling the corresponding method on "visitor" for each AST node type.
 func Visit(node Node, visitor Visitor) error {
 	return VisitFunc(node, func(node Node, next Next) error {
-		if node == nil || (reflect.ValueOf(node).Kind() == reflect.Ptr && reflect.ValueOf(node).IsNil()) {
-			return nil
-		}
-		maybeNext := func(err error) error {
-			if err == TerminateRecursion {
-				return nil
-			}
-			return next(err)
-		}
-		switch n := node.(type) {
-		case nil:
+		err := node.visit(visitor)
+		if err == TerminateRecursion {
 			return nil
-		case *AST:
-			return maybeNext(visitor.VisitAST(n))
-		case ArrayLiteral:
-			return maybeNext(visitor.VisitArrayLiteral(n))
-		case Block:
-			return maybeNext(visitor.VisitBlock(n))
-		case Call:
-			return maybeNext(visitor.VisitCall(n))
-		case *CaseDecl:
-			return maybeNext(visitor.VisitCaseDecl(n))
-		case CaseSelect:
-			return maybeNext(visitor.VisitCaseSelect(n))
-		case CaseStmt:
-			return maybeNext(visitor.VisitCaseStmt(n))
-		case *ClassDecl:
-			return maybeNext(visitor.VisitClassDecl(n))
-		case *ClassMember:
-			return maybeNext(visitor.VisitClassMember(n))
-		case DictOrSetEntryLiteral:
-			return maybeNext(visitor.VisitDictOrSetEntryLiteral(n))
-		case DictOrSetLiteral:
-			return maybeNext(visitor.VisitDictOrSetLiteral(n))
-		case EnumCase:
-			return maybeNext(visitor.VisitEnumCase(n))
-		case *EnumDecl:
-			return maybeNext(visitor.VisitEnumDecl(n))
-		case *EnumMember:
-			return maybeNext(visitor.VisitEnumMember(n))
-		case *Expr:
-			return maybeNext(visitor.VisitExpr(n))
-		case *String:
-			return maybeNext(visitor.VisitString(n))
-		case ForStmt:
-			return maybeNext(visitor.VisitForStmt(n))
-		case *FuncDecl:
-			return maybeNext(visitor.VisitFuncDecl(n))
-		case IfStmt:
-			return maybeNext(visitor.VisitIfStmt(n))
-		case *ImportDecl:
-			return maybeNext(visitor.VisitImportDecl(n))
-		case *InitialiserDecl:
-			return maybeNext(visitor.VisitInitialiserDecl(n))
-		case Parameters:
-			return maybeNext(visitor.VisitParameters(n))
-		case *ReferenceNext:
-			return maybeNext(visitor.VisitReferenceNext(n))
-		case *RootDecl:
-			return maybeNext(visitor.VisitRootDecl(n))
-		case SwitchStmt:
-			return maybeNext(visitor.VisitSwitchStmt(n))
-		case TypeDecl:
-			return maybeNext(visitor.VisitTypeDecl(n))
-		case *NamedTypeDecl:
-			return maybeNext(visitor.VisitNamedTypeDecl(n))
-		case *ArrayTypeDecl:
-			return maybeNext(visitor.VisitArrayTypeDecl(n))
-		case *DictOrSetTypeDecl:
-			return maybeNext(visitor.VisitDictOrSetTypeDecl(n))
-		case *Unary:
-			return maybeNext(visitor.VisitUnary(n))
-		case VarDeclAsgn:
-			return maybeNext(visitor.VisitVarDeclAsgn(n))
-		case *Literal:
-			return maybeNext(visitor.VisitLiteral(n))
-		case *Reference:
-			return maybeNext(visitor.VisitReference(n))
-		case ReturnStmt:
-			return maybeNext(visitor.VisitReturnStmt(n))
-		case Stmt:
-			return maybeNext(visitor.VisitStmt(n))
-		case Terminal:
-			return maybeNext(visitor.VisitTerminal(n))
-		case TypeParamDecl:
-			return maybeNext(visitor.VisitTypeParamDecl(n))
-		case *VarDecl:
-			return maybeNext(visitor.VisitVarDecl(n))
-		default:
-			panic("??")
 		}
+		return next(err)
 	})
 }
@@ -0,0 +1,222 @@
+// Code generated by genvisitor; DO NOT EDIT.
+
+package parser
+
+// Returns true if node is nil, or a nil pointer to a node.
+func isNil(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *AST:
+		return node == nil
+	case *Annotation:
+		return node == nil
+	case *ArrayLiteral:
+		return node == nil
+	case *ArrayTypeDecl:
+		return node == nil
+	case *Block:
+		return node == nil
+	case *BreakStmt:
+		return node == nil
+	case *Call:
+		return node == nil
+	case *CaseDecl:
+		return node == nil
+	case *CaseField:
+		return node == nil
+	case *CaseSelect:
+		return node == nil
+	case *CaseStmt:
+		return node == nil
+	case *ClassDecl:
+		return node == nil
+	case *ClassMember:
+		return node == nil
+	case *Closure:
+		return node == nil
+	case *CondDecl:
+		return node == nil
+	case *ContinueStmt:
+		return node == nil
+	case *DictOrSetEntryLiteral:
+		return node == nil
+	case *DictOrSetLiteral:
+		return node == nil
+	case *DictOrSetTypeDecl:
+		return node == nil
+	case *DoExpr:
+		return node == nil
+	case *Embedded:
+		return node == nil
+	case *EnumCase:
+		return node == nil
+	case *EnumDecl:
+		return node == nil
+	case *EnumMember:
+		return node == nil
+	case *Expr:
+		return node == nil
+	case *ExprStmt:
+		return node == nil
+	case *ForStmt:
+		return node == nil
+	case *FuncDecl:
+		return node == nil
+	case *FuncType:
+		return node == nil
+	case *IfStmt:
+		return node == nil
+	case *ImportDecl:
+		return node == nil
+	case *InitialiserDecl:
+		return node == nil
+	case *Literal:
+		return node == nil
+	case *ModuleDecl:
+		return node == nil
+	case *NamedTypeDecl:
+		return node == nil
+	case *NewExpr:
+		return node == nil
+	case *Parameters:
+		return node == nil
+	case *Pattern:
+		return node == nil
+	case *Reference:
+		return node == nil
+	case *ReferenceNext:
+		return node == nil
+	case *ReturnStmt:
+		return node == nil
+	case *RootDecl:
+		return node == nil
+	case *Stmt:
+		return node == nil
+	case *String:
+		return node == nil
+	case *SwitchStmt:
+		return node == nil
+	case *Template:
+		return node == nil
+	case *Terminal:
+		return node == nil
+	case *TypeDecl:
+		return node == nil
+	case *TypeParamDecl:
+		return node == nil
+	case *Unary:
+		return node == nil
+	case *VarDecl:
+		return node == nil
+	case *VarDeclAsgn:
+		return node == nil
+	}
+	return false
+}
+
+func (n *AST) visit(visitor Visitor) error { return visitor.VisitAST(n) }
+
+func (n *Annotation) visit(visitor Visitor) error { return visitor.VisitAnnotation(n) }
+
+func (n ArrayLiteral) visit(visitor Visitor) error { return visitor.VisitArrayLiteral(n) }
+
+func (n *ArrayTypeDecl) visit(visitor Visitor) error { return visitor.VisitArrayTypeDecl(n) }
+
+func (n Block) visit(visitor Visitor) error { return visitor.VisitBlock(n) }
+
+func (n BreakStmt) visit(visitor Visitor) error { return visitor.VisitBreakStmt(n) }
+
+func (n Call) visit(visitor Visitor) error { return visitor.VisitCall(n) }
+
+func (n *CaseDecl) visit(visitor Visitor) error { return visitor.VisitCaseDecl(n) }
+
+func (n *CaseField) visit(visitor Visitor) error { return visitor.VisitCaseField(n) }
+
+func (n CaseSelect) visit(visitor Visitor) error { return visitor.VisitCaseSelect(n) }
+
+func (n CaseStmt) visit(visitor Visitor) error { return visitor.VisitCaseStmt(n) }
+
+func (n *ClassDecl) visit(visitor Visitor) error { return visitor.VisitClassDecl(n) }
+
+func (n *ClassMember) visit(visitor Visitor) error { return visitor.VisitClassMember(n) }
+
+func (n *Closure) visit(visitor Visitor) error { return visitor.VisitClosure(n) }
+
+func (n *CondDecl) visit(visitor Visitor) error { return visitor.VisitCondDecl(n) }
+
+func (n ContinueStmt) visit(visitor Visitor) error { return visitor.VisitContinueStmt(n) }
+
+func (n DictOrSetEntryLiteral) visit(visitor Visitor) error {
+	return visitor.VisitDictOrSetEntryLiteral(n)
+}
+
+func (n DictOrSetLiteral) visit(visitor Visitor) error { return visitor.VisitDictOrSetLiteral(n) }
+
+func (n *DictOrSetTypeDecl) visit(visitor Visitor) error { return visitor.VisitDictOrSetTypeDecl(n) }
+
+func (n *DoExpr) visit(visitor Visitor) error { return visitor.VisitDoExpr(n) }
+
+func (n *Embedded) visit(visitor Visitor) error { return visitor.VisitEmbedded(n) }
+
+func (n EnumCase) visit(visitor Visitor) error { return visitor.VisitEnumCase(n) }
+
+func (n *EnumDecl) visit(visitor Visitor) error { return visitor.VisitEnumDecl(n) }
+
+func (n *EnumMember) visit(visitor Visitor) error { return visitor.VisitEnumMember(n) }
+
+func (n *Expr) visit(visitor Visitor) error { return visitor.VisitExpr(n) }
+
+func (n *ExprStmt) visit(visitor Visitor) error { return visitor.VisitExprStmt(n) }
+
+func (n ForStmt) visit(visitor Visitor) error { return visitor.VisitForStmt(n) }
+
+func (n *FuncDecl) visit(visitor Visitor) error { return visitor.VisitFuncDecl(n) }
+
+func (n *FuncType) visit(visitor Visitor) error { return visitor.VisitFuncType(n) }
+
+func (n IfStmt) visit(visitor Visitor) error { return visitor.VisitIfStmt(n) }
+
+func (n *ImportDecl) visit(visitor Visitor) error { return visitor.VisitImportDecl(n) }
+
+func (n *InitialiserDecl) visit(visitor Visitor) error { return visitor.VisitInitialiserDecl(n) }
+
+func (n *Literal) visit(visitor Visitor) error { return visitor.VisitLiteral(n) }
+
+func (n *ModuleDecl) visit(visitor Visitor) error { return visitor.VisitModuleDecl(n) }
+
+func (n *NamedTypeDecl) visit(visitor Visitor) error { return visitor.VisitNamedTypeDecl(n) }
+
+func (n *NewExpr) visit(visitor Visitor) error { return visitor.VisitNew(n) }
+
+func (n Parameters) visit(visitor Visitor) error { return visitor.VisitParameters(n) }
+
+func (n *Pattern) visit(visitor Visitor) error { return visitor.VisitPattern(n) }
+
+func (n *Reference) visit(visitor Visitor) error { return visitor.VisitReference(n) }
+
+func (n *ReferenceNext) visit(visitor Visitor) error { return visitor.VisitReferenceNext(n) }
+
+func (n ReturnStmt) visit(visitor Visitor) error { return visitor.VisitReturnStmt(n) }
+
+func (n *RootDecl) visit(visitor Visitor) error { return visitor.VisitRootDecl(n) }
+
+func (n Stmt) visit(visitor Visitor) error { return visitor.VisitStmt(n) }
+
+func (n *String) visit(visitor Visitor) error { return visitor.VisitString(n) }
+
+func (n SwitchStmt) visit(visitor Visitor) error { return visitor.VisitSwitchStmt(n) }
+
+func (n *Template) visit(visitor Visitor) error { return visitor.VisitTemplate(n) }
+
+func (n Terminal) visit(visitor Visitor) error { return visitor.VisitTerminal(n) }
+
+func (n TypeDecl) visit(visitor Visitor) error { return visitor.VisitTypeDecl(n) }
+
+func (n TypeParamDecl) visit(visitor Visitor) error { return visitor.VisitTypeParamDecl(n) }
+
+func (n *Unary) visit(visitor Visitor) error { return visitor.VisitUnary(n) }
+
+func (n *VarDecl) visit(visitor Visitor) error { return visitor.VisitVarDecl(n) }
+
+func (n VarDeclAsgn) visit(visitor Visitor) error { return visitor.VisitVarDeclAsgn(n) }
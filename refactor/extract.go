@@ -0,0 +1,506 @@
+// Package refactor implements source transformations for editors.
+package refactor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// ExtractFunction moves the statements of source between the byte offsets
+// start and end into a new top-level function called name, following the
+// declaration containing them, and replaces them with a call to it.
+//
+// program must have been analysed from source without error. Values declared
+// in the enclosing function and used by the statements become parameters. A
+// single variable declared by the statements and used after them is returned
+// and redeclared at the call.
+//
+// Statements that return, break or continue beyond the selection, assign to
+// values declared outside it, or refer to fields or methods, can't be
+// extracted.
+func ExtractFunction(program *analyser.Program, source string, start, end int, name string) ([]parser.Edit, error) {
+	if tokens, err := parser.Lex(strings.NewReader(name)); err != nil || len(tokens) != 1 || tokens[0].Kind != parser.TokenIdent {
+		return nil, errors.Errorf("%q is not a valid function name", name)
+	}
+	if program.Root.Resolve(name) != nil {
+		return nil, errors.Errorf("%q is already declared", name)
+	}
+
+	e := &extraction{program: program, declared: map[string]int{}}
+	if err := e.selectStatements(start, end); err != nil {
+		return nil, err
+	}
+	for _, stmt := range e.selected {
+		if err := e.checkStatement(stmt); err != nil {
+			return nil, err
+		}
+	}
+	returned, err := e.returned()
+	if err != nil {
+		return nil, err
+	}
+
+	first, last := e.selected[0], e.selected[len(e.selected)-1]
+	params := []string{}
+	args := []string{}
+	for _, param := range e.params {
+		params = append(params, fmt.Sprintf("%s: %s", param.name, types.Describe(param.value.Type())))
+		args = append(args, param.name)
+	}
+	call := fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+	signature := fmt.Sprintf("fn %s(%s)", name, strings.Join(params, ", "))
+
+	// Re-indent the statements one level within the new function.
+	lineStart := strings.LastIndexByte(source[:first.Pos.Offset], '\n') + 1
+	indent := source[lineStart:first.Pos.Offset]
+	if strings.TrimSpace(indent) != "" {
+		indent = ""
+	}
+	lines := strings.Split(source[first.Pos.Offset:last.EndPos.Offset], "\n")
+	for i, line := range lines {
+		if i > 0 {
+			line = strings.TrimPrefix(line, indent)
+		}
+		if line != "" {
+			line = "\t" + line
+		}
+		lines[i] = line
+	}
+	if returned != nil {
+		value := program.Resolved(returned.asgn)
+		signature += ": " + types.Describe(value.Type())
+		lines = append(lines, "\treturn "+returned.asgn.Name)
+		keyword := "let"
+		if returned.decl.Const {
+			keyword = "const"
+		}
+		call = fmt.Sprintf("%s %s = %s", keyword, returned.asgn.Name, call)
+	}
+	fn := fmt.Sprintf("\n\n%s {\n%s\n}", signature, strings.Join(lines, "\n"))
+	return []parser.Edit{
+		{Pos: first.Pos, EndPos: last.EndPos, Text: call},
+		{Pos: e.root.EndPos, EndPos: e.root.EndPos, Text: fn},
+	}, nil
+}
+
+type parameter struct {
+	name  string
+	value *types.Value
+}
+
+type declaration struct {
+	decl *parser.VarDecl
+	asgn *parser.VarDeclAsgn
+}
+
+type extraction struct {
+	program *analyser.Program
+	// The top-level declaration containing the selection.
+	root *parser.RootDecl
+	// The function enclosing the selection, and its body.
+	fn       parser.Node
+	body     *parser.Block
+	selected []*parser.Stmt
+	params   []parameter
+	// Offsets at which names are declared within the selection.
+	declared map[string]int
+	// Scopes declaring each symbol, by name and reference.
+	scopes map[symbol]*analyser.Scope
+}
+
+type symbol struct {
+	name string
+	ref  types.Reference
+}
+
+// Find the statements of the innermost block covered by the selection.
+func (e *extraction) selectStatements(start, end int) error {
+	var block []*parser.Stmt
+	covers := func(node parser.Node) bool {
+		return node.Position().Offset <= start && end <= node.EndPosition().Offset
+	}
+	_ = parser.Inspect(e.program.AST, func(node parser.Node, ancestors []parser.Node) bool {
+		switch node := node.(type) {
+		case *parser.RootDecl:
+			if covers(node) {
+				e.root = node
+			}
+
+		case *parser.FuncDecl:
+			if covers(node.Body) {
+				e.fn, e.body, block = node, node.Body, nil
+			}
+
+		case *parser.InitialiserDecl:
+			if covers(node.Body) {
+				e.fn, e.body, block = node, node.Body, nil
+			}
+
+		case parser.Block:
+			if e.body != nil && covers(node) {
+				block = node.Statements
+			}
+		}
+		return true
+	})
+	if e.body == nil {
+		return errors.New("selection is not within a function body")
+	}
+	for _, stmt := range block {
+		switch {
+		case stmt.EndPos.Offset <= start || stmt.Pos.Offset >= end:
+
+		case stmt.Pos.Offset >= start && stmt.EndPos.Offset <= end:
+			e.selected = append(e.selected, stmt)
+
+		default:
+			return errors.New("selection must cover whole statements")
+		}
+	}
+	if len(e.selected) == 0 {
+		return errors.New("selection contains no statements")
+	}
+	return nil
+}
+
+func (e *extraction) checkStatement(stmt *parser.Stmt) error {
+	var err error
+	_ = parser.Inspect(stmt, func(node parser.Node, ancestors []parser.Node) bool {
+		err = e.checkNode(node, ancestors)
+		return err == nil
+	})
+	return err
+}
+
+func (e *extraction) checkNode(node parser.Node, ancestors []parser.Node) error {
+	switch node := node.(type) {
+	case *parser.VarDecl:
+		for _, asgn := range node.Vars {
+			if asgn.Pattern != nil {
+				for _, name := range asgn.Pattern.Names() {
+					e.declare(name, asgn.Pos.Offset)
+				}
+			} else {
+				e.declare(asgn.Name, asgn.Pos.Offset)
+			}
+		}
+
+	case parser.IfStmt:
+		if node.Binding != "" {
+			e.declare(node.Binding, node.Pos.Offset)
+		}
+
+	case *parser.Closure:
+		for _, name := range node.Parameters {
+			e.declare(name, node.Pos.Offset)
+		}
+
+	case parser.EnumCase:
+		if node.Var != "" {
+			e.declare(node.Var, node.Pos.Offset)
+		}
+		for _, name := range node.Rest {
+			e.declare(name, node.Pos.Offset)
+		}
+
+	case *parser.FuncDecl:
+		e.declare(node.Name, node.Pos.Offset)
+		for _, param := range node.Parameters {
+			for _, name := range param.Names {
+				e.declare(name, param.Pos.Offset)
+			}
+		}
+
+	case parser.ReturnStmt:
+		if !within(ancestors, func(node parser.Node) bool {
+			switch node.(type) {
+			case *parser.FuncDecl, *parser.Closure:
+				return true
+			}
+			return false
+		}) {
+			return errors.Errorf("%s: can't extract a return from the enclosing function", node.Pos)
+		}
+
+	case parser.BreakStmt:
+		if !targeted(ancestors, node.Label, false) {
+			return errors.Errorf("%s: can't extract a break from a statement outside the selection", node.Pos)
+		}
+
+	case parser.ContinueStmt:
+		if !targeted(ancestors, node.Label, true) {
+			return errors.Errorf("%s: can't extract a continue of a loop outside the selection", node.Pos)
+		}
+
+	case *parser.ExprStmt:
+		if node.RHS == nil {
+			return nil
+		}
+		target := root(node.LHS)
+		if target == nil || target.Ident == "" {
+			return nil
+		}
+		if _, ok := e.program.Actual(target).(*types.Value); ok && !e.internal(target.Ident, target.Pos.Offset) {
+			return errors.Errorf("%s: can't extract an assignment to %q, which is declared outside the selection", target.Pos, target.Ident)
+		}
+
+	case *parser.Reference:
+		terminal := node.Terminal
+		if terminal.Ident == "" {
+			return nil
+		}
+		str := stringAncestor(ancestors)
+		if str == nil {
+			return e.reference(terminal, terminal.Pos.Offset, false)
+		}
+		return e.reference(terminal, str.Pos.Offset, true)
+	}
+	return nil
+}
+
+// Classify a reference from within the selection.
+func (e *extraction) reference(terminal *parser.Terminal, offset int, interpolated bool) error {
+	name := terminal.Ident
+	ref := e.program.Actual(terminal)
+	if ref == nil && interpolated {
+		// Interpolated expressions are not resolved by the analyser.
+		ref = e.lookup(name, offset)
+	}
+	switch {
+	case ref == nil:
+		return errors.Errorf("%s: %q is not resolved", terminal.Pos, name)
+
+	case e.internal(name, offset), e.program.Root.Resolve(name) == ref:
+		return nil
+	}
+	value, ok := ref.(*types.Value)
+	if !ok || !e.local(name, value) {
+		return errors.Errorf("%s: can't extract a reference to %q, which is not visible at the top level", terminal.Pos, name)
+	}
+	for _, param := range e.params {
+		if param.name == name {
+			return nil
+		}
+	}
+	e.params = append(e.params, parameter{name: name, value: value})
+	return nil
+}
+
+// Find the value visible as name at offset within the enclosing function,
+// falling back to the top level.
+func (e *extraction) lookup(name string, offset int) types.Reference {
+	if e.internal(name, offset) {
+		return nil
+	}
+	var (
+		ref      types.Reference
+		declared = -1
+	)
+	candidate := func(node parser.Node) {
+		if pos := node.Position().Offset; pos < offset && pos > declared {
+			ref, declared = e.program.Resolved(node), pos
+		}
+	}
+	var params []*parser.Parameters
+	switch fn := e.fn.(type) {
+	case *parser.FuncDecl:
+		params = fn.Parameters
+
+	case *parser.InitialiserDecl:
+		params = fn.Parameters
+	}
+	for _, param := range params {
+		if contains(param.Names, name) {
+			candidate(param)
+		}
+	}
+	_ = parser.Inspect(e.body, func(node parser.Node, ancestors []parser.Node) bool {
+		decl, ok := node.(*parser.VarDecl)
+		if !ok {
+			return true
+		}
+		// Only declarations in blocks enclosing the reference are visible.
+		var block parser.Node = e.body
+		for i := len(ancestors) - 1; i >= 0; i-- {
+			if _, ok := ancestors[i].(parser.Block); ok {
+				block = ancestors[i]
+				break
+			}
+		}
+		if block.Position().Offset > offset || offset >= block.EndPosition().Offset {
+			return true
+		}
+		for _, asgn := range decl.Vars {
+			if asgn.Name == name {
+				candidate(asgn)
+			}
+		}
+		return true
+	})
+	if ref == nil {
+		return e.program.Root.Resolve(name)
+	}
+	return ref
+}
+
+func (e *extraction) declare(name string, offset int) {
+	if _, ok := e.declared[name]; !ok {
+		e.declared[name] = offset
+	}
+}
+
+// Returns true if name was declared within the selection before offset.
+func (e *extraction) internal(name string, offset int) bool {
+	declared, ok := e.declared[name]
+	return ok && declared <= offset
+}
+
+// Returns true if the value was declared within a function, rather than as a
+// field or at the top level.
+func (e *extraction) local(name string, value *types.Value) bool {
+	if e.scopes == nil {
+		e.scopes = map[symbol]*analyser.Scope{}
+		var index func(scope *analyser.Scope)
+		index = func(scope *analyser.Scope) {
+			for name, ref := range scope.Symbols() {
+				e.scopes[symbol{name, ref}] = scope
+			}
+			for _, child := range scope.Children() {
+				index(child)
+			}
+		}
+		index(e.program.Root)
+	}
+	for scope := e.scopes[symbol{name, value}]; scope != nil; scope = scope.Parent() {
+		switch scope.Owner().(type) {
+		case *types.Function:
+			return true
+
+		case *types.ClassType, *types.Enum:
+			return false
+		}
+	}
+	return false
+}
+
+// The variable declared at the top level of the selection and used after it,
+// if any.
+func (e *extraction) returned() (*declaration, error) {
+	last := e.selected[len(e.selected)-1]
+	declarations := []declaration{}
+	destructured := map[string]bool{}
+	for _, stmt := range e.selected {
+		if stmt.VarDecl == nil {
+			continue
+		}
+		for _, asgn := range stmt.VarDecl.Vars {
+			if asgn.Pattern != nil {
+				for _, name := range asgn.Pattern.Names() {
+					destructured[name] = true
+				}
+				continue
+			}
+			declarations = append(declarations, declaration{stmt.VarDecl, asgn})
+		}
+	}
+	used := map[*parser.VarDeclAsgn]bool{}
+	var err error
+	_ = parser.Inspect(e.body, func(node parser.Node, ancestors []parser.Node) bool {
+		reference, ok := node.(*parser.Reference)
+		if !ok || err != nil || reference.Terminal.Ident == "" || reference.Terminal.Pos.Offset < last.EndPos.Offset {
+			return err == nil
+		}
+		name := reference.Terminal.Ident
+		if stringAncestor(ancestors) == nil && destructured[name] {
+			err = errors.Errorf("%s: can't extract the destructured variable %q, which is used after the selection", reference.Terminal.Pos, name)
+			return false
+		}
+		ref := e.program.Actual(reference.Terminal)
+		for _, decl := range declarations {
+			if decl.asgn.Name == name && ref != nil && ref == e.program.Resolved(decl.asgn) {
+				used[decl.asgn] = true
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var returned []declaration
+	for _, decl := range declarations {
+		if used[decl.asgn] {
+			returned = append(returned, decl)
+		}
+	}
+	switch len(returned) {
+	case 0:
+		return nil, nil
+
+	case 1:
+		return &returned[0], nil
+	}
+	names := []string{}
+	for _, decl := range returned {
+		names = append(names, decl.asgn.Name)
+	}
+	return nil, errors.Errorf("can't return %s from one function, as tuples are not supported", strings.Join(names, ", "))
+}
+
+// The terminal at the root of an assignment target, eg. "a" in "a.b[0] = c".
+func root(expr *parser.Expr) *parser.Terminal {
+	var terminal *parser.Terminal
+	_ = parser.Inspect(expr, func(node parser.Node, ancestors []parser.Node) bool {
+		if reference, ok := node.(*parser.Reference); ok && terminal == nil {
+			terminal = reference.Terminal
+		}
+		return terminal == nil
+	})
+	return terminal
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if any of ancestors satisfy match.
+func within(ancestors []parser.Node, match func(node parser.Node) bool) bool {
+	for _, ancestor := range ancestors {
+		if match(ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the target of a break or continue is within ancestors.
+func targeted(ancestors []parser.Node, label string, loop bool) bool {
+	return within(ancestors, func(node parser.Node) bool {
+		stmt, ok := node.(parser.Stmt)
+		if !ok || (stmt.For == nil && (loop || stmt.Switch == nil)) {
+			return false
+		}
+		return label == "" || string(stmt.Label) == label
+	})
+}
+
+// The string an interpolated expression is within, if any, as their positions
+// are relative to the string.
+func stringAncestor(ancestors []parser.Node) *parser.String {
+	for _, ancestor := range ancestors {
+		if str, ok := ancestor.(*parser.String); ok {
+			return str
+		}
+	}
+	return nil
+}
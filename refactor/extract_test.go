@@ -0,0 +1,234 @@
+package refactor
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestExtractFunction(t *testing.T) {
+	prelude := "fn print(v: int) {}\nfn say(s: string) {}\n"
+	tests := []struct {
+		name     string
+		source   string
+		fn       string
+		expected string
+		fail     string
+	}{
+		{name: "Statements",
+			source: `
+fn f(a: int, b: int): int {
+	let c = 1
+	«print(a)
+	print(c + a)»
+	return b
+}
+`,
+			fn: "show",
+			expected: `
+fn f(a: int, b: int): int {
+	let c = 1
+	show(a, c)
+	return b
+}
+
+fn show(a: int, c: int) {
+	print(a)
+	print(c + a)
+}
+`},
+		{name: "ReturnsVariable",
+			source: `
+let scale = 2
+fn f(a: int): int {
+	«let b = a * scale
+	let c = b + 1»
+	return c
+}
+`,
+			fn: "compute",
+			expected: `
+let scale = 2
+fn f(a: int): int {
+	let c = compute(a)
+	return c
+}
+
+fn compute(a: int): int {
+	let b = a * scale
+	let c = b + 1
+	return c
+}
+`},
+		{name: "NestedBlock",
+			source: `
+fn f(a: int) {
+	if a > 1 {
+		«print(a)»
+	}
+}
+`,
+			fn: "show",
+			expected: `
+fn f(a: int) {
+	if a > 1 {
+		show(a)
+	}
+}
+
+fn show(a: int) {
+	print(a)
+}
+`},
+		{name: "Interpolated",
+			source: `
+fn f(a: int) {
+	«say("a is {a}")»
+}
+`,
+			fn: "show",
+			expected: `
+fn f(a: int) {
+	show(a)
+}
+
+fn show(a: int) {
+	say("a is {a}")
+}
+`},
+		{name: "InterpolatedLocal",
+			source: `
+fn f(a: int) {
+	let b = "a"
+	if a > 1 {
+		let b = "b"
+	}
+	«say("b is {b}")»
+}
+`,
+			fn: "show",
+			expected: `
+fn f(a: int) {
+	let b = "a"
+	if a > 1 {
+		let b = "b"
+	}
+	show(b)
+}
+
+fn show(b: string) {
+	say("b is {b}")
+}
+`},
+		{name: "Return",
+			source: `
+fn f(a: int): int {
+	«return a»
+}
+`,
+			fn:   "g",
+			fail: `can't extract a return from the enclosing function`},
+		{name: "Assignment",
+			source: `
+fn f(a: int) {
+	let b = 1
+	«b = a»
+	print(b)
+}
+`,
+			fn:   "g",
+			fail: `can't extract an assignment to "b", which is declared outside the selection`},
+		{name: "MultipleReturns",
+			source: `
+fn f(a: int): int {
+	«let b = a
+	let c = a»
+	return b + c
+}
+`,
+			fn:   "g",
+			fail: `can't return b, c from one function, as tuples are not supported`},
+		{name: "PartialStatement",
+			source: `
+fn f(a: int) {
+	«print(a)
+	print»(a)
+}
+`,
+			fn:   "g",
+			fail: `selection must cover whole statements`},
+		{name: "NotInFunction",
+			source: `
+«let a = 1»
+`,
+			fn:   "g",
+			fail: `selection is not within a function body`},
+		{name: "Field",
+			source: `
+class C {
+	let x: int
+	fn f() {
+		«print(x)»
+	}
+}
+`,
+			fn:   "g",
+			fail: `can't extract a reference to "x", which is not visible at the top level`},
+		{name: "Declared",
+			source: `
+fn f(a: int) {
+	«print(a)»
+}
+`,
+			fn:   "f",
+			fail: `"f" is already declared`},
+		{name: "InvalidName",
+			source: `
+fn f(a: int) {
+	«print(a)»
+}
+`,
+			fn:   "1",
+			fail: `"1" is not a valid function name`},
+	}
+	for _, test := range tests {
+		// nolint: scopelint
+		t.Run(test.name, func(t *testing.T) {
+			source := prelude + test.source
+			start := strings.Index(source, "«")
+			source = strings.Replace(source, "«", "", 1)
+			end := strings.Index(source, "»")
+			source = strings.Replace(source, "»", "", 1)
+			ast, err := parser.ParseString(source)
+			require.NoError(t, err)
+			program, err := analyser.Analyse(ast)
+			require.NoError(t, err)
+			edits, err := ExtractFunction(program, source, start, end, test.fn)
+			if test.fail != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.fail)
+				return
+			}
+			require.NoError(t, err)
+			actual := apply(source, edits)
+			require.Equal(t, prelude+test.expected, actual)
+			ast, err = parser.ParseString(actual)
+			require.NoError(t, err)
+			_, err = analyser.Analyse(ast)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func apply(source string, edits []parser.Edit) string {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].Pos.Offset > edits[j].Pos.Offset })
+	for _, edit := range edits {
+		source = source[:edit.Pos.Offset] + edit.Text + source[edit.EndPos.Offset:]
+	}
+	return source
+}
@@ -0,0 +1,444 @@
+// Package snippets provides structured code templates for completion.
+//
+// The grammatical context at the cursor is determined from the tokens
+// preceding it, so it works on source that is being edited and does not parse.
+// Templates derived from types, such as a switch with all cases of an enum, are
+// taken from the most recent successful analysis.
+//
+// Snippet bodies use the LSP snippet syntax, with tab stops such as $1, $0
+// and placeholders such as ${1:name}.
+package snippets
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+	"github.com/alecthomas/langx/types"
+)
+
+// Context is the grammatical context at a cursor position.
+type Context int
+
+const (
+	// ContextNone is any position not offering snippets, such as within an expression.
+	ContextNone Context = iota
+	// ContextRoot is the start of a top-level declaration.
+	ContextRoot
+	// ContextClass is the start of a class member.
+	ContextClass
+	// ContextEnum is the start of an enum member.
+	ContextEnum
+	// ContextStatement is the start of a statement in a block.
+	ContextStatement
+	// ContextSwitch is the start of a statement in a switch, where a case may also begin.
+	ContextSwitch
+	// ContextCase follows the "case" keyword.
+	ContextCase
+)
+
+func (c Context) String() string {
+	switch c {
+	case ContextNone:
+		return "none"
+	case ContextRoot:
+		return "root"
+	case ContextClass:
+		return "class"
+	case ContextEnum:
+		return "enum"
+	case ContextStatement:
+		return "statement"
+	case ContextSwitch:
+		return "switch"
+	case ContextCase:
+		return "case"
+	}
+	panic("unknown context")
+}
+
+// Snippet is a code template.
+type Snippet struct {
+	// Label shown in the completion list, eg. "fn".
+	Label string
+	// Detail describes the snippet, eg. "function declaration".
+	Detail string
+	// Body in LSP snippet syntax.
+	Body string
+}
+
+// At returns the snippets applicable at offset in source.
+//
+// program is the most recent successful analysis of the source, if any, and
+// is used to generate snippets for enums. After "case", only the cases of the
+// switch subject's enum are offered if the subject is a variable whose type is
+// known, and the cases of every enum otherwise.
+func At(source string, offset int, program *analyser.Program) ([]Snippet, error) {
+	ctx, subject, err := contextAt(source, offset)
+	if err != nil {
+		return nil, err
+	}
+	snippets := []Snippet{}
+	switch ctx {
+	case ContextRoot:
+		snippets = append(snippets, rootSnippets...)
+
+	case ContextClass:
+		snippets = append(snippets, classSnippets...)
+
+	case ContextEnum:
+		snippets = append(snippets, enumSnippets...)
+
+	case ContextSwitch:
+		snippets = append(snippets, caseSnippets...)
+		fallthrough
+
+	case ContextStatement:
+		snippets = append(snippets, statementSnippets...)
+		for _, enum := range enums(program) {
+			snippets = append(snippets, enum.switchSnippet())
+		}
+
+	case ContextCase:
+		typ := subjectType(program, subject)
+		for _, enum := range enums(program) {
+			if typ != nil && typ != enum.enum {
+				continue
+			}
+			for _, cse := range enum.cases {
+				snippets = append(snippets, Snippet{
+					Label:  "." + cse.Name,
+					Detail: enum.name + "." + cse.Name,
+					Body:   "." + pattern(cse, 1) + ":",
+				})
+			}
+		}
+	}
+	return snippets, nil
+}
+
+var (
+	rootSnippets = []Snippet{
+		{Label: "fn", Detail: "function declaration", Body: "fn ${1:name}($2)${3:: ${4:type}} {\n\t$0\n}"},
+		{Label: "class", Detail: "class declaration", Body: "class ${1:Name} {\n\t$0\n}"},
+		{Label: "enum", Detail: "enum declaration", Body: "enum ${1:Name} {\n\tcase ${2:A}\n\t$0\n}"},
+		{Label: "import", Detail: "import declaration", Body: "import ${1:module}"},
+		{Label: "let", Detail: "variable declaration", Body: "let ${1:name} = ${2:value}"},
+	}
+	classSnippets = []Snippet{
+		{Label: "fn", Detail: "method declaration", Body: "fn ${1:name}($2)${3:: ${4:type}} {\n\t$0\n}"},
+		{Label: "init", Detail: "initialiser declaration", Body: "init($1) {\n\t$0\n}"},
+		{Label: "let", Detail: "field declaration", Body: "let ${1:name}: ${2:type}"},
+	}
+	enumSnippets = []Snippet{
+		{Label: "case", Detail: "enum case", Body: "case ${1:Name}"},
+		{Label: "fn", Detail: "method declaration", Body: "fn ${1:name}($2)${3:: ${4:type}} {\n\t$0\n}"},
+	}
+	statementSnippets = []Snippet{
+		{Label: "if", Detail: "if statement", Body: "if ${1:condition} {\n\t$0\n}"},
+		{Label: "ifelse", Detail: "if/else statement", Body: "if ${1:condition} {\n\t$2\n} else {\n\t$0\n}"},
+		{Label: "for", Detail: "for loop", Body: "for ${1:item} in ${2:items} {\n\t$0\n}"},
+		{Label: "switch", Detail: "switch statement", Body: "switch ${1:value} {\ncase ${2:match}:\n\t$0\n}"},
+		{Label: "let", Detail: "variable declaration", Body: "let ${1:name} = ${2:value}"},
+	}
+	caseSnippets = []Snippet{
+		{Label: "case", Detail: "switch case", Body: "case ${1:match}:\n\t$0"},
+		{Label: "default", Detail: "default case", Body: "default:\n\t$0"},
+	}
+)
+
+type enumCases struct {
+	name string
+	enum *types.Enum
+	// Cases in declaration order.
+	cases []*types.Case
+}
+
+// Enums declared at the root of the analysed program.
+func enums(program *analyser.Program) []enumCases {
+	if program == nil {
+		return nil
+	}
+	out := []enumCases{}
+	for _, decl := range program.AST.Declarations {
+		if decl.Enum == nil {
+			continue
+		}
+		enum, ok := program.Resolved(decl.Enum).(*types.Enum)
+		if !ok {
+			continue
+		}
+		// Enum fields are sorted by name, so order cases by their declarations.
+		byName := map[string]*types.Case{}
+		for _, cse := range enum.Cases() {
+			byName[cse.Name] = cse
+		}
+		entry := enumCases{name: enum.Name, enum: enum}
+		for _, member := range decl.Enum.Members {
+			if member.CaseDecl != nil && byName[member.CaseDecl.Name] != nil {
+				entry.cases = append(entry.cases, byName[member.CaseDecl.Name])
+			}
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// A switch over the enum with all cases filled in.
+func (e enumCases) switchSnippet() Snippet {
+	w := &strings.Builder{}
+	fmt.Fprintf(w, "switch ${1:%s} {\n", strings.ToLower(e.name[:1])+e.name[1:])
+	stop := 2
+	for _, cse := range e.cases {
+		fmt.Fprintf(w, "case .%s:\n", pattern(cse, stop))
+		if cse.Case != nil {
+			stop++
+		}
+		fmt.Fprintf(w, "\t$%d\n", stop)
+		stop++
+	}
+	w.WriteString("}")
+	return Snippet{
+		Label:  "switch " + e.name,
+		Detail: "switch over all cases of " + e.name,
+		Body:   w.String(),
+	}
+}
+
+// Pattern matching cse, with a placeholder numbered stop for any value.
+func pattern(cse *types.Case, stop int) string {
+	if cse.Case == nil {
+		return cse.Name
+	}
+	return fmt.Sprintf("%s(${%d:value})", cse.Name, stop)
+}
+
+// The type of the subject of a switch, given the tokens from "switch" to its
+// opening brace, or nil if it is not known.
+//
+// The program may predate edits to the source, so only a variable subject is
+// resolved, to the closest preceding declaration of it whose enclosing nodes
+// contain the switch.
+func subjectType(program *analyser.Program, subject []parser.Token) types.Type {
+	if program == nil || len(subject) != 2 || !isWord(subject[1].Value) {
+		return nil
+	}
+	name, offset := subject[1].Value, subject[0].Pos.Offset
+	contains := func(node parser.Node) bool {
+		return node.Position().Offset <= offset && offset <= node.EndPosition().Offset
+	}
+	var (
+		closest = -1
+		typ     types.Type
+	)
+	declare := func(decl parser.Node, names ...string) {
+		for _, declared := range names {
+			ref := program.Resolved(decl)
+			if declared == name && ref != nil && decl.Position().Offset > closest {
+				closest, typ = decl.Position().Offset, ref.Type()
+			}
+		}
+	}
+	_ = parser.Inspect(program.AST, func(node parser.Node, ancestors []parser.Node) bool {
+		if node.Position().Offset > offset {
+			return false
+		}
+		for _, ancestor := range ancestors {
+			if !contains(ancestor) {
+				return false
+			}
+		}
+		var parameters []*parser.Parameters
+		switch node := node.(type) {
+		case *parser.FuncDecl:
+			parameters = node.Parameters
+		case *parser.InitialiserDecl:
+			parameters = node.Parameters
+		case *parser.VarDeclAsgn:
+			declare(node, node.Name)
+		}
+		if contains(node) {
+			for _, param := range parameters {
+				declare(param, param.Names...)
+			}
+		}
+		return true
+	})
+	if spec, ok := typ.(*types.Specialisation); ok {
+		return spec.Typ
+	}
+	return typ
+}
+
+// The kind of block opened by a "{".
+type blockKind int
+
+const (
+	blockExpr blockKind = iota
+	blockStatement
+	blockClass
+	blockEnum
+	blockSwitch
+)
+
+// ContextAt returns the grammatical context at offset in source.
+func ContextAt(source string, offset int) (Context, error) {
+	ctx, _, err := contextAt(source, offset)
+	return ctx, err
+}
+
+// Returns the context at offset in source, and for ContextCase the tokens
+// from "switch" to the opening brace of the enclosing switch.
+func contextAt(source string, offset int) (Context, []parser.Token, error) {
+	if offset < 0 || offset > len(source) {
+		return ContextNone, nil, errors.Errorf("offset %d is outside the source", offset)
+	}
+	all, err := parser.Lex(strings.NewReader(source[:offset]))
+	if err != nil {
+		return ContextNone, nil, err
+	}
+	tokens := make([]parser.Token, 0, len(all))
+	for _, token := range all {
+		if token.Kind != parser.TokenComment {
+			tokens = append(tokens, token)
+		}
+	}
+	// Ignore the word being typed, if any.
+	if n := len(tokens); n > 0 && tokens[n-1].Pos.Offset+len(tokens[n-1].Value) == offset && isWord(tokens[n-1].Value) {
+		tokens = tokens[:n-1]
+	}
+	stack := []blockKind{}
+	// Headers of the blocks in stack.
+	headers := [][]parser.Token{}
+	// Start of the current declaration or statement.
+	start := 0
+	for i, token := range tokens {
+		switch token.Value {
+		case "{":
+			stack = append(stack, classify(tokens[start:i]))
+			headers = append(headers, tokens[start:i])
+			start = i + 1
+		case "}":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+				headers = headers[:len(headers)-1]
+			}
+			start = i + 1
+		case ";":
+			start = i + 1
+		case ":":
+			if len(stack) > 0 && stack[len(stack)-1] == blockSwitch && isCaseLabel(tokens[start:i]) {
+				start = i + 1
+			}
+		}
+	}
+	block := blockStatement
+	if len(stack) > 0 {
+		block = stack[len(stack)-1]
+	}
+	if n := len(tokens); n > 0 && tokens[n-1].Value == "case" && block == blockSwitch {
+		return ContextCase, switchHeader(headers[len(headers)-1]), nil
+	}
+	if start != len(tokens) {
+		// Within a declaration or statement.
+		return ContextNone, nil, nil
+	}
+	switch {
+	case len(stack) == 0:
+		return ContextRoot, nil, nil
+	case block == blockClass:
+		return ContextClass, nil, nil
+	case block == blockEnum:
+		return ContextEnum, nil, nil
+	case block == blockSwitch:
+		return ContextSwitch, nil, nil
+	case block == blockStatement:
+		return ContextStatement, nil, nil
+	default:
+		return ContextNone, nil, nil
+	}
+}
+
+// The tokens of a switch block header from the "switch" keyword, without any
+// preceding label.
+func switchHeader(header []parser.Token) []parser.Token {
+	for i, token := range header {
+		if token.Value == "switch" {
+			return header[i:]
+		}
+	}
+	return nil
+}
+
+// Classify a block by the tokens preceding its opening brace.
+func classify(header []parser.Token) blockKind {
+	// Skip annotations, modifiers and labels.
+skip:
+	for len(header) > 0 {
+		switch {
+		case header[0].Value == "pub" || header[0].Value == "override" || header[0].Value == "static":
+			header = header[1:]
+		case header[0].Value == "@" && len(header) > 1:
+			header = header[2:]
+			if len(header) > 0 && header[0].Value == "(" {
+				header = skipParens(header)
+			}
+		case len(header) > 1 && header[1].Value == ":" && isWord(header[0].Value):
+			header = header[2:]
+		default:
+			break skip
+		}
+	}
+	if len(header) == 0 {
+		// A nested block.
+		return blockStatement
+	}
+	switch header[0].Value {
+	case "class":
+		return blockClass
+	case "enum":
+		return blockEnum
+	case "switch":
+		return blockSwitch
+	case "fn", "init", "if", "for", "else":
+		return blockStatement
+	}
+	if header[len(header)-1].Value == "do" {
+		return blockStatement
+	}
+	return blockExpr
+}
+
+// Skip a parenthesised token sequence at the start of tokens.
+func skipParens(tokens []parser.Token) []parser.Token {
+	depth := 0
+	for i, token := range tokens {
+		switch token.Value {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return tokens[i+1:]
+			}
+		}
+	}
+	return nil
+}
+
+// Returns true if tokens are a case or default label, excluding the colon.
+func isCaseLabel(tokens []parser.Token) bool {
+	return len(tokens) > 0 && (tokens[0].Value == "case" || tokens[0].Value == "default")
+}
+
+func isWord(s string) bool {
+	for i, r := range s {
+		if !(r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,103 @@
+package snippets
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/analyser"
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestContextAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		context Context
+	}{
+		{name: "Empty", source: `|`, context: ContextRoot},
+		{name: "Root", source: "let a = 1\nfn|", context: ContextRoot},
+		{name: "Class", source: "pub class C {\n  let a = 1\n  |\n}", context: ContextClass},
+		{name: "Enum", source: "enum E {\n  case A\n  |", context: ContextEnum},
+		{name: "Function", source: "fn f() {\n  |\n}", context: ContextStatement},
+		{name: "Else", source: "fn f() {\n  if true {\n  } else {\n    |", context: ContextStatement},
+		{name: "AfterBlock", source: "class C {\n  fn f() {\n    let a = 1\n  }\n  |", context: ContextClass},
+		{name: "Expression", source: "fn f() {\n  let a = |", context: ContextNone},
+		{name: "Dict", source: "let a = {|", context: ContextNone},
+		{name: "Switch", source: "fn f() {\n  outer: switch a {\n  |", context: ContextSwitch},
+		{name: "CaseBody", source: "fn f() {\n  switch a {\n  case .A: |", context: ContextSwitch},
+		{name: "Case", source: "fn f() {\n  switch a {\n  case |", context: ContextCase},
+		{name: "Annotated", source: "@deprecated(\"x\") fn f() {\n  |", context: ContextStatement},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			offset := strings.Index(test.source, "|")
+			source := strings.Replace(test.source, "|", "", 1)
+			context, err := ContextAt(source, offset)
+			require.NoError(t, err)
+			require.Equal(t, test.context, context)
+		})
+	}
+}
+
+func TestAt(t *testing.T) {
+	source := `
+enum Value {
+	case None
+	case Int(int)
+	case Str(string)
+}
+
+enum Colour {
+	case Red
+}
+
+fn g(v: Colour) {}
+
+fn f(v: Value) {
+
+}
+`
+	ast, err := parser.ParseString(source)
+	require.NoError(t, err)
+	program, err := analyser.Analyse(ast)
+	require.NoError(t, err)
+	offset := strings.Index(source, "{\n\n}") + 2
+
+	snippets, err := At(source, offset, program)
+	require.NoError(t, err)
+	labels := []string{}
+	for _, snippet := range snippets {
+		labels = append(labels, snippet.Label)
+	}
+	require.Equal(t, []string{"if", "ifelse", "for", "switch", "let", "switch Value", "switch Colour"}, labels)
+	require.Equal(t, "switch ${1:value} {\n"+
+		"case .None:\n\t$2\n"+
+		"case .Int(${3:value}):\n\t$4\n"+
+		"case .Str(${5:value}):\n\t$6\n"+
+		"}", snippets[5].Body)
+
+	edited := source[:offset] + "switch v {\ncase " + source[offset:]
+	snippets, err = At(edited, offset+16, program)
+	require.NoError(t, err)
+	require.Equal(t, []Snippet{
+		{Label: ".None", Detail: "Value.None", Body: ".None:"},
+		{Label: ".Int", Detail: "Value.Int", Body: ".Int(${1:value}):"},
+		{Label: ".Str", Detail: "Value.Str", Body: ".Str(${1:value}):"},
+	}, snippets)
+
+	// The cases of every enum are offered if the subject's type isn't known.
+	unknown := source[:offset] + "switch v.w {\ncase " + source[offset:]
+	snippets, err = At(unknown, offset+18, program)
+	require.NoError(t, err)
+	require.Len(t, snippets, 4)
+
+	snippets, err = At(source, offset, nil)
+	require.NoError(t, err)
+	require.Len(t, snippets, 5)
+
+	_, err = At(source, len(source)+1, nil)
+	require.EqualError(t, err, fmt.Sprintf("offset %d is outside the source", len(source)+1))
+}
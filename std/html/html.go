@@ -0,0 +1,328 @@
+// Package html implements compile-time checking of HTML generation.
+//
+// Interpolated values in html templates, eg. html"<b>{name}</b>", are escaped
+// by the backends. Escaping is only sufficient where the value is interpreted
+// as text, so Check rejects interpolation elsewhere, and warns about markup
+// built by string concatenation or interpolation, which bypasses escaping.
+package html
+
+import (
+	"strings"
+
+	"github.com/alecthomas/participle"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+// Check html templates in ast.
+//
+// An error is returned if a template interpolates a value where escaping does
+// not make it safe. Warnings are returned for strings containing markup that
+// are constructed without a template.
+func Check(ast *parser.AST) (warnings []error, err error) {
+	// Concatenations already reported as part of an enclosing chain.
+	seen := map[*parser.Expr]bool{}
+	err = parser.VisitFunc(ast, func(node parser.Node, next parser.Next) error {
+		switch node := node.(type) {
+		case *parser.Template:
+			if node.Tag == "html" {
+				if err := checkTemplate(node); err != nil {
+					return err
+				}
+			}
+
+		case *parser.Literal:
+			if str := node.Str; str != nil && interpolated(str) && markup(str) {
+				warnings = append(warnings, participle.Errorf(node.Pos, "string interpolation into markup is not escaped, use an html template"))
+			}
+
+		case *parser.Expr:
+			if node.Op == parser.OpAdd && !seen[node] {
+				operands := concatenation(node, seen)
+				tainted, literal := false, false
+				for _, operand := range operands {
+					if str := stringLiteral(operand); str == nil {
+						tainted = true
+					} else if markup(str) {
+						literal = true
+					}
+				}
+				if tainted && literal {
+					warnings = append(warnings, participle.Errorf(operands[0].Pos, "concatenation into markup is not escaped, use an html template"))
+				}
+			}
+		}
+		return next(nil)
+	})
+	return warnings, err
+}
+
+// Escape s for inclusion in HTML text or a quoted attribute value.
+//
+// This matches the escaping performed by the backends.
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+var escaper = strings.NewReplacer(`&`, "&#38;", `<`, "&#60;", `>`, "&#62;", `"`, "&#34;", `'`, "&#39;")
+
+func checkTemplate(template *parser.Template) error {
+	ctx := &context{}
+	for _, fragment := range template.Str.Fragments {
+		if fragment.Expr == nil {
+			ctx.scan(fragment.String)
+			continue
+		}
+		switch ctx.state {
+		case stateText:
+		case stateDoubleQuoted, stateSingleQuoted:
+			if unsafeAttr(ctx.attr) {
+				return participle.Errorf(template.Pos, "interpolation into %s attribute can not be escaped", ctx.attr)
+			}
+			// Escaping doesn't prevent eg. "javascript:" URLs, so the scheme
+			// must be fixed by the template.
+			if urlAttrs[ctx.attr] && !strings.ContainsAny(ctx.value, ":/?#") {
+				return participle.Errorf(template.Pos, "interpolation into the start of %s attribute can not be escaped", ctx.attr)
+			}
+			ctx.value += "{}"
+		default:
+			return participle.Errorf(template.Pos, "interpolation into %s can not be escaped", ctx.state)
+		}
+	}
+	return nil
+}
+
+// Attributes whose values are interpreted as code.
+func unsafeAttr(name string) bool {
+	return strings.HasPrefix(name, "on") || name == "style"
+}
+
+// Attributes whose values are URLs.
+var urlAttrs = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"codebase":   true,
+	"data":       true,
+	"formaction": true,
+	"href":       true,
+	"longdesc":   true,
+	"manifest":   true,
+	"poster":     true,
+	"src":        true,
+	"srcset":     true,
+	"usemap":     true,
+	"xlink:href": true,
+}
+
+// Flatten a chain of + operators into its operands, marking nested
+// concatenations as seen.
+func concatenation(expr *parser.Expr, seen map[*parser.Expr]bool) []*parser.Expr {
+	if expr.Op != parser.OpAdd {
+		return []*parser.Expr{expr}
+	}
+	seen[expr] = true
+	return append(concatenation(expr.Left, seen), concatenation(expr.Right, seen)...)
+}
+
+// Returns the string literal expr consists of, or nil.
+func stringLiteral(expr *parser.Expr) *parser.String {
+	if expr.Unary == nil || expr.Unary.Op != parser.OpNone {
+		return nil
+	}
+	ref := expr.Unary.Reference
+	if ref.Next != nil || ref.Terminal.Literal == nil {
+		return nil
+	}
+	literal := ref.Terminal.Literal
+	if literal.Str != nil && !interpolated(literal.Str) {
+		return literal.Str
+	}
+	return nil
+}
+
+func interpolated(str *parser.String) bool {
+	for _, fragment := range str.Fragments {
+		if fragment.Expr != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if str contains something resembling a tag.
+func markup(str *parser.String) bool {
+	for _, fragment := range str.Fragments {
+		s := fragment.String
+		for i := strings.IndexByte(s, '<'); i >= 0 && i+1 < len(s); i = strings.IndexByte(s, '<') {
+			if c := s[i+1]; c == '/' || c == '!' || isLetter(c) {
+				return true
+			}
+			s = s[i+1:]
+		}
+	}
+	return false
+}
+
+type state int
+
+const (
+	stateText state = iota
+	stateTagName
+	stateTag
+	stateAttrName
+	stateAfterAttrName
+	stateBeforeValue
+	stateDoubleQuoted
+	stateSingleQuoted
+	stateUnquoted
+	stateComment
+	stateRawText
+)
+
+func (s state) String() string {
+	switch s {
+	case stateText:
+		return "text"
+	case stateTagName:
+		return "tag name"
+	case stateTag, stateAfterAttrName:
+		return "tag"
+	case stateAttrName:
+		return "attribute name"
+	case stateBeforeValue, stateUnquoted:
+		return "unquoted attribute value"
+	case stateDoubleQuoted, stateSingleQuoted:
+		return "attribute value"
+	case stateComment:
+		return "comment"
+	case stateRawText:
+		return "script or style"
+	}
+	panic("unknown state")
+}
+
+// The HTML context at a point in a template.
+//
+// This is a simplification of the HTML tokeniser, sufficient to determine
+// whether escaping an interpolated value is safe.
+type context struct {
+	state state
+	// Name of the tag being scanned, and whether it is an end tag.
+	tag    string
+	endTag bool
+	// Name of the current attribute, and its quoted value so far.
+	attr  string
+	value string
+	// Name of the element whose raw text content is being scanned.
+	raw string
+}
+
+func (c *context) scan(s string) {
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch c.state {
+		case stateText:
+			if ch != '<' || i+1 >= len(s) {
+				continue
+			}
+			switch next := s[i+1]; {
+			case strings.HasPrefix(s[i:], "<!--"):
+				c.state = stateComment
+				i += 3
+			case next == '/' || isLetter(next):
+				c.state, c.tag, c.endTag = stateTagName, "", next == '/'
+				if c.endTag {
+					i++
+				}
+			}
+
+		case stateTagName:
+			switch {
+			case isSpace(ch):
+				c.state = stateTag
+			case ch == '>':
+				c.closeTag()
+			case ch != '/':
+				c.tag += strings.ToLower(string(ch))
+			}
+
+		case stateTag, stateAfterAttrName:
+			switch {
+			case ch == '>':
+				c.closeTag()
+			case ch == '=' && c.state == stateAfterAttrName:
+				c.state = stateBeforeValue
+			case !isSpace(ch) && ch != '/':
+				c.state, c.attr = stateAttrName, strings.ToLower(string(ch))
+			}
+
+		case stateAttrName:
+			switch {
+			case ch == '=':
+				c.state = stateBeforeValue
+			case isSpace(ch):
+				c.state = stateAfterAttrName
+			case ch == '>':
+				c.closeTag()
+			default:
+				c.attr += strings.ToLower(string(ch))
+			}
+
+		case stateBeforeValue:
+			switch {
+			case ch == '"':
+				c.state, c.value = stateDoubleQuoted, ""
+			case ch == '\'':
+				c.state, c.value = stateSingleQuoted, ""
+			case ch == '>':
+				c.closeTag()
+			case !isSpace(ch):
+				c.state = stateUnquoted
+			}
+
+		case stateDoubleQuoted, stateSingleQuoted:
+			if (ch == '"' && c.state == stateDoubleQuoted) || (ch == '\'' && c.state == stateSingleQuoted) {
+				c.state = stateTag
+			} else {
+				c.value += string(ch)
+			}
+
+		case stateUnquoted:
+			switch {
+			case isSpace(ch):
+				c.state = stateTag
+			case ch == '>':
+				c.closeTag()
+			}
+
+		case stateComment:
+			if strings.HasPrefix(s[i:], "-->") {
+				c.state = stateText
+				i += 2
+			}
+
+		case stateRawText:
+			end := "</" + c.raw
+			if len(s)-i >= len(end) && strings.EqualFold(s[i:i+len(end)], end) {
+				c.state, c.tag, c.endTag = stateTagName, c.raw, true
+				i += len(end) - 1
+			}
+		}
+	}
+}
+
+func (c *context) closeTag() {
+	c.state = stateText
+	if !c.endTag && (c.tag == "script" || c.tag == "style") {
+		c.state, c.raw = stateRawText, c.tag
+	}
+}
+
+func isLetter(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f'
+}
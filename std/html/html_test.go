@@ -0,0 +1,123 @@
+package html
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		fail     string
+		warnings []string
+	}{
+		{name: "Comment",
+			input: `
+				fn f(name: string): string {
+					return html"<p class=\"greeting\">Hello, {name}</p><!-- {name} -->"
+				}
+			`,
+			fail: "3:13: interpolation into comment can not be escaped"},
+		{name: "QuotedAttribute",
+			input: `
+				fn f(id: string, title: string): string {
+					return html"<a href=\"/users/{id}\" title='{title}'>link</a>"
+				}
+			`},
+		{name: "URLAttribute",
+			input: `
+				fn f(url: string): string {
+					return html"<a href=\"{url}\">link</a>"
+				}
+			`,
+			fail: "3:13: interpolation into the start of href attribute can not be escaped"},
+		{name: "URLAttributeScheme",
+			input: `
+				fn f(host: string, path: string): string {
+					return html"<img src='https://{host}/{path}'>"
+				}
+			`},
+		{name: "UnquotedAttribute",
+			input: `
+				fn f(url: string): string {
+					return html"<a href={url}>link</a>"
+				}
+			`,
+			fail: "3:13: interpolation into unquoted attribute value can not be escaped"},
+		{name: "EventHandler",
+			input: `
+				fn f(code: string): string {
+					return html"<button onClick=\"{code}\">go</button>"
+				}
+			`,
+			fail: "3:13: interpolation into onclick attribute can not be escaped"},
+		{name: "TagName",
+			input: `
+				fn f(tag: string): string {
+					return html"<{tag}>"
+				}
+			`},
+		{name: "AttributeName",
+			input: `
+				fn f(attr: string): string {
+					return html"<div {attr}=1>"
+				}
+			`,
+			fail: "3:13: interpolation into tag can not be escaped"},
+		{name: "Script",
+			input: `
+				fn f(a: string, b: string): string {
+					return html"<script>let x = 1</script><p>{a}</p><script>f({b})</script>"
+				}
+			`,
+			fail: "3:13: interpolation into script or style can not be escaped"},
+		{name: "OtherTags",
+			input: `
+				fn f(a: string): string {
+					return sql"<a href={a}>"
+				}
+			`},
+		{name: "Bypass",
+			input: `
+				fn f(name: string): string {
+					let a = "<b>" + name + "</b>"
+					let b = "<b>{name}</b>"
+					let c = "a < b" + name
+					let d = "Hello, " + name
+					return html"<b>{name}</b>"
+				}
+			`,
+			warnings: []string{
+				"3:14: concatenation into markup is not escaped, use an html template",
+				"4:14: string interpolation into markup is not escaped, use an html template",
+			}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast, err := parser.ParseString(test.input)
+			require.NoError(t, err)
+			warnings, err := Check(ast)
+			if test.fail != "" {
+				require.EqualError(t, err, test.fail)
+				return
+			}
+			require.NoError(t, err)
+			actual := []string{}
+			for _, warning := range warnings {
+				actual = append(actual, warning.Error())
+			}
+			if test.warnings == nil {
+				test.warnings = []string{}
+			}
+			require.Equal(t, test.warnings, actual)
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	require.Equal(t, "&#60;a href=&#34;x&#34;&#62;Tom &#38; Jerry&#39;s&#60;/a&#62;", Escape(`<a href="x">Tom & Jerry's</a>`))
+}
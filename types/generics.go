@@ -0,0 +1,171 @@
+package types
+
+// TypeParam is a generic type parameter, eg. T in "class List<T>".
+//
+// Constraints may refer to the parameter itself, eg. "T: Comparable<T>", so
+// the types reachable from a TypeParam can be cyclic. Substitute, Identical
+// and String do not descend into constraints for this reason.
+type TypeParam struct {
+	Name string
+	// Constraints that type arguments must satisfy.
+	Constraints []Type
+}
+
+var _ Type = &TypeParam{}
+
+func (t *TypeParam) Type() Type                    { return t }
+func (t *TypeParam) Kind() Kind                    { return KindGeneric }
+func (t *TypeParam) String() string                { return t.Name }
+func (t *TypeParam) CanApply(op Op, rhs Type) bool { return false }
+func (t *TypeParam) TypeParameters() []NamedType   { return nil }
+func (t *TypeParam) Coerce(direction Direction, other Type) Type {
+	if other == t {
+		return other
+	}
+	return nil
+}
+
+// Fields provided by the constraints of the parameter.
+func (t *TypeParam) Fields() []NamedType {
+	fields := []NamedType{}
+	seen := map[string]bool{}
+	for _, constraint := range t.Constraints {
+		for _, field := range constraint.Fields() {
+			if !seen[field.Nme] {
+				seen[field.Nme] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// Substitute args for the corresponding type parameters in t.
+//
+// Only structural types are rebuilt. Named types such as classes are
+// returned as is, as their fields are substituted on access via a
+// Specialisation.
+func Substitute(t Type, params []NamedType, args []Type) Type {
+	switch t := t.(type) {
+	case *TypeParam:
+		for i, param := range params {
+			if param.Typ == t {
+				return args[i]
+			}
+		}
+		return t
+
+	case ArrayType:
+		return Array(Substitute(t.Constraints[0].Typ, params, args))
+
+	case SetType:
+		return Set(Substitute(t.Constraints[0].Typ, params, args))
+
+	case *MapType:
+		return Map(Substitute(t.TParams[0].Typ, params, args), Substitute(t.TParams[1].Typ, params, args))
+
+	case *OptionalType:
+		return Optional(Substitute(t.Enum.TParams[1].Typ, params, args))
+
+	case *Function:
+		fn := &Function{ReturnType: Substitute(t.ReturnType, params, args)}
+		for _, param := range t.Parameters {
+			fn.Parameters = append(fn.Parameters, NamedType{Nme: param.Nme, Typ: Substitute(param.Typ, params, args)})
+		}
+		return fn
+
+	case *Specialisation:
+		sargs := t.Arguments()
+		for i, arg := range sargs {
+			sargs[i] = Substitute(arg, params, args)
+		}
+		return Specialise(t.Typ, sargs...)
+	}
+	return t
+}
+
+// Identical returns true if a and b are the same type.
+func Identical(a, b Type) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	switch a := a.(type) {
+	case ArrayType:
+		b, ok := b.(ArrayType)
+		return ok && Identical(a.Constraints[0].Typ, b.Constraints[0].Typ)
+
+	case SetType:
+		b, ok := b.(SetType)
+		return ok && Identical(a.Constraints[0].Typ, b.Constraints[0].Typ)
+
+	case Generic:
+		b, ok := b.(Generic)
+		return ok && identicalFields(a.Constraints, b.Constraints)
+
+	case *MapType:
+		b, ok := b.(*MapType)
+		return ok && identicalFields(a.TParams, b.TParams)
+
+	case *OptionalType:
+		b, ok := b.(*OptionalType)
+		return ok && Identical(a.Enum.TParams[1].Typ, b.Enum.TParams[1].Typ)
+
+	case *Function:
+		b, ok := b.(*Function)
+		return ok && identicalFields(a.Parameters, b.Parameters) && Identical(a.ReturnType, b.ReturnType)
+
+	case *Specialisation:
+		b, ok := b.(*Specialisation)
+		return ok && Identical(a.Typ, b.Typ) && identicalFields(a.Parameters, b.Parameters)
+	}
+	switch b.(type) {
+	case ArrayType, SetType, Generic:
+		return false
+	}
+	return a == b
+}
+
+// Returns true if the types of a and b are pairwise identical, ignoring names.
+func identicalFields(a, b []NamedType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Identical(a[i].Typ, b[i].Typ) {
+			return false
+		}
+	}
+	return true
+}
+
+// Satisfies returns true if t satisfies constraint.
+//
+// Constraints are structural: t must provide every field of constraint with
+// an identical type. A type parameter also satisfies any of its own
+// constraints, which is what allows F-bounded parameters such as
+// "T: Comparable<T>" to be used as arguments to other constrained types.
+// Builtin types satisfy the prelude Comparable and Equatable constraints
+// through their operators.
+func Satisfies(t, constraint Type) bool {
+	if Identical(t, constraint) {
+		return true
+	}
+	switch t := t.(type) {
+	case *TypeParam:
+		for _, c := range t.Constraints {
+			if Identical(c, constraint) {
+				return true
+			}
+		}
+
+	case Builtin:
+		return builtinSatisfies(t, constraint)
+	}
+	for _, want := range constraint.Fields() {
+		have, ok := FieldByName(t, want.Nme).(NamedType)
+		if !ok || !Identical(have.Typ, want.Typ) {
+			return false
+		}
+	}
+	return true
+}
@@ -15,6 +15,7 @@ const (
 	KindLiteralFloat  // literal float
 	KindLiteralString // literal string
 	KindString        // string
+	KindChar          // char
 	KindBool          // bool
 	KindInt           // int
 	KindFloat         // float
@@ -25,12 +26,13 @@ const (
 	KindAlias         // alias
 	KindAny           // any
 	KindInterface     // interface
+	KindModule        // module
 )
 
-// IsScalar returns true if the type is a scalar (string, bool, int, float).
+// IsScalar returns true if the type is a scalar (string, char, bool, int, float).
 func (i Kind) IsScalar() bool {
 	switch i {
-	case KindString, KindBool, KindInt, KindFloat:
+	case KindString, KindChar, KindBool, KindInt, KindFloat:
 		return true
 	}
 	return false
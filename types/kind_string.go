@@ -15,21 +15,23 @@ func _() {
 	_ = x[KindLiteralFloat-4]
 	_ = x[KindLiteralString-5]
 	_ = x[KindString-6]
-	_ = x[KindBool-7]
-	_ = x[KindInt-8]
-	_ = x[KindFloat-9]
-	_ = x[KindTuple-10]
-	_ = x[KindClass-11]
-	_ = x[KindEnum-12]
-	_ = x[KindCase-13]
-	_ = x[KindAlias-14]
-	_ = x[KindAny-15]
-	_ = x[KindInterface-16]
+	_ = x[KindChar-7]
+	_ = x[KindBool-8]
+	_ = x[KindInt-9]
+	_ = x[KindFloat-10]
+	_ = x[KindTuple-11]
+	_ = x[KindClass-12]
+	_ = x[KindEnum-13]
+	_ = x[KindCase-14]
+	_ = x[KindAlias-15]
+	_ = x[KindAny-16]
+	_ = x[KindInterface-17]
+	_ = x[KindModule-18]
 }
 
-const _Kind_name = "nonegenericfunctionliteral intliteral floatliteral stringstringboolintfloattupleclassenumcasealiasanyinterface"
+const _Kind_name = "nonegenericfunctionliteral intliteral floatliteral stringstringcharboolintfloattupleclassenumcasealiasanyinterfacemodule"
 
-var _Kind_index = [...]uint8{0, 4, 11, 19, 30, 43, 57, 63, 67, 70, 75, 80, 85, 89, 93, 98, 101, 110}
+var _Kind_index = [...]uint8{0, 4, 11, 19, 30, 43, 57, 63, 67, 71, 74, 79, 84, 89, 93, 97, 102, 105, 114, 120}
 
 func (i Kind) String() string {
 	if i < 0 || i >= Kind(len(_Kind_index)-1) {
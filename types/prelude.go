@@ -0,0 +1,158 @@
+package types
+
+import (
+	"strings"
+
+	"github.com/alecthomas/langx/parser"
+)
+
+// Prelude types, available in every module.
+var (
+	// Comparable is satisfied by types with a total order, eg. "T: Comparable<T>".
+	//
+	// compare returns a negative number, zero or a positive number if the
+	// receiver is less than, equal to or greater than other.
+	Comparable = preludeClass("Comparable", func(t Type) NamedType {
+		return NamedType{Nme: "compare", Typ: &Function{Parameters: []NamedType{{"other", t}}, ReturnType: Int}}
+	})
+	// Equatable is satisfied by types that can be compared for equality, eg. "T: Equatable<T>".
+	Equatable = preludeClass("Equatable", func(t Type) NamedType {
+		return NamedType{Nme: "equals", Typ: &Function{Parameters: []NamedType{{"other", t}}, ReturnType: Bool}}
+	})
+)
+
+// Create a prelude class with a single type parameter T and a single method.
+func preludeClass(name string, method func(t Type) NamedType) *ClassType {
+	t := &TypeParam{Name: "T"}
+	return &ClassType{
+		Name:    name,
+		TParams: []NamedType{{"T", t}},
+		Flds:    []NamedType{method(t)},
+	}
+}
+
+// Builtin types satisfy the prelude constraints with their operators.
+func builtinSatisfies(t Builtin, constraint Type) bool {
+	spec, ok := constraint.(*Specialisation)
+	if !ok || !Identical(spec.Parameters[0].Typ, t) {
+		return false
+	}
+	switch spec.Typ {
+	case Comparable:
+		return t.CanApply(parser.OpLt, t)
+
+	case Equatable:
+		return t.CanApply(parser.OpEq, t)
+	}
+	return false
+}
+
+// Overloaded is a function with several signatures, selected at the call
+// site by the number of arguments.
+type Overloaded struct {
+	Overloads []*Function
+}
+
+var _ Type = &Overloaded{}
+
+func (o *Overloaded) Type() Type                                  { return o }
+func (o *Overloaded) Kind() Kind                                  { return KindFunc }
+func (o *Overloaded) Coerce(direction Direction, other Type) Type { return nil }
+func (o *Overloaded) CanApply(op Op, other Type) bool             { return false }
+func (o *Overloaded) Fields() []NamedType                         { return nil }
+func (o *Overloaded) TypeParameters() []NamedType                 { return nil }
+func (o *Overloaded) String() string {
+	overloads := []string{}
+	for _, fn := range o.Overloads {
+		overloads = append(overloads, fn.String())
+	}
+	return strings.Join(overloads, " | ")
+}
+
+// Overload returns the signature taking n arguments, if any.
+func (o *Overloaded) Overload(n int) *Function {
+	for _, fn := range o.Overloads {
+		if len(fn.Parameters) == n {
+			return fn
+		}
+	}
+	return nil
+}
+
+// Methods of arrays with elements of type elem.
+//
+// sort() sorts in place and requires the elements to be Comparable, which is
+// checked at the call site. sort(compare) sorts with a comparison function
+// instead, with the same contract as Comparable.compare.
+//
+// map, filter and reduce return new arrays or values, leaving the array
+// unchanged. Arrays of strings may also be joined with a separator.
+func arrayMethods(elem Type) []NamedType {
+	mapped := &TypeParam{Name: "U"}
+	accumulator := &TypeParam{Name: "U"}
+	methods := []NamedType{
+		{Nme: "map", Typ: &Function{
+			Parameters: []NamedType{{"transform", &Function{
+				Parameters: []NamedType{{"value", elem}},
+				ReturnType: mapped,
+			}}},
+			ReturnType: Array(mapped),
+			TypeParams: []NamedType{{"U", mapped}},
+		}},
+		{Nme: "filter", Typ: &Function{
+			Parameters: []NamedType{{"keep", &Function{
+				Parameters: []NamedType{{"value", elem}},
+				ReturnType: Bool,
+			}}},
+			ReturnType: Array(elem),
+		}},
+		{Nme: "reduce", Typ: &Function{
+			Parameters: []NamedType{
+				{"initial", accumulator},
+				{"combine", &Function{
+					Parameters: []NamedType{{"accumulator", accumulator}, {"value", elem}},
+					ReturnType: accumulator,
+				}},
+			},
+			ReturnType: accumulator,
+			TypeParams: []NamedType{{"U", accumulator}},
+		}},
+		{Nme: "sort", Typ: &Overloaded{Overloads: []*Function{
+			{ReturnType: None},
+			{
+				Parameters: []NamedType{{"compare", &Function{
+					Parameters: []NamedType{{"a", elem}, {"b", elem}},
+					ReturnType: Int,
+				}}},
+				ReturnType: None,
+			},
+		}}},
+	}
+	if elem == String {
+		methods = append(methods, NamedType{Nme: "join", Typ: &Function{
+			Parameters: []NamedType{{"separator", String}},
+			ReturnType: String,
+		}})
+	}
+	return methods
+}
+
+// Methods of strings.
+func stringMethods() []NamedType {
+	return []NamedType{
+		{Nme: "split", Typ: &Function{
+			Parameters: []NamedType{{"separator", String}},
+			ReturnType: Array(String),
+		}},
+	}
+}
+
+// Methods of maps from key to value.
+//
+// keys and values return the keys and values of the map, in the same order.
+func mapMethods(key, value Type) []NamedType {
+	return []NamedType{
+		{Nme: "keys", Typ: &Function{ReturnType: Array(key)}},
+		{Nme: "values", Typ: &Function{ReturnType: Array(value)}},
+	}
+}
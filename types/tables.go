@@ -15,6 +15,10 @@ var opMap = func() map[opKey]bool {
 	out := map[opKey]bool{
 		// Booleans.
 		{KindBool, parser.OpNot, KindNone}: true, // !<num>
+		{KindBool, parser.OpAnd, KindBool}: true,
+		{KindBool, parser.OpOr, KindBool}:  true,
+		{KindBool, parser.OpEq, KindBool}:  true,
+		{KindBool, parser.OpNe, KindBool}:  true,
 
 		// Strings.
 		{KindString, parser.OpAdd, KindString}:     true,
@@ -26,6 +30,14 @@ var opMap = func() map[opKey]bool {
 		{KindString, parser.OpGt, KindString}: true,
 		{KindString, parser.OpLe, KindString}: true,
 		{KindString, parser.OpLt, KindString}: true,
+
+		// Chars.
+		{KindChar, parser.OpEq, KindChar}: true,
+		{KindChar, parser.OpNe, KindChar}: true,
+		{KindChar, parser.OpGe, KindChar}: true,
+		{KindChar, parser.OpGt, KindChar}: true,
+		{KindChar, parser.OpLe, KindChar}: true,
+		{KindChar, parser.OpLt, KindChar}: true,
 	}
 	ops := []parser.Op{
 		parser.OpEq,
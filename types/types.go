@@ -68,6 +68,7 @@ var (
 	Int    Type = Builtin(KindInt)
 	Float  Type = Builtin(KindFloat)
 	String Type = Builtin(KindString)
+	Char   Type = Builtin(KindChar)
 	Bool   Type = Builtin(KindBool)
 	Any    Type = Builtin(KindAny)
 )
@@ -132,6 +133,9 @@ func Map(key, value Type) Type {
 }
 
 func (m *MapType) Type() Type { return m }
+
+// Fields of the map, which are its methods.
+func (m *MapType) Fields() []NamedType { return mapMethods(m.TParams[0].Typ, m.TParams[1].Typ) }
 func (m *MapType) String() string {
 	return fmt.Sprintf("{%s:%s}", m.TParams[0].Typ, m.TParams[1].Typ)
 }
@@ -146,6 +150,12 @@ func Array(value Type) Type {
 
 func (a ArrayType) String() string { return fmt.Sprintf("[%s]", a.Constraints[0].Typ) }
 
+// Fields of the array, including its methods.
+func (a ArrayType) Fields() []NamedType {
+	fields := append([]NamedType{}, a.Constraints...)
+	return append(fields, arrayMethods(a.Constraints[0].Typ)...)
+}
+
 type SetType struct {
 	Generic
 }
@@ -187,12 +197,27 @@ func (b Builtin) GoString() string {
 	s = "types." + strings.Replace(strings.Title(s), " ", "", -1)
 	return s
 }
-func (b Builtin) Type() Type                        { return b }
-func (b Builtin) Name() string                      { return b.Kind().String() }
-func (b Builtin) Kind() Kind                        { return Kind(b) }
-func (b Builtin) Fields() []NamedType               { return nil }
-func (b Builtin) TypeParameters() []NamedType       { return nil }
-func (b Builtin) FieldByName(name string) Reference { return nil }
+func (b Builtin) Type() Type                  { return b }
+func (b Builtin) Name() string                { return b.Kind().String() }
+func (b Builtin) Kind() Kind                  { return Kind(b) }
+func (b Builtin) TypeParameters() []NamedType { return nil }
+
+// Fields of the builtin, which are the methods of strings.
+func (b Builtin) Fields() []NamedType {
+	switch Type(b) {
+	case String, LiteralString:
+		return stringMethods()
+	}
+	return nil
+}
+func (b Builtin) FieldByName(name string) Reference {
+	for _, fld := range b.Fields() {
+		if fld.Nme == name {
+			return fld.Typ
+		}
+	}
+	return nil
+}
 func (b Builtin) Coerce(direction Direction, other Type) Type {
 	if b == other || coercionMap[coercionKey{b.Kind(), other.Kind()}] {
 		return other
@@ -206,17 +231,25 @@ func (b Builtin) CanApply(op Op, other Type) bool {
 type Function struct {
 	Parameters []NamedType
 	ReturnType Type
+	// TypeParams of a generic builtin method, eg. U in "map(transform: fn(T): U): [U]",
+	// inferred from the arguments of each call.
+	TypeParams []NamedType
 }
 
 var _ Type = &Function{}
 
-func (f *Function) Type() Type                                  { return f }
-func (f *Function) Kind() Kind                                  { return KindFunc }
-func (f *Function) Coerce(direction Direction, other Type) Type { return nil }
-func (f *Function) CanApply(op Op, other Type) bool             { return false }
-func (f *Function) Fields() []NamedType                         { return nil }
-func (f *Function) TypeParameters() []NamedType                 { return nil }
-func (f *Function) FieldByName(name string) Reference           { return nil }
+func (f *Function) Type() Type { return f }
+func (f *Function) Kind() Kind { return KindFunc }
+func (f *Function) Coerce(direction Direction, other Type) Type {
+	if Identical(f, other) {
+		return other
+	}
+	return nil
+}
+func (f *Function) CanApply(op Op, other Type) bool   { return false }
+func (f *Function) Fields() []NamedType               { return nil }
+func (f *Function) TypeParameters() []NamedType       { return nil }
+func (f *Function) FieldByName(name string) Reference { return nil }
 func (f *Function) String() string {
 	w := &strings.Builder{}
 	fmt.Fprint(w, "fn(")
@@ -224,7 +257,10 @@ func (f *Function) String() string {
 		if i > 0 {
 			fmt.Fprint(w, ", ")
 		}
-		fmt.Fprintf(w, "%s: %s", param.Name(), param.Type())
+		if param.Name() != "" {
+			fmt.Fprintf(w, "%s: ", param.Name())
+		}
+		fmt.Fprint(w, param.Type())
 	}
 	fmt.Fprint(w, ")")
 	if f.ReturnType != None {
@@ -263,10 +299,30 @@ func (s *ClassType) FieldByName(name string) Reference {
 }
 func (s *ClassType) String() string { return "class" }
 
+// Module is the namespace of an imported module, eg. "util" in
+// "util.double(2)". Its fields are the symbols the module declares.
+type Module struct {
+	Name string
+	Flds []NamedType
+}
+
+var _ Type = &Module{}
+
+func (m *Module) Type() Type                                  { return m }
+func (m *Module) Kind() Kind                                  { return KindModule }
+func (m *Module) Coerce(direction Direction, other Type) Type { return nil }
+func (m *Module) CanApply(op Op, rhs Type) bool               { return false }
+func (m *Module) Fields() []NamedType                         { return m.Flds }
+func (m *Module) TypeParameters() []NamedType                 { return nil }
+func (m *Module) String() string                              { return "module " + m.Name }
+
 type Case struct {
 	Name string
 	Enum *Enum
+	// Case is the type of a single unnamed associated value.
 	Case Type
+	// Values are named associated values.
+	Values []NamedType
 }
 
 var _ Type = &Case{}
@@ -280,6 +336,7 @@ func (c *Case) TypeParameters() []NamedType                 { return nil }
 func (c *Case) FieldByName(name string) Reference           { return nil }
 func (c *Case) String() string                              { return "case" }
 
+// Specialisation of a generic type with type arguments, eg. List<int>.
 type Specialisation struct {
 	Typ        Type
 	Parameters []NamedType
@@ -291,7 +348,7 @@ func Specialise(base Type, parameters ...Type) Type {
 		panic("mismatched number of specialised generic parameters")
 	}
 	fields := make([]NamedType, 0, len(parameters))
-	for i, p := range base.Fields() {
+	for i, p := range base.TypeParameters() {
 		fields = append(fields, NamedType{Nme: p.Nme, Typ: parameters[i]})
 	}
 	return &Specialisation{
@@ -302,27 +359,56 @@ func Specialise(base Type, parameters ...Type) Type {
 
 var _ Type = &Specialisation{}
 
-func (s Specialisation) TypeParameters() []NamedType { return nil }
-func (s Specialisation) FieldByName(name string) Reference {
-	for _, field := range s.Parameters {
+// Arguments of the specialisation, in the order of the type parameters.
+func (s *Specialisation) Arguments() []Type {
+	args := make([]Type, 0, len(s.Parameters))
+	for _, param := range s.Parameters {
+		args = append(args, param.Typ)
+	}
+	return args
+}
+func (s *Specialisation) TypeParameters() []NamedType { return nil }
+func (s *Specialisation) FieldByName(name string) Reference {
+	for _, field := range s.Fields() {
 		if field.Nme == name {
 			return field.Typ
 		}
 	}
 	return nil
 }
-func (s Specialisation) Kind() Kind                                  { return s.Typ.Kind() }
-func (s Specialisation) Type() Type                                  { return s.Typ }
-func (s Specialisation) String() string                              { return "specialisation" }
-func (s Specialisation) Coerce(direction Direction, other Type) Type { panic("implement me") }
-func (s Specialisation) CanApply(op Op, rhs Type) bool               { return false }
-func (s Specialisation) Fields() []NamedType                         { return s.Parameters }
+func (s *Specialisation) Kind() Kind { return s.Typ.Kind() }
+func (s *Specialisation) Type() Type { return s }
+func (s *Specialisation) String() string {
+	args := []string{}
+	for _, param := range s.Parameters {
+		args = append(args, Describe(param.Typ))
+	}
+	return fmt.Sprintf("%s<%s>", Describe(s.Typ), strings.Join(args, ", "))
+}
+func (s *Specialisation) Coerce(direction Direction, other Type) Type {
+	if Identical(s, other) {
+		return other
+	}
+	return nil
+}
+func (s *Specialisation) CanApply(op Op, rhs Type) bool { return false }
+
+// Fields of the generic type, with type parameters replaced by the type arguments.
+func (s *Specialisation) Fields() []NamedType {
+	fields := []NamedType{}
+	for _, field := range s.Typ.Fields() {
+		fields = append(fields, NamedType{Nme: field.Nme, Typ: Substitute(field.Typ, s.Typ.TypeParameters(), s.Arguments())})
+	}
+	return fields
+}
 
 type Enum struct {
 	Name    string
 	TParams []NamedType
 	Flds    []NamedType
 	Init    *Function
+	// Raw is the type of the raw values of the enum's cases, if they have any.
+	Raw Type
 }
 
 var _ Type = &Enum{}
@@ -339,6 +425,9 @@ func (e *Enum) Coerce(direction Direction, other Type) Type {
 	var matched Type
 	for _, cse := range e.Cases() {
 		// fmt.Println(cse.Name, cse.Case, other)
+		if cse.Case == nil {
+			continue
+		}
 		if coerced := cse.Case.Coerce(direction, other); coerced != nil {
 			// Already have a match, coercion is ambiguous.
 			if matched != nil {
@@ -454,6 +543,14 @@ func FieldByName(ref Reference, name string) NamedReference {
 	return nil
 }
 
+// Describe returns the name of a named type, or its description.
+func Describe(t Type) string {
+	if name := TypeName(t); name != "" {
+		return name
+	}
+	return t.String()
+}
+
 // TypeName returns the simple name of a type, if any.
 func TypeName(t Type) string {
 	switch t := t.(type) {